@@ -5,12 +5,19 @@ import { VerifiedToken } from '../services/JwtValidationService.js';
 import { Permission } from '../models/index.js';
 import { isAppError } from '../models/result.js';
 
-export function errorResponse(status: number, error: string, message: string, details?: Record<string, unknown>): HttpResponse {
+export function errorResponse(
+  status: number,
+  error: string,
+  message: string,
+  details?: Record<string, unknown>,
+  fields?: Record<string, unknown>,
+): HttpResponse {
   return new HttpResponse({
     status,
     jsonBody: {
       error,
       message,
+      ...fields,
       details: details ?? {},
       timestamp: new Date().toISOString(),
       request_id: uuidv4(),
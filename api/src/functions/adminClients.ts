@@ -7,6 +7,10 @@ interface ClientActionBody {
   notes?: string;
 }
 
+interface RegistrationTokenBody {
+  ttl_hours?: number;
+}
+
 async function listClientsHandler(request: HttpRequest, _context: InvocationContext): Promise<HttpResponse> {
   if (request.method === 'OPTIONS') return handleOptions();
 
@@ -197,6 +201,73 @@ async function deleteClientHandler(request: HttpRequest, _context: InvocationCon
   }
 }
 
+async function resetCredentialHandler(request: HttpRequest, _context: InvocationContext): Promise<HttpResponse> {
+  if (request.method === 'OPTIONS') return handleOptions();
+
+  try {
+    const user = await authenticateRequest(request);
+    if (!user) {
+      return errorResponse(401, 'unauthorized', 'Valid JWT token required');
+    }
+    if (!requirePermission(user, 'client:approve')) {
+      return errorResponse(403, 'forbidden', 'Missing permission: client:approve');
+    }
+
+    const services = await ensureInitialized();
+    const clientId = request.params.clientId;
+    if (!clientId) {
+      return errorResponse(400, 'validation_failed', 'clientId parameter required');
+    }
+
+    const client = await services.adminService.getClient(clientId);
+    if (!client) {
+      return errorResponse(404, 'not_found', 'Client not found');
+    }
+
+    await services.adminService.resetClientCredential(clientId, user.username, getClientIp(request));
+
+    return jsonResponse(200, {
+      client_id: clientId,
+      status: 'pending',
+    });
+  } catch (err) {
+    return handleError(err);
+  }
+}
+
+async function createRegistrationTokenHandler(request: HttpRequest, _context: InvocationContext): Promise<HttpResponse> {
+  if (request.method === 'OPTIONS') return handleOptions();
+
+  try {
+    const user = await authenticateRequest(request);
+    if (!user) {
+      return errorResponse(401, 'unauthorized', 'Valid JWT token required');
+    }
+    if (!requirePermission(user, 'client:approve')) {
+      return errorResponse(403, 'forbidden', 'Missing permission: client:approve');
+    }
+
+    const body = await parseJsonBody<RegistrationTokenBody>(request) ?? {};
+    if (body.ttl_hours !== undefined && (typeof body.ttl_hours !== 'number' || body.ttl_hours <= 0)) {
+      return errorResponse(400, 'validation_failed', 'ttl_hours must be a positive number');
+    }
+
+    const services = await ensureInitialized();
+    const result = await services.adminService.createRegistrationToken(user.username, body.ttl_hours, getClientIp(request));
+
+    return jsonResponse(201, result);
+  } catch (err) {
+    return handleError(err);
+  }
+}
+
+app.http('mgmtRegistrationTokenCreate', {
+  methods: ['POST', 'OPTIONS'],
+  route: 'manage/registration-tokens',
+  authLevel: 'anonymous',
+  handler: createRegistrationTokenHandler,
+});
+
 app.http('mgmtClientsList', {
   methods: ['GET', 'OPTIONS'],
   route: 'manage/clients',
@@ -218,6 +289,13 @@ app.http('mgmtClientReject', {
   handler: rejectClientHandler,
 });
 
+app.http('mgmtClientResetCredential', {
+  methods: ['POST', 'OPTIONS'],
+  route: 'manage/clients/{clientId}/reset-credential',
+  authLevel: 'anonymous',
+  handler: resetCredentialHandler,
+});
+
 app.http('mgmtClientUpdate', {
   methods: ['PUT', 'DELETE', 'OPTIONS'],
   route: 'manage/clients/{clientId}',
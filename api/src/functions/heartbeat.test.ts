@@ -135,7 +135,7 @@ describe('heartbeat handler validation', () => {
     expect(response2.status).toBe(400);
   });
 
-  it.each(['running', 'pending', 'stopped', 'crashed'])(
+  it.each(['running', 'pending', 'stopped', 'crashed', 'crash_looping'])(
     'valid worker_status "%s" does not return 400',
     async (status) => {
       const response = await invokeHandler(makeHeartbeat({ worker_status: status }));
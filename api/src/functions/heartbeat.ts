@@ -26,9 +26,9 @@ async function handler(request: HttpRequest, _context: InvocationContext): Promi
       return errorResponse(400, 'validation_failed', 'worker_version is required');
     }
 
-    const validWorkerStatuses = ['running', 'pending', 'stopped', 'crashed'];
+    const validWorkerStatuses = ['running', 'pending', 'stopped', 'crashed', 'crash_looping'];
     if (!body.worker_status || !validWorkerStatuses.includes(body.worker_status)) {
-      return errorResponse(400, 'validation_failed', 'worker_status must be one of: running, pending, stopped, crashed');
+      return errorResponse(400, 'validation_failed', 'worker_status must be one of: running, pending, stopped, crashed, crash_looping');
     }
 
     if (!body.system_info || typeof body.system_info !== 'object') {
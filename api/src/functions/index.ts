@@ -4,6 +4,7 @@ import './authRefresh';
 import './authLogout';
 import './heartbeat';
 import './ingest';
+import './ingestPresign';
 import './adminClients';
 import './adminUsers';
 import './adminConfig';
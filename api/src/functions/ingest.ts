@@ -40,7 +40,7 @@ async function handler(request: HttpRequest, _context: InvocationContext): Promi
         const sizeBytes = new TextEncoder().encode(fileContent).length;
         const maxSizeMb = 50;
         if (sizeBytes > maxSizeMb * 1024 * 1024) {
-          return errorResponse(413, 'file_too_large', 'File size exceeds maximum allowed limit', {
+          return errorResponse(413, 'file_too_large', 'File size exceeds maximum allowed limit', undefined, {
             max_size_mb: maxSizeMb,
             actual_size_mb: Math.round(sizeBytes / 1024 / 1024 * 100) / 100,
           });
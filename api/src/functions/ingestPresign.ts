@@ -0,0 +1,16 @@
+import { app, HttpRequest, HttpResponse, InvocationContext } from '@azure/functions';
+import { errorResponse, handleOptions } from './_helpers.js';
+
+// Presigned uploads need an object storage backend, which the built-in
+// storage plugins don't provide. Clients fall back to POST /api/ingest.
+async function handler(request: HttpRequest, _context: InvocationContext): Promise<HttpResponse> {
+  if (request.method === 'OPTIONS') return handleOptions();
+  return errorResponse(501, 'presign_not_supported', 'Presigned uploads are not supported; use POST /api/ingest');
+}
+
+app.http('ingestPresign', {
+  methods: ['POST', 'OPTIONS'],
+  route: 'ingest/presign',
+  authLevel: 'anonymous',
+  handler,
+});
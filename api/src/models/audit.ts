@@ -7,6 +7,8 @@ export type AuditActionType =
   | 'client_reject'
   | 'client_suspend'
   | 'client_delete'
+  | 'client_credential_reset'
+  | 'registration_token_create'
   | 'config_set'
   | 'config_delete'
   | 'user_create'
@@ -3,7 +3,7 @@
 import type { ClientId } from './branded.js';
 
 export type ClientStatus = 'pending' | 'approved' | 'rejected' | 'suspended';
-export type WorkerStatus = 'running' | 'pending' | 'stopped' | 'crashed';
+export type WorkerStatus = 'running' | 'pending' | 'stopped' | 'crashed' | 'crash_looping';
 
 export interface SystemInfo {
   readonly os: string;
@@ -7,6 +7,9 @@ import {
   AuditAction, AuditFilter, AuditActionType, AuditResourceType,
   SystemStats, ClientStatsDetail,
 } from '../models/index.js';
+import {
+  REGISTRATION_TOKEN_PREFIX, CLIENT_CREDENTIAL_PREFIX, RegistrationTokenInfo, generateSecret, hashSecret,
+} from './registration.js';
 
 export class AdminService {
   constructor(private readonly storage: IAdminStoragePlugin) {}
@@ -123,6 +126,27 @@ export class AdminService {
     });
   }
 
+  async createRegistrationToken(
+    createdBy: string,
+    ttlHours?: number,
+    ipAddress?: string,
+  ): Promise<{ registration_token: string; expires_at: string | null }> {
+    const token = generateSecret();
+    const expiresAt = ttlHours ? new Date(Date.now() + ttlHours * 3600 * 1000).toISOString() : null;
+    const info: RegistrationTokenInfo = { created_by: createdBy, expires_at: expiresAt };
+    await this.storage.setConfig(REGISTRATION_TOKEN_PREFIX + hashSecret(token), info, createdBy);
+    await this.storage.logAdminAction({
+      user_id: createdBy,
+      action: 'registration_token_create',
+      resource: 'client',
+      resource_id: null,
+      details: { expires_at: expiresAt },
+      ip_address: ipAddress ?? null,
+      user_agent: null,
+    });
+    return { registration_token: token, expires_at: expiresAt };
+  }
+
   async rejectClient(clientId: string, rejectedBy: string, notes?: string, ipAddress?: string): Promise<void> {
     await this.storage.setClientStatus(clientId, 'rejected', rejectedBy, notes);
     await this.storage.logAdminAction({
@@ -136,6 +160,23 @@ export class AdminService {
     });
   }
 
+  // Forgets the credential a client was issued, e.g. after it lost its state
+  // file. The client goes back to pending until it enrolls with a new
+  // registration token or is approved again.
+  async resetClientCredential(clientId: string, resetBy: string, ipAddress?: string): Promise<void> {
+    await this.storage.deleteConfig(CLIENT_CREDENTIAL_PREFIX + clientId, resetBy);
+    await this.storage.setClientStatus(clientId, 'pending', resetBy, 'Client credential reset');
+    await this.storage.logAdminAction({
+      user_id: resetBy,
+      action: 'client_credential_reset',
+      resource: 'client',
+      resource_id: clientId,
+      details: {},
+      ip_address: ipAddress ?? null,
+      user_agent: null,
+    });
+  }
+
   async suspendClient(clientId: string, suspendedBy: string, notes?: string, ipAddress?: string): Promise<void> {
     await this.storage.setClientStatus(clientId, 'suspended', suspendedBy, notes);
     await this.storage.logAdminAction({
@@ -1,6 +1,8 @@
 import { ClientService } from './ClientService';
 import { InMemoryAdminStorage } from '../plugins/InMemoryAdminStorage';
 import { InMemoryTokenStorage } from '../plugins/InMemoryTokenStorage';
+import { AdminService } from './AdminService';
+import { REGISTRATION_TOKEN_PREFIX, hashSecret } from './registration';
 import type { HeartbeatRequest, IngestRequest } from './ClientService';
 
 let adminStorage: InMemoryAdminStorage;
@@ -107,6 +109,98 @@ describe('ClientService', () => {
     });
   });
 
+  describe('registration token enrollment', () => {
+    it('approves the client and issues a credential', async () => {
+      const { registration_token } = await new AdminService(adminStorage).createRegistrationToken('admin');
+
+      const result = await service.processHeartbeat(makeHeartbeat('enroll.example.com', { registration_token }));
+
+      expect(result.status).toBe(200);
+      expect(result.body.approved).toBe(true);
+      expect(result.body.client_credential).toMatch(/^[0-9a-f]{64}$/);
+      const client = await adminStorage.getClientByHostname('enroll.example.com');
+      expect(client!.status).toBe('approved');
+    });
+
+    it('requires the credential on later heartbeats', async () => {
+      const { registration_token } = await new AdminService(adminStorage).createRegistrationToken('admin');
+      const first = await service.processHeartbeat(makeHeartbeat('cred.example.com', { registration_token }));
+      const client_credential = first.body.client_credential!;
+
+      const ok = await service.processHeartbeat(makeHeartbeat('cred.example.com', { client_credential }));
+      expect(ok.status).toBe(200);
+      expect(ok.body.client_credential).toBeUndefined();
+
+      const missing = await service.processHeartbeat(makeHeartbeat('cred.example.com'));
+      expect(missing.status).toBe(401);
+      const wrong = await service.processHeartbeat(makeHeartbeat('cred.example.com', { client_credential: 'guess' }));
+      expect(wrong.status).toBe(401);
+    });
+
+    it('re-enrolls with a new token after the credential is reset', async () => {
+      const admin = new AdminService(adminStorage);
+      const first = await admin.createRegistrationToken('admin');
+      const enrolled = await service.processHeartbeat(makeHeartbeat('lost.example.com', { registration_token: first.registration_token }));
+
+      await admin.resetClientCredential(enrolled.body.client_id, 'admin');
+      const pending = await service.processHeartbeat(makeHeartbeat('lost.example.com'));
+      expect(pending.status).toBe(202);
+
+      const second = await admin.createRegistrationToken('admin');
+      const result = await service.processHeartbeat(makeHeartbeat('lost.example.com', { registration_token: second.registration_token }));
+      expect(result.status).toBe(200);
+      expect(result.body.client_credential).toMatch(/^[0-9a-f]{64}$/);
+      expect(result.body.client_credential).not.toBe(enrolled.body.client_credential);
+    });
+
+    it('does not re-approve a rejected or suspended client', async () => {
+      for (const status of ['rejected', 'suspended'] as const) {
+        const reg = await adminStorage.registerClient({ hostname: `${status}-enroll.example.com` });
+        await adminStorage.setClientStatus(reg.client_id, status, 'admin');
+        const { registration_token } = await new AdminService(adminStorage).createRegistrationToken('admin');
+
+        const result = await service.processHeartbeat(makeHeartbeat(reg.hostname, { registration_token }));
+
+        expect(result.status).toBe(403);
+        expect(result.body.client_credential).toBeUndefined();
+        expect((await adminStorage.getClient(reg.client_id))!.status).toBe(status);
+        expect(await adminStorage.getConfig(REGISTRATION_TOKEN_PREFIX + hashSecret(registration_token))).toBeTruthy();
+      }
+    });
+
+    it('does not let a token claim an approved client', async () => {
+      const reg = await adminStorage.registerClient({ hostname: 'claimed.example.com' });
+      await adminStorage.setClientStatus(reg.client_id, 'approved', 'admin');
+      const { registration_token } = await new AdminService(adminStorage).createRegistrationToken('admin');
+
+      const result = await service.processHeartbeat(makeHeartbeat('claimed.example.com', { registration_token }));
+      expect(result.body.client_credential).toBeUndefined();
+
+      const real = await service.processHeartbeat(makeHeartbeat('claimed.example.com'));
+      expect(real.status).toBe(200);
+    });
+
+    it('tokens are single-use', async () => {
+      const { registration_token } = await new AdminService(adminStorage).createRegistrationToken('admin');
+      await service.processHeartbeat(makeHeartbeat('first.example.com', { registration_token }));
+
+      const result = await service.processHeartbeat(makeHeartbeat('second.example.com', { registration_token }));
+
+      expect(result.status).toBe(202);
+      expect(result.body.client_credential).toBeUndefined();
+    });
+
+    it('unknown and expired tokens leave the client pending', async () => {
+      const unknown = await service.processHeartbeat(makeHeartbeat('unknown-token.example.com', { registration_token: 'nope' }));
+      expect(unknown.status).toBe(202);
+
+      const expiredAt = new Date(Date.now() - 1000).toISOString();
+      await adminStorage.setConfig(REGISTRATION_TOKEN_PREFIX + hashSecret('expired'), { created_by: 'admin', expires_at: expiredAt }, 'admin');
+      const expired = await service.processHeartbeat(makeHeartbeat('expired-token.example.com', { registration_token: 'expired' }));
+      expect(expired.status).toBe(202);
+    });
+  });
+
   describe('processIngest', () => {
     it('returns 401 for unknown client', async () => {
       const request: IngestRequest = {
@@ -5,6 +5,10 @@ import {
   ClientInfo, ClientRegistration, ClientConfig,
   UsageRecord, IngestionResult,
 } from '../models/index.js';
+import {
+  REGISTRATION_TOKEN_PREFIX, CLIENT_CREDENTIAL_PREFIX, RegistrationTokenInfo,
+  generateSecret, hashSecret,
+} from './registration.js';
 
 export interface HeartbeatRequest {
   client_hostname: string;
@@ -12,6 +16,9 @@ export interface HeartbeatRequest {
   launcher_version: string;
   worker_version: string;
   worker_status: string;
+  registration_token?: string;
+  client_credential?: string;
+  clock_skew_seconds?: number;
   system_info: {
     os: string;
     arch: string;
@@ -29,6 +36,7 @@ export interface HeartbeatRequest {
 export interface HeartbeatResponse {
   client_id: string;
   approved: boolean;
+  client_credential?: string;
   config?: ClientConfig;
   update?: {
     enabled: boolean;
@@ -97,6 +105,31 @@ export class ClientService {
       client = await this.adminStorage.registerClient(registration);
     }
 
+    // A client enrolled with a registration token must present the
+    // credential it was issued. Only a new or pending client may enroll with
+    // a token: one an admin rejected or suspended stays so, and an approved
+    // client can't be claimed by whoever sends its hostname.
+    let issuedCredential: string | undefined;
+    const credential = await this.adminStorage.getConfig(CLIENT_CREDENTIAL_PREFIX + client.client_id);
+    if (credential) {
+      if (!request.client_credential || hashSecret(request.client_credential) !== credential.value) {
+        return {
+          status: 401,
+          body: {
+            client_id: client.client_id,
+            approved: false,
+            server_time: new Date().toISOString(),
+            message: 'Invalid client credential.',
+          },
+        };
+      }
+    } else if (request.registration_token && client.status === 'pending') {
+      issuedCredential = await this.enroll(client.client_id, request.registration_token);
+      if (issuedCredential) {
+        client = (await this.adminStorage.getClient(client.client_id)) ?? client;
+      }
+    }
+
     // Update client info
     await this.adminStorage.updateClient(client.client_id, {
       last_seen: new Date().toISOString(),
@@ -152,6 +185,7 @@ export class ClientService {
       body: {
         client_id: client.client_id,
         approved: true,
+        client_credential: issuedCredential,
         config: config ?? undefined,
         update: {
           enabled: true,
@@ -163,6 +197,26 @@ export class ClientService {
     };
   }
 
+  // Redeems a one-time registration token: the pending client is approved and
+  // issued a credential. Returns undefined if the token is unknown or expired.
+  // The credential authenticates heartbeats only; see processIngest.
+  private async enroll(clientId: string, token: string): Promise<string | undefined> {
+    const key = REGISTRATION_TOKEN_PREFIX + hashSecret(token);
+    const entry = await this.adminStorage.getConfig(key);
+    if (!entry) return undefined;
+    await this.adminStorage.deleteConfig(key, 'registration');
+
+    const info = entry.value as RegistrationTokenInfo;
+    if (info.expires_at && new Date(info.expires_at).getTime() < Date.now()) return undefined;
+
+    const credential = generateSecret();
+    await this.adminStorage.setConfig(CLIENT_CREDENTIAL_PREFIX + clientId, hashSecret(credential), 'registration');
+    await this.adminStorage.setClientStatus(clientId, 'approved', info.created_by, 'Enrolled with registration token');
+    return credential;
+  }
+
+  // Uploads are attributed by hostname alone: the client credential is not
+  // checked here, as the worker that uploads can't read it.
   async processIngest(request: IngestRequest): Promise<{ status: number; body: IngestResponse | { error: string; message: string } }> {
     // Look up client
     const client = await this.adminStorage.getClientByHostname(request.clientHostname);
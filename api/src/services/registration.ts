@@ -0,0 +1,19 @@
+import { createHash, randomBytes } from 'crypto';
+
+// Registration tokens and client credentials are kept in the config store,
+// hashed, under these key prefixes.
+export const REGISTRATION_TOKEN_PREFIX = 'registration_token:';
+export const CLIENT_CREDENTIAL_PREFIX = 'client_credential:';
+
+export interface RegistrationTokenInfo {
+  created_by: string;
+  expires_at: string | null;
+}
+
+export function generateSecret(): string {
+  return randomBytes(32).toString('hex');
+}
+
+export function hashSecret(secret: string): string {
+  return createHash('sha256').update(secret).digest('hex');
+}
@@ -2,15 +2,24 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"github.com/ComputClaw/tokenly-client/internal/config"
 	"github.com/ComputClaw/tokenly-client/internal/launcher"
 	"github.com/ComputClaw/tokenly-client/internal/logging"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
 )
 
 var (
@@ -20,23 +29,88 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "install-service":
+			os.Exit(installService(os.Args[2:]))
+		case "uninstall-service":
+			os.Exit(uninstallService(os.Args[2:]))
+		case "status":
+			os.Exit(statusCommand(os.Args[2:]))
+		}
+	}
+
+	statePath := flag.String("state-path", defaultStatePath(), "Path to the shared state file")
+	configPath := flag.String("config", "", "Config file (default: "+platform.LauncherConfigPath()+" if present)")
 	serverURL := flag.String("server", "", "Server URL (required)")
 	hostname := flag.String("hostname", "", "Override hostname (default: OS hostname)")
 	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn, error")
+	heartbeatPath := flag.String("heartbeat-path", "/api/heartbeat", "Heartbeat endpoint path")
+	ingestPath := flag.String("ingest-path", "", "Ingest endpoint path (default: server config, else /api/ingest)")
+	maxResponseKB := flag.Int("max-response-kb", 1024, "Largest heartbeat response accepted, in KB")
+	headers := headerFlags{}
+	flag.Var(headers, "header", "Extra request header as Name=Value (repeatable)")
+	handoff := flag.String("handoff", "exec", "After a self-update: exec (restart in place) or exit (leave the restart to the service manager)")
+	registrationToken := flag.String("registration-token", "", "One-time token to enroll without manual approval")
+	statusAddr := flag.String("status-addr", "", "Serve /healthz, /status, and /metrics on this loopback address, e.g. 127.0.0.1:9465")
+	correctClock := flag.Bool("correct-clock", false, "Correct generated timestamps for this host's clock skew from the server")
+	stopGrace := flag.Duration("worker-stop-grace", 30*time.Second, "How long the worker is given to exit before it is killed")
+	externalWorker := flag.Bool("external-worker", false, "Don't start the worker: it runs under its own supervisor (systemd unit, Kubernetes sidecar)")
+	workerUser := flag.String("worker-user", "", "Run the worker as this unprivileged user (Unix, launcher running as root)")
+	once := flag.Bool("once", false, "Heartbeat once, run the worker for one cycle if approved, then exit")
 	showVersion := flag.Bool("version", false, "Print version and exit")
+	showStatus := flag.Bool("status", false, "Alias for the status subcommand without --json")
 	flag.Parse()
 
+	// Every flag but --version and --status falls back to its TOKENLY_*
+	// variable, e.g. TOKENLY_SERVER for --server.
+	if err := config.ApplyEnv(flag.CommandLine, "version", "status"); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *showVersion {
 		fmt.Printf("tokenly-launcher version %s (commit: %s, built: %s)\n", version, commit, date)
 		os.Exit(0)
 	}
 
+	if *showStatus {
+		os.Exit(config.RunStatus(os.Stdout, os.Stderr, *statePath, false))
+	}
+
+	fileCfg, err := loadConfigFile(*configPath)
+	if err == nil {
+		err = applyFileConfig(flag.CommandLine, fileCfg, headers)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+	network := fileCfg.Network()
+	transport, err := network.HTTPTransport()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *serverURL == "" {
-		fmt.Fprintln(os.Stderr, "error: --server flag is required")
+		fmt.Fprintln(os.Stderr, "error: --server flag (or TOKENLY_SERVER, or server in the config file) is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
+	normalized, err := config.NormalizeServerURL(*serverURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --server: %v\n", err)
+		os.Exit(1)
+	}
+	*serverURL = normalized
+
+	if *handoff != "exec" && *handoff != "exit" {
+		fmt.Fprintf(os.Stderr, "error: --handoff must be exec or exit, got %q\n", *handoff)
+		os.Exit(1)
+	}
+
 	if *hostname == "" {
 		h, err := os.Hostname()
 		if err != nil {
@@ -46,26 +120,84 @@ func main() {
 		*hostname = h
 	}
 
-	logger, levelVar := logging.NewLogger("launcher", *logLevel)
-
-	// Determine state file path per platform.
-	statePath := defaultStatePath()
+	// Logs go to stderr, or to the config file's log file, which the
+	// worker's output is appended to as well.
+	var logOutput io.Writer = os.Stderr
+	if fileCfg.Log.File != "" {
+		f, err := os.OpenFile(fileCfg.Log.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: open log file: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logOutput = f
+	}
+	logger, levelVar := logging.NewLoggerTo("launcher", *logLevel, logOutput)
 
 	// Determine worker binary name for the current OS.
 	workerBinary := launcher.WorkerBinaryName()
 
 	checker := &launcher.OSProcessChecker{}
-	workerManager := launcher.NewWorkerManager(workerBinary, statePath, checker, logger)
+	if fileCfg.Log.File != "" {
+		checker.Output = logOutput
+	}
+	var wu *launcher.WorkerUser
+	if *workerUser != "" && *externalWorker {
+		fmt.Fprintln(os.Stderr, "error: --worker-user has no effect with --external-worker; run the worker's own unit as that user")
+		os.Exit(1)
+	}
+	if *workerUser != "" {
+		wu, err = setUpWorkerUser(*workerUser, *statePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: --worker-user: %v\n", err)
+			os.Exit(1)
+		}
+		checker.User = wu
+	}
+	workerManager := launcher.NewWorkerManager(workerBinary, *statePath, checker, logger)
 
-	heartbeatClient := launcher.NewHeartbeatClient(*serverURL, logger)
+	heartbeatClient, err := launcher.NewTransport(*serverURL, launcher.TransportOptions{
+		Path:          *heartbeatPath,
+		Headers:       headers,
+		MaxResponseKB: *maxResponseKB,
+		HTTPTransport: transport,
+		Logger:        logger,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
 
 	cfg := launcher.LauncherConfig{
-		ServerURL: *serverURL,
-		Hostname:  *hostname,
-		LogLevel:  *logLevel,
+		ServerURL:      *serverURL,
+		Hostname:       *hostname,
+		LogLevel:       *logLevel,
+		IngestPath:     *ingestPath,
+		RequestHeaders: headers,
+		HealthSocket:   platform.IPCSocketPath(),
+		Network:        network,
+		CorrectClock:   *correctClock,
+
+		RegistrationToken: *registrationToken,
 	}
+	workerManager.SetHealthSocket(cfg.HealthSocket)
+	workerManager.SetStopGrace(*stopGrace)
+	workerManager.SetExternal(*externalWorker)
+
+	l := launcher.NewLauncher(cfg, *statePath, heartbeatClient, workerManager, logger, levelVar, version)
+	l.SetWorkerUser(wu)
+
+	updater := launcher.NewUpdater(*serverURL, logger)
+	updater.SetHeaders(headers)
+	updater.SetTransport(transport)
+	l.SetUpdater(updater)
 
-	l := launcher.NewLauncher(cfg, statePath, heartbeatClient, workerManager, logger, levelVar, version)
+	self, err := launcherPath()
+	if err != nil {
+		logger.Warn("launcher self-update disabled", "error", err)
+	} else {
+		l.SetLauncherBinary(self)
+	}
 
 	// Context with signal handling.
 	ctx, cancel := context.WithCancel(context.Background())
@@ -85,12 +217,99 @@ func main() {
 		"hostname", *hostname,
 	)
 
-	if err := l.Run(ctx); err != nil {
+	if *once {
+		os.Exit(onceExitCode(l.RunOnce(ctx), logger))
+	}
+
+	if *statusAddr != "" {
+		statusServer := launcher.NewStatusServer(*statePath, logger)
+		go func() {
+			if err := statusServer.Serve(ctx, *statusAddr); err != nil {
+				logger.Error("status endpoint failed", "error", err)
+			}
+		}()
+	}
+
+	err = l.Run(ctx)
+	if errors.Is(err, launcher.ErrHandoff) {
+		os.Exit(handOff(*handoff, self, updater, logger))
+	}
+	if err != nil {
 		logger.Error("launcher exited with error", "error", err)
 		os.Exit(1)
 	}
 }
 
+// Exit codes of --once runs besides 0 (success) and 1 (heartbeat or worker
+// failure), so schedulers can tell an unapproved client from a broken one.
+const (
+	exitPending  = 3
+	exitRejected = 4
+)
+
+// onceExitCode logs the outcome of a --once run and maps it to an exit code.
+func onceExitCode(err error, logger *slog.Logger) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, launcher.ErrPending):
+		return exitPending
+	case errors.Is(err, launcher.ErrRejected):
+		return exitRejected
+	default:
+		logger.Error("one-shot run failed", "error", err)
+		return 1
+	}
+}
+
+// exitHandoff is the exit code that tells a service manager the launcher
+// stopped to be restarted into an updated binary.
+const exitHandoff = 75
+
+// handOff restarts into the updated launcher binary at self, or exits for
+// the service manager to do so, returning the exit code if it returns at
+// all. If the new binary can't be executed, the previous one is restored.
+func handOff(mode, self string, updater *launcher.Updater, logger *slog.Logger) int {
+	if mode == "exit" {
+		logger.Info("exiting for the service manager to start the updated launcher")
+		return exitHandoff
+	}
+	logger.Info("restarting into updated launcher", "binary", self)
+	if err := reexec(self, os.Args[1:]); err != nil {
+		logger.Error("failed to start updated launcher, rolling back", "error", err)
+		if err := updater.Rollback(self); err != nil {
+			logger.Error("launcher rollback failed", "error", err)
+		}
+		return 1
+	}
+	return 0
+}
+
+// launcherPath returns the resolved path of the running launcher binary.
+func launcherPath() (string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("locate launcher binary: %w", err)
+	}
+	return filepath.EvalSymlinks(self)
+}
+
+// statusCommand implements the status subcommand, printing the agent's
+// status from the state file.
+func statusCommand(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	statePath := fs.String("state-path", defaultStatePath(), "Path to the shared state file")
+	asJSON := fs.Bool("json", false, "Print the status as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := config.ApplyEnv(fs, "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	return config.RunStatus(os.Stdout, os.Stderr, *statePath, *asJSON)
+}
+
 func defaultStatePath() string {
 	switch runtime.GOOS {
 	case "windows":
@@ -105,3 +324,97 @@ func defaultStatePath() string {
 		return "/var/lib/tokenly/tokenly-state.json"
 	}
 }
+
+// setUpWorkerUser resolves the user the worker should run as and gives it
+// access to the files it writes. Only a root launcher can switch users.
+func setUpWorkerUser(name, statePath string) (*launcher.WorkerUser, error) {
+	if !platform.IsPrivileged() {
+		return nil, fmt.Errorf("the launcher must run as root to start the worker as another user")
+	}
+	wu, err := launcher.LookupWorkerUser(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := wu.PrepareFiles(statePath); err != nil {
+		return nil, err
+	}
+	return wu, nil
+}
+
+// loadConfigFile loads the launcher config file at path. Without an explicit
+// path the platform default is tried, and a missing file there is fine.
+func loadConfigFile(path string) (*launcher.FileConfig, error) {
+	if path != "" {
+		return launcher.LoadFileConfig(path)
+	}
+	fc, err := launcher.LoadFileConfig(platform.LauncherConfigPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return &launcher.FileConfig{}, nil
+	}
+	return fc, err
+}
+
+// applyFileConfig sets the flags not given on the command line from the
+// config file. File headers are added unless a --header of the same name was
+// given.
+func applyFileConfig(fs *flag.FlagSet, fc *launcher.FileConfig, headers headerFlags) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	values := map[string]string{
+		"server":             fc.Server,
+		"hostname":           fc.Hostname,
+		"log-level":          fc.Log.Level,
+		"heartbeat-path":     fc.HeartbeatPath,
+		"ingest-path":        fc.IngestPath,
+		"handoff":            fc.Handoff,
+		"registration-token": fc.RegistrationToken,
+		"status-addr":        fc.StatusAddr,
+		"worker-user":        fc.WorkerUser,
+		"worker-stop-grace":  fc.WorkerStopGrace,
+	}
+	if fc.MaxResponseKB != 0 {
+		values["max-response-kb"] = strconv.Itoa(fc.MaxResponseKB)
+	}
+	if fc.CorrectClock {
+		values["correct-clock"] = "true"
+	}
+	if fc.ExternalWorker {
+		values["external-worker"] = "true"
+	}
+	for name, v := range values {
+		if v == "" || set[name] {
+			continue
+		}
+		if err := fs.Set(name, v); err != nil {
+			return fmt.Errorf("config file: %s: %w", name, err)
+		}
+	}
+	for k, v := range fc.Headers {
+		if _, ok := headers[k]; !ok {
+			headers[k] = v
+		}
+	}
+	return nil
+}
+
+// headerFlags collects repeatable --header Name=Value flags.
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	pairs := make([]string, 0, len(h))
+	for k, v := range h {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (h headerFlags) Set(val string) error {
+	name, value, ok := strings.Cut(val, "=")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("header must be Name=Value, got %q", val)
+	}
+	h[name] = strings.TrimSpace(value)
+	return nil
+}
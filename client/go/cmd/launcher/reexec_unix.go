@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reexec replaces the current process with the binary at path, keeping the
+// PID so service managers and the worker's parent see no change. It only
+// returns on failure.
+func reexec(path string, args []string) error {
+	return syscall.Exec(path, append([]string{path}, args...), os.Environ())
+}
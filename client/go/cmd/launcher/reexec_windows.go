@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// reexec starts the binary at path with the same arguments. Windows cannot
+// replace a running process image, so the caller exits once it returns.
+func reexec(path string, args []string) error {
+	cmd := exec.Command(path, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", path, err)
+	}
+	return nil
+}
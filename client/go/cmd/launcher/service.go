@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/ComputClaw/tokenly-client/internal/launcher"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
+)
+
+// systemdUnitDir is where install-service writes the launcher's unit.
+const systemdUnitDir = "/etc/systemd/system"
+
+// serviceManager installs and removes the launcher as a system service.
+type serviceManager interface {
+	install(opts launcher.ServiceOptions) error
+	uninstall() error
+}
+
+// installService handles `tokenly-launcher install-service`: it registers
+// this binary with the OS service manager, then enables and starts it.
+func installService(args []string) int {
+	fs := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	serverURL := fs.String("server", "", "Server URL (required)")
+	runAs := fs.String("user", "root", "Account the service runs as")
+	logLevel := fs.String("log-level", "", "Log level passed to the service")
+	headers := headerFlags{}
+	fs.Var(headers, "header", "Extra request header as Name=Value (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	mgr, err := serviceManagerForOS()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if *serverURL == "" {
+		fmt.Fprintln(os.Stderr, "error: --server flag is required")
+		fs.Usage()
+		return 2
+	}
+	normalized, err := config.NormalizeServerURL(*serverURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: --server: %v\n", err)
+		return 1
+	}
+	if _, err := user.Lookup(*runAs); err != nil {
+		fmt.Fprintf(os.Stderr, "error: --user: %v\n", err)
+		return 1
+	}
+	binary, err := launcherPath()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+
+	err = mgr.install(launcher.ServiceOptions{
+		Binary:    binary,
+		ServerURL: normalized,
+		User:      *runAs,
+		Headers:   headers,
+		LogLevel:  *logLevel,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// uninstallService handles `tokenly-launcher uninstall-service`: it stops the
+// service registered by install-service and removes it.
+func uninstallService(args []string) int {
+	fs := flag.NewFlagSet("uninstall-service", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	mgr, err := serviceManagerForOS()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	if err := mgr.uninstall(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// serviceManagerForOS returns the service manager for this OS, or why the
+// service subcommands can't run here.
+func serviceManagerForOS() (serviceManager, error) {
+	var mgr serviceManager
+	var tool string
+	switch runtime.GOOS {
+	case "linux":
+		mgr, tool = systemdManager{}, "systemctl"
+	case "darwin":
+		mgr, tool = launchdManager{}, "launchctl"
+	default:
+		return nil, fmt.Errorf("service install is only supported on Linux (systemd) and macOS (launchd)")
+	}
+	if !platform.IsPrivileged() {
+		return nil, fmt.Errorf("service install must run as root")
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return nil, fmt.Errorf("%s not found: %w", tool, err)
+	}
+	return mgr, nil
+}
+
+// servicePerm returns the mode for a service definition. Headers often
+// carry credentials, so definitions with headers are private to root.
+func servicePerm(opts launcher.ServiceOptions) os.FileMode {
+	if len(opts.Headers) > 0 {
+		return 0600
+	}
+	return 0644
+}
+
+// writeServiceFile writes a service definition with exactly mode perm.
+func writeServiceFile(path, content string, perm os.FileMode) error {
+	if err := os.WriteFile(path, []byte(content), perm); err != nil {
+		return err
+	}
+	return os.Chmod(path, perm)
+}
+
+// systemdManager installs the launcher as a systemd unit.
+type systemdManager struct{}
+
+func (systemdManager) install(opts launcher.ServiceOptions) error {
+	path := filepath.Join(systemdUnitDir, launcher.SystemdUnitName)
+	if err := writeServiceFile(path, launcher.SystemdUnit(opts), servicePerm(opts)); err != nil {
+		return fmt.Errorf("write unit: %w", err)
+	}
+	fmt.Printf("wrote %s\n", path)
+
+	if err := runTool("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	if err := runTool("systemctl", "enable", "--now", launcher.SystemdUnitName); err != nil {
+		return err
+	}
+	fmt.Printf("%s enabled and started\n", launcher.SystemdUnitName)
+	return nil
+}
+
+func (systemdManager) uninstall() error {
+	path := filepath.Join(systemdUnitDir, launcher.SystemdUnitName)
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s is not installed\n", launcher.SystemdUnitName)
+		return nil
+	}
+	if err := runTool("systemctl", "disable", "--now", launcher.SystemdUnitName); err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove unit: %w", err)
+	}
+	if err := runTool("systemctl", "daemon-reload"); err != nil {
+		return err
+	}
+	fmt.Printf("%s stopped and removed\n", launcher.SystemdUnitName)
+	return nil
+}
+
+// launchdManager installs the launcher as a LaunchDaemon.
+type launchdManager struct{}
+
+func (launchdManager) install(opts launcher.ServiceOptions) error {
+	// launchd doesn't create the data, runtime, and log directories, and the
+	// service account must own them when it isn't root.
+	dataDir, logDir := platform.DataDir(), platform.LogDir()
+	for _, dir := range []string{dataDir, platform.RunDir(), logDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create %s: %w", dir, err)
+		}
+		if err := chownToUser(dir, opts.User); err != nil {
+			return err
+		}
+	}
+
+	// Replace a loaded daemon so the new definition takes effect.
+	if _, err := os.Stat(launcher.LaunchdPlistPath); err == nil {
+		runTool("launchctl", "bootout", "system/"+launcher.LaunchdLabel)
+	}
+	plist := launcher.LaunchdPlist(opts, dataDir, logDir)
+	if err := writeServiceFile(launcher.LaunchdPlistPath, plist, servicePerm(opts)); err != nil {
+		return fmt.Errorf("write plist: %w", err)
+	}
+	fmt.Printf("wrote %s\n", launcher.LaunchdPlistPath)
+
+	if err := runTool("launchctl", "bootstrap", "system", launcher.LaunchdPlistPath); err != nil {
+		return err
+	}
+	if err := runTool("launchctl", "enable", "system/"+launcher.LaunchdLabel); err != nil {
+		return err
+	}
+	fmt.Printf("%s loaded and started\n", launcher.LaunchdLabel)
+	return nil
+}
+
+func (launchdManager) uninstall() error {
+	if _, err := os.Stat(launcher.LaunchdPlistPath); errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("%s is not installed\n", launcher.LaunchdLabel)
+		return nil
+	}
+	if err := runTool("launchctl", "bootout", "system/"+launcher.LaunchdLabel); err != nil {
+		return err
+	}
+	if err := os.Remove(launcher.LaunchdPlistPath); err != nil {
+		return fmt.Errorf("remove plist: %w", err)
+	}
+	fmt.Printf("%s unloaded and removed\n", launcher.LaunchdLabel)
+	return nil
+}
+
+// chownToUser gives dir to the named account. Root needs no change.
+func chownToUser(dir, name string) error {
+	if name == "" || name == "root" {
+		return nil
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("look up %s: %w", name, err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return fmt.Errorf("uid of %s: %w", name, err)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return fmt.Errorf("gid of %s: %w", name, err)
+	}
+	if err := os.Chown(dir, uid, gid); err != nil {
+		return fmt.Errorf("chown %s: %w", dir, err)
+	}
+	return nil
+}
+
+func runTool(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %v: %w", name, args, err)
+	}
+	return nil
+}
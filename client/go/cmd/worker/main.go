@@ -2,14 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
 	"github.com/ComputClaw/tokenly-client/internal/logging"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
 	"github.com/ComputClaw/tokenly-client/internal/worker"
 )
 
@@ -20,26 +24,53 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "status" {
+		os.Exit(statusCommand(os.Args[2:]))
+	}
+
 	statePath := flag.String("state-path", "", "Path to the shared state file (required)")
 	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn, error")
+	once := flag.Bool("once", false, "Run a single scan-upload cycle, then exit")
+	waitForConfig := flag.Bool("wait-for-config", false, "Wait for the launcher to write an approved config instead of exiting, and exit when a setting read only at startup changes (for externally supervised workers)")
 	showVersion := flag.Bool("version", false, "Print version and exit")
 	flag.Parse()
 
+	// Flags fall back to their TOKENLY_* variables, e.g. TOKENLY_STATE_PATH.
+	if err := config.ApplyEnv(flag.CommandLine, "version"); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+
 	if *showVersion {
 		fmt.Printf("tokenly-worker version %s (commit: %s, built: %s)\n", version, commit, date)
 		os.Exit(0)
 	}
 
 	if *statePath == "" {
-		fmt.Fprintln(os.Stderr, "error: --state-path is required")
+		fmt.Fprintln(os.Stderr, "error: --state-path (or TOKENLY_STATE_PATH) is required")
 		flag.Usage()
 		os.Exit(1)
 	}
 
 	logger, _ := logging.NewLogger("worker", *logLevel)
 
+	// Set up signal handling.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-sigCh
+		logger.Info("received signal, shutting down", "signal", sig)
+		cancel()
+	}()
+
 	// Load config from shared state file written by the launcher.
-	state, err := config.LoadState(*statePath)
+	state, err := loadState(ctx, *statePath, *waitForConfig, logger)
+	if errors.Is(err, context.Canceled) {
+		os.Exit(0)
+	}
 	if err != nil {
 		logger.Error("failed to load state file", "path", *statePath, "error", err)
 		os.Exit(1)
@@ -59,23 +90,15 @@ func main() {
 		hostname = h
 	}
 
-	serverURL := state.ServerEndpoint
-	if serverURL == "" {
+	if state.ServerEndpoint == "" {
 		logger.Error("state file has no server endpoint, cannot start")
 		os.Exit(1)
 	}
-
-	// Set up signal handling.
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM, syscall.SIGINT)
-	go func() {
-		sig := <-sigCh
-		logger.Info("received signal, shutting down", "signal", sig)
-		cancel()
-	}()
+	serverURL, err := config.NormalizeServerURL(state.ServerEndpoint)
+	if err != nil {
+		logger.Error("invalid server endpoint in state file", "error", err)
+		os.Exit(1)
+	}
 
 	// Create and run the worker.
 	w, err := worker.NewWorker(worker.WorkerConfig{
@@ -84,16 +107,73 @@ func main() {
 		StatePath: *statePath,
 		ServerURL: serverURL,
 		LogLevel:  *logLevel,
+		Version:   version,
+
+		IngestPath:     state.EffectiveIngestPath(),
+		RequestHeaders: state.EffectiveRequestHeaders(),
+
+		HealthSocket: state.HealthSocket,
+		Network:      state.Network,
+		ClockOffset:  state.ClockOffset(),
+
+		// Nothing else restarts an externally supervised worker.
+		ExitOnRestartSettings: *waitForConfig,
 	}, logger)
 	if err != nil {
 		logger.Error("failed to create worker", "error", err)
 		os.Exit(1)
 	}
 
-	if err := w.Run(ctx); err != nil {
+	run := w.Run
+	if *once {
+		run = w.RunOnce
+	}
+	if err := run(ctx); errors.Is(err, worker.ErrRestartRequired) {
+		// Non-zero, so a supervisor that only restarts failed units does too.
+		logger.Warn("worker exiting to be restarted with new settings", "error", err)
+		os.Exit(1)
+	} else if err != nil {
 		logger.Error("worker exited with error", "error", err)
 		os.Exit(1)
 	}
 
 	logger.Info("worker exited cleanly")
 }
+
+// configPollInterval is how often --wait-for-config rereads the state file.
+const configPollInterval = 30 * time.Second
+
+// loadState reads the state file written by the launcher. With wait set, it
+// is reread until the launcher has written an approved server config, as a
+// worker started by its own supervisor may come up before the launcher has
+// heard from the server.
+func loadState(ctx context.Context, path string, wait bool, logger *slog.Logger) (*config.StateFile, error) {
+	for {
+		state, err := config.LoadState(path)
+		if err != nil || !wait || (state.ServerApproved && state.ServerConfig != nil) {
+			return state, err
+		}
+		logger.Info("waiting for the launcher to write an approved config", "path", path)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(configPollInterval):
+		}
+	}
+}
+
+// statusCommand implements the status subcommand, printing the agent's
+// status from the state file the worker shares with the launcher.
+func statusCommand(args []string) int {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	statePath := fs.String("state-path", platform.StateFilePath(), "Path to the shared state file")
+	asJSON := fs.Bool("json", false, "Print the status as JSON")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if err := config.ApplyEnv(fs, "json"); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 2
+	}
+	return config.RunStatus(os.Stdout, os.Stderr, *statePath, *asJSON)
+}
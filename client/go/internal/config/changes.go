@@ -0,0 +1,79 @@
+package config
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// restartSettings returns the settings the worker reads only when it starts,
+// keyed by JSON name: what it scans, how, and how often, and how it uploads
+// and disposes of what it finds. Every other setting is applied live.
+func restartSettings(c *ClientConfig) map[string]any {
+	return map[string]any{
+		"discovery_paths":        c.DiscoveryPaths,
+		"file_patterns":          c.FilePatterns,
+		"exclude_patterns":       c.ExcludePatterns,
+		"scan_interval_minutes":  c.ScanIntervalMinutes,
+		"focused_scan_minutes":   c.FocusedScanMinutes,
+		"max_file_age_hours":     c.MaxFileAgeHours,
+		"max_file_size_mb":       c.MaxFileSizeMB,
+		"symlink_policy":         c.SymlinkPolicy,
+		"scan_parallelism":       c.ScanParallelism,
+		"quiescence_seconds":     c.QuiescenceSeconds,
+		"sniff_max_kb":           c.SniffMaxKB,
+		"sniff_lines":            c.SniffLines,
+		"network_fs_policy":      c.NetworkFSPolicy,
+		"network_fs_max_depth":   c.NetworkFSMaxDepth,
+		"network_fs_max_seconds": c.NetworkFSMaxSeconds,
+		"prioritization":         c.Prioritization,
+		"match_rotated":          c.MatchRotated,
+		"pattern_case":           c.PatternCase,
+		"validation_schema":      c.ValidationSchema,
+		"all_drives":             c.AllDrives,
+		"full_rescan_hours":      c.FullRescanHours,
+		"spool_max_files":        c.SpoolMaxFiles,
+		"spool_max_mb":           c.SpoolMaxMB,
+		"ingest_path":            c.IngestPath,
+		"request_headers":        c.RequestHeaders,
+		"upload_mode":            c.UploadMode,
+		"upload_min_kbps":        c.UploadMinKBps,
+		"max_response_kb":        c.MaxResponseKB,
+		"daily_upload_max_files": c.DailyUploadMaxFiles,
+		"daily_upload_max_mb":    c.DailyUploadMaxMB,
+		"post_upload_action":     c.PostUploadAction,
+		"post_upload_move_to":    c.PostUploadMoveTo,
+	}
+}
+
+// RestartSettingsChanged returns the JSON names of the settings that differ
+// between prev and next among those the worker reads only at startup, in
+// name order. A running worker must be restarted to pick them up. Empty and
+// missing lists compare equal. A nil prev changes nothing: the worker that
+// started without a config started with next.
+func RestartSettingsChanged(prev, next *ClientConfig) []string {
+	if prev == nil || next == nil {
+		return nil
+	}
+	a, b := restartSettings(prev), restartSettings(next)
+	var changed []string
+	for name := range a {
+		if settingJSON(a[name]) != settingJSON(b[name]) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func settingJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	switch s := string(data); s {
+	case "null", "[]", "{}":
+		return ""
+	default:
+		return s
+	}
+}
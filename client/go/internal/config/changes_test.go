@@ -0,0 +1,67 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// liveSettings are the settings that need no worker restart: the worker
+// rereads them on each config reload or cycle, or only the launcher uses them.
+var liveSettings = []string{
+	"scan_enabled", "worker_timeout_seconds", "max_concurrent_uploads",
+	"heartbeat_interval_seconds", "log_level", "update_enabled", "update_check_interval_hours",
+	"retry_failed_uploads", "retry_delay_seconds", "retry_max_attempts",
+	"provider_tags", "checksum_algorithm", "gzip_upload_mode", "csv_columns",
+	"sanitize_invalid_lines", "timestamp_skew_minutes", "timestamp_horizon_days", "max_line_kb",
+	"allowed_services", "blocked_services", "required_fields",
+	"max_concurrent_validations", "validation_telemetry",
+	"negative_cache_reprobe_hours", "negative_cache_ttl_days", "max_learned_directories",
+	"learning_sync_hours", "success_rate_half_life_scans", "learning_prune_days",
+	"quarantine_days", "quarantine_max_mb", "archive_days", "archive_max_mb", "secure_delete",
+}
+
+// TestRestartSettings_EverySettingClassified fails when a ClientConfig field
+// is added without deciding whether changing it restarts the worker.
+func TestRestartSettings_EverySettingClassified(t *testing.T) {
+	cfg := DefaultConfig()
+	restart := restartSettings(&cfg)
+	typ := reflect.TypeOf(cfg)
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		_, isRestart := restart[name]
+		isLive := false
+		for _, live := range liveSettings {
+			isLive = isLive || live == name
+		}
+		assert.True(t, isRestart != isLive, "%s must be either a restart or a live setting", name)
+	}
+}
+
+func TestRestartSettingsChanged(t *testing.T) {
+	prev := DefaultConfig()
+	next := DefaultConfig()
+	assert.Empty(t, RestartSettingsChanged(&prev, &next))
+
+	// Settings applied live don't need a restart.
+	next.LogLevel = "debug"
+	next.HeartbeatIntervalSecs = 60
+	next.SecureDelete = true
+	assert.Empty(t, RestartSettingsChanged(&prev, &next))
+
+	next.ScanIntervalMinutes = prev.ScanIntervalMinutes + 1
+	next.FilePatterns = append([]string{"*.ndjson"}, prev.FilePatterns...)
+	next.DiscoveryPaths.Linux = append(next.DiscoveryPaths.Linux, PlainPaths("/srv/logs")...)
+	assert.Equal(t, []string{"discovery_paths", "file_patterns", "scan_interval_minutes"}, RestartSettingsChanged(&prev, &next))
+}
+
+func TestRestartSettingsChanged_EmptyEqualsMissing(t *testing.T) {
+	prev := DefaultConfig()
+	next := DefaultConfig()
+	prev.ExcludePatterns = nil
+	next.ExcludePatterns = []string{}
+	assert.Empty(t, RestartSettingsChanged(&prev, &next))
+	assert.Empty(t, RestartSettingsChanged(nil, &next))
+}
@@ -1,52 +1,227 @@
 package config
 
-// ClientConfig matches the server's ClientConfig type exactly (api/src/models/client.ts:73-93).
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ClientConfig is the worker configuration the server delivers. Its first
+// fields match the server's ClientConfig type (api/src/models/client.ts);
+// the rest are client settings a server may add, and keep their defaults
+// when it does not.
 type ClientConfig struct {
-	ScanEnabled            bool            `json:"scan_enabled"`
-	ScanIntervalMinutes    int             `json:"scan_interval_minutes"`
-	MaxFileAgeHours        int             `json:"max_file_age_hours"`
-	MaxFileSizeMB          int             `json:"max_file_size_mb"`
-	WorkerTimeoutSeconds   int             `json:"worker_timeout_seconds"`
-	MaxConcurrentUploads   int             `json:"max_concurrent_uploads"`
-	DiscoveryPaths         DiscoveryPaths  `json:"discovery_paths"`
-	FilePatterns           []string        `json:"file_patterns"`
-	ExcludePatterns        []string        `json:"exclude_patterns"`
-	HeartbeatIntervalSecs  int             `json:"heartbeat_interval_seconds"`
-	RetryFailedUploads     bool            `json:"retry_failed_uploads"`
-	RetryDelaySeconds      int             `json:"retry_delay_seconds"`
-	LogLevel               string          `json:"log_level"`
-	UpdateEnabled          bool            `json:"update_enabled"`
-	UpdateCheckIntervalHrs int             `json:"update_check_interval_hours"`
+	ScanEnabled            bool              `json:"scan_enabled"`
+	ScanIntervalMinutes    int               `json:"scan_interval_minutes"`
+	MaxFileAgeHours        int               `json:"max_file_age_hours"`
+	MaxFileSizeMB          int               `json:"max_file_size_mb"`
+	WorkerTimeoutSeconds   int               `json:"worker_timeout_seconds"`
+	MaxConcurrentUploads   int               `json:"max_concurrent_uploads"`
+	DiscoveryPaths         DiscoveryPaths    `json:"discovery_paths"`
+	FilePatterns           []string          `json:"file_patterns"`
+	ExcludePatterns        []string          `json:"exclude_patterns"` // base name globs; globs with "/" match the full path
+	HeartbeatIntervalSecs  int               `json:"heartbeat_interval_seconds"`
+	RetryFailedUploads     bool              `json:"retry_failed_uploads"`
+	RetryDelaySeconds      int               `json:"retry_delay_seconds"`
+	RetryMaxAttempts       int               `json:"retry_max_attempts"`
+	LogLevel               string            `json:"log_level"`
+	UpdateEnabled          bool              `json:"update_enabled"`
+	UpdateCheckIntervalHrs int               `json:"update_check_interval_hours"`
+	SpoolMaxFiles          int               `json:"spool_max_files"`
+	SpoolMaxMB             int               `json:"spool_max_mb"`
+	IngestPath             string            `json:"ingest_path"`
+	RequestHeaders         map[string]string `json:"request_headers"`
+	UploadMode             string            `json:"upload_mode"` // "direct" or "presigned"
+	UploadMinKBps          int               `json:"upload_min_kbps"`
+	DailyUploadMaxFiles    int               `json:"daily_upload_max_files"` // 0 = unlimited
+	DailyUploadMaxMB       int               `json:"daily_upload_max_mb"`    // 0 = unlimited
+	ProviderTags           []ProviderTag     `json:"provider_tags"`
+	SymlinkPolicy          string            `json:"symlink_policy"` // "follow" or "skip"
+	ScanParallelism        int               `json:"scan_parallelism"`
+	FullRescanHours        int               `json:"full_rescan_hours"`  // 0 = every scan is full
+	ChecksumAlgorithm      string            `json:"checksum_algorithm"` // "sha256" or "blake3"
+	MaxResponseKB          int               `json:"max_response_kb"`    // upload API response size cap
+	GzipUploadMode         string            `json:"gzip_upload_mode"`   // "compressed" or "decompress"
+	QuiescenceSeconds      int               `json:"quiescence_seconds"` // 0 = pick up files still being written
+	SniffMaxKB             int               `json:"sniff_max_kb"`       // 0 = include files by pattern only
+	SniffLines             int               `json:"sniff_lines"`        // lines probed when sniffing
+	NetworkFSPolicy        string            `json:"network_fs_policy"`  // "limit", "skip", or "scan"
+	NetworkFSMaxDepth      int               `json:"network_fs_max_depth"`
+	NetworkFSMaxSeconds    int               `json:"network_fs_max_seconds"`
+	Prioritization         string            `json:"prioritization"` // "oldest", "newest", "largest", "smallest", or "weighted"
+	MatchRotated           bool              `json:"match_rotated"`  // also match usage.jsonl.1, usage.jsonl.2.gz
+	PatternCase            string            `json:"pattern_case"`   // "auto", "sensitive", or "insensitive"
+	AllDrives              bool              `json:"all_drives"`     // Windows: repeat paths like \logs on every fixed drive
+
+	ValidationSchema          *ValidationSchema `json:"validation_schema,omitempty"`  // replaces the built-in record rules; nil keeps them
+	CSVColumns                map[string]string `json:"csv_columns,omitempty"`        // CSV header to record field, e.g. {"Date": "timestamp"}
+	SanitizeInvalidLines      bool              `json:"sanitize_invalid_lines"`       // upload a copy of partly invalid files holding only valid lines
+	TimestampSkewMinutes      int               `json:"timestamp_skew_minutes"`       // max minutes in the future; 0 = no check
+	TimestampHorizonDays      int               `json:"timestamp_horizon_days"`       // max days in the past; 0 = no check
+	MaxLineKB                 int               `json:"max_line_kb"`                  // longer lines are invalid; 0 = 1024
+	AllowedServices           []string          `json:"allowed_services,omitempty"`   // if set, other services are invalid; ignores case
+	BlockedServices           []string          `json:"blocked_services,omitempty"`   // invalid services, e.g. "mock"; ignores case
+	MaxConcurrentValidations  int               `json:"max_concurrent_validations"`   // 0 = one per CPU
+	ValidationTelemetry       bool              `json:"validation_telemetry"`         // report invalid record counts by kind in heartbeats
+	RequiredFields            []string          `json:"required_fields,omitempty"`    // replaces the schema's required fields
+	NegativeCacheReprobeHours int               `json:"negative_cache_reprobe_hours"` // re-probe empty learned dirs; 0 = 24
+	NegativeCacheTTLDays      int               `json:"negative_cache_ttl_days"`      // forget empty learned dirs; 0 = 7
+	MaxLearnedDirectories     int               `json:"max_learned_directories"`      // lowest-scoring dropped first; 0 = 10000
+	FocusedScanMinutes        int               `json:"focused_scan_minutes"`         // scan dirs busy at this hour in between; 0 = off
+	LearningSyncHours         int               `json:"learning_sync_hours"`          // share learning with the server; 0 (default) = off
+	SuccessRateHalfLifeScans  int               `json:"success_rate_half_life_scans"` // 0 = 24
+	LearningPruneDays         int               `json:"learning_prune_days"`          // drop dirs idle this long; 0 = 30
+	QuarantineDays            int               `json:"quarantine_days"`              // hold uploaded files this long; 0 = delete at once
+	QuarantineMaxMB           int               `json:"quarantine_max_mb"`            // 0 = unlimited
+	ArchiveDays               int               `json:"archive_days"`                 // keep daily archives of uploads; 0 = off
+	ArchiveMaxMB              int               `json:"archive_max_mb"`               // 0 = unlimited
+	SecureDelete              bool              `json:"secure_delete"`                // overwrite files before deleting them
+	PostUploadAction          string            `json:"post_upload_action"`           // "delete", "truncate", "move_to", "keep", or "mark"; "" = delete
+	PostUploadMoveTo          string            `json:"post_upload_move_to,omitempty"`
+}
+
+// Checksum algorithms the client can compute for uploaded files.
+const (
+	ChecksumSHA256 = "sha256"
+	ChecksumBLAKE3 = "blake3"
+)
+
+// SupportedChecksums returns the checksum algorithms the client supports,
+// default first. Advertised to the server, which picks one via ChecksumAlgorithm.
+func SupportedChecksums() []string {
+	return []string{ChecksumSHA256, ChecksumBLAKE3}
+}
+
+// ProviderTag maps files or records to the tool that wrote them. Records
+// without a service field that match the mapping get Service (and Model, if
+// set and the record has none) filled in before validation.
+type ProviderTag struct {
+	PathPattern  string `json:"path_pattern,omitempty"`  // doublestar glob on the file path
+	ContentMatch string `json:"content_match,omitempty"` // substring of the raw record line
+	Service      string `json:"service"`
+	Model        string `json:"model,omitempty"`
 }
 
 // DiscoveryPaths holds per-platform discovery paths.
 type DiscoveryPaths struct {
-	Linux   []string `json:"linux"`
-	Windows []string `json:"windows"`
-	Darwin  []string `json:"darwin"`
+	Linux   []DiscoveryPath `json:"linux"`
+	Windows []DiscoveryPath `json:"windows"`
+	Darwin  []DiscoveryPath `json:"darwin"`
+}
+
+// DiscoveryPath is a path to scan, optionally with its own depth and
+// patterns in place of the global ones. In JSON it is either a plain path
+// string or an object with a "path" field.
+type DiscoveryPath struct {
+	Path            string   `json:"path"`
+	MaxDepth        int      `json:"max_depth,omitempty"`
+	FilePatterns    []string `json:"file_patterns,omitempty"`
+	ExcludePatterns []string `json:"exclude_patterns,omitempty"`
+}
+
+// PlainPaths converts path strings to DiscoveryPaths without overrides.
+func PlainPaths(paths ...string) []DiscoveryPath {
+	out := make([]DiscoveryPath, len(paths))
+	for i, p := range paths {
+		out[i] = DiscoveryPath{Path: p}
+	}
+	return out
+}
+
+// HasOverrides reports whether the path sets any of its own scan settings.
+func (p DiscoveryPath) HasOverrides() bool {
+	return p.MaxDepth > 0 || len(p.FilePatterns) > 0 || len(p.ExcludePatterns) > 0
+}
+
+// UnmarshalJSON accepts a plain path string or an object.
+func (p *DiscoveryPath) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*p = DiscoveryPath{Path: path}
+		return nil
+	}
+	type plain DiscoveryPath
+	var obj plain
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("discovery path must be a string or object: %w", err)
+	}
+	if obj.Path == "" {
+		return fmt.Errorf("discovery path object missing \"path\"")
+	}
+	*p = DiscoveryPath(obj)
+	return nil
+}
+
+// MarshalJSON writes a plain string when the path has no overrides, so
+// configs round-trip in the form the server sent.
+func (p DiscoveryPath) MarshalJSON() ([]byte, error) {
+	if !p.HasOverrides() {
+		return json.Marshal(p.Path)
+	}
+	type plain DiscoveryPath
+	return json.Marshal(plain(p))
 }
 
 // DefaultConfig returns a sensible default configuration used before the server provides one.
 func DefaultConfig() ClientConfig {
 	return ClientConfig{
-		ScanEnabled:            true,
-		ScanIntervalMinutes:    60,
-		MaxFileAgeHours:        24,
-		MaxFileSizeMB:          10,
-		WorkerTimeoutSeconds:   30,
-		MaxConcurrentUploads:   3,
+		ScanEnabled:          true,
+		ScanIntervalMinutes:  60,
+		MaxFileAgeHours:      24,
+		MaxFileSizeMB:        10,
+		WorkerTimeoutSeconds: 30,
+		MaxConcurrentUploads: 3,
 		DiscoveryPaths: DiscoveryPaths{
-			Linux:   []string{"/var/log", "/opt/*/logs", "/home/*/logs"},
-			Windows: []string{"%APPDATA%/logs", "%PROGRAMDATA%/logs"},
-			Darwin:  []string{"/var/log", "/usr/local/var/log"},
+			Linux:   PlainPaths("/var/log", "/opt/*/logs", "/home/*/logs"),
+			Windows: PlainPaths("%APPDATA%/logs", "%PROGRAMDATA%/logs"),
+			Darwin: append(PlainPaths("/var/log", "/usr/local/var/log"),
+				// Sandboxed apps write inside their container; others under
+				// Application Support. Both are wide, so stay shallow.
+				DiscoveryPath{Path: "~/Library/Containers/*/Data/Library/Logs", MaxDepth: 3},
+				DiscoveryPath{Path: "~/Library/Containers/*/Data/Library/Application Support", MaxDepth: 3},
+				DiscoveryPath{Path: "~/Library/Application Support/*", MaxDepth: 3},
+			),
 		},
 		FilePatterns:           []string{"*.jsonl", "*token*.log", "*usage*.log"},
 		ExcludePatterns:        []string{"*temp*", "*cache*", "*backup*"},
 		HeartbeatIntervalSecs:  3600,
 		RetryFailedUploads:     true,
 		RetryDelaySeconds:      300,
+		RetryMaxAttempts:       3,
 		LogLevel:               "info",
 		UpdateEnabled:          true,
 		UpdateCheckIntervalHrs: 24,
+		SpoolMaxFiles:          500,
+		SpoolMaxMB:             100,
+		IngestPath:             "/api/ingest",
+		UploadMode:             "direct",
+		UploadMinKBps:          32,
+		SymlinkPolicy:          "follow",
+		ScanParallelism:        4,
+		FullRescanHours:        24,
+		ChecksumAlgorithm:      ChecksumSHA256,
+		MaxResponseKB:          64,
+		GzipUploadMode:         "decompress",
+		QuiescenceSeconds:      60,
+		SniffLines:             5,
+		NetworkFSPolicy:        "limit",
+		NetworkFSMaxDepth:      3,
+		NetworkFSMaxSeconds:    60,
+		Prioritization:         "oldest",
+		PatternCase:            "auto",
+		TimestampSkewMinutes:   60,
+		MaxLineKB:              1024,
+
+		NegativeCacheReprobeHours: 24,
+		NegativeCacheTTLDays:      7,
+		MaxLearnedDirectories:     10000,
+		FocusedScanMinutes:        15,
+		SuccessRateHalfLifeScans:  24,
+		LearningPruneDays:         30,
+
+		PostUploadAction: "delete",
+		ProviderTags: []ProviderTag{
+			{PathPattern: "**/.claude/**", Service: "anthropic"},
+			{PathPattern: "**/.codex/**", Service: "openai"},
+		},
 	}
 }
@@ -19,14 +19,52 @@ func TestDefaultConfig(t *testing.T) {
 	assert.NotEmpty(t, cfg.DiscoveryPaths.Linux)
 	assert.NotEmpty(t, cfg.DiscoveryPaths.Windows)
 	assert.NotEmpty(t, cfg.DiscoveryPaths.Darwin)
+	var darwin []string
+	for _, dp := range cfg.DiscoveryPaths.Darwin {
+		darwin = append(darwin, dp.Path)
+	}
+	assert.Contains(t, darwin, "~/Library/Containers/*/Data/Library/Logs")
+	assert.Contains(t, darwin, "~/Library/Application Support/*")
 	assert.NotEmpty(t, cfg.FilePatterns)
+	assert.NotContains(t, cfg.FilePatterns, "*usage*.csv", "CSV pickup is opt-in")
+	assert.Zero(t, cfg.LearningSyncHours, "learning sync is opt-in")
 	assert.NotEmpty(t, cfg.ExcludePatterns)
 	assert.Equal(t, 3600, cfg.HeartbeatIntervalSecs)
 	assert.True(t, cfg.RetryFailedUploads)
 	assert.Equal(t, 300, cfg.RetryDelaySeconds)
+	assert.Equal(t, 3, cfg.RetryMaxAttempts)
 	assert.Equal(t, "info", cfg.LogLevel)
 	assert.True(t, cfg.UpdateEnabled)
 	assert.Equal(t, 24, cfg.UpdateCheckIntervalHrs)
+	assert.Equal(t, 500, cfg.SpoolMaxFiles)
+	assert.Equal(t, 100, cfg.SpoolMaxMB)
+	assert.Equal(t, "/api/ingest", cfg.IngestPath)
+	assert.Equal(t, "follow", cfg.SymlinkPolicy)
+	assert.Equal(t, 4, cfg.ScanParallelism)
+	assert.Equal(t, 24, cfg.FullRescanHours)
+	assert.Equal(t, ChecksumSHA256, cfg.ChecksumAlgorithm)
+	assert.Equal(t, 64, cfg.MaxResponseKB)
+	assert.Equal(t, "decompress", cfg.GzipUploadMode)
+	assert.Equal(t, 60, cfg.QuiescenceSeconds)
+	assert.Zero(t, cfg.SniffMaxKB)
+	assert.Equal(t, 5, cfg.SniffLines)
+	assert.Equal(t, "limit", cfg.NetworkFSPolicy)
+	assert.Equal(t, 3, cfg.NetworkFSMaxDepth)
+	assert.Equal(t, 60, cfg.NetworkFSMaxSeconds)
+	assert.Equal(t, "oldest", cfg.Prioritization)
+	assert.False(t, cfg.MatchRotated)
+	assert.Equal(t, "auto", cfg.PatternCase)
+	assert.False(t, cfg.AllDrives)
+	assert.Equal(t, 60, cfg.TimestampSkewMinutes)
+	assert.Zero(t, cfg.TimestampHorizonDays)
+	assert.Equal(t, 1024, cfg.MaxLineKB)
+	assert.Zero(t, cfg.MaxConcurrentValidations, "one per CPU")
+	assert.Equal(t, ChecksumSHA256, SupportedChecksums()[0])
+	require.NotEmpty(t, cfg.ProviderTags)
+	assert.Equal(t, "anthropic", cfg.ProviderTags[0].Service)
+	assert.Equal(t, "direct", cfg.UploadMode)
+	assert.Equal(t, 32, cfg.UploadMinKBps)
+	assert.Equal(t, "delete", cfg.PostUploadAction)
 }
 
 func TestConfigJSONRoundTrip(t *testing.T) {
@@ -70,5 +108,43 @@ func TestConfigMatchesServerSchema(t *testing.T) {
 	assert.True(t, cfg.ScanEnabled)
 	assert.Equal(t, 60, cfg.ScanIntervalMinutes)
 	assert.Equal(t, 3600, cfg.HeartbeatIntervalSecs)
-	assert.Equal(t, []string{"/var/log"}, cfg.DiscoveryPaths.Linux)
+	assert.Equal(t, PlainPaths("/var/log"), cfg.DiscoveryPaths.Linux)
+}
+
+func TestDiscoveryPath_StringOrObject(t *testing.T) {
+	var dp DiscoveryPaths
+	err := json.Unmarshal([]byte(`{
+		"linux": ["/var/log", {"path": "/opt/*/logs", "max_depth": 2, "file_patterns": ["*.jsonl"]}]
+	}`), &dp)
+	require.NoError(t, err)
+	require.Len(t, dp.Linux, 2)
+	assert.Equal(t, DiscoveryPath{Path: "/var/log"}, dp.Linux[0])
+	assert.Equal(t, "/opt/*/logs", dp.Linux[1].Path)
+	assert.Equal(t, 2, dp.Linux[1].MaxDepth)
+	assert.Equal(t, []string{"*.jsonl"}, dp.Linux[1].FilePatterns)
+
+	out, err := json.Marshal(dp.Linux)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["/var/log", {"path": "/opt/*/logs", "max_depth": 2, "file_patterns": ["*.jsonl"]}]`, string(out))
+}
+
+func TestDiscoveryPath_ObjectWithoutPath(t *testing.T) {
+	var p DiscoveryPath
+	assert.Error(t, json.Unmarshal([]byte(`{"max_depth": 2}`), &p))
+	assert.Error(t, json.Unmarshal([]byte(`42`), &p))
+}
+
+func TestServiceFiltersFromServer(t *testing.T) {
+	var cfg ClientConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"allowed_services":["openai"],"blocked_services":["mock"]}`), &cfg))
+	assert.Equal(t, []string{"openai"}, cfg.AllowedServices)
+	assert.Equal(t, []string{"mock"}, cfg.BlockedServices)
+	assert.Nil(t, DefaultConfig().AllowedServices, "every service is collected by default")
+}
+
+func TestRequiredFieldsFromServer(t *testing.T) {
+	var cfg ClientConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"required_fields":["timestamp","service"]}`), &cfg))
+	assert.Equal(t, []string{"timestamp", "service"}, cfg.RequiredFields)
+	assert.Nil(t, DefaultConfig().RequiredFields, "the schema decides by default")
 }
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// NormalizeServerURL validates a server URL and returns it in canonical form:
+// lowercase scheme, no trailing slash, no query or fragment. A URL without a
+// scheme is taken to be https, and a bare IPv6 address is bracketed. Base
+// paths such as https://host/tokenly are kept so API paths join beneath them.
+func NormalizeServerURL(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	if s == "" {
+		return "", fmt.Errorf("server URL is empty")
+	}
+
+	if !strings.Contains(s, "://") {
+		if ip := net.ParseIP(s); ip != nil && ip.To4() == nil {
+			s = "[" + s + "]"
+		}
+		s = "https://" + s
+	}
+
+	// url.Parse reports an unbracketed IPv6 host as a bad port; say what
+	// is actually wrong.
+	authority := s[strings.Index(s, "://")+3:]
+	if i := strings.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+	if strings.Count(authority, ":") > 1 && !strings.Contains(authority, "[") {
+		return "", fmt.Errorf("server URL %q: IPv6 addresses must be in brackets, e.g. http://[::1]:8080", raw)
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", fmt.Errorf("parse server URL: %w", err)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("server URL %q has no host", raw)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("server URL %q must not include a query or fragment", raw)
+	}
+
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// ErrResponseTooLarge is returned by ReadLimited when a response body exceeds
+// its cap. Callers treat it as a protocol error.
+var ErrResponseTooLarge = errors.New("response body too large")
+
+// ReadLimited reads a response body of at most max bytes. A larger body is
+// not read further and yields ErrResponseTooLarge.
+func ReadLimited(r io.Reader, max int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return data, err
+	}
+	if int64(len(data)) > max {
+		return data[:max], fmt.Errorf("%w: exceeds %d bytes", ErrResponseTooLarge, max)
+	}
+	return data, nil
+}
+
+// JoinURL appends an API path to a server URL, keeping any base path and
+// producing exactly one slash between them.
+func JoinURL(base, path string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.TrimLeft(path, "/")
+}
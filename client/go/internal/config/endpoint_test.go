@@ -0,0 +1,64 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeServerURL(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"https://tokenly.example.com", "https://tokenly.example.com"},
+		{"https://tokenly.example.com/", "https://tokenly.example.com"},
+		{"  HTTPS://host:8443/tokenly/  ", "https://host:8443/tokenly"},
+		{"http://[::1]:8080/", "http://[::1]:8080"},
+		{"http://[fe80::1%25en0]:8080", "http://[fe80::1%25en0]:8080"},
+		{"http://192.168.1.10:8080", "http://192.168.1.10:8080"},
+		{"tokenly.example.com", "https://tokenly.example.com"},
+		{"host:8080/base", "https://host:8080/base"},
+		{"::1", "https://[::1]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := NormalizeServerURL(tt.in)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalizeServerURL_Errors(t *testing.T) {
+	for _, in := range []string{"", "http://", "http://::1:8080", "https://host/?x=1", "https://host/#frag"} {
+		t.Run(in, func(t *testing.T) {
+			_, err := NormalizeServerURL(in)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := NormalizeServerURL("http://fe80::1:8080")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "brackets")
+}
+
+func TestJoinURL(t *testing.T) {
+	assert.Equal(t, "https://host/api/ingest", JoinURL("https://host", "/api/ingest"))
+	assert.Equal(t, "https://host/api/ingest", JoinURL("https://host/", "/api/ingest"))
+	assert.Equal(t, "https://host/tokenly/api/heartbeat", JoinURL("https://host/tokenly/", "api/heartbeat"))
+	assert.Equal(t, "http://[::1]:8080/api/ingest", JoinURL("http://[::1]:8080", "/api/ingest"))
+}
+
+func TestReadLimited(t *testing.T) {
+	data, err := ReadLimited(strings.NewReader("hello"), 5)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+
+	_, err = ReadLimited(strings.NewReader("hello!"), 5)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrResponseTooLarge))
+	assert.Contains(t, err.Error(), "exceeds 5 bytes")
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvPrefix prefixes the environment variables that stand in for flags.
+const EnvPrefix = "TOKENLY_"
+
+// EnvName returns the environment variable that stands in for the named
+// flag: --log-level is TOKENLY_LOG_LEVEL.
+func EnvName(flagName string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// ApplyEnv sets the flags in fs not given on the command line from their
+// environment variables, so containers can be configured through the
+// environment alone. Empty variables are ignored, as are the flags in skip.
+func ApplyEnv(fs *flag.FlagSet, skip ...string) error {
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	for _, name := range skip {
+		set[name] = true
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || set[f.Name] {
+			return
+		}
+		env := EnvName(f.Name)
+		val := os.Getenv(env)
+		if val == "" {
+			return
+		}
+		if serr := fs.Set(f.Name, val); serr != nil {
+			err = fmt.Errorf("%s: %w", env, serr)
+		}
+	})
+	return err
+}
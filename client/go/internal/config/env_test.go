@@ -0,0 +1,53 @@
+package config
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "TOKENLY_SERVER", EnvName("server"))
+	assert.Equal(t, "TOKENLY_LOG_LEVEL", EnvName("log-level"))
+	assert.Equal(t, "TOKENLY_STATE_PATH", EnvName("state-path"))
+}
+
+func TestApplyEnv(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	server := fs.String("server", "", "")
+	logLevel := fs.String("log-level", "info", "")
+	hostname := fs.String("hostname", "", "")
+	once := fs.Bool("once", false, "")
+	version := fs.Bool("version", false, "")
+
+	t.Setenv("TOKENLY_SERVER", "https://env.example.com")
+	t.Setenv("TOKENLY_LOG_LEVEL", "debug")
+	t.Setenv("TOKENLY_HOSTNAME", "")
+	t.Setenv("TOKENLY_ONCE", "true")
+	t.Setenv("TOKENLY_VERSION", "1.2.3")
+
+	require.NoError(t, fs.Parse([]string{"--log-level", "warn"}))
+	require.NoError(t, ApplyEnv(fs, "version"))
+
+	assert.Equal(t, "https://env.example.com", *server)
+	assert.Equal(t, "warn", *logLevel, "flags win over the environment")
+	assert.Equal(t, "", *hostname, "empty variables are ignored")
+	assert.True(t, *once)
+	assert.False(t, *version, "skipped flags are not read from the environment")
+
+	// Variables set this way count as given, e.g. for config-file merging.
+	given := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	assert.True(t, given["server"])
+}
+
+func TestApplyEnv_InvalidValue(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.Int("max-response-kb", 1024, "")
+	t.Setenv("TOKENLY_MAX_RESPONSE_KB", "lots")
+
+	require.NoError(t, fs.Parse(nil))
+	assert.ErrorContains(t, ApplyEnv(fs), "TOKENLY_MAX_RESPONSE_KB")
+}
@@ -0,0 +1,10 @@
+package config
+
+// HealthStatus is the worker's answer to a health probe on its IPC socket.
+// LastProgress is when the worker's main loop last showed signs of life, so
+// a process that is alive but stuck can be told apart from a healthy one.
+type HealthStatus struct {
+	PID          int    `json:"pid"`
+	State        string `json:"state"`
+	LastProgress string `json:"last_progress"` // RFC3339
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// IndexedDir is a directory as seen by the last scan that read it.
+type IndexedDir struct {
+	ModTime time.Time              `json:"mod_time"`
+	Subdirs []string               `json:"subdirs,omitempty"` // names of subdirectories walked
+	Files   map[string]IndexedFile `json:"files,omitempty"`   // matching files by name
+
+	HasIgnore bool `json:"has_ignore,omitempty"` // holds a .tokenlyignore file
+}
+
+// IndexedFile is a file as seen by the last scan that read its directory.
+type IndexedFile struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Done    bool      `json:"done,omitempty"`    // processed and kept; skip while unchanged
+	Sniffed bool      `json:"sniffed,omitempty"` // matched by content, not by file pattern
+}
+
+// ScanIndexFile is the persisted directory index used for incremental scans.
+type ScanIndexFile struct {
+	Directories  map[string]*IndexedDir `json:"directories"`
+	LastFullScan string                 `json:"last_full_scan,omitempty"`
+}
+
+// NewScanIndexFile returns a new empty ScanIndexFile.
+func NewScanIndexFile() *ScanIndexFile {
+	return &ScanIndexFile{Directories: make(map[string]*IndexedDir)}
+}
+
+// LoadScanIndex reads and parses the scan index from the given path.
+// Returns a new empty ScanIndexFile if the file does not exist.
+func LoadScanIndex(path string) (*ScanIndexFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewScanIndexFile(), nil
+		}
+		return nil, fmt.Errorf("read scan index: %w", err)
+	}
+
+	var idx ScanIndexFile
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parse scan index: %w: %w", ErrCacheCorrupt, err)
+	}
+	if idx.Directories == nil {
+		idx.Directories = make(map[string]*IndexedDir)
+	}
+	return &idx, nil
+}
+
+// Save writes the scan index to the given path atomically (temp file + rename).
+func (idx *ScanIndexFile) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("marshal scan index: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create scan index dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp scan index: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename scan index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanIndexRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+
+	idx := NewScanIndexFile()
+	idx.LastFullScan = "2026-03-01T12:00:00Z"
+	idx.Directories["/var/log/app"] = &IndexedDir{
+		ModTime: mtime,
+		Subdirs: []string{"old"},
+		Files:   map[string]IndexedFile{"usage.jsonl": {Size: 42, ModTime: mtime, Done: true}},
+	}
+	require.NoError(t, idx.Save(path))
+
+	loaded, err := LoadScanIndex(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-01T12:00:00Z", loaded.LastFullScan)
+	dir := loaded.Directories["/var/log/app"]
+	require.NotNil(t, dir)
+	assert.True(t, dir.ModTime.Equal(mtime), "mod times keep nanosecond precision")
+	assert.Equal(t, []string{"old"}, dir.Subdirs)
+	assert.True(t, dir.Files["usage.jsonl"].Done)
+}
+
+func TestLoadScanIndexMissingFile(t *testing.T) {
+	idx, err := LoadScanIndex(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.NotNil(t, idx.Directories)
+	assert.Empty(t, idx.Directories)
+}
+
+func TestLoadScanIndexInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+	_, err := LoadScanIndex(path)
+	assert.ErrorIs(t, err, ErrCacheCorrupt)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -15,6 +16,26 @@ type DirectoryStats struct {
 	LastSuccess    string  `json:"last_success,omitempty"`
 	SuccessRate    float64 `json:"success_rate"`
 	AvgFilesPerScan float64 `json:"avg_files_per_scan"`
+
+	// HourlyYield counts files found by the local hour of day they were
+	// found in, 24 entries from midnight.
+	HourlyYield []int `json:"hourly_yield,omitempty"`
+
+	// BytesFound totals the sizes of the files found, and AvgFileSize is
+	// their average size in bytes.
+	BytesFound  int64   `json:"bytes_found,omitempty"`
+	AvgFileSize float64 `json:"avg_file_size,omitempty"`
+
+	// FilesUploaded and FilesRejected count the directory's files the server
+	// accepted and rejected.
+	FilesUploaded int `json:"files_uploaded,omitempty"`
+	FilesRejected int `json:"files_rejected,omitempty"`
+
+	// LastFailure is why the directory's last scan found no files:
+	// "permission_denied", "excluded", or "empty". It is cleared when files
+	// are found. Failures counts such scans by reason.
+	LastFailure string         `json:"last_failure,omitempty"`
+	Failures    map[string]int `json:"failures,omitempty"`
 }
 
 // LearningFile represents persisted learning data (spec 02, section "Learning Data Model").
@@ -22,6 +43,32 @@ type LearningFile struct {
 	Directories   map[string]*DirectoryStats `json:"directories"`
 	NegativeCache []string                   `json:"negative_cache"`
 	LastUpdated   string                     `json:"last_updated"`
+
+	// NegativeCacheTimes records when each NegativeCache entry was added and
+	// last re-probed. Entries from older files have none.
+	NegativeCacheTimes map[string]*NegativeCacheEntry `json:"negative_cache_times,omitempty"`
+
+	// Patterns counts, for each directory tree walked, how each file pattern
+	// has fared there, keyed by tree root and then by pattern.
+	Patterns map[string]map[string]*PatternStats `json:"patterns,omitempty"`
+}
+
+// PatternStats counts the scans of a tree made while a file pattern was
+// configured for it, and the files it matched there.
+type PatternStats struct {
+	Scans int `json:"scans"`
+	Files int `json:"files"`
+}
+
+// NegativeCacheEntry holds the times, in RFC 3339, of a negative-cached
+// directory.
+type NegativeCacheEntry struct {
+	CachedAt   string `json:"cached_at"`
+	LastProbed string `json:"last_probed,omitempty"`
+
+	// Subtree caches the whole tree under the directory, so scans walking
+	// into it skip its descendants.
+	Subtree bool `json:"subtree,omitempty"`
 }
 
 // NewLearningFile returns a new empty LearningFile.
@@ -29,11 +76,29 @@ func NewLearningFile() *LearningFile {
 	return &LearningFile{
 		Directories:   make(map[string]*DirectoryStats),
 		NegativeCache: []string{},
+
+		NegativeCacheTimes: make(map[string]*NegativeCacheEntry),
+		Patterns:           make(map[string]map[string]*PatternStats),
 	}
 }
 
+// ErrLearningCorrupt is returned by LoadLearning when the learning file
+// cannot be parsed, e.g. after being truncated.
+var ErrLearningCorrupt = errors.New("learning data corrupt")
+
+// ErrCacheCorrupt is returned, wrapped, by the loaders of files the worker
+// can rebuild, such as the retry spool, when they cannot be parsed.
+var ErrCacheCorrupt = errors.New("cache file corrupt")
+
+// LearningBackupPath returns the path Save keeps the previous learning file
+// at.
+func LearningBackupPath(path string) string {
+	return path + ".bak"
+}
+
 // LoadLearning reads and parses the learning file from the given path.
-// Returns a new empty LearningFile if the file does not exist.
+// Returns a new empty LearningFile if the file does not exist, and an error
+// wrapping ErrLearningCorrupt if it cannot be parsed.
 func LoadLearning(path string) (*LearningFile, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
@@ -45,7 +110,7 @@ func LoadLearning(path string) (*LearningFile, error) {
 
 	var lf LearningFile
 	if err := json.Unmarshal(data, &lf); err != nil {
-		return nil, fmt.Errorf("parse learning file: %w", err)
+		return nil, fmt.Errorf("parse learning file: %w: %w", ErrLearningCorrupt, err)
 	}
 	if lf.Directories == nil {
 		lf.Directories = make(map[string]*DirectoryStats)
@@ -53,10 +118,17 @@ func LoadLearning(path string) (*LearningFile, error) {
 	if lf.NegativeCache == nil {
 		lf.NegativeCache = []string{}
 	}
+	if lf.NegativeCacheTimes == nil {
+		lf.NegativeCacheTimes = make(map[string]*NegativeCacheEntry)
+	}
+	if lf.Patterns == nil {
+		lf.Patterns = make(map[string]map[string]*PatternStats)
+	}
 	return &lf, nil
 }
 
-// Save writes the learning file to the given path atomically (temp file + rename).
+// Save writes the learning file to the given path atomically (temp file +
+// rename), first moving the previous file to LearningBackupPath.
 func (lf *LearningFile) Save(path string) error {
 	data, err := json.MarshalIndent(lf, "", "  ")
 	if err != nil {
@@ -73,6 +145,10 @@ func (lf *LearningFile) Save(path string) error {
 		return fmt.Errorf("write temp learning file: %w", err)
 	}
 
+	if err := os.Rename(path, LearningBackupPath(path)); err != nil && !os.IsNotExist(err) {
+		os.Remove(tmp)
+		return fmt.Errorf("back up learning file: %w", err)
+	}
 	if err := os.Rename(tmp, path); err != nil {
 		os.Remove(tmp)
 		return fmt.Errorf("rename learning file: %w", err)
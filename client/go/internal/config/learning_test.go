@@ -59,6 +59,7 @@ func TestLoadLearningInvalidJSON(t *testing.T) {
 	_, err = LoadLearning(path)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "parse learning file")
+	assert.ErrorIs(t, err, ErrLearningCorrupt)
 }
 
 func TestLoadLearningNilFields(t *testing.T) {
@@ -92,3 +93,37 @@ func TestLearningSaveAtomicity(t *testing.T) {
 	_, err = os.Stat(path + ".tmp")
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestLearningSaveKeepsBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "learning.json")
+
+	lf := NewLearningFile()
+	lf.LastUpdated = "2026-01-01T00:00:00Z"
+	require.NoError(t, lf.Save(path))
+	_, err := os.Stat(LearningBackupPath(path))
+	assert.True(t, os.IsNotExist(err), "nothing to back up on the first save")
+
+	lf.LastUpdated = "2026-01-02T00:00:00Z"
+	require.NoError(t, lf.Save(path))
+	backup, err := LoadLearning(LearningBackupPath(path))
+	require.NoError(t, err)
+	assert.Equal(t, "2026-01-01T00:00:00Z", backup.LastUpdated)
+}
+
+func TestLearningFileNegativeCacheTimes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "learning.json")
+	lf := NewLearningFile()
+	lf.NegativeCache = []string{"/tmp/logs"}
+	lf.NegativeCacheTimes["/tmp/logs"] = &NegativeCacheEntry{CachedAt: "2026-02-09T09:00:00Z"}
+	require.NoError(t, lf.Save(path))
+
+	loaded, err := LoadLearning(path)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-02-09T09:00:00Z", loaded.NegativeCacheTimes["/tmp/logs"].CachedAt)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"negative_cache":["/tmp/logs"]}`), 0644))
+	loaded, err = LoadLearning(path)
+	require.NoError(t, err)
+	assert.NotNil(t, loaded.NegativeCacheTimes)
+	assert.Empty(t, loaded.NegativeCacheTimes)
+}
@@ -0,0 +1,64 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+)
+
+// NetworkOptions are local proxy and TLS settings for talking to the server.
+// They come from the launcher's config file and reach the worker through the
+// state file.
+type NetworkOptions struct {
+	Proxy              string `json:"proxy,omitempty"`     // proxy URL; empty uses HTTPS_PROXY and friends
+	CAFile             string `json:"ca_file,omitempty"`   // PEM bundle trusted in addition to the system roots
+	CertFile           string `json:"cert_file,omitempty"` // client certificate for mutual TLS
+	KeyFile            string `json:"key_file,omitempty"`  // key of CertFile
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+}
+
+// HTTPTransport builds an HTTP transport honoring o. A nil o yields the
+// default transport's settings.
+func (o *NetworkOptions) HTTPTransport() (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if o == nil {
+		return t, nil
+	}
+
+	if o.Proxy != "" {
+		proxy, err := url.Parse(o.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", o.Proxy)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if o.CAFile != "" {
+		pem, err := os.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", o.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if o.CertFile != "" || o.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	tlsConfig.InsecureSkipVerify = o.InsecureSkipVerify
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
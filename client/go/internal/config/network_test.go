@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkOptions_NilUsesDefaults(t *testing.T) {
+	var o *NetworkOptions
+	tr, err := o.HTTPTransport()
+	require.NoError(t, err)
+	assert.NotNil(t, tr.Proxy)
+	if tr.TLSClientConfig != nil {
+		assert.Nil(t, tr.TLSClientConfig.RootCAs)
+		assert.False(t, tr.TLSClientConfig.InsecureSkipVerify)
+	}
+}
+
+func TestNetworkOptions_Proxy(t *testing.T) {
+	o := &NetworkOptions{Proxy: "http://proxy.internal:3128"}
+	tr, err := o.HTTPTransport()
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest(http.MethodGet, "https://tokenly.example.com/api/heartbeat", nil)
+	proxy, err := tr.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, &url.URL{Scheme: "http", Host: "proxy.internal:3128"}, proxy)
+
+	_, err = (&NetworkOptions{Proxy: "not a url"}).HTTPTransport()
+	assert.ErrorContains(t, err, "invalid proxy URL")
+}
+
+func TestNetworkOptions_CAFile(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // the untrusted attempt logs a handshake error
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	cert := srv.Certificate()
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0644))
+
+	// Without the CA the server's certificate isn't trusted.
+	tr, err := (&NetworkOptions{}).HTTPTransport()
+	require.NoError(t, err)
+	_, err = (&http.Client{Transport: tr}).Get(srv.URL)
+	require.Error(t, err)
+
+	tr, err = (&NetworkOptions{CAFile: caFile}).HTTPTransport()
+	require.NoError(t, err)
+	resp, err := (&http.Client{Transport: tr}).Get(srv.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestNetworkOptions_BadFiles(t *testing.T) {
+	dir := t.TempDir()
+	junk := filepath.Join(dir, "junk.pem")
+	require.NoError(t, os.WriteFile(junk, []byte("not a certificate"), 0644))
+
+	_, err := (&NetworkOptions{CAFile: filepath.Join(dir, "missing.pem")}).HTTPTransport()
+	assert.ErrorContains(t, err, "read CA file")
+	_, err = (&NetworkOptions{CAFile: junk}).HTTPTransport()
+	assert.ErrorContains(t, err, "no certificates")
+	_, err = (&NetworkOptions{CertFile: junk, KeyFile: junk}).HTTPTransport()
+	assert.ErrorContains(t, err, "load client certificate")
+}
@@ -0,0 +1,84 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WorkerReport is the worker's self-report, written next to the state file
+// after each cycle so the launcher can include it in heartbeat stats. It is
+// the worker → launcher counterpart of StateFile.
+type WorkerReport struct {
+	WorkerVersion      string `json:"worker_version,omitempty"`
+	UpdatedAt          string `json:"updated_at"`
+	LastScanTime       string `json:"last_scan_time,omitempty"`
+	FilesUploadedToday int    `json:"files_uploaded_today"`
+	BytesUploadedToday int64  `json:"bytes_uploaded_today"`
+	DailyCapReached    bool   `json:"daily_cap_reached"`
+	DiscoveryPaths     int    `json:"discovery_paths"`
+	UnreachablePaths   int    `json:"unreachable_paths"`
+
+	// LastCycleCompleted is when the worker's main loop last finished a
+	// cycle, whatever its outcome. The launcher treats a worker that stops
+	// advancing it as hung.
+	LastCycleCompleted string `json:"last_cycle_completed,omitempty"`
+
+	// Counters from the last scan; see ScanReport for the full breakdown.
+	PermissionDenied int `json:"permission_denied"`
+	FilesTooOld      int `json:"files_too_old"`
+	FilesTooLarge    int `json:"files_too_large"`
+	GlobErrors       int `json:"glob_errors"`
+
+	// Invalid records in the last cycle by kind of failure; only reported
+	// with ClientConfig.ValidationTelemetry.
+	ValidationFailures map[string]int `json:"validation_failures,omitempty"`
+}
+
+// WorkerReportPath returns the report path that pairs with the given state file.
+func WorkerReportPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "tokenly-worker-report.json")
+}
+
+// LoadWorkerReport reads the worker report from the given path.
+// Returns nil and no error if the file does not exist.
+func LoadWorkerReport(path string) (*WorkerReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read worker report: %w", err)
+	}
+
+	var r WorkerReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse worker report: %w", err)
+	}
+	return &r, nil
+}
+
+// Save writes the worker report to the given path atomically (temp file + rename).
+func (r *WorkerReport) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal worker report: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create worker report dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp worker report: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename worker report: %w", err)
+	}
+	return nil
+}
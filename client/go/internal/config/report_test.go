@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkerReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "report.json")
+	r := &WorkerReport{
+		UpdatedAt:          "2026-02-09T09:00:00Z",
+		FilesUploadedToday: 12,
+		BytesUploadedToday: 4096,
+		DailyCapReached:    true,
+	}
+	require.NoError(t, r.Save(path))
+
+	loaded, err := LoadWorkerReport(path)
+	require.NoError(t, err)
+	assert.Equal(t, r, loaded)
+
+	_, err = os.Stat(path + ".tmp")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLoadWorkerReportMissingFile(t *testing.T) {
+	r, err := LoadWorkerReport(filepath.Join(t.TempDir(), "nonexistent.json"))
+	require.NoError(t, err)
+	assert.Nil(t, r)
+}
+
+func TestWorkerReportPath(t *testing.T) {
+	path := WorkerReportPath(filepath.Join("data", "tokenly-state.json"))
+	assert.Equal(t, filepath.Join("data", "tokenly-worker-report.json"), path)
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SanitizedEntry records how much of a file kept in place after a sanitized
+// upload has been sent, so that when it grows only the new lines are.
+type SanitizedEntry struct {
+	Lines      int       `json:"lines"`       // lines of the file covered by uploads
+	LinesHash  string    `json:"lines_hash"`  // SHA-256 of those lines, to tell growth from a rewrite
+	UploadedAt time.Time `json:"uploaded_at"` // when the last part was sent
+}
+
+// SanitizedFile is the persisted upload progress of sanitized files, keyed
+// by file path.
+type SanitizedFile struct {
+	Files map[string]SanitizedEntry `json:"files"`
+}
+
+// NewSanitizedFile returns a new empty SanitizedFile.
+func NewSanitizedFile() *SanitizedFile {
+	return &SanitizedFile{Files: make(map[string]SanitizedEntry)}
+}
+
+// LoadSanitized reads and parses the sanitized upload progress from the given
+// path. Returns a new empty SanitizedFile if the file does not exist, and an
+// error wrapping ErrCacheCorrupt if it cannot be parsed.
+func LoadSanitized(path string) (*SanitizedFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewSanitizedFile(), nil
+		}
+		return nil, fmt.Errorf("read sanitized progress: %w", err)
+	}
+
+	var sf SanitizedFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, fmt.Errorf("parse sanitized progress: %w: %w", ErrCacheCorrupt, err)
+	}
+	if sf.Files == nil {
+		sf.Files = make(map[string]SanitizedEntry)
+	}
+	return &sf, nil
+}
+
+// Save writes the sanitized upload progress to the given path atomically
+// (temp file + rename).
+func (sf *SanitizedFile) Save(path string) error {
+	data, err := json.Marshal(sf)
+	if err != nil {
+		return fmt.Errorf("marshal sanitized progress: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create sanitized progress dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp sanitized progress: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename sanitized progress: %w", err)
+	}
+	return nil
+}
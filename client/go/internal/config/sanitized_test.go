@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizedRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sanitized.json")
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	sf := NewSanitizedFile()
+	sf.Files["/var/log/app/usage.jsonl"] = SanitizedEntry{Lines: 40, LinesHash: "abc", UploadedAt: at}
+	require.NoError(t, sf.Save(path))
+
+	loaded, err := LoadSanitized(path)
+	require.NoError(t, err)
+	entry, ok := loaded.Files["/var/log/app/usage.jsonl"]
+	require.True(t, ok)
+	assert.Equal(t, 40, entry.Lines)
+	assert.Equal(t, "abc", entry.LinesHash)
+	assert.True(t, entry.UploadedAt.Equal(at))
+}
+
+func TestLoadSanitizedMissingOrCorrupt(t *testing.T) {
+	sf, err := LoadSanitized(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, sf.Files)
+
+	path := filepath.Join(t.TempDir(), "sanitized.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+	_, err = LoadSanitized(path)
+	assert.ErrorIs(t, err, ErrCacheCorrupt)
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ScanReport describes the worker's last scan: what it walked and why files
+// and directories were passed over. It is written next to the state file so
+// admins can see why a file was not picked up.
+type ScanReport struct {
+	StartedAt     string `json:"started_at"`
+	DurationMs    int64  `json:"duration_ms"`
+	Candidates    int    `json:"candidates"`
+	DirsWalked    int    `json:"dirs_walked"`     // read from disk
+	DirsFromIndex int    `json:"dirs_from_index"` // unchanged, listed from the scan index
+
+	// NegativeCached counts learned directories skipped because they
+	// repeatedly yielded nothing.
+	NegativeCached int `json:"negative_cached"`
+
+	// Reprobed counts negative-cached directories scanned again this cycle
+	// in case they have started receiving logs.
+	Reprobed int `json:"reprobed,omitempty"`
+
+	// Focused is set for an extra scan of only the directories that are
+	// productive at this time of day.
+	Focused bool `json:"focused,omitempty"`
+
+	// PermissionDenied counts paths that could not be read; the first few
+	// are listed in PermissionErrors.
+	PermissionDenied int      `json:"permission_denied"`
+	PermissionErrors []string `json:"permission_errors,omitempty"`
+
+	// Blocked lists up to 20 learned directories that could not be scanned
+	// this cycle, with why: "permission_denied" or "excluded".
+	Blocked map[string]string `json:"blocked,omitempty"`
+
+	// GlobErrors counts discovery paths whose glob could not be expanded.
+	GlobErrors int `json:"glob_errors,omitempty"`
+
+	// Filtered counts files and directories passed over, by the rule that
+	// filtered them, e.g. "file_pattern" or "max_age".
+	Filtered map[string]int `json:"filtered,omitempty"`
+
+	// PatternHits counts the files whose names matched each file pattern,
+	// whether or not they were then filtered. Patterns missing here matched
+	// nothing.
+	PatternHits map[string]int `json:"pattern_hits,omitempty"`
+}
+
+// ScanReportPath returns the scan report path that pairs with the given state file.
+func ScanReportPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "tokenly-scan-report.json")
+}
+
+// LoadScanReport reads the scan report from the given path.
+// Returns nil and no error if the file does not exist.
+func LoadScanReport(path string) (*ScanReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("read scan report: %w", err)
+	}
+
+	var r ScanReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("parse scan report: %w", err)
+	}
+	return &r, nil
+}
+
+// Save writes the scan report to the given path atomically (temp file + rename).
+func (r *ScanReport) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal scan report: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create scan report dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp scan report: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename scan report: %w", err)
+	}
+	return nil
+}
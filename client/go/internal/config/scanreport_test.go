@@ -0,0 +1,36 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanReportRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "scan-report.json")
+	r := &ScanReport{
+		StartedAt:        "2026-02-09T09:00:00Z",
+		DurationMs:       1500,
+		Candidates:       3,
+		DirsWalked:       10,
+		PermissionDenied: 1,
+		PermissionErrors: []string{"/root"},
+		Filtered:         map[string]int{"file_pattern": 7, "max_age": 2},
+	}
+	require.NoError(t, r.Save(path))
+
+	loaded, err := LoadScanReport(path)
+	require.NoError(t, err)
+	assert.Equal(t, r, loaded)
+
+	missing, err := LoadScanReport(filepath.Join(t.TempDir(), "nonexistent.json"))
+	require.NoError(t, err)
+	assert.Nil(t, missing)
+}
+
+func TestScanReportPath(t *testing.T) {
+	path := ScanReportPath(filepath.Join("data", "tokenly-state.json"))
+	assert.Equal(t, filepath.Join("data", "tokenly-scan-report.json"), path)
+}
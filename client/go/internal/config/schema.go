@@ -0,0 +1,72 @@
+package config
+
+// Field types a ValidationSchema can require.
+const (
+	FieldString    = "string"    // non-empty string
+	FieldNumber    = "number"    // any JSON number
+	FieldInteger   = "integer"   // JSON number without a fraction
+	FieldTimestamp = "timestamp" // RFC 3339 string
+	FieldBool      = "boolean"
+)
+
+// Cross-field checks a ValidationSchema can apply.
+const (
+	CheckSum    = "sum"     // the field equals the sum of the other fields
+	CheckAtMost = "at_most" // the field is at most the sum of the other fields
+)
+
+// ValidationSchema describes what makes a JSONL line a valid token-usage
+// record. The server can send one in ClientConfig to change the rules without
+// a new client release; without one the client uses DefaultValidationSchema.
+type ValidationSchema struct {
+	Fields []FieldRule      `json:"fields"`
+	Checks []CrossFieldRule `json:"checks,omitempty"`
+
+	// Versions holds the rules for records with a schema_version field, by
+	// version number, e.g. "2". Records without the field, or with a version
+	// not listed, get Fields and Checks. Versions of a version are ignored.
+	Versions map[string]*ValidationSchema `json:"versions,omitempty"`
+}
+
+// FieldRule constrains one top-level record field. Fields not listed are
+// ignored. An optional field is only checked when present.
+type FieldRule struct {
+	Name     string   `json:"name"`
+	Type     string   `json:"type"` // one of the Field* types
+	Required bool     `json:"required,omitempty"`
+	Min      *float64 `json:"min,omitempty"` // numeric types only
+	Max      *float64 `json:"max,omitempty"`
+}
+
+// CrossFieldRule relates numeric fields of one record, e.g. total_tokens to
+// input_tokens and output_tokens. It is skipped when any field it names is
+// absent or not a number.
+type CrossFieldRule struct {
+	Check  string   `json:"check"` // one of the Check* kinds
+	Field  string   `json:"field"`
+	Fields []string `json:"fields"`
+}
+
+// DefaultValidationSchema returns the built-in record rules: timestamp,
+// service, and model are required; token counts, when present, must be
+// between 0 and 1,000,000, and total_tokens must be input_tokens plus
+// output_tokens; cost must not be negative.
+func DefaultValidationSchema() *ValidationSchema {
+	minTokens, maxTokens := 0.0, 1_000_000.0
+	return &ValidationSchema{
+		Fields: []FieldRule{
+			{Name: "timestamp", Type: FieldTimestamp, Required: true},
+			{Name: "service", Type: FieldString, Required: true},
+			{Name: "model", Type: FieldString, Required: true},
+			{Name: "input_tokens", Type: FieldNumber, Min: &minTokens, Max: &maxTokens},
+			{Name: "output_tokens", Type: FieldNumber, Min: &minTokens, Max: &maxTokens},
+			{Name: "cache_read_input_tokens", Type: FieldNumber, Min: &minTokens, Max: &maxTokens},
+			{Name: "cache_creation_input_tokens", Type: FieldNumber, Min: &minTokens, Max: &maxTokens},
+			{Name: "total_tokens", Type: FieldNumber, Min: &minTokens},
+			{Name: "cost", Type: FieldNumber, Min: &minTokens},
+		},
+		Checks: []CrossFieldRule{
+			{Check: CheckSum, Field: "total_tokens", Fields: []string{"input_tokens", "output_tokens"}},
+		},
+	}
+}
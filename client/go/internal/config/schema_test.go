@@ -0,0 +1,60 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefaultValidationSchema(t *testing.T) {
+	schema := DefaultValidationSchema()
+	var required []string
+	for _, f := range schema.Fields {
+		if f.Required {
+			required = append(required, f.Name)
+		}
+	}
+	assert.Equal(t, []string{"timestamp", "service", "model"}, required)
+	require.Len(t, schema.Checks, 1)
+	assert.Equal(t, CrossFieldRule{Check: CheckSum, Field: "total_tokens", Fields: []string{"input_tokens", "output_tokens"}},
+		schema.Checks[0])
+}
+
+func TestValidationSchemaVersionsFromServer(t *testing.T) {
+	var schema ValidationSchema
+	require.NoError(t, json.Unmarshal([]byte(`{"fields": [{"name": "model", "type": "string", "required": true}],
+		"versions": {"2": {"fields": [{"name": "model_id", "type": "string", "required": true}]}}}`), &schema))
+	require.Contains(t, schema.Versions, "2")
+	assert.Equal(t, "model_id", schema.Versions["2"].Fields[0].Name)
+}
+
+func TestValidationSchemaChecksFromServer(t *testing.T) {
+	var schema ValidationSchema
+	require.NoError(t, json.Unmarshal([]byte(`{"fields": [],
+		"checks": [{"check": "at_most", "field": "cached_tokens", "fields": ["prompt_tokens"]}]}`), &schema))
+	assert.Equal(t, []CrossFieldRule{{Check: CheckAtMost, Field: "cached_tokens", Fields: []string{"prompt_tokens"}}},
+		schema.Checks)
+}
+
+func TestValidationSchemaFromServer(t *testing.T) {
+	var cfg ClientConfig
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"validation_schema": {"fields": [
+			{"name": "timestamp", "type": "timestamp", "required": true},
+			{"name": "cost_usd", "type": "number", "required": true, "min": 0}
+		]}
+	}`), &cfg))
+
+	require.NotNil(t, cfg.ValidationSchema)
+	require.Len(t, cfg.ValidationSchema.Fields, 2)
+	cost := cfg.ValidationSchema.Fields[1]
+	assert.Equal(t, FieldNumber, cost.Type)
+	assert.True(t, cost.Required)
+	require.NotNil(t, cost.Min)
+	assert.Zero(t, *cost.Min)
+	assert.Nil(t, cost.Max)
+
+	assert.Nil(t, DefaultConfig().ValidationSchema, "the built-in rules apply until the server sends a schema")
+}
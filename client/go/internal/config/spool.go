@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SpoolEntry is a file waiting to be re-uploaded after a retryable failure.
+type SpoolEntry struct {
+	SizeBytes    int64     `json:"size_bytes"`
+	ModifiedAt   time.Time `json:"modified_at"`
+	DiscoveredAt time.Time `json:"discovered_at"`
+	Attempts     int       `json:"attempts"`
+	NextAttempt  time.Time `json:"next_attempt"`
+}
+
+// SpoolFile is the persisted retry spool, keyed by file path.
+type SpoolFile struct {
+	Files map[string]SpoolEntry `json:"files"`
+}
+
+// NewSpoolFile returns a new empty SpoolFile.
+func NewSpoolFile() *SpoolFile {
+	return &SpoolFile{Files: make(map[string]SpoolEntry)}
+}
+
+// LoadSpool reads and parses the retry spool from the given path. Returns a
+// new empty SpoolFile if the file does not exist, and an error wrapping
+// ErrCacheCorrupt if it cannot be parsed.
+func LoadSpool(path string) (*SpoolFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewSpoolFile(), nil
+		}
+		return nil, fmt.Errorf("read retry spool: %w", err)
+	}
+
+	var sf SpoolFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, fmt.Errorf("parse retry spool: %w: %w", ErrCacheCorrupt, err)
+	}
+	if sf.Files == nil {
+		sf.Files = make(map[string]SpoolEntry)
+	}
+	return &sf, nil
+}
+
+// Save writes the retry spool to the given path atomically (temp file +
+// rename).
+func (sf *SpoolFile) Save(path string) error {
+	data, err := json.Marshal(sf)
+	if err != nil {
+		return fmt.Errorf("marshal retry spool: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create retry spool dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp retry spool: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename retry spool: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpoolRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.json")
+	next := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	sf := NewSpoolFile()
+	sf.Files["/var/log/app/usage.jsonl"] = SpoolEntry{SizeBytes: 42, Attempts: 3, NextAttempt: next}
+	require.NoError(t, sf.Save(path))
+
+	loaded, err := LoadSpool(path)
+	require.NoError(t, err)
+	entry, ok := loaded.Files["/var/log/app/usage.jsonl"]
+	require.True(t, ok)
+	assert.Equal(t, 3, entry.Attempts)
+	assert.True(t, entry.NextAttempt.Equal(next))
+}
+
+func TestLoadSpoolMissingOrCorrupt(t *testing.T) {
+	sf, err := LoadSpool(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, sf.Files)
+
+	path := filepath.Join(t.TempDir(), "spool.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+	_, err = LoadSpool(path)
+	assert.ErrorIs(t, err, ErrCacheCorrupt)
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 // StateFile represents the launcher's persistent state (spec 01, section "Runtime State File").
@@ -19,6 +21,99 @@ type StateFile struct {
 	ServerApproved      bool          `json:"server_approved"`
 	ConsecutiveFailures int           `json:"consecutive_failures"`
 	ServerConfig        *ClientConfig `json:"server_config,omitempty"`
+
+	// Lifecycle counters, kept across restarts. WorkerRestarts counts the
+	// times the worker was found dead while it should have been running.
+	LauncherStartedAt string `json:"launcher_started_at,omitempty"`
+	LauncherStarts    int    `json:"launcher_starts,omitempty"`
+	WorkerStartedAt   string `json:"worker_started_at,omitempty"`
+	WorkerRestarts    int    `json:"worker_restarts,omitempty"`
+
+	// WorkerHungRestarts counts the workers killed and restarted because
+	// they were running but had stopped making progress.
+	WorkerHungRestarts int `json:"worker_hung_restarts,omitempty"`
+
+	// Crash-loop tracking, kept so a launcher restart doesn't reset the
+	// backoff: how many workers in a row died soon after starting, and
+	// when the next may be started.
+	WorkerQuickDeaths  int    `json:"worker_quick_deaths,omitempty"`
+	WorkerRestartAfter string `json:"worker_restart_after,omitempty"`
+
+	// Launcher self-update: the running launcher's version and when an
+	// update for it was last checked.
+	LauncherVersion         string `json:"launcher_version,omitempty"`
+	LastLauncherUpdateCheck string `json:"last_launcher_update_check,omitempty"`
+
+	// Worker update rollback: the version an update replaced and, until the
+	// new worker has run past its probation, when that ends; and the last
+	// version rolled back, which is not installed again.
+	UpdatedFromVersion   string `json:"updated_from_version,omitempty"`
+	UpdateProbationUntil string `json:"update_probation_until,omitempty"`
+	RolledBackVersion    string `json:"rolled_back_version,omitempty"`
+
+	// Local endpoint overrides set by launcher flags; they take precedence
+	// over the server-delivered config.
+	IngestPath     string            `json:"ingest_path,omitempty"`
+	RequestHeaders map[string]string `json:"request_headers,omitempty"`
+
+	// HealthSocket is where the worker serves health probes; empty disables
+	// them.
+	HealthSocket string `json:"health_socket,omitempty"`
+
+	// Network holds the local proxy and TLS settings; nil uses the defaults.
+	Network *NetworkOptions `json:"network,omitempty"`
+
+	// OfflineSince is when the launcher began running the worker on its
+	// cached config because heartbeats were failing; empty while online.
+	OfflineSince string `json:"offline_since,omitempty"`
+
+	// ClientCredential is the secret the server issued when the client
+	// enrolled with a registration token. Its presence makes the state file
+	// private to its owner; a state file shared with the worker leaves it
+	// out, see SaveShared.
+	ClientCredential string `json:"client_credential,omitempty"`
+
+	// ClockSkewSeconds is the server's clock minus this host's, as measured
+	// at the last heartbeat. With CorrectClock set it is added to the
+	// timestamps the agent generates for the server.
+	ClockSkewSeconds int  `json:"clock_skew_seconds,omitempty"`
+	CorrectClock     bool `json:"correct_clock,omitempty"`
+}
+
+// ClockOffset returns what to add to local time for timestamps sent to the
+// server: the measured skew if clock correction is on, else zero.
+func (s *StateFile) ClockOffset() time.Duration {
+	if s == nil || !s.CorrectClock {
+		return 0
+	}
+	return time.Duration(s.ClockSkewSeconds) * time.Second
+}
+
+// EffectiveIngestPath returns the ingest path to use: the local override if
+// set, else the server config's path, else the protocol default.
+func (s *StateFile) EffectiveIngestPath() string {
+	if s.IngestPath != "" {
+		return s.IngestPath
+	}
+	if s.ServerConfig != nil && s.ServerConfig.IngestPath != "" {
+		return s.ServerConfig.IngestPath
+	}
+	return "/api/ingest"
+}
+
+// EffectiveRequestHeaders merges the server config's headers with the local
+// overrides. Local values win on conflicting keys.
+func (s *StateFile) EffectiveRequestHeaders() map[string]string {
+	headers := make(map[string]string)
+	if s.ServerConfig != nil {
+		for k, v := range s.ServerConfig.RequestHeaders {
+			headers[k] = v
+		}
+	}
+	for k, v := range s.RequestHeaders {
+		headers[k] = v
+	}
+	return headers
 }
 
 // LoadState reads and parses the state file from the given path.
@@ -41,20 +136,82 @@ func LoadState(path string) (*StateFile, error) {
 
 // Save writes the state file to the given path atomically (temp file + rename).
 func (s *StateFile) Save(path string) error {
-	data, err := json.MarshalIndent(s, "", "  ")
+	return s.save(path, -1)
+}
+
+// SaveShared is Save for a worker running as another user: the file is
+// group-owned by gid and readable by that group only, so the worker can read
+// its config and no one else can. The credential is kept out of it, in a file
+// only the owner can read; see LoadCredential. The trade-off is that the
+// worker can't authenticate its uploads with it: the credential covers the
+// launcher's heartbeats only, and the server identifies uploads by hostname.
+func (s *StateFile) SaveShared(path string, gid int) error {
+	return s.save(path, gid)
+}
+
+// CredentialPath returns where the credential is kept while the state file
+// at statePath is shared with the worker.
+func CredentialPath(statePath string) string {
+	return filepath.Join(filepath.Dir(statePath), "tokenly-credential")
+}
+
+// LoadCredential reads the credential SaveShared kept out of the state file
+// at statePath. Returns "" if there is none.
+func LoadCredential(statePath string) (string, error) {
+	data, err := os.ReadFile(CredentialPath(statePath))
 	if err != nil {
-		return fmt.Errorf("marshal state: %w", err)
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("read credential file: %w", err)
 	}
+	return strings.TrimSpace(string(data)), nil
+}
 
+func (s *StateFile) save(path string, gid int) error {
 	dir := filepath.Dir(path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("create state dir: %w", err)
 	}
 
+	shared := *s
+	credPath := CredentialPath(path)
+	if gid >= 0 && s.ClientCredential != "" {
+		if err := os.WriteFile(credPath+".tmp", []byte(s.ClientCredential+"\n"), 0600); err != nil {
+			return fmt.Errorf("write credential file: %w", err)
+		}
+		if err := os.Rename(credPath+".tmp", credPath); err != nil {
+			os.Remove(credPath + ".tmp")
+			return fmt.Errorf("rename credential file: %w", err)
+		}
+		shared.ClientCredential = ""
+	} else if err := os.Remove(credPath); err != nil && !os.IsNotExist(err) {
+		// A stale credential would be loaded again on the next start.
+		return fmt.Errorf("remove credential file: %w", err)
+	}
+
+	data, err := json.MarshalIndent(&shared, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	perm := os.FileMode(0644)
+	if gid >= 0 {
+		perm = 0640
+	} else if s.ClientCredential != "" {
+		perm = 0600
+	}
 	tmp := path + ".tmp"
-	if err := os.WriteFile(tmp, data, 0644); err != nil {
+	os.Remove(tmp) // a leftover would keep its old mode
+	if err := os.WriteFile(tmp, data, perm); err != nil {
 		return fmt.Errorf("write temp state file: %w", err)
 	}
+	if gid >= 0 {
+		if err := os.Chown(tmp, -1, gid); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("set state file group: %w", err)
+		}
+	}
 
 	if err := os.Rename(tmp, path); err != nil {
 		os.Remove(tmp)
@@ -3,7 +3,9 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -43,6 +45,16 @@ func TestStateFileRoundTrip(t *testing.T) {
 	assert.Equal(t, cfg.ScanIntervalMinutes, loaded.ServerConfig.ScanIntervalMinutes)
 }
 
+func TestStateClockOffset(t *testing.T) {
+	var nilState *StateFile
+	assert.Zero(t, nilState.ClockOffset())
+
+	s := &StateFile{ClockSkewSeconds: -90}
+	assert.Zero(t, s.ClockOffset(), "measured skew is only applied when correction is on")
+	s.CorrectClock = true
+	assert.Equal(t, -90*time.Second, s.ClockOffset())
+}
+
 func TestLoadStateMissingFile(t *testing.T) {
 	state, err := LoadState(filepath.Join(t.TempDir(), "nonexistent.json"))
 	require.NoError(t, err)
@@ -72,3 +84,75 @@ func TestStateSaveAtomicity(t *testing.T) {
 	_, err = os.Stat(path + ".tmp")
 	assert.True(t, os.IsNotExist(err))
 }
+
+func TestStateSave_PrivateWithCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	require.NoError(t, (&StateFile{Hostname: "test"}).Save(path))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	require.NoError(t, (&StateFile{Hostname: "test", ClientCredential: "secret"}).Save(path))
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestStateSaveShared_GroupReadable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	// The current group is the one the test can always chown to.
+	state := &StateFile{Hostname: "test", ClientCredential: "secret"}
+	require.NoError(t, state.SaveShared(path, os.Getgid()))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// The worker's group can read the state file, but not the credential.
+	loaded, err := LoadState(path)
+	require.NoError(t, err)
+	assert.Empty(t, loaded.ClientCredential)
+	info, err = os.Stat(CredentialPath(path))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	cred, err := LoadCredential(path)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", cred)
+
+	// Saved privately again, or without a credential, the file goes.
+	state.ClientCredential = ""
+	require.NoError(t, state.SaveShared(path, os.Getgid()))
+	assert.NoFileExists(t, CredentialPath(path))
+}
+
+func TestEffectiveIngestPath(t *testing.T) {
+	state := &StateFile{}
+	assert.Equal(t, "/api/ingest", state.EffectiveIngestPath())
+
+	cfg := DefaultConfig()
+	cfg.IngestPath = "/gw/ingest"
+	state.ServerConfig = &cfg
+	assert.Equal(t, "/gw/ingest", state.EffectiveIngestPath())
+
+	state.IngestPath = "/local/ingest"
+	assert.Equal(t, "/local/ingest", state.EffectiveIngestPath())
+}
+
+func TestEffectiveRequestHeaders(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.RequestHeaders = map[string]string{"X-Tenant": "server", "X-Route": "a"}
+	state := &StateFile{
+		ServerConfig:   &cfg,
+		RequestHeaders: map[string]string{"X-Tenant": "local"},
+	}
+
+	headers := state.EffectiveRequestHeaders()
+	assert.Equal(t, map[string]string{"X-Tenant": "local", "X-Route": "a"}, headers)
+}
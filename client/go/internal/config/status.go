@@ -0,0 +1,166 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// UptimeInfo reports how long the agent's processes have been up and how
+// often they restart, so the server can spot an agent stuck in a crash loop.
+type UptimeInfo struct {
+	LauncherStartedAt  string `json:"launcher_started_at"`
+	LauncherUptimeSecs int64  `json:"launcher_uptime_seconds"`
+	LauncherRestarts   int    `json:"launcher_restarts"`
+	WorkerStartedAt    string `json:"worker_started_at,omitempty"`
+	WorkerUptimeSecs   int64  `json:"worker_uptime_seconds,omitempty"`
+	WorkerRestarts     int    `json:"worker_restarts"`
+	WorkerHungRestarts int    `json:"worker_hung_restarts,omitempty"`
+}
+
+// NewUptimeInfo derives uptime and restart counts from the state file. Returns
+// nil if the launcher has not recorded a start. Worker uptime is only
+// reported while the worker is running.
+func NewUptimeInfo(state *StateFile, now time.Time) *UptimeInfo {
+	started, err := time.Parse(time.RFC3339, state.LauncherStartedAt)
+	if err != nil {
+		return nil
+	}
+	info := &UptimeInfo{
+		LauncherStartedAt:  state.LauncherStartedAt,
+		LauncherUptimeSecs: int64(now.Sub(started).Seconds()),
+		LauncherRestarts:   max(state.LauncherStarts-1, 0),
+		WorkerRestarts:     state.WorkerRestarts,
+		WorkerHungRestarts: state.WorkerHungRestarts,
+	}
+	if state.WorkerStatus == "running" {
+		if ws, err := time.Parse(time.RFC3339, state.WorkerStartedAt); err == nil {
+			info.WorkerStartedAt = state.WorkerStartedAt
+			info.WorkerUptimeSecs = int64(now.Sub(ws).Seconds())
+		}
+	}
+	return info
+}
+
+// Status summarizes the agent's state file and the worker's latest report
+// for the status subcommands. It is also their --json output.
+type Status struct {
+	Server              string        `json:"server"`
+	Approved            bool          `json:"approved"`
+	LastHeartbeat       string        `json:"last_heartbeat,omitempty"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	OfflineSince        string        `json:"offline_since,omitempty"`
+	LauncherVersion     string        `json:"launcher_version,omitempty"`
+	WorkerVersion       string        `json:"worker_version,omitempty"`
+	WorkerStatus        string        `json:"worker_status"`
+	WorkerPID           int           `json:"worker_pid,omitempty"`
+	Uptime              *UptimeInfo   `json:"uptime,omitempty"`
+	Report              *WorkerReport `json:"worker_report,omitempty"`
+}
+
+// NewStatus builds the status from the state file and the worker's report,
+// which may be nil.
+func NewStatus(state *StateFile, report *WorkerReport, now time.Time) *Status {
+	workerStatus := state.WorkerStatus
+	if workerStatus == "" {
+		workerStatus = "stopped"
+	}
+	st := &Status{
+		Server:              state.ServerEndpoint,
+		Approved:            state.ServerApproved,
+		LastHeartbeat:       state.LastHeartbeat,
+		ConsecutiveFailures: state.ConsecutiveFailures,
+		OfflineSince:        state.OfflineSince,
+		LauncherVersion:     state.LauncherVersion,
+		WorkerVersion:       state.WorkerVersion,
+		WorkerStatus:        workerStatus,
+		Uptime:              NewUptimeInfo(state, now),
+		Report:              report,
+	}
+	if workerStatus == "running" {
+		st.WorkerPID = state.WorkerPID
+	}
+	return st
+}
+
+// WriteStatus prints st as a human-readable summary.
+func WriteStatus(w io.Writer, st *Status) {
+	approval := "pending"
+	if st.Approved {
+		approval = "approved"
+	}
+	fmt.Fprintf(w, "Server:           %s (%s)\n", orNone(st.Server), approval)
+	fmt.Fprintf(w, "Last heartbeat:   %s (%d consecutive failures)\n", orNone(st.LastHeartbeat), st.ConsecutiveFailures)
+	if st.OfflineSince != "" {
+		fmt.Fprintf(w, "Offline:          since %s, running on cached config\n", st.OfflineSince)
+	}
+	fmt.Fprintf(w, "Versions:         launcher %s, worker %s\n",
+		orNone(st.LauncherVersion), orNone(st.WorkerVersion))
+
+	if up := st.Uptime; up != nil {
+		fmt.Fprintf(w, "Launcher uptime:  %s (since %s, %d restarts)\n",
+			secondsDuration(up.LauncherUptimeSecs), up.LauncherStartedAt, up.LauncherRestarts)
+		if up.WorkerStartedAt != "" {
+			fmt.Fprintf(w, "Worker uptime:    %s (since %s, pid %d)\n",
+				secondsDuration(up.WorkerUptimeSecs), up.WorkerStartedAt, st.WorkerPID)
+		} else {
+			fmt.Fprintf(w, "Worker:           %s\n", st.WorkerStatus)
+		}
+		fmt.Fprintf(w, "Worker restarts:  %d\n", up.WorkerRestarts)
+		if up.WorkerHungRestarts > 0 {
+			fmt.Fprintf(w, "  of them hung:   %d\n", up.WorkerHungRestarts)
+		}
+	} else {
+		fmt.Fprintf(w, "Launcher:         not started\n")
+	}
+
+	if report := st.Report; report != nil {
+		fmt.Fprintf(w, "Last scan:        %s\n", orNone(report.LastScanTime))
+		fmt.Fprintf(w, "Uploaded today:   %d files, %d bytes\n", report.FilesUploadedToday, report.BytesUploadedToday)
+		fmt.Fprintf(w, "Discovery paths:  %d (%d unreachable)\n", report.DiscoveryPaths, report.UnreachablePaths)
+	}
+}
+
+// WriteStatusJSON writes st as indented JSON, for scripts.
+func WriteStatusJSON(w io.Writer, st *Status) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(st)
+}
+
+// RunStatus loads the state file at statePath and its worker report and
+// prints the status to w, as JSON if asJSON is set. It backs the status
+// subcommands of both binaries and returns their exit code.
+func RunStatus(w, errw io.Writer, statePath string, asJSON bool) int {
+	state, err := LoadState(statePath)
+	if err != nil {
+		fmt.Fprintf(errw, "error: %v\n", err)
+		return 1
+	}
+	report, err := LoadWorkerReport(WorkerReportPath(statePath))
+	if err != nil {
+		fmt.Fprintf(errw, "warning: %v\n", err)
+	}
+	st := NewStatus(state, report, time.Now())
+	if asJSON {
+		if err := WriteStatusJSON(w, st); err != nil {
+			fmt.Fprintf(errw, "error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	WriteStatus(w, st)
+	return 0
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func secondsDuration(secs int64) time.Duration {
+	return time.Duration(secs) * time.Second
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUptimeInfo(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Nil(t, NewUptimeInfo(&StateFile{}, now))
+
+	state := &StateFile{
+		LauncherStartedAt: "2026-03-01T10:00:00Z",
+		LauncherStarts:    3,
+		WorkerStartedAt:   "2026-03-01T11:55:00Z",
+		WorkerRestarts:    4,
+		WorkerStatus:      "running",
+	}
+	up := NewUptimeInfo(state, now)
+	require.NotNil(t, up)
+	assert.Equal(t, int64(7200), up.LauncherUptimeSecs)
+	assert.Equal(t, 2, up.LauncherRestarts)
+	assert.Equal(t, int64(300), up.WorkerUptimeSecs)
+	assert.Equal(t, 4, up.WorkerRestarts)
+
+	state.WorkerStatus = "stopped"
+	up = NewUptimeInfo(state, now)
+	assert.Empty(t, up.WorkerStartedAt)
+	assert.Zero(t, up.WorkerUptimeSecs)
+	assert.Equal(t, 4, up.WorkerRestarts)
+}
+
+func TestWriteStatus(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	state := &StateFile{
+		ServerEndpoint:    "https://tokenly.example.com",
+		ServerApproved:    true,
+		LauncherStartedAt: "2026-03-01T10:00:00Z",
+		LauncherStarts:    1,
+		WorkerStartedAt:   "2026-03-01T11:00:00Z",
+		WorkerStatus:      "running",
+		WorkerPID:         4242,
+		WorkerRestarts:    2,
+		OfflineSince:      "2026-03-01T11:30:00Z",
+
+		ConsecutiveFailures: 2,
+	}
+	report := &WorkerReport{FilesUploadedToday: 5, BytesUploadedToday: 2048, DiscoveryPaths: 3, UnreachablePaths: 1}
+
+	var buf bytes.Buffer
+	WriteStatus(&buf, NewStatus(state, report, now))
+	out := buf.String()
+	assert.Contains(t, out, "https://tokenly.example.com (approved)")
+	assert.Contains(t, out, "Launcher uptime:  2h0m0s")
+	assert.Contains(t, out, "0 restarts")
+	assert.Contains(t, out, "Worker uptime:    1h0m0s")
+	assert.Contains(t, out, "pid 4242")
+	assert.Contains(t, out, "Worker restarts:  2")
+	assert.Contains(t, out, "5 files, 2048 bytes")
+	assert.Contains(t, out, "3 (1 unreachable)")
+	assert.Contains(t, out, "Offline:          since 2026-03-01T11:30:00Z")
+	assert.Contains(t, out, "(2 consecutive failures)")
+
+	buf.Reset()
+	WriteStatus(&buf, NewStatus(&StateFile{}, nil, now))
+	assert.Contains(t, buf.String(), "not started")
+	assert.NotContains(t, buf.String(), "Last scan")
+	assert.NotContains(t, buf.String(), "Offline")
+}
+
+func TestRunStatus(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, (&StateFile{
+		ServerEndpoint: "https://tokenly.example.com",
+		ServerApproved: true,
+		WorkerStatus:   "running",
+		WorkerPID:      4242,
+		LastHeartbeat:  "2026-03-01T11:59:00Z",
+	}).Save(statePath))
+	require.NoError(t, (&WorkerReport{LastScanTime: "2026-03-01T11:58:00Z"}).Save(WorkerReportPath(statePath)))
+
+	var out, errOut bytes.Buffer
+	require.Equal(t, 0, RunStatus(&out, &errOut, statePath, false))
+	assert.Contains(t, out.String(), "https://tokenly.example.com (approved)")
+	assert.Contains(t, out.String(), "Last scan:        2026-03-01T11:58:00Z")
+
+	out.Reset()
+	require.Equal(t, 0, RunStatus(&out, &errOut, statePath, true))
+	var st Status
+	require.NoError(t, json.Unmarshal(out.Bytes(), &st))
+	assert.True(t, st.Approved)
+	assert.Equal(t, "running", st.WorkerStatus)
+	assert.Equal(t, 4242, st.WorkerPID)
+	assert.Equal(t, "2026-03-01T11:59:00Z", st.LastHeartbeat)
+	require.NotNil(t, st.Report)
+	assert.Equal(t, "2026-03-01T11:58:00Z", st.Report.LastScanTime)
+	assert.Empty(t, errOut.String())
+
+	require.NoError(t, os.WriteFile(statePath, []byte("{"), 0644))
+	assert.Equal(t, 1, RunStatus(&out, &errOut, statePath, false))
+	assert.Contains(t, errOut.String(), "error:")
+}
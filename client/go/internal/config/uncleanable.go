@@ -0,0 +1,76 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// UncleanableEntry is an uploaded file the worker could not clean up, as it
+// was when cleanup failed.
+type UncleanableEntry struct {
+	Size     int64     `json:"size"`
+	ModTime  time.Time `json:"mod_time"`
+	Error    string    `json:"error"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// UncleanableFile is the persisted record of uploaded files that could not be
+// cleaned up.
+type UncleanableFile struct {
+	Files map[string]UncleanableEntry `json:"files"`
+}
+
+// NewUncleanableFile returns a new empty UncleanableFile.
+func NewUncleanableFile() *UncleanableFile {
+	return &UncleanableFile{Files: make(map[string]UncleanableEntry)}
+}
+
+// LoadUncleanable reads and parses the uncleanable file list from the given
+// path. Returns a new empty UncleanableFile if the file does not exist, and an
+// error wrapping ErrCacheCorrupt if it cannot be parsed.
+func LoadUncleanable(path string) (*UncleanableFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewUncleanableFile(), nil
+		}
+		return nil, fmt.Errorf("read uncleanable list: %w", err)
+	}
+
+	var uf UncleanableFile
+	if err := json.Unmarshal(data, &uf); err != nil {
+		return nil, fmt.Errorf("parse uncleanable list: %w: %w", ErrCacheCorrupt, err)
+	}
+	if uf.Files == nil {
+		uf.Files = make(map[string]UncleanableEntry)
+	}
+	return &uf, nil
+}
+
+// Save writes the uncleanable file list to the given path atomically (temp
+// file + rename).
+func (uf *UncleanableFile) Save(path string) error {
+	data, err := json.Marshal(uf)
+	if err != nil {
+		return fmt.Errorf("marshal uncleanable list: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create uncleanable list dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp uncleanable list: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename uncleanable list: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUncleanableRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uncleanable.json")
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+
+	uf := NewUncleanableFile()
+	uf.Files["/var/log/app/usage.jsonl"] = UncleanableEntry{Size: 42, ModTime: mtime, Error: "permission denied"}
+	require.NoError(t, uf.Save(path))
+
+	loaded, err := LoadUncleanable(path)
+	require.NoError(t, err)
+	entry, ok := loaded.Files["/var/log/app/usage.jsonl"]
+	require.True(t, ok)
+	assert.True(t, entry.ModTime.Equal(mtime))
+	assert.Equal(t, "permission denied", entry.Error)
+}
+
+func TestLoadUncleanableMissingOrInvalid(t *testing.T) {
+	uf, err := LoadUncleanable(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.Empty(t, uf.Files)
+
+	path := filepath.Join(t.TempDir(), "uncleanable.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+	_, err = LoadUncleanable(path)
+	assert.ErrorIs(t, err, ErrCacheCorrupt)
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// CachedValidation is a file that failed validation, as it was when checked.
+type CachedValidation struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Hash    string    `json:"hash"`  // algorithm-prefixed content digest
+	Rules   string    `json:"rules"` // fingerprint of the validation settings applied
+
+	TotalLines     int       `json:"total_lines"`
+	InvalidRecords int       `json:"invalid_records"`
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// ValidationCacheFile is the persisted record of files known to be invalid.
+type ValidationCacheFile struct {
+	Files map[string]CachedValidation `json:"files"`
+}
+
+// NewValidationCacheFile returns a new empty ValidationCacheFile.
+func NewValidationCacheFile() *ValidationCacheFile {
+	return &ValidationCacheFile{Files: make(map[string]CachedValidation)}
+}
+
+// LoadValidationCache reads and parses the validation cache from the given
+// path. Returns a new empty ValidationCacheFile if the file does not exist,
+// and an error wrapping ErrCacheCorrupt if it cannot be parsed.
+func LoadValidationCache(path string) (*ValidationCacheFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return NewValidationCacheFile(), nil
+		}
+		return nil, fmt.Errorf("read validation cache: %w", err)
+	}
+
+	var vc ValidationCacheFile
+	if err := json.Unmarshal(data, &vc); err != nil {
+		return nil, fmt.Errorf("parse validation cache: %w: %w", ErrCacheCorrupt, err)
+	}
+	if vc.Files == nil {
+		vc.Files = make(map[string]CachedValidation)
+	}
+	return &vc, nil
+}
+
+// Save writes the validation cache to the given path atomically (temp file +
+// rename).
+func (vc *ValidationCacheFile) Save(path string) error {
+	data, err := json.Marshal(vc)
+	if err != nil {
+		return fmt.Errorf("marshal validation cache: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create validation cache dir: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("write temp validation cache: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("rename validation cache: %w", err)
+	}
+	return nil
+}
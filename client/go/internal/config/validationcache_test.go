@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidationCacheRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	mtime := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+
+	vc := NewValidationCacheFile()
+	vc.Files["/var/log/app/bad.jsonl"] = CachedValidation{
+		Size: 42, ModTime: mtime, Hash: "blake3:abc", Rules: "r1", TotalLines: 3, InvalidRecords: 3,
+	}
+	require.NoError(t, vc.Save(path))
+
+	loaded, err := LoadValidationCache(path)
+	require.NoError(t, err)
+	entry, ok := loaded.Files["/var/log/app/bad.jsonl"]
+	require.True(t, ok)
+	assert.True(t, entry.ModTime.Equal(mtime), "mod times keep nanosecond precision")
+	assert.Equal(t, "blake3:abc", entry.Hash)
+	assert.Equal(t, 3, entry.InvalidRecords)
+}
+
+func TestLoadValidationCacheMissingFile(t *testing.T) {
+	vc, err := LoadValidationCache(filepath.Join(t.TempDir(), "missing.json"))
+	require.NoError(t, err)
+	assert.NotNil(t, vc.Files)
+	assert.Empty(t, vc.Files)
+}
+
+func TestLoadValidationCacheInvalidJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+	_, err := LoadValidationCache(path)
+	assert.ErrorIs(t, err, ErrCacheCorrupt)
+}
@@ -0,0 +1,82 @@
+package launcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// FileConfig is the launcher's optional YAML config file. It carries the
+// same settings as the command-line flags, plus proxy and TLS options, so
+// provisioning tools can drop a file instead of templating a command line.
+// Flags given explicitly take precedence over the file.
+type FileConfig struct {
+	Server            string            `yaml:"server"`
+	Hostname          string            `yaml:"hostname"`
+	Log               FileLogConfig     `yaml:"log"`
+	HeartbeatPath     string            `yaml:"heartbeat_path"`
+	IngestPath        string            `yaml:"ingest_path"`
+	Headers           map[string]string `yaml:"headers"`
+	MaxResponseKB     int               `yaml:"max_response_kb"`
+	Handoff           string            `yaml:"handoff"`
+	RegistrationToken string            `yaml:"registration_token"`
+	StatusAddr        string            `yaml:"status_addr"`
+	WorkerUser        string            `yaml:"worker_user"`
+	WorkerStopGrace   string            `yaml:"worker_stop_grace"` // a duration, e.g. 30s
+	CorrectClock      bool              `yaml:"correct_clock"`
+	ExternalWorker    bool              `yaml:"external_worker"`
+	Proxy             string            `yaml:"proxy"`
+	TLS               FileTLSConfig     `yaml:"tls"`
+}
+
+// FileLogConfig holds the config file's log settings.
+type FileLogConfig struct {
+	Level string `yaml:"level"`
+	File  string `yaml:"file"` // appended to instead of writing to stderr
+}
+
+// FileTLSConfig holds the config file's TLS settings for server connections.
+type FileTLSConfig struct {
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// LoadFileConfig reads the config file at path. Unknown keys are rejected so
+// typos don't silently fall back to defaults. A missing file yields an error
+// matching os.ErrNotExist; an empty one an empty config.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file: %w", err)
+	}
+
+	var fc FileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return &fc, nil
+}
+
+// Network returns the file's proxy and TLS settings, or nil if it has none.
+func (fc *FileConfig) Network() *config.NetworkOptions {
+	if fc == nil || (fc.Proxy == "" && fc.TLS == FileTLSConfig{}) {
+		return nil
+	}
+	return &config.NetworkOptions{
+		Proxy:              fc.Proxy,
+		CAFile:             fc.TLS.CAFile,
+		CertFile:           fc.TLS.CertFile,
+		KeyFile:            fc.TLS.KeyFile,
+		InsecureSkipVerify: fc.TLS.InsecureSkipVerify,
+	}
+}
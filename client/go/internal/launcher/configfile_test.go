@@ -0,0 +1,62 @@
+package launcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestLoadFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "launcher.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`server: https://tokenly.example.com
+hostname: build-01
+log:
+  level: debug
+  file: /var/log/tokenly/launcher.log
+headers:
+  X-Tenant: acme
+max_response_kb: 2048
+proxy: http://proxy.internal:3128
+tls:
+  ca_file: /etc/tokenly/ca.pem
+`), 0644))
+
+	fc, err := LoadFileConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "https://tokenly.example.com", fc.Server)
+	assert.Equal(t, "build-01", fc.Hostname)
+	assert.Equal(t, FileLogConfig{Level: "debug", File: "/var/log/tokenly/launcher.log"}, fc.Log)
+	assert.Equal(t, map[string]string{"X-Tenant": "acme"}, fc.Headers)
+	assert.Equal(t, 2048, fc.MaxResponseKB)
+	assert.Equal(t, &config.NetworkOptions{
+		Proxy:  "http://proxy.internal:3128",
+		CAFile: "/etc/tokenly/ca.pem",
+	}, fc.Network())
+}
+
+func TestLoadFileConfig_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "launcher.yaml")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	fc, err := LoadFileConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, &FileConfig{}, fc)
+	assert.Nil(t, fc.Network())
+}
+
+func TestLoadFileConfig_Errors(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := LoadFileConfig(filepath.Join(dir, "missing.yaml"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	path := filepath.Join(dir, "launcher.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("servr: https://tokenly.example.com\n"), 0644))
+	_, err = LoadFileConfig(path)
+	assert.ErrorContains(t, err, "servr")
+}
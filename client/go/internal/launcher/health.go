@@ -0,0 +1,36 @@
+package launcher
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// ErrNoHealthSocket is returned by ProbeHealth when the worker has no health
+// socket, e.g. because it predates health probes.
+var ErrNoHealthSocket = errors.New("no health socket")
+
+// ProbeHealth asks the worker serving the unix socket at path for its health
+// status, giving up after timeout.
+func ProbeHealth(path string, timeout time.Duration) (*config.HealthStatus, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w: %s", ErrNoHealthSocket, path)
+		}
+		return nil, fmt.Errorf("connect to health socket: %w", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	var st config.HealthStatus
+	if err := json.NewDecoder(conn).Decode(&st); err != nil {
+		return nil, fmt.Errorf("read health status: %w", err)
+	}
+	return &st, nil
+}
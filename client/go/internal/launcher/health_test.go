@@ -0,0 +1,51 @@
+package launcher
+
+import (
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeHealth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worker.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		json.NewEncoder(conn).Encode(config.HealthStatus{PID: 42, State: "idle", LastProgress: "2026-03-01T12:00:00Z"})
+		conn.Close()
+	}()
+
+	st, err := ProbeHealth(path, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 42, st.PID)
+	assert.Equal(t, "idle", st.State)
+	assert.Equal(t, "2026-03-01T12:00:00Z", st.LastProgress)
+}
+
+func TestProbeHealth_NoSocket(t *testing.T) {
+	_, err := ProbeHealth(filepath.Join(t.TempDir(), "worker.sock"), time.Second)
+	require.ErrorIs(t, err, ErrNoHealthSocket)
+}
+
+func TestProbeHealth_Unresponsive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "worker.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	defer ln.Close()
+	// Connections are accepted by the kernel but never answered.
+
+	_, err = ProbeHealth(path, 100*time.Millisecond)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrNoHealthSocket)
+}
@@ -5,9 +5,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
@@ -15,13 +15,25 @@ import (
 
 // HeartbeatRequest matches the protocol spec heartbeat request contract.
 type HeartbeatRequest struct {
-	ClientHostname  string          `json:"client_hostname"`
-	Timestamp       string          `json:"timestamp"`
-	LauncherVersion string          `json:"launcher_version"`
-	WorkerVersion   string          `json:"worker_version"`
-	WorkerStatus    string          `json:"worker_status"`
-	SystemInfo      SystemInfo      `json:"system_info"`
-	Stats           *HeartbeatStats `json:"stats,omitempty"`
+	ClientHostname  string             `json:"client_hostname"`
+	Timestamp       string             `json:"timestamp"`
+	LauncherVersion string             `json:"launcher_version"`
+	WorkerVersion   string             `json:"worker_version"`
+	WorkerStatus    string             `json:"worker_status"`
+	SystemInfo      SystemInfo         `json:"system_info"`
+	Stats           *HeartbeatStats    `json:"stats,omitempty"`
+	Uptime          *config.UptimeInfo `json:"uptime,omitempty"`
+
+	SupportedChecksums []string `json:"supported_checksums,omitempty"`
+
+	// ClockSkewSeconds is the server's clock minus this host's, measured at
+	// the previous heartbeat.
+	ClockSkewSeconds int `json:"clock_skew_seconds,omitempty"`
+
+	// Enrollment: the one-time registration token until the server issues a
+	// credential, the credential after.
+	RegistrationToken string `json:"registration_token,omitempty"`
+	ClientCredential  string `json:"client_credential,omitempty"`
 }
 
 // SystemInfo describes the client machine.
@@ -37,20 +49,33 @@ type HeartbeatStats struct {
 	LastScanTime             string `json:"last_scan_time,omitempty"`
 	DirectoriesMonitored     int    `json:"directories_monitored,omitempty"`
 	ErrorsSinceLastHeartbeat int    `json:"errors_since_last_heartbeat,omitempty"`
+	BytesUploadedToday       int64  `json:"bytes_uploaded_today,omitempty"`
+	DailyCapReached          bool   `json:"daily_cap_reached,omitempty"`
+	UnreachablePaths         int    `json:"unreachable_paths,omitempty"`
+	PermissionDenied         int    `json:"permission_denied,omitempty"`
+	FilesTooOld              int    `json:"files_too_old,omitempty"`
+	FilesTooLarge            int    `json:"files_too_large,omitempty"`
+	GlobErrors               int    `json:"glob_errors,omitempty"`
+
+	// Opt-in counts of invalid records by kind of failure, without content.
+	ValidationFailures map[string]int `json:"validation_failures,omitempty"`
 }
 
 // HeartbeatResponse matches the server's heartbeat response contract.
 type HeartbeatResponse struct {
 	ClientID          string               `json:"client_id"`
 	Approved          bool                 `json:"approved"`
+	ClientCredential  string               `json:"client_credential,omitempty"`
 	Config            *config.ClientConfig `json:"config,omitempty"`
 	Update            *UpdateInfo          `json:"update,omitempty"`
+	LauncherUpdate    *UpdateInfo          `json:"launcher_update,omitempty"`
 	ServerTime        string               `json:"server_time"`
 	Message           string               `json:"message,omitempty"`
 	RetryAfterSeconds int                  `json:"retry_after_seconds,omitempty"`
 }
 
-// UpdateInfo describes an available software update.
+// UpdateInfo describes an available software update. Update describes the
+// worker; LauncherUpdate, the launcher itself.
 type UpdateInfo struct {
 	Enabled            bool   `json:"enabled"`
 	Available          bool   `json:"available"`
@@ -67,9 +92,16 @@ type HeartbeatSender interface {
 	SendHeartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, int, error)
 }
 
+// defaultMaxHeartbeatBytes caps the size of a heartbeat response body. It is
+// larger than the upload cap since responses carry the full client config.
+const defaultMaxHeartbeatBytes = 1024 * 1024
+
 // HeartbeatClient sends heartbeat requests to the server.
 type HeartbeatClient struct {
 	serverURL  string
+	path       string
+	maxResp    int64 // response body cap in bytes
+	headers    map[string]string
 	httpClient *http.Client
 	logger     *slog.Logger
 }
@@ -78,6 +110,8 @@ type HeartbeatClient struct {
 func NewHeartbeatClient(serverURL string, logger *slog.Logger) *HeartbeatClient {
 	return &HeartbeatClient{
 		serverURL: serverURL,
+		path:      "/api/heartbeat",
+		maxResp:   defaultMaxHeartbeatBytes,
 		httpClient: &http.Client{
 			Timeout: 30 * time.Second,
 		},
@@ -85,7 +119,37 @@ func NewHeartbeatClient(serverURL string, logger *slog.Logger) *HeartbeatClient
 	}
 }
 
-// SendHeartbeat POSTs a heartbeat to {server}/api/heartbeat and returns the
+// SetPath overrides the heartbeat endpoint path (default "/api/heartbeat").
+func (c *HeartbeatClient) SetPath(path string) {
+	if path == "" {
+		return
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	c.path = path
+}
+
+// SetHeaders sets extra headers sent with every heartbeat request.
+func (c *HeartbeatClient) SetHeaders(headers map[string]string) {
+	c.headers = headers
+}
+
+// SetTransport sets the HTTP transport heartbeats are sent with, e.g. one
+// configured with a proxy or custom TLS. Nil keeps the default.
+func (c *HeartbeatClient) SetTransport(rt http.RoundTripper) {
+	c.httpClient.Transport = rt
+}
+
+// SetMaxResponseKB caps the size of heartbeat responses in KB. Non-positive
+// values keep the default.
+func (c *HeartbeatClient) SetMaxResponseKB(kb int) {
+	if kb > 0 {
+		c.maxResp = int64(kb) * 1024
+	}
+}
+
+// SendHeartbeat POSTs a heartbeat to {server}{path} and returns the
 // parsed response, HTTP status code, and any error.
 func (c *HeartbeatClient) SendHeartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, int, error) {
 	body, err := json.Marshal(req)
@@ -93,11 +157,14 @@ func (c *HeartbeatClient) SendHeartbeat(ctx context.Context, req *HeartbeatReque
 		return nil, 0, fmt.Errorf("marshal heartbeat request: %w", err)
 	}
 
-	url := c.serverURL + "/api/heartbeat"
+	url := config.JoinURL(c.serverURL, c.path)
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
 		return nil, 0, fmt.Errorf("create heartbeat request: %w", err)
 	}
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	c.logger.Debug("sending heartbeat", "url", url)
@@ -108,7 +175,7 @@ func (c *HeartbeatClient) SendHeartbeat(ctx context.Context, req *HeartbeatReque
 	}
 	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := config.ReadLimited(resp.Body, c.maxResp)
 	if err != nil {
 		return nil, resp.StatusCode, fmt.Errorf("read heartbeat response: %w", err)
 	}
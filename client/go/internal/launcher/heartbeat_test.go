@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
@@ -226,3 +227,54 @@ func configForTest() config.ClientConfig {
 		LogLevel:              "info",
 	}
 }
+
+func TestHeartbeat_CustomPathAndHeaders(t *testing.T) {
+	var gotPath, gotRoute string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotRoute = r.Header.Get("X-Route")
+		w.WriteHeader(200)
+		json.NewEncoder(w).Encode(HeartbeatResponse{ClientID: "client-123", Approved: true})
+	}))
+	defer srv.Close()
+
+	client := NewHeartbeatClient(srv.URL, testLogger())
+	client.SetPath("/gw/heartbeat")
+	client.SetHeaders(map[string]string{"X-Route": "eu"})
+	_, status, err := client.SendHeartbeat(context.Background(), makeTestRequest())
+	require.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, "/gw/heartbeat", gotPath)
+	assert.Equal(t, "eu", gotRoute)
+}
+
+func TestHeartbeat_BasePathAndTrailingSlash(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(202)
+		json.NewEncoder(w).Encode(HeartbeatResponse{ClientID: "c", ServerTime: "2026-01-15T10:00:01Z"})
+	}))
+	defer srv.Close()
+
+	client := NewHeartbeatClient(srv.URL+"/tokenly/", testLogger())
+	_, _, err := client.SendHeartbeat(context.Background(), makeTestRequest())
+	require.NoError(t, err)
+	assert.Equal(t, "/tokenly/api/heartbeat", gotPath)
+}
+
+func TestHeartbeat_OversizedResponseIsError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"client_id":"` + strings.Repeat("x", 2048) + `"}`))
+	}))
+	defer srv.Close()
+
+	client := NewHeartbeatClient(srv.URL, testLogger())
+	client.SetMaxResponseKB(1)
+	resp, status, err := client.SendHeartbeat(context.Background(), makeTestRequest())
+	require.Error(t, err)
+	assert.ErrorIs(t, err, config.ErrResponseTooLarge)
+	assert.Nil(t, resp)
+	assert.Equal(t, 200, status)
+}
@@ -0,0 +1,53 @@
+package launcher
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// LaunchdLabel is the label of the launcher's LaunchDaemon.
+const LaunchdLabel = "com.tokenly.launcher"
+
+// LaunchdPlistPath is where the launcher's LaunchDaemon plist is installed.
+const LaunchdPlistPath = "/Library/LaunchDaemons/" + LaunchdLabel + ".plist"
+
+// LaunchdPlist renders a LaunchDaemon plist for the launcher. It is kept
+// alive by launchd, runs in dataDir, and writes its output to logDir.
+func LaunchdPlist(opts ServiceOptions, dataDir, logDir string) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString(`<plist version="1.0">` + "\n<dict>\n")
+	plistString(&b, "Label", LaunchdLabel)
+	b.WriteString("\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range opts.Args() {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", xmlEscape(a))
+	}
+	b.WriteString("\t</array>\n")
+	if !opts.runsAsRoot() {
+		plistString(&b, "UserName", opts.User)
+	}
+	b.WriteString("\t<key>EnvironmentVariables</key>\n\t<dict>\n")
+	fmt.Fprintf(&b, "\t\t<key>PATH</key>\n\t\t<string>%s</string>\n", xmlEscape(opts.searchPath()))
+	b.WriteString("\t</dict>\n")
+	plistString(&b, "WorkingDirectory", dataDir)
+	plistString(&b, "StandardOutPath", filepath.Join(logDir, "launcher.log"))
+	plistString(&b, "StandardErrorPath", filepath.Join(logDir, "launcher.log"))
+	b.WriteString("\t<key>RunAtLoad</key>\n\t<true/>\n")
+	b.WriteString("\t<key>KeepAlive</key>\n\t<true/>\n")
+	b.WriteString("\t<key>ThrottleInterval</key>\n\t<integer>10</integer>\n")
+	b.WriteString("</dict>\n</plist>\n")
+	return b.String()
+}
+
+func plistString(b *strings.Builder, key, value string) {
+	fmt.Fprintf(b, "\t<key>%s</key>\n\t<string>%s</string>\n", key, xmlEscape(value))
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,45 @@
+package launcher
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLaunchdPlist(t *testing.T) {
+	plist := LaunchdPlist(ServiceOptions{
+		Binary:    "/usr/local/bin/tokenly-launcher",
+		ServerURL: "https://tokenly.example.com",
+		User:      "_tokenly",
+		Headers:   map[string]string{"Authorization": "Bearer <k&v>"},
+	}, "/Library/Application Support/Tokenly", "/var/log/tokenly")
+
+	assert.Contains(t, plist, "<string>"+LaunchdLabel+"</string>")
+	assert.Contains(t, plist, "\t\t<string>/usr/local/bin/tokenly-launcher</string>\n\t\t<string>--server</string>\n\t\t<string>https://tokenly.example.com</string>\n")
+	assert.Contains(t, plist, "<string>Authorization=Bearer &lt;k&amp;v&gt;</string>")
+	assert.Contains(t, plist, "<key>UserName</key>\n\t<string>_tokenly</string>")
+	assert.Contains(t, plist, "<string>/usr/local/bin:/usr/local/sbin:")
+	assert.Contains(t, plist, "<key>WorkingDirectory</key>\n\t<string>/Library/Application Support/Tokenly</string>")
+	assert.Contains(t, plist, "<string>/var/log/tokenly/launcher.log</string>")
+	assert.Contains(t, plist, "<key>KeepAlive</key>\n\t<true/>")
+
+	// The result is well-formed XML.
+	d := xml.NewDecoder(strings.NewReader(plist))
+	d.Strict = true
+	for {
+		_, err := d.Token()
+		if err != nil {
+			require.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+}
+
+func TestLaunchdPlist_RootOmitsUserName(t *testing.T) {
+	plist := LaunchdPlist(ServiceOptions{Binary: "/usr/local/bin/tokenly-launcher", ServerURL: "https://h"}, "/d", "/l")
+	assert.NotContains(t, plist, "UserName")
+}
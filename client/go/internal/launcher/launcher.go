@@ -2,9 +2,11 @@ package launcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"os"
 	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
@@ -14,9 +16,18 @@ import (
 
 // LauncherConfig holds the top-level launcher configuration from CLI flags.
 type LauncherConfig struct {
-	ServerURL string
-	Hostname  string
-	LogLevel  string
+	ServerURL      string
+	Hostname       string
+	LogLevel       string
+	IngestPath     string                 // optional local override of the server-delivered ingest path
+	RequestHeaders map[string]string      // optional extra headers, merged over server-delivered headers
+	HealthSocket   string                 // optional; where the worker serves health probes
+	Network        *config.NetworkOptions // optional proxy and TLS settings, passed on to the worker
+	CorrectClock   bool                   // apply the measured clock skew to generated timestamps
+
+	// RegistrationToken enrolls the client without manual approval. It is
+	// sent until the server issues a credential in exchange.
+	RegistrationToken string
 }
 
 // Launcher orchestrates heartbeating and worker process supervision.
@@ -31,8 +42,24 @@ type Launcher struct {
 	logger          *slog.Logger
 	levelVar        *slog.LevelVar
 	launcherVersion string
+	updater         *Updater    // nil disables worker updates
+	launcherBinary  string      // empty disables launcher self-update
+	handoff         bool        // a new launcher binary is installed
+	workerUser      *WorkerUser // nil: the worker runs as the launcher's user
+	skewWarned      bool        // the current clock skew has been warned about
 }
 
+// ErrPending and ErrRejected are returned by RunOnce when the server has not
+// approved this client.
+var (
+	ErrPending  = errors.New("client pending approval")
+	ErrRejected = errors.New("client rejected by server")
+)
+
+// ErrHandoff is returned by Run after a launcher update has been installed.
+// The worker is left running; the caller restarts into the new binary.
+var ErrHandoff = errors.New("launcher updated, restart required")
+
 // NewLauncher creates a Launcher instance.
 func NewLauncher(
 	cfg LauncherConfig,
@@ -54,15 +81,32 @@ func NewLauncher(
 	}
 }
 
+// SetUpdater enables installing worker updates announced by the server.
+func (l *Launcher) SetUpdater(u *Updater) {
+	l.updater = u
+}
+
+// SetLauncherBinary enables launcher self-update, replacing the binary at
+// path when the server announces a new launcher version.
+func (l *Launcher) SetLauncherBinary(path string) {
+	l.launcherBinary = path
+}
+
+// SetWorkerUser records that the worker runs as u, so the state file is
+// saved readable by its group.
+func (l *Launcher) SetWorkerUser(u *WorkerUser) {
+	l.workerUser = u
+}
+
 // Run executes the main launcher loop until the context is cancelled.
 func (l *Launcher) Run(ctx context.Context) error {
-	state, err := config.LoadState(l.statePath)
-	if err != nil {
-		return fmt.Errorf("load state: %w", err)
+	if err := l.loadState(); err != nil {
+		return err
 	}
-	l.state = state
-	l.state.ServerEndpoint = l.config.ServerURL
-	l.state.Hostname = l.config.Hostname
+	l.state.LauncherStartedAt = time.Now().UTC().Format(time.RFC3339)
+	l.state.LauncherStarts++
+	l.state.LauncherVersion = l.launcherVersion
+	l.detectWorkerVersion()
 
 	// Initial heartbeat interval: 60s for quick registration.
 	interval := 60 * time.Second
@@ -81,15 +125,18 @@ func (l *Launcher) Run(ctx context.Context) error {
 		case <-ctx.Done():
 			l.logger.Info("launcher shutting down")
 			l.workerManager.EnsureStopped(l.state)
-			l.state.WorkerStatus = "stopped"
-			l.state.WorkerPID = 0
-			if err := l.state.Save(l.statePath); err != nil {
+			if err := l.writeState(); err != nil {
 				l.logger.Error("failed to save state on shutdown", "error", err)
 			}
 			return nil
 
 		case <-timer.C:
 			newInterval := l.doHeartbeat(ctx)
+			if l.handoff {
+				l.logger.Info("handing off to updated launcher")
+				l.saveState()
+				return ErrHandoff
+			}
 			if newInterval > 0 {
 				interval = newInterval
 			}
@@ -98,18 +145,123 @@ func (l *Launcher) Run(ctx context.Context) error {
 	}
 }
 
+// RunOnce sends a single heartbeat, saves the config it returns and, if the
+// client is approved, runs the worker for one scan-upload cycle. It is for
+// schedulers that start the agent periodically instead of keeping it
+// running. Returns ErrPending or ErrRejected if the client isn't approved.
+// Updates are not installed in this mode.
+func (l *Launcher) RunOnce(ctx context.Context) error {
+	if err := l.loadState(); err != nil {
+		return err
+	}
+	defer l.saveState()
+	l.state.WorkerStatus = "stopped"
+	l.state.WorkerPID = 0
+	if l.workerManager.External() {
+		l.state.WorkerStatus = l.workerManager.ExternalStatus(l.state)
+	}
+	l.detectWorkerVersion()
+
+	sent := time.Now()
+	resp, status, err := l.heartbeatClient.SendHeartbeat(ctx, l.buildHeartbeatRequest())
+	if err == nil {
+		err = serverError(status)
+	}
+	if err != nil {
+		l.state.ConsecutiveFailures++
+		// Offline, a previously approved client still runs its cycle on the
+		// cached config; the heartbeat failure is reported all the same.
+		if l.state.ServerApproved && l.state.ServerConfig != nil {
+			l.logger.Warn("server unreachable, running worker on cached config", "error", err)
+			l.saveState()
+			if err := l.workerManager.RunOnce(); err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+	l.state.LastHeartbeat = time.Now().UTC().Format(time.RFC3339)
+	l.recordClockSkew(resp, sent, time.Now())
+
+	switch status {
+	case 200:
+		l.state.ServerApproved = true
+		l.state.ConsecutiveFailures = 0
+		l.storeCredential(resp)
+		if resp.Config != nil {
+			l.state.ServerConfig = resp.Config
+			if resp.Config.LogLevel != "" {
+				l.levelVar.Set(logging.ParseLevel(resp.Config.LogLevel))
+			}
+		}
+		l.saveState()
+		l.logger.Info("heartbeat approved", "client_id", resp.ClientID)
+		if l.state.ServerConfig == nil {
+			return fmt.Errorf("server sent no config")
+		}
+		return l.workerManager.RunOnce()
+	case 202:
+		l.state.ServerApproved = false
+		l.state.ConsecutiveFailures = 0
+		l.logger.Info("heartbeat pending", "message", resp.Message)
+		return ErrPending
+	case 401:
+		l.dropCredential()
+		fallthrough
+	case 403:
+		l.state.ServerApproved = false
+		l.state.ConsecutiveFailures = 0
+		l.logger.Warn("client rejected by server", "status", status)
+		return ErrRejected
+	default:
+		l.state.ConsecutiveFailures++
+		return fmt.Errorf("unexpected heartbeat status %d", status)
+	}
+}
+
+// loadState loads the state file and applies the local overrides to it.
+func (l *Launcher) loadState() error {
+	state, err := config.LoadState(l.statePath)
+	if err != nil {
+		return fmt.Errorf("load state: %w", err)
+	}
+	if state.ClientCredential == "" {
+		// Kept apart while the state file is shared with the worker.
+		if state.ClientCredential, err = config.LoadCredential(l.statePath); err != nil {
+			return fmt.Errorf("load state: %w", err)
+		}
+	}
+	l.state = state
+	l.state.ServerEndpoint = l.config.ServerURL
+	l.state.Hostname = l.config.Hostname
+	l.state.IngestPath = l.config.IngestPath
+	l.state.RequestHeaders = l.config.RequestHeaders
+	l.state.HealthSocket = l.config.HealthSocket
+	l.state.Network = l.config.Network
+	l.state.CorrectClock = l.config.CorrectClock
+	return nil
+}
+
 // doHeartbeat sends one heartbeat and handles the response. Returns the next interval.
 func (l *Launcher) doHeartbeat(ctx context.Context) time.Duration {
 	// Check current worker status before sending heartbeat.
 	workerStatus := "stopped"
-	if l.workerManager.IsRunning() {
+	if l.workerManager.External() {
+		workerStatus = l.workerManager.ExternalStatus(l.state)
+	} else if l.workerManager.IsRunning() {
 		workerStatus = "running"
+	} else if l.workerManager.CrashLooping() {
+		workerStatus = "crash_looping"
 	}
 	l.state.WorkerStatus = workerStatus
 
 	req := l.buildHeartbeatRequest()
 
+	sent := time.Now()
 	resp, status, err := l.heartbeatClient.SendHeartbeat(ctx, req)
+	if err == nil {
+		err = serverError(status)
+	}
 	if err != nil {
 		l.state.ConsecutiveFailures++
 		failures := l.state.ConsecutiveFailures
@@ -120,21 +272,39 @@ func (l *Launcher) doHeartbeat(ctx context.Context) time.Duration {
 			"consecutive_failures", failures,
 			"next_retry", interval,
 		)
+		l.runOffline()
 		l.saveState()
 		return interval
 	}
 
 	l.state.LastHeartbeat = time.Now().UTC().Format(time.RFC3339)
+	l.recordClockSkew(resp, sent, time.Now())
+	if l.state.OfflineSince != "" {
+		l.logger.Info("server reachable again", "offline_since", l.state.OfflineSince)
+		l.state.OfflineSince = ""
+	}
 
 	switch {
 	case status == 200:
-		return l.handleApproved(resp)
+		l.applyUpdate(ctx, resp)
+		interval := l.handleApproved(resp)
+		l.applyLauncherUpdate(ctx, resp)
+		return interval
 	case status == 202:
 		l.handlePending(resp)
 		if resp.RetryAfterSeconds > 0 {
 			return time.Duration(resp.RetryAfterSeconds) * time.Second
 		}
 		return 60 * time.Second
+	case status == 401:
+		l.dropCredential()
+		l.handleRejected()
+		if l.config.RegistrationToken != "" {
+			// Retry soon with the token, to re-enroll once the server has
+			// reset the credential.
+			return 60 * time.Second
+		}
+		return 3600 * time.Second
 	case status == 403:
 		l.handleRejected()
 		return 3600 * time.Second
@@ -150,8 +320,11 @@ func (l *Launcher) doHeartbeat(ctx context.Context) time.Duration {
 func (l *Launcher) handleApproved(resp *HeartbeatResponse) time.Duration {
 	l.state.ServerApproved = true
 	l.state.ConsecutiveFailures = 0
+	l.storeCredential(resp)
 
+	var changed []string
 	if resp.Config != nil {
+		changed = config.RestartSettingsChanged(l.state.ServerConfig, resp.Config)
 		l.state.ServerConfig = resp.Config
 
 		// Update log level from server config.
@@ -164,25 +337,277 @@ func (l *Launcher) handleApproved(resp *HeartbeatResponse) time.Duration {
 	// so the worker can read the latest config on startup.
 	l.saveState()
 
-	// Ensure worker process is running.
+	// The worker reads scan settings only at startup.
+	if len(changed) > 0 && l.workerManager.IsRunning() {
+		l.logger.Info("scan settings changed, restarting worker", "changed", changed)
+		l.workerManager.EnsureStopped(l.state)
+	}
+
+	l.ensureWorker()
+
+	l.logger.Info("heartbeat approved", "client_id", resp.ClientID)
+
+	if resp.Config != nil && resp.Config.HeartbeatIntervalSecs > 0 {
+		return time.Duration(resp.Config.HeartbeatIntervalSecs) * time.Second
+	}
+	return 300 * time.Second
+}
+
+// serverError returns an error for a 5xx heartbeat status: a server that is
+// up but failing is treated like one that can't be reached.
+func serverError(status int) error {
+	if status >= 500 {
+		return fmt.Errorf("server error: status %d", status)
+	}
+	return nil
+}
+
+// runOffline keeps the worker running on the config cached in the state
+// file while the server can't be reached, so a launcher started during an
+// outage still collects. The worker leaves files whose uploads fail in place
+// and retries them, so data queues locally until connectivity returns.
+// Without a previously approved config there is nothing to run.
+func (l *Launcher) runOffline() {
+	if !l.state.ServerApproved || l.state.ServerConfig == nil {
+		return
+	}
+	if l.state.OfflineSince == "" {
+		l.state.OfflineSince = time.Now().UTC().Format(time.RFC3339)
+		l.logger.Warn("server unreachable, running worker on cached config")
+	}
+	l.ensureWorker()
+}
+
+// ensureWorker starts the worker if it isn't running and records the
+// outcome in the state. An externally supervised worker's status is only
+// read from its report.
+func (l *Launcher) ensureWorker() {
+	if l.workerManager.External() {
+		l.state.WorkerStatus = l.workerManager.ExternalStatus(l.state)
+		l.state.WorkerPID = 0
+		// Its supervisor may have swapped in another version meanwhile.
+		if v, err := l.workerManager.Version(); err == nil {
+			l.state.WorkerVersion = v
+		}
+		return
+	}
+	wasRunning := l.state.WorkerStatus == "running"
+	l.checkUpdateProbation()
 	pid, started, err := l.workerManager.EnsureRunning(l.state)
-	if err != nil {
+	if errors.Is(err, ErrCrashLooping) {
+		l.logger.Warn("worker restart delayed", "error", err)
+		l.state.WorkerStatus = "crash_looping"
+		l.state.WorkerPID = 0
+		l.saveState()
+	} else if err != nil {
 		l.logger.Error("failed to ensure worker running", "error", err)
 	} else {
 		l.state.WorkerPID = pid
 		l.state.WorkerStatus = "running"
 		if started {
-			l.logger.Info("worker started", "pid", pid)
+			l.state.WorkerStartedAt = time.Now().UTC().Format(time.RFC3339)
+			if wasRunning {
+				l.state.WorkerRestarts++
+				l.logger.Warn("worker was not running, restarted", "pid", pid, "restarts", l.state.WorkerRestarts)
+			} else {
+				l.logger.Info("worker started", "pid", pid)
+			}
 			l.saveState()
 		}
 	}
+}
 
-	l.logger.Info("heartbeat approved", "client_id", resp.ClientID)
+// applyUpdate installs the worker update announced in resp, if any is due.
+// Optional updates are checked at most once per check interval; required
+// ones are installed as soon as they are seen. The update is downloaded and
+// verified while the old worker runs; it is then stopped for the swap and
+// started again here, rolling back if the new binary won't start, or, see
+// checkUpdateProbation, dies soon after. A rolled back version is not
+// installed again.
+func (l *Launcher) applyUpdate(ctx context.Context, resp *HeartbeatResponse) {
+	info := resp.Update
+	now := time.Now().UTC()
+	// An externally supervised worker is updated with its unit or image.
+	if l.updater == nil || l.workerManager.External() ||
+		!updateWanted(info, l.state.WorkerVersion, l.state.LastUpdateCheck, l.effectiveConfig(resp), now) ||
+		info.Version == l.state.RolledBackVersion {
+		return
+	}
+	l.state.LastUpdateCheck = now.Format(time.RFC3339)
+	defer l.saveState()
 
-	if resp.Config != nil && resp.Config.HeartbeatIntervalSecs > 0 {
-		return time.Duration(resp.Config.HeartbeatIntervalSecs) * time.Second
+	binary, err := l.workerManager.BinaryPath()
+	if err != nil {
+		l.logger.Error("worker update failed", "version", info.Version, "error", err)
+		return
 	}
-	return 300 * time.Second
+
+	l.logger.Info("updating worker",
+		"from", l.state.WorkerVersion,
+		"to", info.Version,
+		"required", info.Required,
+	)
+	staged, err := l.updater.Stage(ctx, info, binary)
+	if err != nil {
+		l.logger.Error("worker update failed", "version", info.Version, "error", err)
+		return
+	}
+	if !l.workerManager.EnsureStopped(l.state) {
+		os.Remove(staged)
+		l.logger.Warn("worker did not stop, deferring update", "version", info.Version)
+		return
+	}
+	if err := l.updater.Swap(staged, binary, info.Version); err != nil {
+		l.logger.Error("worker update failed", "version", info.Version, "error", err)
+		return
+	}
+
+	// The new binary may well fix whatever made the old one crash.
+	l.workerManager.ResetCrashLoop()
+	pid, _, err := l.workerManager.EnsureRunning(l.state)
+	if err != nil {
+		l.logger.Error("updated worker failed to start, rolling back", "version", info.Version, "error", err)
+		if err := l.updater.Rollback(binary); err != nil {
+			l.logger.Error("worker rollback failed", "error", err)
+		}
+		l.state.RolledBackVersion = info.Version
+		return
+	}
+	l.state.UpdatedFromVersion = l.state.WorkerVersion
+	l.state.UpdateProbationUntil = now.Add(quickDeathWindow).Format(time.RFC3339)
+	l.state.WorkerVersion = info.Version
+	if v, err := l.workerManager.Version(); err == nil && v != info.Version {
+		l.logger.Warn("updated worker reports a different version", "announced", info.Version, "reported", v)
+		l.state.WorkerVersion = v
+	}
+	l.state.WorkerPID = pid
+	l.state.WorkerStatus = "running"
+	l.state.WorkerStartedAt = now.Format(time.RFC3339)
+	l.logger.Info("worker updated", "version", info.Version, "pid", pid)
+}
+
+// checkUpdateProbation rolls back a worker update whose new worker has died
+// within quickDeathWindow of being installed, so the previous version is
+// started again in its place, and ends the probation of one that outlived it.
+func (l *Launcher) checkUpdateProbation() {
+	if l.state.UpdateProbationUntil == "" {
+		return
+	}
+	until, err := time.Parse(time.RFC3339, l.state.UpdateProbationUntil)
+	if err != nil || time.Now().After(until) {
+		l.state.UpdateProbationUntil = ""
+		return
+	}
+	if l.updater == nil || l.workerManager.PID() == 0 || l.workerManager.IsRunning() {
+		return
+	}
+	binary, err := l.workerManager.BinaryPath()
+	if err == nil {
+		err = l.updater.Rollback(binary)
+	}
+	if err != nil {
+		l.logger.Error("worker rollback failed", "error", err)
+		return
+	}
+	l.logger.Error("updated worker died soon after starting, rolled back",
+		"version", l.state.WorkerVersion, "restored", l.state.UpdatedFromVersion)
+	l.state.RolledBackVersion = l.state.WorkerVersion
+	l.state.WorkerVersion = l.state.UpdatedFromVersion
+	l.state.UpdateProbationUntil = ""
+	l.saveState()
+}
+
+// applyLauncherUpdate installs the launcher update announced in resp, if any
+// is due, and flags the launcher for handoff to the new binary. The running
+// process keeps its own copy, so replacing the file is safe on every OS.
+func (l *Launcher) applyLauncherUpdate(ctx context.Context, resp *HeartbeatResponse) {
+	info := resp.LauncherUpdate
+	now := time.Now().UTC()
+	if l.updater == nil || l.launcherBinary == "" ||
+		!updateWanted(info, l.launcherVersion, l.state.LastLauncherUpdateCheck, l.effectiveConfig(resp), now) {
+		return
+	}
+	l.state.LastLauncherUpdateCheck = now.Format(time.RFC3339)
+	defer l.saveState()
+
+	l.logger.Info("updating launcher",
+		"from", l.launcherVersion,
+		"to", info.Version,
+		"required", info.Required,
+	)
+	if err := l.updater.Install(ctx, info, l.launcherBinary); err != nil {
+		l.logger.Error("launcher update failed", "version", info.Version, "error", err)
+		return
+	}
+	l.handoff = true
+}
+
+// effectiveConfig returns the config in resp, else the last one received.
+func (l *Launcher) effectiveConfig(resp *HeartbeatResponse) *config.ClientConfig {
+	if resp.Config != nil {
+		return resp.Config
+	}
+	return l.state.ServerConfig
+}
+
+// updateWanted reports whether info announces an update to install over the
+// installed version. Optional updates wait for the check interval since
+// lastCheck; required ones don't. Updates disabled in cfg are never wanted.
+func updateWanted(info *UpdateInfo, installed, lastCheck string, cfg *config.ClientConfig, now time.Time) bool {
+	if info == nil || !info.Enabled || !info.Available {
+		return false
+	}
+	if info.Version == "" || info.Version == installed {
+		return false
+	}
+	if cfg != nil && !cfg.UpdateEnabled {
+		return false
+	}
+	return info.Required || updateCheckDue(lastCheck, updateInterval(info, cfg), now)
+}
+
+// updateInterval returns how often optional updates are checked: the
+// server's per-update interval, else the config's, else daily.
+func updateInterval(info *UpdateInfo, cfg *config.ClientConfig) time.Duration {
+	hours := info.CheckIntervalHours
+	if hours <= 0 && cfg != nil {
+		hours = cfg.UpdateCheckIntervalHrs
+	}
+	if hours <= 0 {
+		hours = 24
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// updateCheckDue reports whether interval has passed since the last check.
+// A missing or unparseable last check counts as due.
+func updateCheckDue(last string, interval time.Duration, now time.Time) bool {
+	t, err := time.Parse(time.RFC3339, last)
+	if err != nil {
+		return true
+	}
+	return now.Sub(t) >= interval
+}
+
+// storeCredential keeps the credential the server issued in exchange for
+// the registration token. It is sent instead of the token from then on.
+func (l *Launcher) storeCredential(resp *HeartbeatResponse) {
+	if resp.ClientCredential == "" {
+		return
+	}
+	l.state.ClientCredential = resp.ClientCredential
+	l.logger.Info("enrolled with registration token", "client_id", resp.ClientID)
+}
+
+// dropCredential forgets a credential the server no longer accepts, so the
+// registration token, if one is configured, is sent again to re-enroll.
+func (l *Launcher) dropCredential() {
+	if l.state.ClientCredential == "" {
+		l.logger.Error("server requires a client credential; enroll with a registration token")
+		return
+	}
+	l.state.ClientCredential = ""
+	l.logger.Error("server rejected the client credential, dropping it; re-enroll with a new registration token")
 }
 
 // handlePending processes a 202 pending heartbeat response.
@@ -192,8 +617,6 @@ func (l *Launcher) handlePending(resp *HeartbeatResponse) {
 
 	// Stop worker — not approved yet.
 	l.workerManager.EnsureStopped(l.state)
-	l.state.WorkerStatus = "stopped"
-	l.state.WorkerPID = 0
 	l.saveState()
 
 	l.logger.Info("heartbeat pending",
@@ -208,13 +631,60 @@ func (l *Launcher) handleRejected() {
 	l.state.ConsecutiveFailures = 0
 
 	l.workerManager.EnsureStopped(l.state)
-	l.state.WorkerStatus = "stopped"
-	l.state.WorkerPID = 0
 	l.saveState()
 
 	l.logger.Warn("client rejected by server, heartbeat interval set to 1hr")
 }
 
+// clockSkewWarn is how far the local clock may be off from the server's
+// before the launcher warns about it.
+const clockSkewWarn = time.Minute
+
+// recordClockSkew measures how far the local clock is off from the server's,
+// comparing the response's server time to the midpoint of the request. The
+// server time has second precision, so smaller skews are noise.
+func (l *Launcher) recordClockSkew(resp *HeartbeatResponse, sent, received time.Time) {
+	if resp == nil || resp.ServerTime == "" {
+		return
+	}
+	serverTime, err := time.Parse(time.RFC3339, resp.ServerTime)
+	if err != nil {
+		l.logger.Debug("ignoring unparsable server time", "server_time", resp.ServerTime)
+		return
+	}
+	skew := serverTime.Sub(sent.Add(received.Sub(sent) / 2)).Round(time.Second)
+	l.state.ClockSkewSeconds = int(skew / time.Second)
+
+	if skew.Abs() < clockSkewWarn {
+		if l.skewWarned {
+			l.logger.Info("clock skew back within bounds", "skew", skew)
+			l.skewWarned = false
+		}
+		return
+	}
+	if !l.skewWarned {
+		l.logger.Warn("local clock is off from the server's",
+			"skew", skew,
+			"correcting", l.state.CorrectClock,
+		)
+		l.skewWarned = true
+	}
+}
+
+// detectWorkerVersion records the version the installed worker binary
+// reports. If it can't be queried the last known version is kept.
+func (l *Launcher) detectWorkerVersion() {
+	v, err := l.workerManager.Version()
+	if err != nil {
+		l.logger.Warn("could not determine worker version", "error", err)
+		return
+	}
+	if v != l.state.WorkerVersion {
+		l.logger.Info("worker version detected", "version", v)
+	}
+	l.state.WorkerVersion = v
+}
+
 // buildHeartbeatRequest constructs a HeartbeatRequest from current state.
 func (l *Launcher) buildHeartbeatRequest() *HeartbeatRequest {
 	workerVersion := l.state.WorkerVersion
@@ -227,9 +697,9 @@ func (l *Launcher) buildHeartbeatRequest() *HeartbeatRequest {
 		workerStatus = "stopped"
 	}
 
-	return &HeartbeatRequest{
+	req := &HeartbeatRequest{
 		ClientHostname:  l.config.Hostname,
-		Timestamp:       time.Now().UTC().Format(time.RFC3339),
+		Timestamp:       time.Now().Add(l.state.ClockOffset()).UTC().Format(time.RFC3339),
 		LauncherVersion: l.launcherVersion,
 		WorkerVersion:   workerVersion,
 		WorkerStatus:    workerStatus,
@@ -238,11 +708,58 @@ func (l *Launcher) buildHeartbeatRequest() *HeartbeatRequest {
 			Arch:     platform.ArchName(),
 			Platform: platform.PlatformDetail(),
 		},
+		Stats:              l.workerStats(),
+		Uptime:             config.NewUptimeInfo(l.state, time.Now()),
+		SupportedChecksums: config.SupportedChecksums(),
+		ClientCredential:   l.state.ClientCredential,
+		ClockSkewSeconds:   l.state.ClockSkewSeconds,
+	}
+	if req.ClientCredential == "" {
+		req.RegistrationToken = l.config.RegistrationToken
+	}
+	return req
+}
+
+// workerStats reads the worker's latest report for inclusion in the heartbeat.
+// Returns nil if the worker has not reported yet.
+func (l *Launcher) workerStats() *HeartbeatStats {
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(l.statePath))
+	if err != nil {
+		l.logger.Warn("failed to read worker report", "error", err)
+		return nil
+	}
+	if report == nil {
+		return nil
+	}
+	return &HeartbeatStats{
+		FilesUploadedToday: report.FilesUploadedToday,
+		LastScanTime:       report.LastScanTime,
+		BytesUploadedToday: report.BytesUploadedToday,
+		DailyCapReached:    report.DailyCapReached,
+
+		DirectoriesMonitored: report.DiscoveryPaths - report.UnreachablePaths,
+		UnreachablePaths:     report.UnreachablePaths,
+
+		PermissionDenied: report.PermissionDenied,
+		FilesTooOld:      report.FilesTooOld,
+		FilesTooLarge:    report.FilesTooLarge,
+		GlobErrors:       report.GlobErrors,
+
+		ValidationFailures: report.ValidationFailures,
 	}
 }
 
 func (l *Launcher) saveState() {
-	if err := l.state.Save(l.statePath); err != nil {
+	if err := l.writeState(); err != nil {
 		l.logger.Error("failed to save state", "error", err)
 	}
 }
+
+// writeState saves the state file, shared with the worker's group if the
+// worker runs as another user.
+func (l *Launcher) writeState() error {
+	if l.workerUser != nil {
+		return l.state.SaveShared(l.statePath, l.workerUser.GID)
+	}
+	return l.state.Save(l.statePath)
+}
@@ -2,8 +2,10 @@ package launcher
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log/slog"
+	"os"
 	"path/filepath"
 	"testing"
 	"time"
@@ -19,10 +21,12 @@ type mockHeartbeatSender2 struct {
 	status   int
 	err      error
 	calls    int
+	requests []*HeartbeatRequest
 }
 
-func (m *mockHeartbeatSender2) SendHeartbeat(_ context.Context, _ *HeartbeatRequest) (*HeartbeatResponse, int, error) {
+func (m *mockHeartbeatSender2) SendHeartbeat(_ context.Context, req *HeartbeatRequest) (*HeartbeatResponse, int, error) {
 	m.calls++
+	m.requests = append(m.requests, req)
 	return m.response, m.status, m.err
 }
 
@@ -70,6 +74,36 @@ func TestLauncher_ApprovedFlow(t *testing.T) {
 	assert.NotNil(t, state.ServerConfig)
 }
 
+func TestLauncher_ExternalWorker(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	wm.SetExternal(true)
+	hb := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{ClientID: "id", Approved: true, Config: &cfg}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+	require.NoError(t, l.loadState())
+
+	// The worker has not reported yet: it is stopped, and not started here.
+	l.doHeartbeat(context.Background())
+	assert.Empty(t, checker.running)
+	assert.Equal(t, "stopped", l.state.WorkerStatus)
+	assert.True(t, l.state.ServerApproved, "config is still written for the worker")
+
+	// Once it reports, it is running at the version it reports.
+	report := &config.WorkerReport{WorkerVersion: "2.0.0", UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	require.NoError(t, report.Save(config.WorkerReportPath(statePath)))
+	l.doHeartbeat(context.Background())
+	assert.Equal(t, "running", l.state.WorkerStatus)
+	assert.Equal(t, "2.0.0", l.state.WorkerVersion)
+	assert.Equal(t, "running", hb.requests[len(hb.requests)-1].WorkerStatus)
+
+	// One-shot runs don't run it either.
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Empty(t, checker.runs)
+}
+
 func TestLauncher_PendingFlow(t *testing.T) {
 	hb := &mockHeartbeatSender2{
 		response: &HeartbeatResponse{
@@ -118,6 +152,66 @@ func TestLauncher_RejectedFlow(t *testing.T) {
 	assert.Equal(t, "stopped", state.WorkerStatus)
 }
 
+func TestLauncher_OfflineRunsCachedConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	hb := &mockHeartbeatSender2{err: errors.New("connection refused")}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	// First-ever start: nothing cached, nothing runs.
+	require.NoError(t, l.loadState())
+	l.doHeartbeat(context.Background())
+	assert.Empty(t, checker.running)
+	assert.Empty(t, l.state.OfflineSince)
+
+	// A previously approved config keeps the worker running through an outage.
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: &cfg}).Save(statePath))
+	require.NoError(t, l.loadState())
+	l.doHeartbeat(context.Background())
+	assert.Equal(t, "running", l.state.WorkerStatus)
+	assert.True(t, wm.IsRunning())
+	assert.NotEmpty(t, l.state.OfflineSince)
+
+	// A failing server counts as unreachable too.
+	hb.err, hb.status = nil, 503
+	hb.response = &HeartbeatResponse{Message: "storage unavailable"}
+	checker.running[wm.PID()] = false
+	l.doHeartbeat(context.Background())
+	assert.Equal(t, "running", l.state.WorkerStatus)
+	assert.True(t, wm.IsRunning())
+	assert.NotEmpty(t, l.state.OfflineSince)
+
+	// Back online, the offline marker is cleared.
+	hb.err, hb.status = nil, 200
+	hb.response = &HeartbeatResponse{ClientID: "id", Approved: true, Config: &cfg}
+	l.doHeartbeat(context.Background())
+	assert.Empty(t, l.state.OfflineSince)
+	assert.Equal(t, "running", l.state.WorkerStatus)
+}
+
+func TestLauncher_RunOnceOffline(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: &cfg}).Save(statePath))
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	hb := &mockHeartbeatSender2{err: errors.New("connection refused")}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	err := l.RunOnce(context.Background())
+	assert.ErrorContains(t, err, "heartbeat", "the failed heartbeat is still reported")
+	assert.Len(t, checker.runs, 1, "the worker ran on the cached config")
+
+	hb.err, hb.status, hb.response = nil, 500, &HeartbeatResponse{}
+	err = l.RunOnce(context.Background())
+	assert.ErrorContains(t, err, "status 500")
+	assert.Len(t, checker.runs, 2, "a server error is handled like an outage")
+}
+
 func TestLauncher_ErrorBackoff(t *testing.T) {
 	hb := &mockHeartbeatSender2{
 		err: assert.AnError,
@@ -164,3 +258,459 @@ func TestLauncher_GracefulShutdown(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "stopped", state.WorkerStatus)
 }
+
+func TestLauncher_HeartbeatIncludesWorkerReport(t *testing.T) {
+	l, statePath := newLauncherForTest(t, &mockHeartbeatSender2{})
+	l.state = &config.StateFile{}
+
+	assert.Nil(t, l.buildHeartbeatRequest().Stats)
+	assert.Equal(t, config.SupportedChecksums(), l.buildHeartbeatRequest().SupportedChecksums)
+
+	report := &config.WorkerReport{FilesUploadedToday: 7, BytesUploadedToday: 1024, DailyCapReached: true,
+		DiscoveryPaths: 5, UnreachablePaths: 2, PermissionDenied: 4, FilesTooOld: 3, FilesTooLarge: 1, GlobErrors: 1,
+		ValidationFailures: map[string]int{"missing_field:model": 2}}
+	require.NoError(t, report.Save(config.WorkerReportPath(statePath)))
+
+	stats := l.buildHeartbeatRequest().Stats
+	require.NotNil(t, stats)
+	assert.Equal(t, 7, stats.FilesUploadedToday)
+	assert.Equal(t, int64(1024), stats.BytesUploadedToday)
+	assert.True(t, stats.DailyCapReached)
+	assert.Equal(t, 3, stats.DirectoriesMonitored)
+	assert.Equal(t, 2, stats.UnreachablePaths)
+	assert.Equal(t, 4, stats.PermissionDenied)
+	assert.Equal(t, 3, stats.FilesTooOld)
+	assert.Equal(t, 1, stats.FilesTooLarge)
+	assert.Equal(t, 1, stats.GlobErrors)
+	assert.Equal(t, map[string]int{"missing_field:model": 2}, stats.ValidationFailures)
+}
+
+func TestLauncher_CountsStartsAndWorkerRestarts(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	cfg := config.DefaultConfig()
+	hb := &mockHeartbeatSender2{response: &HeartbeatResponse{ClientID: "id", Approved: true, Config: &cfg}, status: 200}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		require.NoError(t, l.Run(ctx))
+		cancel()
+	}
+	state, err := config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, state.LauncherStarts)
+	assert.NotEmpty(t, state.LauncherStartedAt)
+	assert.Zero(t, state.WorkerRestarts, "starts after a clean shutdown are not restarts")
+
+	// The worker dies while it should be running: the next heartbeat restarts it.
+	l.state.WorkerStatus = "running"
+	for pid := range checker.running {
+		checker.running[pid] = false
+	}
+	l.handleApproved(hb.response)
+	assert.Equal(t, 1, l.state.WorkerRestarts)
+	assert.NotEmpty(t, l.state.WorkerStartedAt)
+
+	up := l.buildHeartbeatRequest().Uptime
+	require.NotNil(t, up)
+	assert.Equal(t, 1, up.LauncherRestarts)
+	assert.Equal(t, 1, up.WorkerRestarts)
+	assert.NotEmpty(t, up.WorkerStartedAt)
+}
+
+func newUpdateLauncher(t *testing.T, body []byte) (*Launcher, *mockChecker, string) {
+	t.Helper()
+	srv, _ := serveBinary(t, body)
+	binary := installedBinary(t, "old worker")
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager(binary, statePath, checker, silentLogger())
+	l := NewLauncher(LauncherConfig{ServerURL: srv.URL, Hostname: "h"}, statePath, &mockHeartbeatSender2{}, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+	l.SetUpdater(NewUpdater(srv.URL, silentLogger()))
+	l.state = &config.StateFile{WorkerVersion: "1.0.0"}
+	return l, checker, binary
+}
+
+func TestLauncher_AppliesUpdate(t *testing.T) {
+	body := []byte("new worker")
+	l, _, binary := newUpdateLauncher(t, body)
+	cfg := config.DefaultConfig()
+	resp := &HeartbeatResponse{Approved: true, Config: &cfg, Update: &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0",
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body),
+	}}
+
+	l.applyUpdate(context.Background(), resp)
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new worker", string(data))
+	assert.Equal(t, "1.1.0", l.state.WorkerVersion)
+	assert.Equal(t, "running", l.state.WorkerStatus)
+	assert.NotEmpty(t, l.state.LastUpdateCheck)
+}
+
+func TestLauncher_UpdateHonorsIntervalAndRequired(t *testing.T) {
+	body := []byte("new worker")
+	l, _, binary := newUpdateLauncher(t, body)
+	cfg := config.DefaultConfig()
+	info := &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0",
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body), CheckIntervalHours: 6,
+	}
+	resp := &HeartbeatResponse{Approved: true, Config: &cfg, Update: info}
+
+	// Checked an hour ago: an optional update waits for the interval.
+	l.state.LastUpdateCheck = time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	l.applyUpdate(context.Background(), resp)
+	assert.Equal(t, "1.0.0", l.state.WorkerVersion)
+
+	// Updates disabled in config: even a required one is skipped.
+	info.Required = true
+	cfg.UpdateEnabled = false
+	l.applyUpdate(context.Background(), resp)
+	assert.Equal(t, "1.0.0", l.state.WorkerVersion)
+
+	// A required update does not wait for the interval.
+	cfg.UpdateEnabled = true
+	l.applyUpdate(context.Background(), resp)
+	assert.Equal(t, "1.1.0", l.state.WorkerVersion)
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new worker", string(data))
+}
+
+func TestLauncher_UpdateRollsBackWhenWorkerFailsToStart(t *testing.T) {
+	body := []byte("new worker")
+	l, checker, binary := newUpdateLauncher(t, body)
+	checker.startError = errors.New("exec format error")
+	resp := &HeartbeatResponse{Approved: true, Update: &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0",
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body),
+	}}
+
+	l.applyUpdate(context.Background(), resp)
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(data))
+	assert.Equal(t, "1.0.0", l.state.WorkerVersion)
+}
+
+func TestLauncher_UpdateVerifiedBeforeStoppingWorker(t *testing.T) {
+	l, checker, _ := newUpdateLauncher(t, []byte("new worker"))
+	_, _, err := l.workerManager.EnsureRunning(l.state)
+	require.NoError(t, err)
+	resp := &HeartbeatResponse{Approved: true, Update: &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0",
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum([]byte("other")),
+	}}
+
+	l.applyUpdate(context.Background(), resp)
+	assert.Zero(t, checker.stops, "a download that fails verification leaves the worker running")
+	assert.True(t, l.workerManager.IsRunning())
+}
+
+func TestLauncher_UpdateRollsBackWhenWorkerDiesSoon(t *testing.T) {
+	body := []byte("new worker")
+	l, checker, binary := newUpdateLauncher(t, body)
+	resp := &HeartbeatResponse{Approved: true, Update: &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0", Required: true,
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body),
+	}}
+	l.applyUpdate(context.Background(), resp)
+	require.Equal(t, "1.1.0", l.state.WorkerVersion)
+	require.NotEmpty(t, l.state.UpdateProbationUntil)
+
+	checker.running[l.workerManager.PID()] = false
+	l.ensureWorker()
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(data))
+	assert.Equal(t, "1.0.0", l.state.WorkerVersion)
+	assert.Equal(t, "1.1.0", l.state.RolledBackVersion)
+	assert.True(t, l.workerManager.IsRunning(), "the previous version is started again")
+
+	l.applyUpdate(context.Background(), resp)
+	assert.Equal(t, "1.0.0", l.state.WorkerVersion, "a rolled back version is not installed again")
+}
+
+func TestLauncher_SelfUpdateHandsOff(t *testing.T) {
+	body := []byte("new launcher")
+	srv, _ := serveBinary(t, body)
+	self := installedBinary(t, "old launcher")
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	cfg := config.DefaultConfig()
+	hb := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{
+		ClientID: "id", Approved: true, Config: &cfg,
+		LauncherUpdate: &UpdateInfo{
+			Enabled: true, Available: true, Version: "1.1.0",
+			DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body),
+		},
+	}}
+	l := NewLauncher(LauncherConfig{ServerURL: srv.URL, Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+	l.SetUpdater(NewUpdater(srv.URL, silentLogger()))
+	l.SetLauncherBinary(self)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	err := l.Run(ctx)
+	require.ErrorIs(t, err, ErrHandoff)
+
+	data, err := os.ReadFile(self)
+	require.NoError(t, err)
+	assert.Equal(t, "new launcher", string(data))
+
+	// The worker keeps running across the handoff.
+	state, err := config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "running", state.WorkerStatus)
+	assert.True(t, checker.running[state.WorkerPID])
+	assert.Equal(t, "1.0.0", state.LauncherVersion)
+	assert.NotEmpty(t, state.LastLauncherUpdateCheck)
+}
+
+func TestUpdateWanted(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	cfg := config.DefaultConfig()
+	info := &UpdateInfo{Enabled: true, Available: true, Version: "1.1.0", CheckIntervalHours: 6}
+	recent := now.Add(-time.Hour).Format(time.RFC3339)
+	old := now.Add(-7 * time.Hour).Format(time.RFC3339)
+
+	assert.True(t, updateWanted(info, "1.0.0", "", &cfg, now))
+	assert.True(t, updateWanted(info, "1.0.0", old, &cfg, now))
+	assert.False(t, updateWanted(info, "1.0.0", recent, &cfg, now))
+	assert.False(t, updateWanted(info, "1.1.0", "", &cfg, now), "already installed")
+	assert.False(t, updateWanted(nil, "1.0.0", "", &cfg, now))
+
+	required := *info
+	required.Required = true
+	assert.True(t, updateWanted(&required, "1.0.0", recent, &cfg, now))
+
+	cfg.UpdateEnabled = false
+	assert.False(t, updateWanted(&required, "1.0.0", "", &cfg, now))
+}
+
+func TestLauncher_RestartsWorkerWhenScanSettingsChange(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, &mockHeartbeatSender2{}, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+	l.state = &config.StateFile{}
+
+	cfg := config.DefaultConfig()
+	l.handleApproved(&HeartbeatResponse{Approved: true, Config: &cfg})
+	first := l.state.WorkerPID
+	require.True(t, checker.running[first])
+
+	// A change the worker applies live leaves it alone.
+	live := cfg
+	live.LogLevel = "debug"
+	l.handleApproved(&HeartbeatResponse{Approved: true, Config: &live})
+	assert.Equal(t, first, l.state.WorkerPID)
+
+	// A scan setting change restarts it.
+	scan := live
+	scan.ScanIntervalMinutes = cfg.ScanIntervalMinutes * 2
+	l.handleApproved(&HeartbeatResponse{Approved: true, Config: &scan})
+	assert.False(t, checker.running[first])
+	assert.NotEqual(t, first, l.state.WorkerPID)
+	assert.True(t, checker.running[l.state.WorkerPID])
+	assert.Zero(t, l.state.WorkerRestarts, "a deliberate restart is not a crash")
+}
+
+func TestLauncher_RunOnce(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	hb := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{ClientID: "id", Approved: true, Config: &cfg}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Equal(t, 1, hb.calls)
+	require.Len(t, checker.runs, 1)
+	assert.Equal(t, []string{"--state-path", statePath, "--once"}, checker.runs[0])
+	assert.Empty(t, checker.running, "no long-running worker is started")
+
+	state, err := config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.True(t, state.ServerApproved)
+	assert.NotNil(t, state.ServerConfig)
+	assert.Zero(t, state.LauncherStarts, "one-shot runs are not launcher restarts")
+
+	// A failed worker run is an error.
+	checker.runError = errors.New("exit status 1")
+	assert.Error(t, l.RunOnce(context.Background()))
+}
+
+func TestLauncher_ReportsDetectedWorkerVersion(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	hb := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{ClientID: "id", Approved: true, Config: &cfg}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	// Without a working --version the heartbeat falls back to 0.0.0.
+	require.NoError(t, l.RunOnce(context.Background()))
+	require.Len(t, hb.requests, 1)
+	assert.Equal(t, "0.0.0", hb.requests[0].WorkerVersion)
+
+	checker.output = "tokenly-worker version 1.2.3 (commit: abc, built: now)\n"
+	require.NoError(t, l.RunOnce(context.Background()))
+	require.Len(t, hb.requests, 2)
+	assert.Equal(t, "1.2.3", hb.requests[1].WorkerVersion)
+
+	// A later failure to query keeps the last known version.
+	checker.output = ""
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Equal(t, "1.2.3", hb.requests[2].WorkerVersion)
+}
+
+func TestLauncher_RecordsClockSkew(t *testing.T) {
+	l, _ := newLauncherForTest(t, &mockHeartbeatSender2{})
+	require.NoError(t, l.loadState())
+
+	sent := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	received := sent.Add(2 * time.Second)
+	resp := &HeartbeatResponse{ServerTime: "2026-01-15T10:05:01Z"}
+	l.recordClockSkew(resp, sent, received)
+	assert.Equal(t, 300, l.state.ClockSkewSeconds, "measured against the request's midpoint")
+	assert.True(t, l.skewWarned)
+
+	req := l.buildHeartbeatRequest()
+	assert.Equal(t, 300, req.ClockSkewSeconds)
+	ts, err := time.Parse(time.RFC3339, req.Timestamp)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), ts, 5*time.Second, "uncorrected by default")
+
+	l.state.CorrectClock = true
+	ts, err = time.Parse(time.RFC3339, l.buildHeartbeatRequest().Timestamp)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), ts, 5*time.Second)
+
+	l.recordClockSkew(&HeartbeatResponse{ServerTime: "2026-01-15T10:00:01Z"}, sent, received)
+	assert.Zero(t, l.state.ClockSkewSeconds)
+	assert.False(t, l.skewWarned)
+
+	// An unparsable server time leaves the measurement alone.
+	l.state.ClockSkewSeconds = 7
+	l.recordClockSkew(&HeartbeatResponse{ServerTime: "soon"}, sent, received)
+	assert.Equal(t, 7, l.state.ClockSkewSeconds)
+}
+
+func TestLauncher_UpdateRecordsReportedVersion(t *testing.T) {
+	body := []byte("new worker")
+	l, checker, _ := newUpdateLauncher(t, body)
+	checker.output = "tokenly-worker version 1.1.1 (commit: abc, built: now)\n"
+	cfg := config.DefaultConfig()
+	resp := &HeartbeatResponse{Approved: true, Config: &cfg, Update: &UpdateInfo{
+		Enabled: true, Available: true, Version: "1.1.0",
+		DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body),
+	}}
+
+	l.applyUpdate(context.Background(), resp)
+	assert.Equal(t, "1.1.1", l.state.WorkerVersion, "the installed binary's own version wins")
+}
+
+func TestLauncher_RegistrationTokenEnrollment(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	wm := NewWorkerManager("tokenly-worker", statePath, newMockChecker(), silentLogger())
+	hb := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{
+		ClientID: "id", Approved: true, Config: &cfg, ClientCredential: "issued-credential",
+	}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h", RegistrationToken: "one-time"},
+		statePath, hb, wm, silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Equal(t, "one-time", hb.requests[0].RegistrationToken)
+	assert.Empty(t, hb.requests[0].ClientCredential)
+
+	state, err := config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "issued-credential", state.ClientCredential)
+
+	// Once enrolled, the credential is sent instead of the token.
+	hb.response.ClientCredential = ""
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Empty(t, hb.requests[1].RegistrationToken)
+	assert.Equal(t, "issued-credential", hb.requests[1].ClientCredential)
+
+	// A rejected credential stops the client like a rejection, and is
+	// dropped so the token is sent again.
+	hb.status = 401
+	require.ErrorIs(t, l.RunOnce(context.Background()), ErrRejected)
+	state, err = config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Empty(t, state.ClientCredential)
+	hb.status = 200
+	require.NoError(t, l.RunOnce(context.Background()))
+	assert.Equal(t, "one-time", hb.requests[3].RegistrationToken)
+	assert.Empty(t, hb.requests[3].ClientCredential)
+}
+
+func TestLauncher_LoadsCredentialKeptApart(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, (&config.StateFile{ClientCredential: "issued"}).SaveShared(statePath, os.Getgid()))
+	wm := NewWorkerManager("tokenly-worker", statePath, newMockChecker(), silentLogger())
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath,
+		&mockHeartbeatSender2{}, wm, silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	require.NoError(t, l.loadState())
+	assert.Equal(t, "issued", l.buildHeartbeatRequest().ClientCredential)
+}
+
+func TestLauncher_RejectedCredentialRetriesWithToken(t *testing.T) {
+	cfg := config.DefaultConfig()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	wm := NewWorkerManager("tokenly-worker", statePath, newMockChecker(), silentLogger())
+	hb := &mockHeartbeatSender2{status: 401, response: &HeartbeatResponse{}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h", RegistrationToken: "one-time"},
+		statePath, hb, wm, silentLogger(), &slog.LevelVar{}, "1.0.0")
+	require.NoError(t, l.loadState())
+	l.state.ClientCredential = "revoked"
+	l.state.ServerConfig = &cfg
+
+	assert.Equal(t, 60*time.Second, l.doHeartbeat(context.Background()))
+	assert.Empty(t, l.state.ClientCredential)
+	assert.Equal(t, "one-time", l.buildHeartbeatRequest().RegistrationToken)
+
+	l.config.RegistrationToken = ""
+	assert.Equal(t, 3600*time.Second, l.doHeartbeat(context.Background()))
+}
+
+func TestLauncher_RunOnceNotApproved(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	hb := &mockHeartbeatSender2{status: 202, response: &HeartbeatResponse{Message: "awaiting approval"}}
+	l := NewLauncher(LauncherConfig{ServerURL: "http://test", Hostname: "h"}, statePath, hb, wm,
+		silentLogger(), &slog.LevelVar{}, "1.0.0")
+
+	require.ErrorIs(t, l.RunOnce(context.Background()), ErrPending)
+
+	hb.status, hb.response = 403, &HeartbeatResponse{}
+	require.ErrorIs(t, l.RunOnce(context.Background()), ErrRejected)
+
+	hb.err = errors.New("connection refused")
+	err := l.RunOnce(context.Background())
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrPending)
+	assert.Empty(t, checker.runs)
+
+	state, err := config.LoadState(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, 1, state.ConsecutiveFailures)
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// processRunning sends pid signal 0, which checks that it exists without
+// signalling it. A process owned by another user refuses it with EPERM but
+// is alive all the same.
+func processRunning(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	err = proc.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// processPath returns the executable pid runs: from /proc where there is
+// one, and from ps otherwise.
+func processPath(pid int) (string, error) {
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		// A binary replaced by an update since the process started.
+		return strings.TrimSuffix(exe, " (deleted)"), nil
+	}
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return "", fmt.Errorf("read executable of process %d: %w", pid, err)
+	}
+	exe := strings.TrimSpace(string(out))
+	if exe == "" {
+		return "", fmt.Errorf("read executable of process %d: no such process", pid)
+	}
+	return exe, nil
+}
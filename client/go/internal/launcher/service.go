@@ -0,0 +1,43 @@
+package launcher
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// ServiceOptions describes the launcher service to install.
+type ServiceOptions struct {
+	Binary    string            // absolute path of the launcher binary
+	ServerURL string            // --server value
+	User      string            // account to run as; empty or "root" runs as root
+	Headers   map[string]string // --header values
+	LogLevel  string            // --log-level value; empty keeps the default
+}
+
+// Args returns the command line the service runs, binary first, with
+// headers in name order so generated files are stable.
+func (o ServiceOptions) Args() []string {
+	args := []string{o.Binary, "--server", o.ServerURL}
+	if o.LogLevel != "" {
+		args = append(args, "--log-level", o.LogLevel)
+	}
+	names := make([]string, 0, len(o.Headers))
+	for name := range o.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--header", name+"="+o.Headers[name])
+	}
+	return args
+}
+
+func (o ServiceOptions) runsAsRoot() bool {
+	return o.User == "" || o.User == "root"
+}
+
+// searchPath returns the PATH the service runs with. The worker is found on
+// PATH, so the launcher's directory goes first.
+func (o ServiceOptions) searchPath() string {
+	return filepath.Dir(o.Binary) + ":/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+}
@@ -0,0 +1,187 @@
+package launcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// StatusServer serves the agent's status over HTTP on a loopback address,
+// for node monitoring agents: /healthz for liveness checks, /status with the
+// same JSON as the status subcommand, and /metrics in the Prometheus text
+// format. Everything is read from the state file and worker report, as the
+// status subcommand does.
+type StatusServer struct {
+	statePath string
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+// NewStatusServer creates a StatusServer reporting on the state file at
+// statePath.
+func NewStatusServer(statePath string, logger *slog.Logger) *StatusServer {
+	return &StatusServer{statePath: statePath, logger: logger, now: time.Now}
+}
+
+// Serve listens on addr, which must be a loopback address, and serves until
+// ctx is done.
+func (s *StatusServer) Serve(ctx context.Context, addr string) error {
+	if err := checkLoopback(addr); err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen on status address: %w", err)
+	}
+
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	s.logger.Info("serving status", "addr", ln.Addr().String())
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve status: %w", err)
+	}
+	return nil
+}
+
+// Handler returns the HTTP handler for the status endpoints.
+func (s *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", s.handleHealthz)
+	mux.HandleFunc("GET /status", s.handleStatus)
+	mux.HandleFunc("GET /metrics", s.handleMetrics)
+	return mux
+}
+
+// load reads the current status from the state file and worker report.
+func (s *StatusServer) load() (*config.Status, error) {
+	state, err := config.LoadState(s.statePath)
+	if err != nil {
+		return nil, err
+	}
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(s.statePath))
+	if err != nil {
+		s.logger.Warn("failed to read worker report", "error", err)
+	}
+	return config.NewStatus(state, report, s.now()), nil
+}
+
+// handleHealthz answers 200 unless an approved client's worker isn't
+// running, which is 503. A client still waiting for approval is healthy.
+func (s *StatusServer) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	st, err := s.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if st.Approved && st.WorkerStatus != "running" {
+		http.Error(w, "worker "+st.WorkerStatus, http.StatusServiceUnavailable)
+		return
+	}
+	io.WriteString(w, "ok\n")
+}
+
+func (s *StatusServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := s.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	config.WriteStatusJSON(w, st)
+}
+
+func (s *StatusServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	st, err := s.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	WriteMetrics(w, st)
+}
+
+// WriteMetrics writes st in the Prometheus text exposition format.
+// Timestamps are Unix seconds; unknown ones are left out.
+func WriteMetrics(w io.Writer, st *config.Status) {
+	gauge := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name, formatMetric(v))
+	}
+	counter := func(name, help string, v float64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %s\n", name, help, name, name, formatMetric(v))
+	}
+	timestamp := func(name, help, ts string) {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil {
+			gauge(name, help, float64(t.Unix()))
+		}
+	}
+
+	gauge("tokenly_approved", "Whether the server has approved this client.", boolMetric(st.Approved))
+	gauge("tokenly_worker_running", "Whether the worker process is running.", boolMetric(st.WorkerStatus == "running"))
+	gauge("tokenly_worker_crash_looping", "Whether worker restarts are backed off after repeated crashes.",
+		boolMetric(st.WorkerStatus == "crash_looping"))
+	gauge("tokenly_offline", "Whether the worker is running on cached config because heartbeats fail.",
+		boolMetric(st.OfflineSince != ""))
+	gauge("tokenly_heartbeat_consecutive_failures", "Heartbeats failed in a row.", float64(st.ConsecutiveFailures))
+	timestamp("tokenly_last_heartbeat_timestamp_seconds", "Time of the last successful heartbeat.", st.LastHeartbeat)
+
+	if up := st.Uptime; up != nil {
+		gauge("tokenly_launcher_uptime_seconds", "Seconds since the launcher started.", float64(up.LauncherUptimeSecs))
+		counter("tokenly_launcher_restarts_total", "Launcher restarts recorded in the state file.", float64(up.LauncherRestarts))
+		counter("tokenly_worker_restarts_total", "Times the worker was found dead and restarted.", float64(up.WorkerRestarts))
+		counter("tokenly_worker_hung_restarts_total", "Times the worker was killed and restarted for making no progress.",
+			float64(up.WorkerHungRestarts))
+		if up.WorkerStartedAt != "" {
+			gauge("tokenly_worker_uptime_seconds", "Seconds since the worker started.", float64(up.WorkerUptimeSecs))
+		}
+	}
+
+	if r := st.Report; r != nil {
+		timestamp("tokenly_last_scan_timestamp_seconds", "Time of the worker's last scan.", r.LastScanTime)
+		gauge("tokenly_files_uploaded_today", "Files uploaded today.", float64(r.FilesUploadedToday))
+		gauge("tokenly_bytes_uploaded_today", "Bytes uploaded today.", float64(r.BytesUploadedToday))
+		gauge("tokenly_daily_cap_reached", "Whether today's upload cap is reached.", boolMetric(r.DailyCapReached))
+		gauge("tokenly_discovery_paths", "Configured discovery paths.", float64(r.DiscoveryPaths))
+		gauge("tokenly_unreachable_paths", "Discovery paths that could not be read in the last scan.", float64(r.UnreachablePaths))
+	}
+}
+
+func formatMetric(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// checkLoopback rejects listen addresses other than loopback ones, so the
+// status endpoint isn't exposed to the network.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid status address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil
+	}
+	return fmt.Errorf("status address %q is not a loopback address", addr)
+}
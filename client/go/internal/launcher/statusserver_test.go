@@ -0,0 +1,122 @@
+package launcher
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func newStatusServerForTest(t *testing.T, state *config.StateFile) (*StatusServer, string) {
+	t.Helper()
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, state.Save(statePath))
+	s := NewStatusServer(statePath, silentLogger())
+	s.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	return s, statePath
+}
+
+func getStatus(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestStatusServer_Healthz(t *testing.T) {
+	s, statePath := newStatusServerForTest(t, &config.StateFile{})
+	h := s.Handler()
+
+	// Waiting for approval is healthy.
+	code, body := getStatus(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok\n", body)
+
+	require.NoError(t, (&config.StateFile{ServerApproved: true, WorkerStatus: "crash_looping"}).Save(statePath))
+	code, body = getStatus(t, h, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Contains(t, body, "crash_looping")
+
+	require.NoError(t, (&config.StateFile{ServerApproved: true, WorkerStatus: "running"}).Save(statePath))
+	code, _ = getStatus(t, h, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+}
+
+func TestStatusServer_StatusAndMetrics(t *testing.T) {
+	s, statePath := newStatusServerForTest(t, &config.StateFile{
+		ServerEndpoint:      "https://tokenly.example.com",
+		ServerApproved:      true,
+		WorkerStatus:        "running",
+		WorkerPID:           4242,
+		WorkerStartedAt:     "2026-03-01T11:00:00Z",
+		LauncherStartedAt:   "2026-03-01T10:00:00Z",
+		LauncherStarts:      2,
+		LastHeartbeat:       "2026-03-01T11:59:00Z",
+		ConsecutiveFailures: 1,
+	})
+	require.NoError(t, (&config.WorkerReport{FilesUploadedToday: 7, DiscoveryPaths: 3}).Save(config.WorkerReportPath(statePath)))
+	h := s.Handler()
+
+	code, body := getStatus(t, h, "/status")
+	require.Equal(t, http.StatusOK, code)
+	var st config.Status
+	require.NoError(t, json.Unmarshal([]byte(body), &st))
+	assert.Equal(t, 4242, st.WorkerPID)
+	assert.Equal(t, 1, st.ConsecutiveFailures)
+	require.NotNil(t, st.Report)
+	assert.Equal(t, 7, st.Report.FilesUploadedToday)
+
+	code, body = getStatus(t, h, "/metrics")
+	require.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "# TYPE tokenly_approved gauge\ntokenly_approved 1\n")
+	assert.Contains(t, body, "tokenly_worker_running 1\n")
+	assert.Contains(t, body, "tokenly_heartbeat_consecutive_failures 1\n")
+	assert.Contains(t, body, "tokenly_launcher_uptime_seconds 7200\n")
+	assert.Contains(t, body, "tokenly_launcher_restarts_total 1\n")
+	assert.Contains(t, body, "tokenly_worker_uptime_seconds 3600\n")
+	assert.Contains(t, body, "tokenly_last_heartbeat_timestamp_seconds 1772366340\n")
+	assert.Contains(t, body, "tokenly_files_uploaded_today 7\n")
+	assert.NotContains(t, body, "tokenly_last_scan_timestamp_seconds", "unknown timestamps are left out")
+
+	code, _ = getStatus(t, h, "/nope")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestStatusServer_Serve(t *testing.T) {
+	s, _ := newStatusServerForTest(t, &config.StateFile{})
+
+	assert.ErrorContains(t, s.Serve(context.Background(), "0.0.0.0:0"), "not a loopback address")
+	assert.ErrorContains(t, s.Serve(context.Background(), "tokenly.example.com:9465"), "not a loopback address")
+
+	// Find a free loopback port, then serve on it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ctx, addr) }()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		resp, err = http.Get("http://" + addr + "/healthz")
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "ok\n", string(body))
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,66 @@
+package launcher
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// SystemdUnitName is the name the launcher's systemd unit is installed under.
+const SystemdUnitName = "tokenly-launcher.service"
+
+// SystemdUnit renders a hardened systemd unit for the launcher. The system
+// is read-only to the service except for its state directory and the
+// binaries' directory, which self-updates write to. Home directories stay
+// writable so uploaded files can be cleaned up.
+func SystemdUnit(opts ServiceOptions) string {
+	binDir := filepath.Dir(opts.Binary)
+
+	args := opts.Args()
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		quoted[i] = systemdQuote(a)
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=Tokenly usage log collector\n")
+	b.WriteString("Wants=network-online.target\n")
+	b.WriteString("After=network-online.target\n")
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=simple\n")
+	fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(quoted, " "))
+	if !opts.runsAsRoot() {
+		fmt.Fprintf(&b, "User=%s\n", opts.User)
+	}
+	fmt.Fprintf(&b, "Environment=%s\n", systemdQuote("PATH="+opts.searchPath()))
+	b.WriteString("Restart=always\n")
+	b.WriteString("RestartSec=10\n")
+	b.WriteString("StateDirectory=tokenly\n")
+	b.WriteString("RuntimeDirectory=tokenly\n")
+	fmt.Fprintf(&b, "ReadWritePaths=%s\n", systemdQuote(binDir))
+	b.WriteString("NoNewPrivileges=true\n")
+	b.WriteString("PrivateTmp=true\n")
+	b.WriteString("ProtectSystem=full\n")
+	b.WriteString("ProtectKernelTunables=true\n")
+	b.WriteString("ProtectKernelModules=true\n")
+	b.WriteString("ProtectControlGroups=true\n")
+	b.WriteString("RestrictSUIDSGID=true\n")
+	b.WriteString("LockPersonality=true\n")
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=multi-user.target\n")
+	return b.String()
+}
+
+// systemdQuote quotes a unit-file argument when needed, escaping the
+// specifiers and variables systemd would otherwise expand.
+func systemdQuote(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
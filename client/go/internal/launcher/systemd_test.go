@@ -0,0 +1,38 @@
+package launcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSystemdUnit(t *testing.T) {
+	unit := SystemdUnit(ServiceOptions{
+		Binary:    "/opt/tokenly/bin/tokenly-launcher",
+		ServerURL: "https://tokenly.example.com",
+		User:      "tokenly",
+		Headers:   map[string]string{"X-Tenant": "acme", "Authorization": "Bearer a$b"},
+	})
+
+	assert.Contains(t, unit, `ExecStart=/opt/tokenly/bin/tokenly-launcher --server https://tokenly.example.com --header "Authorization=Bearer a$$b" --header X-Tenant=acme`+"\n")
+	assert.Contains(t, unit, "User=tokenly\n")
+	assert.Contains(t, unit, "Environment=PATH=/opt/tokenly/bin:/usr/local/sbin:")
+	assert.Contains(t, unit, "Restart=always\n")
+	assert.Contains(t, unit, "ReadWritePaths=/opt/tokenly/bin\n")
+	assert.Contains(t, unit, "NoNewPrivileges=true\n")
+	assert.Contains(t, unit, "WantedBy=multi-user.target\n")
+}
+
+func TestSystemdUnit_RootOmitsUser(t *testing.T) {
+	unit := SystemdUnit(ServiceOptions{Binary: "/usr/local/bin/tokenly-launcher", ServerURL: "https://h", User: "root"})
+	assert.NotContains(t, unit, "User=")
+	assert.Contains(t, unit, "ExecStart=/usr/local/bin/tokenly-launcher --server https://h\n")
+}
+
+func TestSystemdQuote(t *testing.T) {
+	assert.Equal(t, "plain", systemdQuote("plain"))
+	assert.Equal(t, `"a b"`, systemdQuote("a b"))
+	assert.Equal(t, `"say \"hi\""`, systemdQuote(`say "hi"`))
+	assert.Equal(t, "100%%", systemdQuote("100%"))
+	assert.Equal(t, `""`, systemdQuote(""))
+}
@@ -0,0 +1,108 @@
+package launcher
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// TransportOptions carries settings shared by all heartbeat transports.
+type TransportOptions struct {
+	Path          string            // heartbeat endpoint path, for transports that use one
+	Headers       map[string]string // extra request metadata
+	MaxResponseKB int               // response size cap; 0 uses the transport's default
+	HTTPTransport http.RoundTripper // for HTTP-based transports; nil uses the default
+	Logger        *slog.Logger
+}
+
+// TransportFactory builds a HeartbeatSender for a server URL.
+type TransportFactory func(serverURL string, opts TransportOptions) (HeartbeatSender, error)
+
+var (
+	transportsMu sync.RWMutex
+	transports   = make(map[string]TransportFactory)
+)
+
+func init() {
+	RegisterTransport("http", newHTTPTransport)
+	RegisterTransport("https", newHTTPTransport)
+}
+
+// RegisterTransport makes a heartbeat transport available for a URL scheme.
+// Embedders call it (typically from init) to plug in custom transports such as
+// a message bus. It panics if factory is nil or the scheme is already taken,
+// mirroring database/sql.Register.
+func RegisterTransport(scheme string, factory TransportFactory) {
+	scheme = strings.ToLower(scheme)
+	if factory == nil {
+		panic("launcher: RegisterTransport factory is nil for scheme " + scheme)
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if _, dup := transports[scheme]; dup {
+		panic("launcher: RegisterTransport called twice for scheme " + scheme)
+	}
+	transports[scheme] = factory
+}
+
+// Transports returns the registered URL schemes, sorted.
+func Transports() []string {
+	transportsMu.RLock()
+	defer transportsMu.RUnlock()
+
+	schemes := make([]string, 0, len(transports))
+	for s := range transports {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewTransport returns a HeartbeatSender for serverURL using the transport
+// registered for its scheme. A URL without a scheme is https. HTTP URLs are
+// normalized first; any other transport gets the URL as given, since only it
+// knows what its URLs look like.
+func NewTransport(serverURL string, opts TransportOptions) (HeartbeatSender, error) {
+	serverURL = strings.TrimSpace(serverURL)
+	scheme := "https"
+	if i := strings.Index(serverURL, "://"); i >= 0 {
+		scheme = strings.ToLower(serverURL[:i])
+	}
+
+	transportsMu.RLock()
+	factory, ok := transports[scheme]
+	transportsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported server URL scheme %q (registered: %s)",
+			scheme, strings.Join(Transports(), ", "))
+	}
+
+	if scheme == "http" || scheme == "https" {
+		normalized, err := config.NormalizeServerURL(serverURL)
+		if err != nil {
+			return nil, err
+		}
+		serverURL = normalized
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.Default()
+	}
+	return factory(serverURL, opts)
+}
+
+// newHTTPTransport is the TransportFactory for http and https URLs.
+func newHTTPTransport(serverURL string, opts TransportOptions) (HeartbeatSender, error) {
+	c := NewHeartbeatClient(serverURL, opts.Logger)
+	c.SetPath(opts.Path)
+	c.SetHeaders(opts.Headers)
+	c.SetMaxResponseKB(opts.MaxResponseKB)
+	c.SetTransport(opts.HTTPTransport)
+	return c, nil
+}
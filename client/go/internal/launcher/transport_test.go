@@ -0,0 +1,82 @@
+package launcher
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransport_HTTPSchemes(t *testing.T) {
+	for _, u := range []string{"http://localhost:7071", "HTTPS://example.com"} {
+		sender, err := NewTransport(u, TransportOptions{Logger: testLogger()})
+		require.NoError(t, err, u)
+		assert.IsType(t, &HeartbeatClient{}, sender)
+	}
+}
+
+func TestNewTransport_MaxResponseKB(t *testing.T) {
+	sender, err := NewTransport("http://localhost:7071", TransportOptions{MaxResponseKB: 8, Logger: testLogger()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(8*1024), sender.(*HeartbeatClient).maxResp)
+
+	sender, err = NewTransport("http://localhost:7071", TransportOptions{Logger: testLogger()})
+	require.NoError(t, err)
+	assert.Equal(t, int64(defaultMaxHeartbeatBytes), sender.(*HeartbeatClient).maxResp)
+}
+
+func TestNewTransport_UnknownScheme(t *testing.T) {
+	_, err := NewTransport("carrier-pigeon://coop", TransportOptions{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "carrier-pigeon")
+	assert.Contains(t, err.Error(), "https")
+}
+
+// testBusSeq gives each run a fresh scheme, since registrations are global
+// and cannot be undone (keeps -count > 1 working).
+var testBusSeq atomic.Int32
+
+func TestRegisterTransport_CustomScheme(t *testing.T) {
+	scheme := fmt.Sprintf("testbus%d", testBusSeq.Add(1))
+	mock := &mockHeartbeatSender2{status: 200, response: &HeartbeatResponse{Approved: true}}
+	var gotURL string
+	RegisterTransport(scheme, func(serverURL string, opts TransportOptions) (HeartbeatSender, error) {
+		gotURL = serverURL
+		return mock, nil
+	})
+	assert.Contains(t, Transports(), scheme)
+
+	sender, err := NewTransport(scheme+"://queue/heartbeats", TransportOptions{})
+	require.NoError(t, err)
+	_, status, err := sender.SendHeartbeat(context.Background(), makeTestRequest())
+	require.NoError(t, err)
+	assert.Equal(t, 200, status)
+	assert.Equal(t, scheme+"://queue/heartbeats", gotURL)
+	assert.Equal(t, 1, mock.calls)
+
+	// URLs of other transports are passed through, not reshaped as HTTP ones.
+	_, err = NewTransport(scheme+"://broker-a,broker-b/topic?partition=2#x", TransportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, scheme+"://broker-a,broker-b/topic?partition=2#x", gotURL)
+}
+
+func TestRegisterTransport_DuplicatePanics(t *testing.T) {
+	assert.Panics(t, func() {
+		RegisterTransport("https", newHTTPTransport)
+	})
+	assert.Panics(t, func() {
+		RegisterTransport("nilfactory", nil)
+	})
+}
+
+func TestNewTransport_NormalizesServerURL(t *testing.T) {
+	sender, err := NewTransport("HTTP://[::1]:8080/tokenly/", TransportOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "http://[::1]:8080/tokenly", sender.(*HeartbeatClient).serverURL)
+
+	_, err = NewTransport("http://fe80::1:8080", TransportOptions{})
+	assert.ErrorContains(t, err, "brackets")
+}
@@ -0,0 +1,263 @@
+package launcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// defaultMaxUpdateBytes caps the size of a downloaded binary.
+const defaultMaxUpdateBytes = 256 * 1024 * 1024
+
+// BackupSuffix is appended to a binary's name to name the copy of the
+// previous version kept for rollback.
+const BackupSuffix = ".backup"
+
+// ErrChecksumMismatch is returned when a downloaded update does not match the
+// checksum announced by the server.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Updater downloads worker and launcher updates announced in heartbeat
+// responses and swaps them in for the installed binary, keeping the previous
+// version as a backup.
+type Updater struct {
+	serverURL  string
+	headers    map[string]string
+	maxBytes   int64
+	httpClient *http.Client
+	logger     *slog.Logger
+}
+
+// NewUpdater creates an Updater that accepts downloads only from serverURL.
+func NewUpdater(serverURL string, logger *slog.Logger) *Updater {
+	return &Updater{
+		serverURL: serverURL,
+		maxBytes:  defaultMaxUpdateBytes,
+		httpClient: &http.Client{
+			Timeout: 10 * time.Minute,
+		},
+		logger: logger,
+	}
+}
+
+// SetHeaders sets extra headers sent with every download request.
+func (u *Updater) SetHeaders(headers map[string]string) {
+	u.headers = headers
+}
+
+// SetTransport sets the HTTP transport downloads use. Nil keeps the default.
+func (u *Updater) SetTransport(rt http.RoundTripper) {
+	u.httpClient.Transport = rt
+}
+
+// Install downloads the update described by info, verifies its checksum, and
+// replaces the binary at binaryPath; see Stage and Swap. On error the
+// installed binary is unchanged.
+func (u *Updater) Install(ctx context.Context, info *UpdateInfo, binaryPath string) error {
+	staged, err := u.Stage(ctx, info, binaryPath)
+	if err != nil {
+		return err
+	}
+	return u.Swap(staged, binaryPath, info.Version)
+}
+
+// Stage downloads the update described by info next to binaryPath, so the
+// swap stays on one filesystem, and verifies its checksum. Returns the path
+// of the verified binary for Swap. The installed binary is not touched, so
+// it can keep running meanwhile.
+func (u *Updater) Stage(ctx context.Context, info *UpdateInfo, binaryPath string) (string, error) {
+	alg, want, err := parseUpdateChecksum(info.Checksum)
+	if err != nil {
+		return "", err
+	}
+	src, err := u.downloadURL(info.DownloadURL)
+	if err != nil {
+		return "", err
+	}
+
+	u.logger.Info("downloading update", "component", component(binaryPath), "version", info.Version, "url", src)
+	tmp := binaryPath + ".new"
+	got, err := u.download(ctx, src, tmp)
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if got != want {
+		os.Remove(tmp)
+		return "", fmt.Errorf("verify %s update %s: %w", alg, info.Version, ErrChecksumMismatch)
+	}
+	return tmp, nil
+}
+
+// Swap installs the staged binary at binaryPath, keeping the previous one at
+// binaryPath + BackupSuffix. The backup is a hard link or copy, so
+// binaryPath is replaced in one rename and is never missing; only where a
+// running binary cannot be replaced, as on Windows, is it renamed aside
+// first. On error the installed binary is unchanged and the staged one
+// removed.
+func (u *Updater) Swap(staged, binaryPath, version string) error {
+	backup := binaryPath + BackupSuffix
+	if err := backupBinary(binaryPath, backup); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("back up binary: %w", err)
+	}
+	if err := os.Rename(staged, binaryPath); err != nil {
+		if err := os.Rename(binaryPath, backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(staged)
+			return fmt.Errorf("install binary: %w", err)
+		}
+		if err := os.Rename(staged, binaryPath); err != nil {
+			os.Rename(backup, binaryPath)
+			os.Remove(staged)
+			return fmt.Errorf("install binary: %w", err)
+		}
+	}
+
+	u.logger.Info("update installed", "component", component(binaryPath), "version", version, "binary", binaryPath)
+	return nil
+}
+
+// backupBinary makes backup a hard link to binary, or a copy where links are
+// not supported. A missing binary has nothing to back up.
+func backupBinary(binary, backup string) error {
+	if err := os.Remove(backup); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	err := os.Link(binary, backup)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	in, err := os.Open(binary)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(backup, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(backup)
+	}
+	return err
+}
+
+// Rollback restores the backup kept by the last Install.
+func (u *Updater) Rollback(binaryPath string) error {
+	if err := os.Rename(binaryPath+BackupSuffix, binaryPath); err != nil {
+		return fmt.Errorf("restore %s backup: %w", component(binaryPath), err)
+	}
+	u.logger.Warn("update rolled back", "component", component(binaryPath), "binary", binaryPath)
+	return nil
+}
+
+// component names what binaryPath holds for logs: its file name without the
+// Windows extension, e.g. "tokenly-worker" or "tokenly-launcher".
+func component(binaryPath string) string {
+	return strings.TrimSuffix(filepath.Base(binaryPath), ".exe")
+}
+
+// downloadURL resolves the announced download URL. Relative URLs are joined
+// to the server URL; absolute ones must point at the server's host.
+func (u *Updater) downloadURL(raw string) (string, error) {
+	if raw == "" {
+		return "", fmt.Errorf("update has no download URL")
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("parse download URL: %w", err)
+	}
+	if !parsed.IsAbs() {
+		return config.JoinURL(u.serverURL, raw), nil
+	}
+	server, err := url.Parse(u.serverURL)
+	if err != nil {
+		return "", fmt.Errorf("parse server URL: %w", err)
+	}
+	if parsed.Scheme != server.Scheme || parsed.Host != server.Host {
+		return "", fmt.Errorf("refusing update from %s: not the configured server", parsed.Host)
+	}
+	return raw, nil
+}
+
+// download streams src into path and returns the hex SHA-256 of what was
+// written. Downloads over the size cap fail.
+func (u *Updater) download(ctx context.Context, src, path string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return "", fmt.Errorf("create download request: %w", err)
+	}
+	for k, v := range u.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download update: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download update: status %d", resp.StatusCode)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", fmt.Errorf("create update file: %w", err)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(resp.Body, u.maxBytes+1))
+	if err == nil && n > u.maxBytes {
+		err = fmt.Errorf("%w: exceeds %d bytes", config.ErrResponseTooLarge, u.maxBytes)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("write update file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// parseUpdateChecksum splits an "algorithm:hex" checksum. A bare hex digest
+// is taken as SHA-256, the only algorithm supported for updates.
+func parseUpdateChecksum(s string) (alg, digest string, err error) {
+	alg, digest, found := strings.Cut(s, ":")
+	if !found {
+		alg, digest = "sha256", s
+	}
+	alg = strings.ToLower(alg)
+	digest = strings.ToLower(digest)
+	if alg != "sha256" {
+		return "", "", fmt.Errorf("unsupported update checksum algorithm %q", alg)
+	}
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != sha256.Size*2 {
+		return "", "", fmt.Errorf("invalid update checksum %q", s)
+	}
+	return alg, digest, nil
+}
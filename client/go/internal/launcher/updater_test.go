@@ -0,0 +1,156 @@
+package launcher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func sha256Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// serveBinary serves body at /downloads/worker and records the request headers.
+func serveBinary(t *testing.T, body []byte) (*httptest.Server, *http.Header) {
+	t.Helper()
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/downloads/worker" {
+			http.NotFound(w, r)
+			return
+		}
+		got = r.Header.Clone()
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &got
+}
+
+func installedBinary(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tokenly-worker")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0755))
+	return path
+}
+
+func TestUpdater_InstallSwapsBinaryAndKeepsBackup(t *testing.T) {
+	newBin := []byte("new worker")
+	srv, headers := serveBinary(t, newBin)
+	binary := installedBinary(t, "old worker")
+
+	u := NewUpdater(srv.URL, silentLogger())
+	u.SetHeaders(map[string]string{"Authorization": "Bearer k"})
+	info := &UpdateInfo{Version: "1.2.0", DownloadURL: "/downloads/worker", Checksum: sha256Checksum(newBin)}
+	require.NoError(t, u.Install(context.Background(), info, binary))
+
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new worker", string(data))
+	backup, err := os.ReadFile(binary + BackupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(backup))
+	assert.NoFileExists(t, binary+".new")
+	assert.Equal(t, "Bearer k", headers.Get("Authorization"))
+
+	require.NoError(t, u.Rollback(binary))
+	data, err = os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(data))
+}
+
+func TestComponent(t *testing.T) {
+	assert.Equal(t, "tokenly-worker", component("/usr/local/bin/tokenly-worker"))
+	assert.Equal(t, "tokenly-launcher", component(filepath.Join("Tokenly", "tokenly-launcher.exe")))
+}
+
+func TestUpdater_StageLeavesBinaryInPlace(t *testing.T) {
+	newBin := []byte("new worker")
+	srv, _ := serveBinary(t, newBin)
+	binary := installedBinary(t, "old worker")
+
+	u := NewUpdater(srv.URL, silentLogger())
+	info := &UpdateInfo{Version: "1.2.0", DownloadURL: "/downloads/worker", Checksum: sha256Checksum(newBin)}
+	staged, err := u.Stage(context.Background(), info, binary)
+	require.NoError(t, err)
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(data), "the installed binary is untouched until the swap")
+
+	require.NoError(t, u.Swap(staged, binary, info.Version))
+	data, err = os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "new worker", string(data))
+	backup, err := os.ReadFile(binary + BackupSuffix)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(backup))
+	assert.NoFileExists(t, staged)
+}
+
+func TestUpdater_ChecksumMismatchKeepsBinary(t *testing.T) {
+	srv, _ := serveBinary(t, []byte("tampered"))
+	binary := installedBinary(t, "old worker")
+
+	u := NewUpdater(srv.URL, silentLogger())
+	info := &UpdateInfo{Version: "1.2.0", DownloadURL: srv.URL + "/downloads/worker", Checksum: sha256Checksum([]byte("genuine"))}
+	err := u.Install(context.Background(), info, binary)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	data, err := os.ReadFile(binary)
+	require.NoError(t, err)
+	assert.Equal(t, "old worker", string(data))
+	assert.NoFileExists(t, binary+BackupSuffix)
+	assert.NoFileExists(t, binary+".new")
+}
+
+func TestUpdater_RefusesForeignHost(t *testing.T) {
+	body := []byte("new worker")
+	srv, _ := serveBinary(t, body)
+	binary := installedBinary(t, "old worker")
+
+	u := NewUpdater("https://tokenly.example.com", silentLogger())
+	info := &UpdateInfo{Version: "1.2.0", DownloadURL: srv.URL + "/downloads/worker", Checksum: sha256Checksum(body)}
+	err := u.Install(context.Background(), info, binary)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not the configured server")
+}
+
+func TestUpdater_SizeCap(t *testing.T) {
+	body := []byte("a worker binary that is too large")
+	srv, _ := serveBinary(t, body)
+	binary := installedBinary(t, "old worker")
+
+	u := NewUpdater(srv.URL, silentLogger())
+	u.maxBytes = 8
+	info := &UpdateInfo{Version: "1.2.0", DownloadURL: "/downloads/worker", Checksum: sha256Checksum(body)}
+	require.Error(t, u.Install(context.Background(), info, binary))
+	assert.NoFileExists(t, binary+".new")
+}
+
+func TestParseUpdateChecksum(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	alg, got, err := parseUpdateChecksum("SHA256:" + digest)
+	require.NoError(t, err)
+	assert.Equal(t, "sha256", alg)
+	assert.Equal(t, digest, got)
+
+	_, got, err = parseUpdateChecksum(digest)
+	require.NoError(t, err)
+	assert.Equal(t, digest, got)
+
+	_, _, err = parseUpdateChecksum("md5:" + digest)
+	assert.Error(t, err)
+	_, _, err = parseUpdateChecksum("sha256:xyz")
+	assert.Error(t, err)
+}
@@ -1,13 +1,19 @@
 package launcher
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
 )
@@ -18,37 +24,176 @@ type ProcessChecker interface {
 	IsProcessRunning(pid int) bool
 	// StartProcess spawns the worker binary and returns its PID.
 	StartProcess(binary string, args ...string) (int, error)
+	// RunProcess runs the worker binary and waits for it to exit.
+	RunProcess(binary string, args ...string) error
+	// ProcessOutput runs the worker binary and returns its standard output.
+	ProcessOutput(binary string, args ...string) ([]byte, error)
+	// StopProcess asks the process with the given PID to exit.
+	StopProcess(pid int) error
+	// KillProcess forcibly terminates the process with the given PID.
+	KillProcess(pid int) error
+	// ExitTime returns when a process started by StartProcess exited, and
+	// false if it hasn't or wasn't started here. Each exit is reported once.
+	ExitTime(pid int) (time.Time, bool)
+	// ProcessPath returns the executable the process with the given PID runs.
+	ProcessPath(pid int) (string, error)
 }
 
 // OSProcessChecker implements ProcessChecker using real OS calls.
-type OSProcessChecker struct{}
+type OSProcessChecker struct {
+	// Output receives the worker's stdout and stderr. Nil passes the
+	// launcher's own through.
+	Output io.Writer
 
-// IsProcessRunning checks if a process exists by sending signal 0.
+	// User, if set, is the unprivileged account the worker runs as.
+	User *WorkerUser
+
+	mu     sync.Mutex
+	exited map[int]time.Time
+}
+
+// attachOutput connects cmd's stdout and stderr to the configured output
+// and sets the user it runs as.
+func (c *OSProcessChecker) attachOutput(cmd *exec.Cmd) {
+	c.User.applyTo(cmd)
+	if c.Output != nil {
+		cmd.Stdout = c.Output
+		cmd.Stderr = c.Output
+		return
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+}
+
+// IsProcessRunning checks if a process exists: with signal 0 on Unix, and by
+// its exit code on Windows.
 func (c *OSProcessChecker) IsProcessRunning(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
-	proc, err := os.FindProcess(pid)
-	if err != nil {
-		return false
-	}
-	// On Unix, Signal(0) checks existence without sending a signal.
-	// On Windows, FindProcess always succeeds, but Signal will fail if process is gone.
-	err = proc.Signal(syscall0())
-	return err == nil
+	return processRunning(pid)
 }
 
 // StartProcess spawns a new process and returns its PID.
 func (c *OSProcessChecker) StartProcess(binary string, args ...string) (int, error) {
 	cmd := exec.Command(binary, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	c.attachOutput(cmd)
 	if err := cmd.Start(); err != nil {
 		return 0, fmt.Errorf("start process %s: %w", binary, err)
 	}
-	return cmd.Process.Pid, nil
+	// Reap the process when it exits, so it doesn't linger as a zombie that
+	// IsProcessRunning still sees, and note when that was.
+	pid := cmd.Process.Pid
+	go func() {
+		cmd.Wait()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.exited == nil {
+			c.exited = make(map[int]time.Time)
+		}
+		c.exited[pid] = time.Now()
+	}()
+	return pid, nil
+}
+
+// ExitTime returns when a process started by StartProcess exited.
+func (c *OSProcessChecker) ExitTime(pid int) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.exited[pid]
+	delete(c.exited, pid)
+	return t, ok
+}
+
+// ProcessPath returns the executable a running process was started from.
+func (c *OSProcessChecker) ProcessPath(pid int) (string, error) {
+	return processPath(pid)
 }
 
+// Crash-loop detection: a worker that dies within quickDeathWindow of being
+// started counts as a quick death. After crashLoopThreshold of them in a row,
+// restarts back off exponentially from crashBackoffBase up to crashBackoffMax.
+const (
+	quickDeathWindow   = 10 * time.Minute
+	crashLoopThreshold = 3
+	crashBackoffBase   = time.Minute
+	crashBackoffMax    = time.Hour
+)
+
+// ErrCrashLooping is returned by EnsureRunning while restarts of a
+// crash-looping worker are backed off.
+var ErrCrashLooping = errors.New("worker is crash-looping")
+
+// RunProcess runs a process to completion.
+func (c *OSProcessChecker) RunProcess(binary string, args ...string) error {
+	cmd := exec.Command(binary, args...)
+	c.attachOutput(cmd)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("run process %s: %w", binary, err)
+	}
+	return nil
+}
+
+// ProcessOutput runs a process to completion and captures its stdout.
+func (c *OSProcessChecker) ProcessOutput(binary string, args ...string) ([]byte, error) {
+	cmd := exec.Command(binary, args...)
+	c.User.applyTo(cmd)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("run process %s: %w", binary, err)
+	}
+	return out, nil
+}
+
+// StopProcess sends a process SIGTERM. Windows has no such signal, so
+// there it fails and the caller falls back to KillProcess.
+func (c *OSProcessChecker) StopProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("find process %d: %w", pid, err)
+	}
+	if err := proc.Signal(syscall.SIGTERM); err != nil {
+		return fmt.Errorf("terminate process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// KillProcess forcibly terminates a process.
+func (c *OSProcessChecker) KillProcess(pid int) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("find process %d: %w", pid, err)
+	}
+	if err := proc.Kill(); err != nil {
+		return fmt.Errorf("kill process %d: %w", pid, err)
+	}
+	return nil
+}
+
+// Health probing: a worker is probed once it has been up for healthGrace,
+// and is considered hung after healthProbeFailures failed probes in a row or
+// when it reports no progress for hungAfter.
+const (
+	healthGrace         = time.Minute
+	healthProbeTimeout  = 5 * time.Second
+	healthProbeFailures = 2
+	hungAfter           = 30 * time.Minute
+)
+
+// staleCycles is how many scan intervals may pass, but never less than
+// hungAfter, without the worker reporting a completed cycle before it is
+// considered hung.
+const staleCycles = 3
+
+// Stopping the worker: it is asked to exit and given the stop grace period,
+// then killed, after which the launcher waits up to killWait for the process
+// to be gone.
+const (
+	defaultStopGrace = 30 * time.Second
+	defaultKillWait  = 5 * time.Second
+	stopPollInterval = 100 * time.Millisecond
+)
+
 // WorkerManager checks if the worker process is running and starts it if not.
 // No IPC — the worker reads config from the shared state file.
 type WorkerManager struct {
@@ -59,6 +204,34 @@ type WorkerManager struct {
 
 	mu  sync.Mutex
 	pid int
+	// startedHere: pid was started by this launcher, not picked up from the
+	// state file, so it can't be some other process that reused the PID.
+	startedHere bool
+
+	// Crash-loop tracking: when the current worker was started, how many
+	// workers in a row died soon after starting, and when the next start is
+	// allowed.
+	startedAt   time.Time
+	quickDeaths int
+	nextStart   time.Time
+	now         func() time.Time
+
+	// restored is set once the crash-loop tracking has been read back from
+	// the state file.
+	restored bool
+
+	// Health probing over the worker's IPC socket; disabled when
+	// healthSocket is empty.
+	healthSocket  string
+	probe         func(path string, timeout time.Duration) (*config.HealthStatus, error)
+	probeFailures int
+
+	stopGrace time.Duration
+	killWait  time.Duration
+
+	// external: the worker runs under its own supervisor and is only
+	// watched, never started or stopped.
+	external bool
 }
 
 // NewWorkerManager creates a WorkerManager.
@@ -68,23 +241,128 @@ func NewWorkerManager(workerBinary string, statePath string, checker ProcessChec
 		statePath:    statePath,
 		checker:      checker,
 		logger:       logger,
+		now:          time.Now,
+		probe:        ProbeHealth,
+		stopGrace:    defaultStopGrace,
+		killWait:     defaultKillWait,
 	}
 }
 
+// SetHealthSocket enables probing the worker's health socket at path, so a
+// worker that is alive but stuck is restarted. Empty disables probes.
+func (m *WorkerManager) SetHealthSocket(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.healthSocket = path
+}
+
+// SetStopGrace sets how long a worker asked to exit is given before it is
+// killed. Non-positive values select the default of 30 seconds.
+func (m *WorkerManager) SetStopGrace(d time.Duration) {
+	if d <= 0 {
+		d = defaultStopGrace
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopGrace = d
+}
+
+// SetExternal puts the manager in external-supervisor mode, for a worker
+// run by its own systemd unit or as a Kubernetes sidecar: it is never started
+// or stopped here, and its status comes from the liveness timestamps in its
+// report instead of a PID. See ExternalStatus.
+func (m *WorkerManager) SetExternal(external bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.external = external
+}
+
+// External reports whether the worker is externally supervised.
+func (m *WorkerManager) External() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.external
+}
+
+// ExternalStatus derives an externally supervised worker's status from its
+// report: running if it was updated within the stale limit, crashed if it
+// has gone quiet since, and stopped if the worker has never reported.
+func (m *WorkerManager) ExternalStatus(state *config.StateFile) string {
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(m.statePath))
+	if err != nil {
+		m.logger.Warn("failed to read worker report", "error", err)
+		return "stopped"
+	}
+	if report == nil {
+		return "stopped"
+	}
+	var last time.Time
+	for _, ts := range []string{report.UpdatedAt, report.LastCycleCompleted} {
+		if t, err := time.Parse(time.RFC3339, ts); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	if m.now().Sub(last) < staleLimit(state) {
+		return "running"
+	}
+	return "crashed"
+}
+
 // EnsureRunning checks if the worker is alive (by PID). If not, starts it.
 // Returns the worker PID and whether it was newly started.
 func (m *WorkerManager) EnsureRunning(state *config.StateFile) (pid int, started bool, err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	now := m.now()
+	m.restoreCrashLoop(state)
+	defer m.saveCrashLoop(state)
+
 	// First check the PID we have in memory.
 	if m.pid > 0 && m.checker.IsProcessRunning(m.pid) {
-		return m.pid, false, nil
+		if !m.hung(state, now) {
+			if m.quickDeaths > 0 && now.Sub(m.startedAt) >= quickDeathWindow {
+				m.logger.Info("worker stable again", "pid", m.pid)
+				m.quickDeaths = 0
+			}
+			return m.pid, false, nil
+		}
+		switch ours, known := m.isWorker(m.pid, m.startedHere); {
+		case !known:
+			m.logger.Error("worker is unresponsive, but its executable can't be confirmed; not killing it", "pid", m.pid)
+			return m.pid, false, nil
+		case !ours:
+			m.logger.Warn("worker PID now belongs to another process, leaving it alone", "pid", m.pid)
+		default:
+			m.logger.Warn("worker is unresponsive, killing it", "pid", m.pid)
+			state.WorkerHungRestarts++
+			if err := m.checker.KillProcess(m.pid); err != nil {
+				m.logger.Error("failed to kill hung worker", "pid", m.pid, "error", err)
+				return m.pid, false, nil
+			}
+			if !m.waitGone(m.pid, m.killWait) {
+				m.logger.Error("hung worker still running after kill", "pid", m.pid)
+				return m.pid, false, nil
+			}
+		}
+	}
+
+	// A worker we started has died: note whether it died quickly.
+	if m.pid > 0 {
+		m.recordDeath(now)
+		m.pid = 0
+	}
+	if now.Before(m.nextStart) {
+		return 0, false, fmt.Errorf("%w: next start after %s", ErrCrashLooping, m.nextStart.Format(time.RFC3339))
 	}
 
 	// Fall back to PID from state file.
-	if state.WorkerPID > 0 && m.pid != state.WorkerPID && m.checker.IsProcessRunning(state.WorkerPID) {
+	if state.WorkerPID > 0 && m.pid != state.WorkerPID && m.checker.IsProcessRunning(state.WorkerPID) && m.mayBeWorker(state.WorkerPID) {
 		m.pid = state.WorkerPID
+		m.startedHere = false
+		if t, err := time.Parse(time.RFC3339, state.WorkerStartedAt); err == nil {
+			m.startedAt = t
+		}
 		return m.pid, false, nil
 	}
 
@@ -101,32 +379,327 @@ func (m *WorkerManager) EnsureRunning(state *config.StateFile) (pid int, started
 	}
 
 	m.pid = newPid
+	m.startedHere = true
+	m.startedAt = now
+	m.probeFailures = 0
 	m.logger.Info("worker started", "pid", newPid)
 	return newPid, true, nil
 }
 
-// EnsureStopped kills the worker if it's running.
-func (m *WorkerManager) EnsureStopped(state *config.StateFile) {
+// hung probes the worker's health socket and reports whether the worker is
+// stuck. Must be called with m.mu held.
+func (m *WorkerManager) hung(state *config.StateFile, now time.Time) bool {
+	if now.Sub(m.startedAt) < healthGrace {
+		return false
+	}
+	if m.stale(state, now) {
+		return true
+	}
+	if m.healthSocket == "" {
+		return false
+	}
+	st, err := m.probe(m.healthSocket, healthProbeTimeout)
+	if errors.Is(err, ErrNoHealthSocket) {
+		// Nothing to probe; the process check is all there is.
+		m.logger.Debug("worker has no health socket", "error", err)
+		return false
+	}
+	if err == nil {
+		last, perr := time.Parse(time.RFC3339, st.LastProgress)
+		if perr == nil && now.Sub(last) >= hungAfter {
+			err = fmt.Errorf("no progress since %s", st.LastProgress)
+		}
+	}
+	if err != nil {
+		m.probeFailures++
+		m.logger.Warn("worker health probe failed", "pid", m.pid, "failures", m.probeFailures, "error", err)
+		return m.probeFailures >= healthProbeFailures
+	}
+	m.probeFailures = 0
+	return false
+}
+
+// stale reports whether the worker has gone staleCycles scan intervals
+// without completing a cycle, going by the last_cycle_completed time in its
+// report, or since it was started if that is later. Workers that don't
+// report the time are never stale. Must be called with m.mu held.
+func (m *WorkerManager) stale(state *config.StateFile, now time.Time) bool {
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(m.statePath))
+	if err != nil || report == nil {
+		return false
+	}
+	last, err := time.Parse(time.RFC3339, report.LastCycleCompleted)
+	if err != nil {
+		return false
+	}
+	if m.startedAt.After(last) {
+		last = m.startedAt
+	}
+
+	limit := staleLimit(state)
+	if now.Sub(last) < limit {
+		return false
+	}
+	m.logger.Warn("worker has not completed a cycle", "pid", m.pid, "since", last.UTC().Format(time.RFC3339), "limit", limit)
+	return true
+}
+
+// staleLimit returns how long a worker may go without completing a cycle:
+// staleCycles scan intervals, but at least hungAfter.
+func staleLimit(state *config.StateFile) time.Duration {
+	interval := 60 * time.Minute
+	if state.ServerConfig != nil && state.ServerConfig.ScanIntervalMinutes > 0 {
+		interval = time.Duration(state.ServerConfig.ScanIntervalMinutes) * time.Minute
+	}
+	return max(staleCycles*interval, hungAfter)
+}
+
+// recordDeath counts the death of the worker started at m.startedAt and, once
+// quick deaths pile up, pushes the next start out. The death is timed by
+// when the process exited if the checker saw that, else by now, when it was
+// found dead. Must be called with m.mu held.
+func (m *WorkerManager) recordDeath(now time.Time) {
+	died := now
+	if t, ok := m.checker.ExitTime(m.pid); ok && t.Before(now) {
+		died = t
+	}
+	if died.Sub(m.startedAt) >= quickDeathWindow {
+		m.quickDeaths = 0
+		return
+	}
+	m.quickDeaths++
+	if m.quickDeaths < crashLoopThreshold {
+		return
+	}
+	backoff := crashBackoffMax
+	if shift := m.quickDeaths - crashLoopThreshold; shift < 6 {
+		backoff = min(crashBackoffBase<<shift, crashBackoffMax)
+	}
+	m.nextStart = now.Add(backoff)
+	m.logger.Warn("worker is crash-looping, backing off restarts",
+		"quick_deaths", m.quickDeaths,
+		"backoff", backoff,
+	)
+}
+
+// restoreCrashLoop reads the crash-loop tracking a previous launcher left in
+// state, the first time it is called. Must be called with m.mu held.
+func (m *WorkerManager) restoreCrashLoop(state *config.StateFile) {
+	if m.restored {
+		return
+	}
+	m.restored = true
+	m.quickDeaths = state.WorkerQuickDeaths
+	if t, err := time.Parse(time.RFC3339, state.WorkerRestartAfter); err == nil {
+		m.nextStart = t
+	}
+}
+
+// saveCrashLoop records the crash-loop tracking in state. Must be called
+// with m.mu held.
+func (m *WorkerManager) saveCrashLoop(state *config.StateFile) {
+	state.WorkerQuickDeaths = m.quickDeaths
+	state.WorkerRestartAfter = ""
+	if !m.nextStart.IsZero() {
+		state.WorkerRestartAfter = m.nextStart.UTC().Format(time.RFC3339)
+	}
+}
+
+// CrashLooping reports whether the worker has died soon after starting too
+// many times in a row.
+func (m *WorkerManager) CrashLooping() bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.quickDeaths >= crashLoopThreshold
+}
 
-	pid := m.pid
-	if pid <= 0 {
-		pid = state.WorkerPID
+// ResetCrashLoop forgets earlier quick deaths, e.g. once a new worker binary
+// is installed.
+func (m *WorkerManager) ResetCrashLoop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.quickDeaths = 0
+	m.nextStart = time.Time{}
+	m.restored = true
+}
+
+// RunOnce runs the worker for a single scan-upload cycle and waits for it.
+func (m *WorkerManager) RunOnce() error {
+	if m.External() {
+		m.logger.Info("worker is externally supervised, not running it")
+		return nil
+	}
+	m.logger.Info("running worker once", "binary", m.workerBinary)
+	if err := m.checker.RunProcess(m.workerBinary, "--state-path", m.statePath, "--once"); err != nil {
+		return fmt.Errorf("run worker once: %w", err)
+	}
+	return nil
+}
+
+// Version runs the worker binary with --version and returns the version it
+// reports, so heartbeats carry what is actually installed. An externally
+// supervised worker's binary may not be here; its report carries the version.
+func (m *WorkerManager) Version() (string, error) {
+	if m.External() {
+		report, err := config.LoadWorkerReport(config.WorkerReportPath(m.statePath))
+		if err != nil {
+			return "", err
+		}
+		if report == nil || report.WorkerVersion == "" {
+			return "", fmt.Errorf("worker has not reported its version")
+		}
+		return report.WorkerVersion, nil
+	}
+	out, err := m.checker.ProcessOutput(m.workerBinary, "--version")
+	if err != nil {
+		return "", fmt.Errorf("query worker version: %w", err)
 	}
+	return parseWorkerVersion(out)
+}
+
+// parseWorkerVersion extracts the version from the worker's --version
+// output: "tokenly-worker version 1.2.3 (commit: ..., built: ...)".
+func parseWorkerVersion(out []byte) (string, error) {
+	fields := strings.Fields(string(out))
+	if len(fields) < 3 || fields[0] != "tokenly-worker" || fields[1] != "version" {
+		return "", fmt.Errorf("unexpected worker version output %q", strings.TrimSpace(string(out)))
+	}
+	return fields[2], nil
+}
+
+// EnsureStopped stops the worker if it's running: it is asked to exit, and
+// killed if it hasn't after the stop grace period. Only once the process is
+// confirmed gone are the worker's PID cleared, here and in state, and its
+// status set to stopped; a worker that survives stays on record, so it is
+// neither reported as stopped nor started a second time. Returns whether the
+// worker is stopped.
+func (m *WorkerManager) EnsureStopped(state *config.StateFile) bool {
+	m.mu.Lock()
+	if m.external {
+		// Its supervisor stops it; an unapproved worker pauses by itself.
+		m.mu.Unlock()
+		return true
+	}
+	pid, startedHere := m.pid, m.startedHere
+	grace, killWait := m.stopGrace, m.killWait
+	m.mu.Unlock()
 	if pid <= 0 {
-		return
+		pid, startedHere = state.WorkerPID, false
+	}
+
+	if pid > 0 && !m.stop(pid, startedHere, grace, killWait) {
+		state.WorkerPID = pid
+		return false
+	}
+
+	m.mu.Lock()
+	if m.pid == pid {
+		m.pid = 0
+	}
+	m.mu.Unlock()
+	state.WorkerPID = 0
+	state.WorkerStatus = "stopped"
+	return true
+}
+
+// isWorker reports whether pid is a worker this launcher may signal: one it
+// started itself, or one running the worker binary. known is false when the
+// process's executable can't be read, in which case ours is false too.
+func (m *WorkerManager) isWorker(pid int, startedHere bool) (ours, known bool) {
+	if startedHere {
+		return true, true
+	}
+	exe, err := m.checker.ProcessPath(pid)
+	if err != nil {
+		m.logger.Warn("failed to read worker executable", "pid", pid, "error", err)
+		return false, false
+	}
+	return samePath(exe, m.workerBinary), true
+}
+
+// mayBeWorker reports whether pid, picked up from the state file, can be
+// taken for the worker: it isn't known to run something else.
+func (m *WorkerManager) mayBeWorker(pid int) bool {
+	exe, err := m.checker.ProcessPath(pid)
+	if err != nil || samePath(exe, m.workerBinary) {
+		return true
+	}
+	m.logger.Info("recorded worker PID now belongs to another process", "pid", pid, "executable", exe)
+	return false
+}
+
+// samePath reports whether a and b name the same file, following symlinks.
+func samePath(a, b string) bool {
+	if resolved, err := filepath.EvalSymlinks(a); err == nil {
+		a = resolved
+	}
+	if resolved, err := filepath.EvalSymlinks(b); err == nil {
+		b = resolved
+	}
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(filepath.Clean(a), filepath.Clean(b))
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// stop runs the stop sequence for pid and reports whether it is gone. A
+// process the launcher didn't start is only signalled once its executable
+// shows it is the worker, so a PID since reused by something else is never
+// killed.
+func (m *WorkerManager) stop(pid int, startedHere bool, grace, killWait time.Duration) bool {
+	if !m.checker.IsProcessRunning(pid) {
+		return true
+	}
+	ours, known := m.isWorker(pid, startedHere)
+	if known && !ours {
+		m.logger.Warn("worker PID now belongs to another process, leaving it alone", "pid", pid)
+		return true
+	}
+
+	m.logger.Info("stopping worker", "pid", pid, "grace", grace)
+	if err := m.checker.StopProcess(pid); err != nil {
+		// Windows can't interrupt another process; go straight to killing it.
+		m.logger.Warn("failed to ask worker to exit", "pid", pid, "error", err)
+	} else if m.waitGone(pid, grace) {
+		return true
+	}
+	if !ours {
+		m.logger.Error("worker did not exit, and its executable can't be confirmed; not killing it", "pid", pid)
+		return false
+	}
+
+	m.logger.Warn("worker did not exit, killing it", "pid", pid)
+	if err := m.checker.KillProcess(pid); err != nil {
+		m.logger.Error("failed to kill worker", "pid", pid, "error", err)
 	}
+	if m.waitGone(pid, killWait) {
+		return true
+	}
+	m.logger.Error("worker still running after kill", "pid", pid)
+	return false
+}
 
-	if m.checker.IsProcessRunning(pid) {
-		proc, err := os.FindProcess(pid)
-		if err == nil {
-			m.logger.Info("stopping worker", "pid", pid)
-			proc.Signal(os.Interrupt)
+// waitGone polls until pid has exited or timeout has passed, and reports
+// whether it exited.
+func (m *WorkerManager) waitGone(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for m.checker.IsProcessRunning(pid) {
+		if !time.Now().Before(deadline) {
+			return false
 		}
+		time.Sleep(stopPollInterval)
 	}
+	return true
+}
 
-	m.pid = 0
+// BinaryPath returns the absolute path of the worker binary, looking a bare
+// name up on PATH as starting the process does.
+func (m *WorkerManager) BinaryPath() (string, error) {
+	path, err := exec.LookPath(m.workerBinary)
+	if err != nil {
+		return "", fmt.Errorf("locate worker binary: %w", err)
+	}
+	return filepath.Abs(path)
 }
 
 // IsRunning checks if the worker process is alive.
@@ -151,18 +724,6 @@ func WorkerBinaryName() string {
 	return "tokenly-worker"
 }
 
-// syscall0 returns signal 0 for process existence checking.
-// On Windows, os.Signal doesn't support signal 0, so we use a type that
-// implements os.Signal but is a no-op.
-func syscall0() os.Signal {
-	return signal0{}
-}
-
-type signal0 struct{}
-
-func (signal0) Signal() {}
-func (signal0) String() string { return "signal 0" }
-
 // WorkerStatusFromPID returns the worker_status string for the heartbeat
 // based on whether the PID is alive.
 func WorkerStatusFromPID(pid int, checker ProcessChecker) string {
@@ -1,20 +1,111 @@
 package launcher
 
 import (
+	"errors"
 	"io"
 	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// fakeWorkerEnv makes the test binary stand in for the worker: started with
+// it set, it runs until stopped instead of running the tests. "ignore-term"
+// makes it ignore SIGTERM too, like a stuck worker.
+const fakeWorkerEnv = "TOKENLY_TEST_FAKE_WORKER"
+
+func TestMain(m *testing.M) {
+	switch os.Getenv(fakeWorkerEnv) {
+	case "ignore-term":
+		signal.Ignore(syscall.SIGTERM)
+		fallthrough
+	case "run":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// realChecker is an OSProcessChecker that counts the processes it starts and
+// kills, and kills those still running when the test ends.
+type realChecker struct {
+	*OSProcessChecker
+	mu      sync.Mutex
+	started []int
+	kills   int
+}
+
+func (c *realChecker) StartProcess(binary string, args ...string) (int, error) {
+	pid, err := c.OSProcessChecker.StartProcess(binary, args...)
+	if err == nil {
+		c.mu.Lock()
+		c.started = append(c.started, pid)
+		c.mu.Unlock()
+	}
+	return pid, err
+}
+
+func (c *realChecker) KillProcess(pid int) error {
+	c.mu.Lock()
+	c.kills++
+	c.mu.Unlock()
+	return c.OSProcessChecker.KillProcess(pid)
+}
+
+// running returns the started processes that are still alive.
+func (c *realChecker) running() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var pids []int
+	for _, pid := range c.started {
+		if c.IsProcessRunning(pid) {
+			pids = append(pids, pid)
+		}
+	}
+	return pids
+}
+
+// realWorkerManager returns a WorkerManager whose worker is the test binary
+// itself, run as a real process in the given fakeWorkerEnv mode.
+func realWorkerManager(t *testing.T, mode string) (*WorkerManager, *realChecker) {
+	t.Helper()
+	self, err := os.Executable()
+	require.NoError(t, err)
+	t.Setenv(fakeWorkerEnv, mode)
+	checker := &realChecker{OSProcessChecker: &OSProcessChecker{Output: io.Discard}}
+	t.Cleanup(func() {
+		for _, pid := range checker.running() {
+			checker.OSProcessChecker.KillProcess(pid)
+		}
+	})
+	wm := NewWorkerManager(self, filepath.Join(t.TempDir(), "state.json"), checker, silentLogger())
+	wm.killWait = 5 * time.Second
+	return wm, checker
+}
+
 // mockChecker implements ProcessChecker for testing.
 type mockChecker struct {
 	running    map[int]bool
 	nextPID    int
 	startError error
+	runs       [][]string // args of each RunProcess call
+	runError   error
+	output     string // stdout returned by ProcessOutput
+	ignoreStop bool   // StopProcess leaves the process running
+	ignoreKill bool   // KillProcess leaves the process running
+	stops      int
+	kills      int
+	exited     map[int]time.Time // exit times reported by ExitTime
+	paths      map[int]string    // executables reported by ProcessPath
 }
 
 func newMockChecker() *mockChecker {
@@ -38,6 +129,48 @@ func (c *mockChecker) StartProcess(binary string, args ...string) (int, error) {
 	return pid, nil
 }
 
+func (c *mockChecker) RunProcess(binary string, args ...string) error {
+	c.runs = append(c.runs, args)
+	return c.runError
+}
+
+func (c *mockChecker) ProcessOutput(binary string, args ...string) ([]byte, error) {
+	if c.output == "" {
+		return nil, errors.New("no output")
+	}
+	return []byte(c.output), nil
+}
+
+func (c *mockChecker) StopProcess(pid int) error {
+	c.stops++
+	if c.ignoreStop {
+		return nil
+	}
+	c.running[pid] = false
+	return nil
+}
+
+func (c *mockChecker) KillProcess(pid int) error {
+	c.kills++
+	if c.ignoreKill {
+		return nil
+	}
+	c.running[pid] = false
+	return nil
+}
+
+func (c *mockChecker) ExitTime(pid int) (time.Time, bool) {
+	t, ok := c.exited[pid]
+	return t, ok
+}
+
+func (c *mockChecker) ProcessPath(pid int) (string, error) {
+	if exe, ok := c.paths[pid]; ok {
+		return exe, nil
+	}
+	return "", errors.New("unknown process")
+}
+
 func silentLogger() *slog.Logger {
 	return slog.New(slog.NewTextHandler(io.Discard, nil))
 }
@@ -119,8 +252,149 @@ func TestEnsureStopped(t *testing.T) {
 	require.NoError(t, err)
 	assert.True(t, checker.running[pid])
 
-	wm.EnsureStopped(state)
+	assert.True(t, wm.EnsureStopped(state))
 	assert.Equal(t, 0, wm.PID())
+	assert.Zero(t, state.WorkerPID)
+	assert.Equal(t, "stopped", state.WorkerStatus)
+	assert.Zero(t, checker.kills, "a worker that exits in time isn't killed")
+}
+
+func TestEnsureStopped_KillsAfterGrace(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	wm.SetStopGrace(50 * time.Millisecond)
+	state := testState()
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	checker.ignoreStop = true
+
+	assert.True(t, wm.EnsureStopped(state))
+	assert.Equal(t, 1, checker.stops)
+	assert.Equal(t, 1, checker.kills)
+	assert.False(t, checker.running[pid])
+	assert.Equal(t, "stopped", state.WorkerStatus)
+}
+
+func TestEnsureStopped_RecordedPIDChecked(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("/opt/tokenly/tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	wm.SetStopGrace(10 * time.Millisecond)
+	wm.killWait = 10 * time.Millisecond
+	checker.ignoreStop = true
+
+	// The PID has been reused by another program: it is left alone.
+	checker.running[5555] = true
+	checker.paths = map[int]string{5555: "/usr/bin/postgres", 6666: "/opt/tokenly/tokenly-worker"}
+	state := testState()
+	state.WorkerPID = 5555
+	assert.True(t, wm.EnsureStopped(state))
+	assert.Zero(t, checker.stops+checker.kills)
+	assert.True(t, checker.running[5555])
+	assert.Zero(t, state.WorkerPID)
+
+	// The worker binary: stopped and, when stuck, killed.
+	checker.running[6666] = true
+	state.WorkerPID = 6666
+	assert.True(t, wm.EnsureStopped(state))
+	assert.Equal(t, 1, checker.kills)
+
+	// Its executable can't be read: asked to exit, never killed.
+	checker.running[7777] = true
+	state.WorkerPID = 7777
+	assert.False(t, wm.EnsureStopped(state))
+	assert.Equal(t, 2, checker.stops)
+	assert.Equal(t, 1, checker.kills)
+	assert.Equal(t, 7777, state.WorkerPID)
+}
+
+func TestOSProcessChecker_ProcessPath(t *testing.T) {
+	self, err := os.Executable()
+	require.NoError(t, err)
+	exe, err := (&OSProcessChecker{}).ProcessPath(os.Getpid())
+	require.NoError(t, err)
+	assert.True(t, samePath(exe, self), "%s is %s", exe, self)
+}
+
+func TestOSProcessChecker_IsProcessRunning(t *testing.T) {
+	self, err := os.Executable()
+	require.NoError(t, err)
+	t.Setenv(fakeWorkerEnv, "run")
+	c := &OSProcessChecker{Output: io.Discard}
+	assert.True(t, c.IsProcessRunning(os.Getpid()))
+
+	pid, err := c.StartProcess(self)
+	require.NoError(t, err)
+	assert.True(t, c.IsProcessRunning(pid))
+	require.NoError(t, c.KillProcess(pid))
+	assert.Eventually(t, func() bool { return !c.IsProcessRunning(pid) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestEnsureStopped_RealWorker(t *testing.T) {
+	for _, tc := range []struct {
+		mode   string
+		killed bool
+	}{
+		{"run", runtime.GOOS == "windows"}, // Windows has no SIGTERM to exit on
+		{"ignore-term", true},
+	} {
+		t.Run(tc.mode, func(t *testing.T) {
+			wm, checker := realWorkerManager(t, tc.mode)
+			wm.SetStopGrace(500 * time.Millisecond)
+			state := testState()
+
+			pid, started, err := wm.EnsureRunning(state)
+			require.NoError(t, err)
+			require.True(t, started)
+			state.WorkerPID = pid
+			time.Sleep(100 * time.Millisecond) // let it set up its signal handling
+
+			assert.True(t, wm.EnsureStopped(state))
+			assert.False(t, checker.IsProcessRunning(pid), "the PID is confirmed gone")
+			assert.Zero(t, state.WorkerPID)
+			assert.Equal(t, "stopped", state.WorkerStatus)
+			assert.Equal(t, tc.killed, checker.kills == 1)
+		})
+	}
+}
+
+func TestEnsureRunning_IgnoresReusedPID(t *testing.T) {
+	checker := newMockChecker()
+	checker.running[5555] = true
+	checker.paths = map[int]string{5555: "/usr/bin/postgres"}
+	wm := NewWorkerManager("/opt/tokenly/tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	state := testState()
+	state.WorkerPID = 5555
+
+	pid, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	assert.NotEqual(t, 5555, pid)
+}
+
+func TestEnsureStopped_KeepsSurvivingWorker(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	wm.SetStopGrace(10 * time.Millisecond)
+	wm.killWait = 10 * time.Millisecond
+	state := testState()
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	state.WorkerPID = pid
+	state.WorkerStatus = "running"
+	checker.ignoreStop = true
+	checker.ignoreKill = true
+
+	assert.False(t, wm.EnsureStopped(state))
+	assert.Equal(t, pid, wm.PID(), "the worker stays on record")
+	assert.Equal(t, pid, state.WorkerPID)
+	assert.Equal(t, "running", state.WorkerStatus)
+
+	// It isn't started a second time while it lives.
+	_, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
 }
 
 func TestIsRunning_NotStarted(t *testing.T) {
@@ -129,8 +403,403 @@ func TestIsRunning_NotStarted(t *testing.T) {
 	assert.False(t, wm.IsRunning())
 }
 
+func TestWorkerManager_Version(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "", checker, silentLogger())
+
+	checker.output = "tokenly-worker version 1.4.2 (commit: abc123, built: 2026-01-01)\n"
+	v, err := wm.Version()
+	require.NoError(t, err)
+	assert.Equal(t, "1.4.2", v)
+
+	checker.output = "something else\n"
+	_, err = wm.Version()
+	assert.Error(t, err)
+
+	checker.output = ""
+	_, err = wm.Version()
+	assert.Error(t, err)
+}
+
 func TestWorkerBinaryName(t *testing.T) {
 	name := WorkerBinaryName()
 	assert.NotEmpty(t, name)
 	assert.Contains(t, name, "tokenly-worker")
 }
+
+func TestEnsureRunning_BacksOffCrashLoop(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+
+	// The worker dies right after each start.
+	for i := 0; i < crashLoopThreshold; i++ {
+		pid, started, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.True(t, started)
+		checker.running[pid] = false
+		now = now.Add(5 * time.Minute)
+	}
+
+	_, _, err := wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+	assert.True(t, wm.CrashLooping())
+
+	// Still backed off until a minute after the third death was seen.
+	now = now.Add(30 * time.Second)
+	_, _, err = wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+
+	now = now.Add(time.Minute)
+	pid, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+
+	// Another quick death doubles the backoff.
+	checker.running[pid] = false
+	now = now.Add(time.Minute)
+	_, _, err = wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+	now = now.Add(90 * time.Second)
+	_, _, err = wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+	now = now.Add(time.Minute)
+	pid, _, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+
+	// Staying up past the window clears the crash loop.
+	now = now.Add(quickDeathWindow)
+	_, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+	assert.False(t, wm.CrashLooping())
+	assert.True(t, checker.running[pid])
+}
+
+func TestEnsureRunning_TimesDeathByExit(t *testing.T) {
+	checker := newMockChecker()
+	checker.exited = make(map[int]time.Time)
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+
+	// Each worker dies a minute in, but that is only seen much later.
+	for i := 0; i < crashLoopThreshold; i++ {
+		pid, started, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.True(t, started)
+		checker.running[pid] = false
+		checker.exited[pid] = now.Add(time.Minute)
+		now = now.Add(quickDeathWindow + time.Hour)
+	}
+	_, _, err := wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+}
+
+func TestEnsureRunning_RealWorkerSurvivesHeartbeats(t *testing.T) {
+	wm, checker := realWorkerManager(t, "run")
+	state := testState()
+
+	first, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	require.True(t, started)
+	for range 5 {
+		pid, started, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.False(t, started)
+		assert.Equal(t, first, pid)
+	}
+	assert.Equal(t, []int{first}, checker.running(), "one worker process")
+	assert.Zero(t, state.WorkerQuickDeaths)
+
+	// A worker that does die is counted once and replaced once.
+	require.NoError(t, checker.KillProcess(first))
+	require.Eventually(t, func() bool { return !checker.IsProcessRunning(first) }, 5*time.Second, 10*time.Millisecond)
+	second, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	_, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+	assert.Equal(t, []int{second}, checker.running())
+	assert.Equal(t, 1, state.WorkerQuickDeaths)
+}
+
+func TestEnsureRunning_AdoptsRealWorkerAfterHandoff(t *testing.T) {
+	old, checker := realWorkerManager(t, "ignore-term")
+	state := testState()
+	pid, _, err := old.EnsureRunning(state)
+	require.NoError(t, err)
+	state.WorkerPID = pid
+	time.Sleep(100 * time.Millisecond) // let it set up its signal handling
+
+	// The updated launcher comes up with a fresh manager and the state file.
+	fresh := &realChecker{OSProcessChecker: &OSProcessChecker{Output: io.Discard}}
+	wm := NewWorkerManager(old.workerBinary, old.statePath, fresh, silentLogger())
+	wm.SetStopGrace(100 * time.Millisecond)
+	got, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+	assert.Equal(t, pid, got)
+	assert.Empty(t, fresh.started, "no second worker")
+	assert.Equal(t, []int{pid}, checker.running())
+
+	// Its executable matches, so it can be stopped, kill included.
+	assert.True(t, wm.EnsureStopped(state))
+	assert.Equal(t, 1, fresh.kills)
+	assert.Empty(t, checker.running())
+}
+
+func TestEnsureRunning_CrashLoopSurvivesLauncherRestart(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+	for i := 0; i < crashLoopThreshold; i++ {
+		pid, _, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		checker.running[pid] = false
+	}
+	_, _, err := wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+	assert.Equal(t, crashLoopThreshold, state.WorkerQuickDeaths)
+	assert.Equal(t, "2026-03-01T12:01:00Z", state.WorkerRestartAfter)
+
+	restarted := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	restarted.now = wm.now
+	_, _, err = restarted.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping, "the backoff outlives the launcher")
+	assert.True(t, restarted.CrashLooping())
+
+	now = now.Add(time.Minute)
+	_, started, err := restarted.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+}
+
+func TestEnsureRunning_SlowDeathIsNotCrashLoop(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+
+	for i := 0; i < crashLoopThreshold+1; i++ {
+		pid, started, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.True(t, started)
+		checker.running[pid] = false
+		now = now.Add(time.Hour)
+	}
+	assert.False(t, wm.CrashLooping())
+}
+
+func TestResetCrashLoop(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+	for i := 0; i < crashLoopThreshold; i++ {
+		pid, _, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		checker.running[pid] = false
+	}
+	_, _, err := wm.EnsureRunning(state)
+	require.ErrorIs(t, err, ErrCrashLooping)
+
+	wm.ResetCrashLoop()
+	_, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+}
+
+func TestEnsureRunning_RestartsHungWorker(t *testing.T) {
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", "/tmp/state.json", checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	wm.SetHealthSocket("/run/tokenly/worker.sock")
+	progress := now
+	var probeErr error
+	wm.probe = func(string, time.Duration) (*config.HealthStatus, error) {
+		if probeErr != nil {
+			return nil, probeErr
+		}
+		return &config.HealthStatus{LastProgress: progress.Format(time.RFC3339)}, nil
+	}
+	state := testState()
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+
+	// Healthy probes keep the worker.
+	now = now.Add(5 * time.Minute)
+	progress = now
+	got, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+	assert.Equal(t, pid, got)
+
+	// No progress for too long: one failed probe is tolerated, two restart it.
+	now = now.Add(hungAfter)
+	_, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+	now = now.Add(5 * time.Minute)
+	got, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	assert.NotEqual(t, pid, got)
+	assert.False(t, checker.running[pid], "hung worker is killed")
+
+	// A worker without a health socket is left alone.
+	probeErr = ErrNoHealthSocket
+	for i := 0; i < 3; i++ {
+		now = now.Add(5 * time.Minute)
+		_, started, err = wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.False(t, started)
+	}
+}
+
+func TestEnsureRunning_RestartsHungRealWorker(t *testing.T) {
+	wm, checker := realWorkerManager(t, "ignore-term")
+	now := time.Now()
+	wm.now = func() time.Time { return now }
+	wm.SetHealthSocket("/run/tokenly/worker.sock")
+	wm.probe = func(string, time.Duration) (*config.HealthStatus, error) {
+		return nil, errors.New("connection refused")
+	}
+	state := testState()
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	now = now.Add(healthGrace)
+	for i := 1; i < healthProbeFailures; i++ {
+		_, started, err := wm.EnsureRunning(state)
+		require.NoError(t, err)
+		assert.False(t, started)
+	}
+	got, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	assert.False(t, checker.IsProcessRunning(pid), "the hung worker is killed")
+	assert.Equal(t, []int{got}, checker.running())
+	assert.Equal(t, 1, state.WorkerHungRestarts)
+}
+
+func TestWorkerManager_ExternalStatus(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	wm.SetExternal(true)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+	state.ServerConfig.ScanIntervalMinutes = 60
+
+	assert.Equal(t, "stopped", wm.ExternalStatus(state), "never reported")
+	_, err := wm.Version()
+	assert.Error(t, err)
+
+	report := &config.WorkerReport{
+		WorkerVersion:      "1.5.0",
+		UpdatedAt:          now.Add(-time.Hour).Format(time.RFC3339),
+		LastCycleCompleted: now.Add(-2 * time.Hour).Format(time.RFC3339),
+	}
+	require.NoError(t, report.Save(config.WorkerReportPath(statePath)))
+	assert.Equal(t, "running", wm.ExternalStatus(state))
+	v, err := wm.Version()
+	require.NoError(t, err)
+	assert.Equal(t, "1.5.0", v)
+
+	now = now.Add(3 * time.Hour)
+	assert.Equal(t, "crashed", wm.ExternalStatus(state), "quiet for three scan intervals")
+
+	// It is never stopped or run from here.
+	state.WorkerStatus = "running"
+	assert.True(t, wm.EnsureStopped(state))
+	assert.Equal(t, "running", state.WorkerStatus)
+	assert.Zero(t, checker.stops)
+	require.NoError(t, wm.RunOnce())
+	assert.Empty(t, checker.runs)
+}
+
+func TestEnsureRunning_RestartsStaleWorker(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	checker := newMockChecker()
+	wm := NewWorkerManager("tokenly-worker", statePath, checker, silentLogger())
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	wm.now = func() time.Time { return now }
+	state := testState()
+	state.ServerConfig.ScanIntervalMinutes = 60
+	report := func(completed time.Time) {
+		r := &config.WorkerReport{UpdatedAt: completed.Format(time.RFC3339)}
+		if !completed.IsZero() {
+			r.LastCycleCompleted = completed.Format(time.RFC3339)
+		}
+		require.NoError(t, r.Save(config.WorkerReportPath(statePath)))
+	}
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+
+	// A worker that doesn't report completed cycles is never stale.
+	report(time.Time{})
+	now = now.Add(10 * time.Hour)
+	_, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+
+	// Cycles completing within three scan intervals keep it.
+	report(now.Add(-2 * time.Hour))
+	_, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+
+	// Three intervals without one restart it, and the event is counted.
+	now = now.Add(time.Hour)
+	got, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	assert.NotEqual(t, pid, got)
+	assert.False(t, checker.running[pid], "stale worker is killed")
+	assert.Equal(t, 1, state.WorkerHungRestarts)
+
+	// The new worker is judged from its start, not the old report.
+	now = now.Add(time.Hour)
+	_, started, err = wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started)
+}
+
+func TestEnsureRunning_RestartsStaleRealWorker(t *testing.T) {
+	wm, checker := realWorkerManager(t, "ignore-term")
+	now := time.Now()
+	wm.now = func() time.Time { return now }
+	state := testState()
+	state.ServerConfig.ScanIntervalMinutes = 60
+
+	pid, _, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	report := &config.WorkerReport{UpdatedAt: now.Format(time.RFC3339), LastCycleCompleted: now.Format(time.RFC3339)}
+	require.NoError(t, report.Save(config.WorkerReportPath(wm.statePath)))
+
+	now = now.Add(2 * time.Hour)
+	_, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.False(t, started, "within three scan intervals")
+
+	now = now.Add(2 * time.Hour)
+	got, started, err := wm.EnsureRunning(state)
+	require.NoError(t, err)
+	assert.True(t, started)
+	assert.False(t, checker.IsProcessRunning(pid), "the stale worker is killed")
+	assert.Equal(t, []int{got}, checker.running())
+	assert.Equal(t, 1, state.WorkerHungRestarts)
+}
@@ -0,0 +1,197 @@
+package launcher
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
+)
+
+// WorkerUser is the unprivileged account a root launcher starts the worker
+// as, so a flaw in the component that parses arbitrary files can't be used
+// to take over the machine. The launcher itself keeps running as root: it
+// owns the state file, with the server credential, and installs updates.
+type WorkerUser struct {
+	Name   string
+	UID    int
+	GID    int
+	Groups []int // supplementary groups, for access to files via group permissions
+}
+
+// Account databases checked for other members of the worker's group.
+var (
+	passwdFile = "/etc/passwd"
+	groupFile  = "/etc/group"
+)
+
+// LookupWorkerUser resolves the named account. Running the worker as another
+// user is supported on Unix only, and never as root. The account's primary
+// group must be its own: the state file is shared with that group.
+func LookupWorkerUser(name string) (*WorkerUser, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("running the worker as another user is not supported on Windows")
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("look up worker user: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return nil, fmt.Errorf("worker user %s has non-numeric uid %q", name, u.Uid)
+	}
+	gid, err := strconv.Atoi(u.Gid)
+	if err != nil {
+		return nil, fmt.Errorf("worker user %s has non-numeric gid %q", name, u.Gid)
+	}
+	if uid == 0 {
+		return nil, fmt.Errorf("worker user %s is root", name)
+	}
+	if others := groupMembers(name, gid); len(others) > 0 {
+		return nil, fmt.Errorf("worker user %s shares its primary group %d with %s; give it a group of its own",
+			name, gid, strings.Join(others, ", "))
+	}
+
+	wu := &WorkerUser{Name: name, UID: uid, GID: gid}
+	if ids, err := u.GroupIds(); err == nil {
+		for _, id := range ids {
+			if g, err := strconv.Atoi(id); err == nil && g != gid {
+				wu.Groups = append(wu.Groups, g)
+			}
+		}
+	}
+	return wu, nil
+}
+
+// groupMembers returns the accounts other than name whose primary group is
+// gid or that are listed as members of it, going by the local account files.
+// Accounts only known to a directory service are not seen.
+func groupMembers(name string, gid int) []string {
+	seen := make(map[string]bool)
+	var others []string
+	add := func(account string) {
+		if account != "" && account != name && !seen[account] {
+			seen[account] = true
+			others = append(others, account)
+		}
+	}
+	id := strconv.Itoa(gid)
+	// passwd: name:password:uid:gid:...
+	readAccounts(passwdFile, func(fields []string) {
+		if len(fields) > 3 && fields[3] == id {
+			add(fields[0])
+		}
+	})
+	// group: name:password:gid:member,member
+	readAccounts(groupFile, func(fields []string) {
+		if len(fields) > 3 && fields[2] == id {
+			for _, member := range strings.Split(fields[3], ",") {
+				add(strings.TrimSpace(member))
+			}
+		}
+	})
+	return others
+}
+
+// readAccounts calls fn with the colon-separated fields of each entry in an
+// account file. A file that can't be read is skipped.
+func readAccounts(path string, fn func(fields []string)) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fn(strings.Split(line, ":"))
+	}
+}
+
+// PrepareFiles gives the worker user the access it needs under the default
+// platform paths, with the state file at statePath: see Prepare. An existing
+// state file is rewritten as SaveShared does.
+func (u *WorkerUser) PrepareFiles(statePath string) error {
+	learning := platform.LearningFilePath()
+	dirs := []string{filepath.Dir(statePath), platform.DataDir(), platform.RunDir()}
+	files := []string{
+		learning,
+		config.LearningBackupPath(learning),
+		platform.LedgerFilePath(),
+		platform.ScanIndexFilePath(),
+		platform.ValidationCacheFilePath(),
+		platform.UncleanableFilePath(),
+		platform.SpoolFilePath(),
+		platform.SanitizedFilePath(),
+		platform.QuarantineDir(),
+		platform.ArchiveDir(),
+		config.WorkerReportPath(statePath),
+		config.ScanReportPath(statePath),
+	}
+	if err := u.Prepare(dirs, files); err != nil {
+		return err
+	}
+	return u.shareState(statePath)
+}
+
+// shareState rewrites an existing state file readable by the worker's group
+// and without the credential.
+func (u *WorkerUser) shareState(statePath string) error {
+	if _, err := os.Stat(statePath); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	state, err := config.LoadState(statePath)
+	if err != nil {
+		return err
+	}
+	if state.ClientCredential == "" {
+		if state.ClientCredential, err = config.LoadCredential(statePath); err != nil {
+			return err
+		}
+	}
+	if err := state.SaveShared(statePath, u.GID); err != nil {
+		return fmt.Errorf("share state file: %w", err)
+	}
+	return nil
+}
+
+// Prepare makes dirs group-owned by the worker's group and group-writable
+// with the sticky bit set, so the worker can create files in them but not
+// replace or remove the launcher's. The files it writes are handed over to
+// it, directories with their contents. Paths that don't exist are skipped.
+func (u *WorkerUser) Prepare(dirs, files []string) error {
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("create %s: %w", dir, err)
+		}
+		if err := os.Chown(dir, -1, u.GID); err != nil {
+			return fmt.Errorf("set group of %s: %w", dir, err)
+		}
+		if err := os.Chmod(dir, 0775|os.ModeSticky); err != nil {
+			return fmt.Errorf("set mode of %s: %w", dir, err)
+		}
+	}
+	for _, root := range files {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, u.UID, u.GID)
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("hand %s to worker user: %w", root, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package launcher
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestLookupWorkerUser_Unknown(t *testing.T) {
+	_, err := LookupWorkerUser("tokenly-no-such-user")
+	assert.Error(t, err)
+}
+
+func TestLookupWorkerUser_RejectsRoot(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no root user on Windows")
+	}
+	_, err := LookupWorkerUser("root")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is root")
+}
+
+func TestGroupMembers(t *testing.T) {
+	dir := t.TempDir()
+	passwd, group := filepath.Join(dir, "passwd"), filepath.Join(dir, "group")
+	require.NoError(t, os.WriteFile(passwd, []byte(
+		"root:x:0:0:root:/root:/bin/sh\n"+
+			"tokenly:x:990:990::/nonexistent:/usr/sbin/nologin\n"+
+			"alice:x:1000:100::/home/alice:/bin/sh\n"+
+			"bob:x:1001:100::/home/bob:/bin/sh\n"), 0644))
+	require.NoError(t, os.WriteFile(group, []byte(
+		"# local groups\n"+
+			"tokenly:x:990:\n"+
+			"users:x:100:carol,tokenly\n"), 0644))
+	oldPasswd, oldGroup := passwdFile, groupFile
+	passwdFile, groupFile = passwd, group
+	t.Cleanup(func() { passwdFile, groupFile = oldPasswd, oldGroup })
+
+	assert.Empty(t, groupMembers("tokenly", 990), "a group of its own")
+	assert.Equal(t, []string{"alice", "bob", "carol"}, groupMembers("tokenly", 100))
+}
+
+func TestWorkerUser_Prepare(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	// Handing files to the current user works without privileges.
+	u := &WorkerUser{Name: "test", UID: os.Getuid(), GID: os.Getgid()}
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	quarantine := filepath.Join(dataDir, "quarantine")
+	require.NoError(t, os.MkdirAll(filepath.Join(quarantine, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(quarantine, "a", "f.json"), []byte("{}"), 0644))
+
+	err := u.Prepare(
+		[]string{dataDir, filepath.Join(root, "run")},
+		[]string{quarantine, filepath.Join(dataDir, "missing.json")},
+	)
+	require.NoError(t, err)
+
+	for _, dir := range []string{dataDir, filepath.Join(root, "run")} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0775), info.Mode().Perm(), dir)
+		assert.NotZero(t, info.Mode()&os.ModeSticky, dir)
+	}
+}
+
+func TestWorkerUser_ShareStateWithoutCredential(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	require.NoError(t, (&config.StateFile{Hostname: "h", ClientCredential: "secret"}).Save(statePath))
+
+	u := &WorkerUser{Name: "test", UID: os.Getuid(), GID: os.Getgid()}
+	require.NoError(t, u.shareState(statePath))
+
+	info, err := os.Stat(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	cred, err := config.LoadCredential(statePath)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", cred)
+}
+
+func TestWorkerUser_ApplyTo(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("running the worker as another user is not supported on Windows")
+	}
+	cmd := exec.Command("true")
+	(*WorkerUser)(nil).applyTo(cmd)
+	assert.Nil(t, cmd.SysProcAttr)
+
+	(&WorkerUser{UID: 1234, GID: 5678, Groups: []int{42}}).applyTo(cmd)
+	require.NotNil(t, cmd.SysProcAttr)
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package launcher
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// applyTo makes cmd run as the worker user. A nil user leaves cmd as is.
+func (u *WorkerUser) applyTo(cmd *exec.Cmd) {
+	if u == nil {
+		return
+	}
+	groups := make([]uint32, len(u.Groups))
+	for i, g := range u.Groups {
+		groups[i] = uint32(g)
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(u.UID), Gid: uint32(u.GID), Groups: groups},
+	}
+}
@@ -0,0 +1,9 @@
+//go:build windows
+
+package launcher
+
+import "os/exec"
+
+// applyTo is a no-op: LookupWorkerUser refuses to resolve a worker user on
+// Windows.
+func (u *WorkerUser) applyTo(cmd *exec.Cmd) {}
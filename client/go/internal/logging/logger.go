@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"io"
 	"log/slog"
 	"os"
 	"strings"
@@ -9,10 +10,15 @@ import (
 // NewLogger creates a structured JSON logger for the given component.
 // The level can be dynamically changed via the returned LevelVar.
 func NewLogger(component, level string) (*slog.Logger, *slog.LevelVar) {
+	return NewLoggerTo(component, level, os.Stderr)
+}
+
+// NewLoggerTo is NewLogger writing to w instead of stderr.
+func NewLoggerTo(component, level string, w io.Writer) (*slog.Logger, *slog.LevelVar) {
 	lvl := &slog.LevelVar{}
 	lvl.Set(ParseLevel(level))
 
-	handler := slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
 		Level: lvl,
 	})
 
@@ -1,6 +1,7 @@
 package logging
 
 import (
+	"bytes"
 	"log/slog"
 	"testing"
 
@@ -15,6 +16,16 @@ func TestNewLogger(t *testing.T) {
 	assert.Equal(t, slog.LevelInfo, lvl.Level())
 }
 
+func TestNewLoggerTo(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewLoggerTo("launcher", "info", &buf)
+	logger.Debug("hidden")
+	logger.Info("shown")
+	assert.NotContains(t, buf.String(), "hidden")
+	assert.Contains(t, buf.String(), `"msg":"shown"`)
+	assert.Contains(t, buf.String(), `"component":"launcher"`)
+}
+
 func TestNewLoggerDynamicLevel(t *testing.T) {
 	logger, lvl := NewLogger("worker", "debug")
 	require.NotNil(t, logger)
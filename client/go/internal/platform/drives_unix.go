@@ -0,0 +1,6 @@
+//go:build !windows
+
+package platform
+
+// FixedDrives returns nil: only Windows has drive letters.
+func FixedDrives() []string { return nil }
@@ -0,0 +1,29 @@
+//go:build windows
+
+package platform
+
+import "golang.org/x/sys/windows"
+
+// FixedDrives returns the local fixed drives, e.g. ["C:", "D:"]. Removable,
+// optical, and network drives are left out.
+func FixedDrives() []string {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil
+	}
+	var drives []string
+	for i := 0; i < 26; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		drive := string(rune('A'+i)) + ":"
+		root, err := windows.UTF16PtrFromString(drive + `\`)
+		if err != nil {
+			continue
+		}
+		if windows.GetDriveType(root) == windows.DRIVE_FIXED {
+			drives = append(drives, drive)
+		}
+	}
+	return drives
+}
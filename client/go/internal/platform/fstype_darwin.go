@@ -0,0 +1,26 @@
+//go:build darwin
+
+package platform
+
+import (
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// RemoteFSType returns the type of the network or FUSE filesystem holding
+// path, or "" if it is local or cannot be determined.
+func RemoteFSType(path string) string {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return ""
+	}
+	name := unix.ByteSliceToString(st.Fstypename[:])
+	switch {
+	case name == "nfs", name == "smbfs", name == "afpfs", name == "webdav":
+		return name
+	case strings.Contains(name, "fuse"):
+		return name // osxfuse, macfuse, fusefs
+	}
+	return ""
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package platform
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// RemoteFSType returns "smb" if path is a UNC path or on a mapped network
+// drive, or "" if it is local or cannot be determined.
+func RemoteFSType(path string) string {
+	vol := filepath.VolumeName(path)
+	if strings.HasPrefix(vol, `\\`) {
+		return "smb"
+	}
+	if vol == "" {
+		return ""
+	}
+	root, err := windows.UTF16PtrFromString(vol + `\`)
+	if err != nil {
+		return ""
+	}
+	if windows.GetDriveType(root) == windows.DRIVE_REMOTE {
+		return "smb"
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package platform
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ExpandPath expands environment variables and a leading "~" in a configured
+// path. "~" is the current user's home directory, except when the agent runs
+// privileged: a system service's own home is rarely what was meant, so "~"
+// then becomes a glob over every user's home directory under UsersDir, e.g.
+// "~/logs" becomes "/home/*/logs". "~name" is that user's home directory.
+func ExpandPath(path string) string {
+	home, _ := os.UserHomeDir()
+	return expandHome(os.ExpandEnv(path), IsPrivileged(), home, UsersDir())
+}
+
+// expandHome replaces a leading "~" or "~name" path element.
+func expandHome(path string, privileged bool, home, usersDir string) string {
+	if !strings.HasPrefix(path, "~") {
+		return path
+	}
+	name, rest := path[1:], ""
+	if i := strings.IndexAny(name, `/\`); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+
+	var dir string
+	switch {
+	case name != "":
+		dir = filepath.Join(usersDir, name)
+	case privileged:
+		dir = filepath.Join(usersDir, "*")
+	case home != "":
+		dir = home
+	default:
+		return path
+	}
+	return dir + rest
+}
@@ -0,0 +1,36 @@
+package platform
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandHome(t *testing.T) {
+	users := filepath.FromSlash("/home")
+	tests := []struct {
+		path       string
+		privileged bool
+		want       string
+	}{
+		{"/var/log", false, "/var/log"},
+		{"~", false, "/home/me"},
+		{"~/logs", false, "/home/me/logs"},
+		{"~/logs", true, filepath.Join(users, "*") + "/logs"},
+		{"~alice/logs", false, filepath.Join(users, "alice") + "/logs"},
+		{"~alice/logs", true, filepath.Join(users, "alice") + "/logs"},
+		{"a/~/b", true, "a/~/b"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, expandHome(tt.path, tt.privileged, "/home/me", users), tt.path)
+	}
+
+	assert.Equal(t, "~/logs", expandHome("~/logs", false, "", users), "no home directory to expand to")
+}
+
+func TestExpandPath(t *testing.T) {
+	t.Setenv("TOKENLY_TEST_DIR", "/data")
+	assert.Equal(t, "/data/logs", ExpandPath("$TOKENLY_TEST_DIR/logs"))
+	assert.NotContains(t, ExpandPath("~/logs"), "~")
+}
@@ -7,6 +7,11 @@ func IPCSocketPath() string {
 	return filepath.Join(RunDir(), "worker.sock")
 }
 
+// LauncherConfigPath returns the default path of the launcher's config file.
+func LauncherConfigPath() string {
+	return filepath.Join(ConfigDir(), "launcher.yaml")
+}
+
 // StateFilePath returns the path to the state file.
 func StateFilePath() string {
 	return filepath.Join(DataDir(), "tokenly-state.json")
@@ -16,3 +21,55 @@ func StateFilePath() string {
 func LearningFilePath() string {
 	return filepath.Join(DataDir(), "tokenly-learning.json")
 }
+
+// LedgerFilePath returns the path to the local upload ledger.
+func LedgerFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-ledger.jsonl")
+}
+
+// ScanIndexFilePath returns the path to the incremental scan index.
+func ScanIndexFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-scan-index.json")
+}
+
+// ValidationCacheFilePath returns the path to the cache of files known to
+// fail validation.
+func ValidationCacheFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-validation-cache.json")
+}
+
+// UncleanableFilePath returns the path to the list of uploaded files that
+// could not be cleaned up.
+func UncleanableFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-uncleanable.json")
+}
+
+// SpoolFilePath returns the path to the spool of files waiting to be
+// re-uploaded.
+func SpoolFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-spool.json")
+}
+
+// SanitizedFilePath returns the path to the upload progress of files kept in
+// place after a sanitized upload.
+func SanitizedFilePath() string {
+	return filepath.Join(DataDir(), "tokenly-sanitized.json")
+}
+
+// QuarantineDir returns the directory uploaded files are held in before
+// deletion, when quarantine is enabled.
+func QuarantineDir() string {
+	return filepath.Join(DataDir(), "quarantine")
+}
+
+// ArchiveDir returns the directory daily archives of uploaded files are
+// written to, when archiving is enabled.
+func ArchiveDir() string {
+	return filepath.Join(DataDir(), "archive")
+}
+
+// AgentDirs returns the directories the agent itself writes to. They must
+// never be scanned or cleaned, whatever the discovery configuration says.
+func AgentDirs() []string {
+	return []string{DataDir(), RunDir(), LogDir()}
+}
@@ -5,8 +5,14 @@ package platform
 // DataDir returns the data directory for macOS.
 func DataDir() string { return "/Library/Application Support/Tokenly" }
 
+// ConfigDir returns the configuration directory for macOS (same as data dir).
+func ConfigDir() string { return DataDir() }
+
 // RunDir returns the runtime directory for macOS.
 func RunDir() string { return "/var/run/tokenly" }
 
 // LogDir returns the log directory for macOS.
 func LogDir() string { return "/var/log/tokenly" }
+
+// UsersDir returns the directory holding user home directories on macOS.
+func UsersDir() string { return "/Users" }
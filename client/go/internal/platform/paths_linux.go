@@ -5,8 +5,14 @@ package platform
 // DataDir returns the data directory for Linux.
 func DataDir() string { return "/var/lib/tokenly" }
 
+// ConfigDir returns the configuration directory for Linux.
+func ConfigDir() string { return "/etc/tokenly" }
+
 // RunDir returns the runtime directory for Linux.
 func RunDir() string { return "/var/run/tokenly" }
 
 // LogDir returns the log directory for Linux.
 func LogDir() string { return "/var/log/tokenly" }
+
+// UsersDir returns the directory holding user home directories on Linux.
+func UsersDir() string { return "/home" }
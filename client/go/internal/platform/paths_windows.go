@@ -12,6 +12,11 @@ func DataDir() string {
 	return filepath.Join(os.Getenv("PROGRAMDATA"), "Tokenly")
 }
 
+// ConfigDir returns the configuration directory for Windows (same as data dir).
+func ConfigDir() string {
+	return DataDir()
+}
+
 // RunDir returns the runtime directory for Windows (same as data dir).
 func RunDir() string {
 	return filepath.Join(os.Getenv("PROGRAMDATA"), "Tokenly")
@@ -21,3 +26,12 @@ func RunDir() string {
 func LogDir() string {
 	return filepath.Join(os.Getenv("PROGRAMDATA"), "Tokenly", "logs")
 }
+
+// UsersDir returns the directory holding user profiles on Windows.
+func UsersDir() string {
+	drive := os.Getenv("SystemDrive")
+	if drive == "" {
+		drive = "C:"
+	}
+	return drive + `\Users`
+}
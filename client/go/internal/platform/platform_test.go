@@ -1,8 +1,11 @@
 package platform
 
 import (
+	"io/fs"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -39,6 +42,12 @@ func TestDataDir(t *testing.T) {
 	assert.True(t, strings.Contains(dir, "tokenly") || strings.Contains(dir, "Tokenly"))
 }
 
+func TestLauncherConfigPath(t *testing.T) {
+	path := LauncherConfigPath()
+	assert.Equal(t, ConfigDir(), filepath.Dir(path))
+	assert.Equal(t, "launcher.yaml", filepath.Base(path))
+}
+
 func TestRunDir(t *testing.T) {
 	dir := RunDir()
 	require.NotEmpty(t, dir)
@@ -66,3 +75,51 @@ func TestLearningFilePath(t *testing.T) {
 	require.NotEmpty(t, path)
 	assert.Contains(t, path, "tokenly-learning.json")
 }
+
+func TestLedgerFilePath(t *testing.T) {
+	path := LedgerFilePath()
+	require.NotEmpty(t, path)
+	assert.Contains(t, path, "tokenly-ledger.jsonl")
+}
+
+func TestScanIndexFilePath(t *testing.T) {
+	path := ScanIndexFilePath()
+	require.NotEmpty(t, path)
+	assert.Contains(t, path, "tokenly-scan-index.json")
+}
+
+func TestValidationCacheFilePath(t *testing.T) {
+	path := ValidationCacheFilePath()
+	require.NotEmpty(t, path)
+	assert.Contains(t, path, "tokenly-validation-cache.json")
+}
+
+func TestAgentDirs(t *testing.T) {
+	dirs := AgentDirs()
+	assert.Contains(t, dirs, DataDir())
+	assert.Contains(t, dirs, LogDir())
+}
+
+func TestRemoteFSType(t *testing.T) {
+	assert.Empty(t, RemoteFSType(t.TempDir()), "test temp dirs are local")
+	assert.Empty(t, RemoteFSType("/does/not/exist"))
+}
+
+func TestIsPrivacyDenied(t *testing.T) {
+	eperm := &fs.PathError{Op: "open", Path: "/Users/a/Library/Containers/x/Data", Err: syscall.EPERM}
+	assert.Equal(t, runtime.GOOS == "darwin", IsPrivacyDenied(eperm))
+	assert.False(t, IsPrivacyDenied(&fs.PathError{Op: "open", Path: "/x", Err: syscall.EACCES}))
+	assert.False(t, IsPrivacyDenied(nil))
+}
+
+func TestFixedDrives(t *testing.T) {
+	drives := FixedDrives()
+	if runtime.GOOS != "windows" {
+		assert.Empty(t, drives)
+		return
+	}
+	require.NotEmpty(t, drives)
+	for _, d := range drives {
+		assert.Regexp(t, `^[A-Z]:$`, d)
+	}
+}
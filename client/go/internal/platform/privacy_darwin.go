@@ -0,0 +1,16 @@
+//go:build darwin
+
+package platform
+
+import (
+	"errors"
+	"syscall"
+)
+
+// IsPrivacyDenied reports whether err is macOS privacy protection (TCC)
+// refusing access, as it does for other apps' sandbox containers and parts
+// of Application Support unless the process has Full Disk Access. Plain
+// permission bits fail with EACCES instead.
+func IsPrivacyDenied(err error) bool {
+	return errors.Is(err, syscall.EPERM)
+}
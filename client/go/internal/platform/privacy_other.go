@@ -0,0 +1,7 @@
+//go:build !darwin
+
+package platform
+
+// IsPrivacyDenied always returns false: only macOS has privacy protection
+// separate from file permissions.
+func IsPrivacyDenied(err error) bool { return false }
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package platform
+
+import "os"
+
+// IsPrivileged reports whether the process runs as root.
+func IsPrivileged() bool { return os.Geteuid() == 0 }
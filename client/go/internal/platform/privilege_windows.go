@@ -0,0 +1,9 @@
+//go:build windows
+
+package platform
+
+import "golang.org/x/sys/windows"
+
+// IsPrivileged reports whether the process runs elevated, as the agent's
+// service does.
+func IsPrivileged() bool { return windows.GetCurrentProcessToken().IsElevated() }
@@ -0,0 +1,328 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// Record formats the client can normalize.
+const (
+	// FormatOpenAIUsageExport is OpenAI's usage export: one line per
+	// aggregation bucket, with epoch timestamps and n_*_tokens_total counts.
+	FormatOpenAIUsageExport = "openai_usage_export"
+
+	// FormatNestedUsage is an API response or SDK log line with its token
+	// counts in a "usage" object, or under the prompt_tokens and
+	// completion_tokens names.
+	FormatNestedUsage = "nested_usage"
+)
+
+// FormatAdapter recognizes a third-party record shape and rewrites it into
+// the canonical schema (timestamp, service, model, input_tokens,
+// output_tokens).
+type FormatAdapter interface {
+	Name() string
+	Match(data map[string]any) bool
+	Normalize(data map[string]any) map[string]any
+}
+
+// formatAdapters is the registry of known formats, tried in order. Vendor
+// layouts come before the generic nestedUsage, which would also match them.
+var formatAdapters = []FormatAdapter{openAIUsageExport{}, anthropicMessageLog{}, geminiUsage{}, nestedUsage{}}
+
+// matchAdapter returns the first adapter that matches a record, or nil.
+func matchAdapter(data map[string]any) FormatAdapter {
+	for _, a := range formatAdapters {
+		if a.Match(data) {
+			return a
+		}
+	}
+	return nil
+}
+
+// adaptRecord normalizes a record matched by one of the format adapters.
+// Returns the record unchanged and "" if none matches.
+func adaptRecord(data map[string]any) (map[string]any, string) {
+	if a := matchAdapter(data); a != nil {
+		return a.Normalize(data), a.Name()
+	}
+	return data, ""
+}
+
+// openRecords opens a file's content as JSONL records in plain UTF-8 (see
+// openText), with CSV files converted by conv. Also returns the file's text
+// encoding, or "" for plain UTF-8.
+func openRecords(path string, conv *CSVConverter) (io.ReadCloser, string, error) {
+	f, enc, err := openText(path)
+	if err != nil || !isCSV(path) {
+		return f, enc, err
+	}
+	return readCloser{conv.Convert(f), f}, enc, nil
+}
+
+// readCloser pairs a reader with the closer of what it reads from.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// adapterFor returns the adapter with the given name, or nil.
+func adapterFor(format string) FormatAdapter {
+	for _, a := range formatAdapters {
+		if a.Name() == format {
+			return a
+		}
+	}
+	return nil
+}
+
+// recordRewrite describes how a file's records are rewritten for upload. The
+// zero value uploads the content as it is on disk.
+type recordRewrite struct {
+	format  string              // SourceFormat: an adapter, CSV, or text encoding
+	csv     *CSVConverter       // converts a FormatCSV source
+	tagger  *ProviderTagger     // fills in missing services; nil leaves them
+	pathTag *config.ProviderTag // the tagger's match on the original file's path
+	clock   time.Duration       // added to record timestamps; see StateFile.ClockOffset
+}
+
+// none reports whether the content is uploaded as it is on disk.
+func (rw recordRewrite) none() bool {
+	return rw.format == "" && rw.tagger == nil && rw.clock == 0
+}
+
+// shiftTimestamp adds the clock offset to a record's timestamp, keeping its
+// layout, and reports whether it changed anything. Timestamps that aren't
+// RFC 3339 are left as they are.
+func (rw recordRewrite) shiftTimestamp(data map[string]any) bool {
+	s, ok := data["timestamp"].(string)
+	if rw.clock == 0 || !ok {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return false
+	}
+	layout := time.RFC3339
+	if ts.Nanosecond() != 0 {
+		layout = time.RFC3339Nano
+	}
+	data["timestamp"] = ts.Add(rw.clock).Format(layout)
+	return true
+}
+
+// normalizeContent returns a reader of the records in r rewritten as the
+// validator saw them, a line at a time as it is read: those the format's
+// adapter matches are normalized, missing services are filled in by the
+// tagger, and timestamps are shifted by the clock offset. Every other line
+// is copied as-is. Lines always end in a newline.
+func normalizeContent(r io.Reader, rw recordRewrite) (io.Reader, error) {
+	adapter := adapterFor(rw.format)
+	if adapter == nil && rw.format != "" && rw.format != FormatCSV && !isTextEncoding(rw.format) {
+		return nil, fmt.Errorf("unknown record format %q", rw.format)
+	}
+	br := bufio.NewReader(r)
+	return &pullReader{next: func(out *bytes.Buffer) error {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimRight(line, "\r\n")
+			var data map[string]any
+			if json.Unmarshal(line, &data) == nil {
+				changed := false
+				if adapter != nil && adapter.Match(data) {
+					data, changed = adapter.Normalize(data), true
+				}
+				if rw.tagger.fill(data, string(line), rw.pathTag) != nil {
+					changed = true
+				}
+				if rw.shiftTimestamp(data) {
+					changed = true
+				}
+				if changed {
+					normalized, merr := json.Marshal(data)
+					if merr != nil {
+						return fmt.Errorf("marshal normalized record: %w", merr)
+					}
+					line = normalized
+				}
+			}
+			out.Write(line)
+			out.WriteByte('\n')
+		}
+		return err
+	}}, nil
+}
+
+// openNormalized opens a file's content rewritten as rw says, in plain UTF-8,
+// rewriting it as it is read. CSV files are first converted with rw.csv; for
+// a text encoding without tagging the content is only transcoded.
+func openNormalized(path string, rw recordRewrite) (io.ReadCloser, error) {
+	f, _, err := openText(path)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader = f
+	if rw.format == FormatCSV {
+		r = rw.csv.Convert(f)
+	}
+	if adapterFor(rw.format) != nil || rw.tagger != nil || rw.clock != 0 || (rw.format != FormatCSV && !isTextEncoding(rw.format)) {
+		if r, err = normalizeContent(r, rw); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+	return readCloser{r, f}, nil
+}
+
+// pullReader is an io.Reader whose content is produced a piece at a time by
+// next, which appends to out and returns io.EOF once there is no more.
+type pullReader struct {
+	next func(out *bytes.Buffer) error
+	buf  bytes.Buffer
+	err  error
+}
+
+func (p *pullReader) Read(b []byte) (int, error) {
+	for p.buf.Len() == 0 && p.err == nil {
+		p.err = p.next(&p.buf)
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(b)
+	}
+	return 0, p.err
+}
+
+// openAIUsageExport adapts OpenAI usage export records, e.g.
+//
+//	{"aggregation_timestamp":1736937000,"snapshot_id":"gpt-4o-2024-08-06",
+//	 "n_context_tokens_total":1200,"n_generated_tokens_total":300,"n_requests":4}
+type openAIUsageExport struct{}
+
+func (openAIUsageExport) Name() string { return FormatOpenAIUsageExport }
+
+func (openAIUsageExport) Match(data map[string]any) bool {
+	_, snapshot := data["snapshot_id"].(string)
+	_, tokens := data["n_context_tokens_total"].(float64)
+	return snapshot && tokens
+}
+
+// Normalize maps the export's fields onto the canonical ones and keeps the
+// rest, e.g. n_requests and project_id, as they are.
+func (openAIUsageExport) Normalize(data map[string]any) map[string]any {
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	for _, k := range []string{"snapshot_id", "n_context_tokens_total", "n_generated_tokens_total"} {
+		delete(out, k)
+	}
+	for _, k := range []string{"aggregation_timestamp", "timestamp"} {
+		if ts, ok := epochTime(data[k]); ok {
+			delete(out, k)
+			out["timestamp"] = ts.UTC().Format(time.RFC3339)
+			break
+		}
+	}
+	if _, ok := out["service"]; !ok {
+		out["service"] = "openai"
+	}
+	out["model"] = data["snapshot_id"]
+	out["input_tokens"] = data["n_context_tokens_total"]
+	if v, ok := data["n_generated_tokens_total"]; ok {
+		out["output_tokens"] = v
+	}
+	return out
+}
+
+// usageFieldNames maps token count names found in usage objects to the
+// canonical field names.
+var usageFieldNames = map[string]string{
+	"prompt_tokens":               "input_tokens",
+	"completion_tokens":           "output_tokens",
+	"input_tokens":                "input_tokens",
+	"output_tokens":               "output_tokens",
+	"total_tokens":                "total_tokens",
+	"cache_read_input_tokens":     "cache_read_input_tokens",
+	"cache_creation_input_tokens": "cache_creation_input_tokens",
+}
+
+// nestedUsage adapts records with nested or alternately named token counts,
+// e.g.
+//
+//	{"created":1736937000,"model":"gpt-4","usage":{"prompt_tokens":10,"completion_tokens":5}}
+type nestedUsage struct{}
+
+func (nestedUsage) Name() string { return FormatNestedUsage }
+
+func (nestedUsage) Match(data map[string]any) bool {
+	if usage, ok := data["usage"].(map[string]any); ok {
+		for name := range usageFieldNames {
+			if _, ok := usage[name].(float64); ok {
+				return true
+			}
+		}
+	}
+	_, prompt := data["prompt_tokens"].(float64)
+	_, completion := data["completion_tokens"].(float64)
+	_, input := data["input_tokens"]
+	return (prompt || completion) && !input
+}
+
+// Normalize lifts the usage object's token counts to the top level under the
+// canonical names, keeping any other usage fields, e.g. prompt_tokens_details,
+// in the object. A Unix "created" time becomes the timestamp if there is none.
+func (nestedUsage) Normalize(data map[string]any) map[string]any {
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	for _, alt := range []string{"prompt_tokens", "completion_tokens"} {
+		if v, ok := out[alt].(float64); ok {
+			delete(out, alt)
+			out[usageFieldNames[alt]] = v
+		}
+	}
+	if usage, ok := data["usage"].(map[string]any); ok {
+		rest := make(map[string]any, len(usage))
+		for k, v := range usage {
+			if name, known := usageFieldNames[k]; known {
+				if _, isNum := v.(float64); isNum {
+					out[name] = v
+					continue
+				}
+			}
+			rest[k] = v
+		}
+		if len(rest) > 0 {
+			out["usage"] = rest
+		} else {
+			delete(out, "usage")
+		}
+	}
+	if _, ok := out["timestamp"]; !ok {
+		if ts, ok := epochTime(data["created"]); ok {
+			delete(out, "created")
+			out["timestamp"] = ts.UTC().Format(time.RFC3339)
+		}
+	}
+	return out
+}
+
+// epochTime converts a Unix timestamp in seconds, or milliseconds if too
+// large to be seconds, to a time.
+func epochTime(v any) (time.Time, bool) {
+	n, ok := v.(float64)
+	if !ok || n <= 0 {
+		return time.Time{}, false
+	}
+	if n >= 1e12 {
+		return time.UnixMilli(int64(n)), true
+	}
+	return time.Unix(int64(n), 0), true
+}
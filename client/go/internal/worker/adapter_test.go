@@ -0,0 +1,213 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func openAIExportRecord() string {
+	return `{"aggregation_timestamp":1736937000,"snapshot_id":"gpt-4o-2024-08-06","n_context_tokens_total":1200,"n_generated_tokens_total":300,"n_requests":4}`
+}
+
+func TestOpenAIUsageExport_Normalize(t *testing.T) {
+	var data map[string]any
+	require.NoError(t, json.Unmarshal([]byte(openAIExportRecord()), &data))
+
+	normalized, format := adaptRecord(data)
+	assert.Equal(t, FormatOpenAIUsageExport, format)
+	assert.Equal(t, map[string]any{
+		"timestamp":     "2025-01-15T10:30:00Z",
+		"service":       "openai",
+		"model":         "gpt-4o-2024-08-06",
+		"input_tokens":  1200.0,
+		"output_tokens": 300.0,
+		"n_requests":    4.0,
+	}, normalized)
+	assert.True(t, defaultValidator.Valid(normalized))
+
+	canonical := map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "model": "gpt-4"}
+	same, format := adaptRecord(canonical)
+	assert.Empty(t, format)
+	assert.Equal(t, canonical, same)
+}
+
+func TestEpochTime(t *testing.T) {
+	want := time.Date(2025, 1, 15, 10, 30, 0, 0, time.UTC)
+	ts, ok := epochTime(1736937000.0)
+	require.True(t, ok)
+	assert.True(t, want.Equal(ts))
+	ts, ok = epochTime(1736937000000.0)
+	require.True(t, ok)
+	assert.True(t, want.Equal(ts), "milliseconds")
+	_, ok = epochTime("2025-01-15T10:30:00Z")
+	assert.False(t, ok)
+}
+
+func TestNormalizeContent(t *testing.T) {
+	in := openAIExportRecord() + "\r\nnot json\n" + validRecord()
+	r, err := normalizeContent(strings.NewReader(in), recordRewrite{format: FormatOpenAIUsageExport})
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"input_tokens":1200`)
+	assert.NotContains(t, lines[0], "snapshot_id")
+	assert.Equal(t, "not json", lines[1])
+	assert.Equal(t, validRecord(), lines[2])
+
+	_, err = normalizeContent(strings.NewReader(in), recordRewrite{format: "unknown"})
+	assert.Error(t, err)
+}
+
+func TestNormalizeContent_ShiftsTimestamps(t *testing.T) {
+	in := validRecord() + "\n" +
+		`{"timestamp":"2025-01-15T10:30:00.250Z","service":"openai","model":"gpt-4"}` + "\n" +
+		`{"timestamp":"yesterday","service":"openai","model":"gpt-4"}` + "\n"
+	rw := recordRewrite{clock: -90 * time.Second}
+	assert.False(t, rw.none())
+	r, err := normalizeContent(strings.NewReader(in), rw)
+	require.NoError(t, err)
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], `"timestamp":"2025-01-15T10:28:30Z"`)
+	assert.Contains(t, lines[1], `"timestamp":"2025-01-15T10:28:30.25Z"`)
+	assert.Contains(t, lines[2], `"timestamp":"yesterday"`, "unparseable timestamps are left alone")
+}
+
+func TestValidateJSONLFile_OpenAIExport(t *testing.T) {
+	path := writeJSONLFile(t, t.TempDir(), "usage-export.jsonl", []string{openAIExportRecord(), openAIExportRecord()})
+
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 2, result.AdaptedRecords)
+	assert.Equal(t, FormatOpenAIUsageExport, result.Format)
+	assert.True(t, looksLikeTokenFile(path, 5, nil))
+}
+
+func TestBuildFileMetadata_Normalized(t *testing.T) {
+	path := writeJSONLFile(t, t.TempDir(), "usage-export.jsonl", []string{openAIExportRecord()})
+
+	meta, err := buildFileMetadata(path, config.ChecksumSHA256, GzipUploadCompressed, recordRewrite{format: FormatOpenAIUsageExport})
+	require.NoError(t, err)
+	assert.Equal(t, FormatOpenAIUsageExport, meta.SourceFormat)
+
+	r, err := openUpload(path, meta)
+	require.NoError(t, err)
+	defer r.Close()
+	sent, err := io.ReadAll(r)
+	require.NoError(t, err)
+	sum := sha256.Sum256(sent)
+	assert.Equal(t, hex.EncodeToString(sum[:]), meta.FileHash, "hash covers the normalized content")
+	assert.Equal(t, int64(len(sent)), meta.SizeBytes)
+	assert.Equal(t, 1, meta.LineCount)
+}
+
+func TestWorker_UploadsNormalizedExport(t *testing.T) {
+	var body, format string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(f)
+		body = string(data)
+		var meta struct {
+			FileInfo struct {
+				SourceFormat string `json:"source_format"`
+			} `json:"file_info"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("metadata")), &meta))
+		format = meta.FileInfo.SourceFormat
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	writeJSONLFile(t, dir, "usage-export.jsonl", []string{openAIExportRecord()})
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	assert.Equal(t, FormatOpenAIUsageExport, format)
+	assert.Contains(t, body, `"model":"gpt-4o-2024-08-06"`)
+	assert.Contains(t, body, `"timestamp":"2025-01-15T10:30:00Z"`)
+}
+
+func TestNestedUsage_Normalize(t *testing.T) {
+	var data map[string]any
+	require.NoError(t, json.Unmarshal([]byte(`{"created":1736937000,"service":"openai","model":"gpt-4",
+		"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15,"prompt_tokens_details":{"cached_tokens":2}}}`), &data))
+
+	normalized, format := adaptRecord(data)
+	assert.Equal(t, FormatNestedUsage, format)
+	assert.Equal(t, map[string]any{
+		"timestamp":     "2025-01-15T10:30:00Z",
+		"service":       "openai",
+		"model":         "gpt-4",
+		"input_tokens":  10.0,
+		"output_tokens": 5.0,
+		"total_tokens":  15.0,
+		"usage":         map[string]any{"prompt_tokens_details": map[string]any{"cached_tokens": 2.0}},
+	}, normalized)
+	assert.True(t, defaultValidator.Valid(normalized))
+	_, again := adaptRecord(normalized)
+	assert.Empty(t, again, "normalized records are not adapted twice")
+}
+
+func TestNestedUsage_Shapes(t *testing.T) {
+	anthropic := map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "anthropic", "model": "claude-3",
+		"usage": map[string]any{"input_tokens": 20.0, "output_tokens": 7.0, "cache_read_input_tokens": 100.0}}
+	normalized, format := adaptRecord(anthropic)
+	assert.Equal(t, FormatNestedUsage, format)
+	assert.NotContains(t, normalized, "usage")
+	assert.Equal(t, 100.0, normalized["cache_read_input_tokens"])
+
+	flat := map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "model": "gpt-4",
+		"prompt_tokens": 10.0, "completion_tokens": 5.0}
+	normalized, format = adaptRecord(flat)
+	assert.Equal(t, FormatNestedUsage, format)
+	assert.Equal(t, 10.0, normalized["input_tokens"])
+	assert.NotContains(t, normalized, "prompt_tokens")
+
+	_, format = adaptRecord(map[string]any{"model": "gpt-4", "usage": map[string]any{"note": "none"}})
+	assert.Empty(t, format, "a usage object without token counts")
+}
+
+func TestValidateJSONLFile_NestedUsage(t *testing.T) {
+	path := writeJSONLFile(t, t.TempDir(), "responses.jsonl", []string{
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","usage":{"prompt_tokens":10,"completion_tokens":5}}`,
+	})
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, FormatNestedUsage, result.Format)
+
+	out, err := openNormalized(path, recordRewrite{format: result.Format})
+	require.NoError(t, err)
+	defer out.Close()
+	body, err := io.ReadAll(out)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":10,"output_tokens":5}`,
+		string(body))
+}
@@ -0,0 +1,192 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Archive files are named archivePrefix, the day in UTC, and archiveSuffix.
+const (
+	archivePrefix    = "tokenly-archive-"
+	archiveSuffix    = ".tar.gz"
+	archiveDayFormat = "2006-01-02"
+)
+
+// Archiver keeps an on-host copy of uploaded files for audit: each file is
+// appended to a compressed tar archive for the day, and archives are deleted
+// once past their retention age or over the size cap, oldest first. Each
+// file is appended as its own gzip member holding a tar entry, so appending
+// never rewrites the archive; the entries read back as one tar stream. It is
+// safe for concurrent use.
+type Archiver struct {
+	mu       sync.Mutex
+	dir      string
+	maxAge   time.Duration // 0 disables archiving
+	maxBytes int64         // 0 for no size cap
+	now      func() time.Time
+	logger   *slog.Logger
+}
+
+// NewArchiver creates an Archiver that writes to dir. It archives nothing
+// until SetRetention enables it.
+func NewArchiver(dir string, logger *slog.Logger) *Archiver {
+	return &Archiver{dir: dir, now: time.Now, logger: logger}
+}
+
+// SetRetention sets how long archives are kept and the most space they may
+// take together. A non-positive maxAge disables archiving; a non-positive
+// maxBytes removes the size cap.
+func (a *Archiver) SetRetention(maxAge time.Duration, maxBytes int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.maxAge = max(maxAge, 0)
+	a.maxBytes = max(maxBytes, 0)
+}
+
+// Add appends the file at path to today's archive, named by its absolute
+// path. It does nothing while archiving is disabled.
+func (a *Archiver) Add(path string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.maxAge == 0 {
+		return nil
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("resolve %q: %w", path, err)
+	}
+	src, err := os.Open(abs)
+	if err != nil {
+		return fmt.Errorf("open %q: %w", path, err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("stat %q: %w", path, err)
+	}
+
+	if err := os.MkdirAll(a.dir, 0700); err != nil {
+		return fmt.Errorf("create archive dir: %w", err)
+	}
+	archive := filepath.Join(a.dir, archivePrefix+a.now().UTC().Format(archiveDayFormat)+archiveSuffix)
+	f, err := os.OpenFile(archive, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("open archive: %w", err)
+	}
+	start, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open archive: %w", err)
+	}
+
+	if err := appendEntry(f, src, info, filepath.ToSlash(mirroredPath(abs))); err != nil {
+		// Drop the partial entry, so the archive still reads back.
+		f.Truncate(start)
+		f.Close()
+		return fmt.Errorf("archive %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close archive: %w", err)
+	}
+	a.logger.Debug("archived file", "path", path, "archive", archive)
+	return nil
+}
+
+// appendEntry writes one gzip member to w holding a tar entry for the file,
+// padded to a whole block but without the end-of-archive marker, so later
+// entries continue the same tar stream.
+func appendEntry(w io.Writer, src io.Reader, info fs.FileInfo, name string) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     info.Size(),
+		Mode:     0600,
+		ModTime:  info.ModTime(),
+		Format:   tar.FormatPAX,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, src); err != nil {
+		return err
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// Prune deletes archives past their retention age, then the oldest ones
+// while the archives take more than the size cap. Today's archive is kept.
+// Returns the number deleted.
+func (a *Archiver) Prune() (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.maxAge == 0 {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(a.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read archive dir: %w", err)
+	}
+
+	type archive struct {
+		name string
+		day  time.Time
+		size int64
+	}
+	var archives []archive
+	var total int64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, archivePrefix) || !strings.HasSuffix(name, archiveSuffix) {
+			continue
+		}
+		day, err := time.Parse(archiveDayFormat, strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix))
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		archives = append(archives, archive{name, day, info.Size()})
+		total += info.Size()
+	}
+	sort.Slice(archives, func(i, j int) bool { return archives[i].day.Before(archives[j].day) })
+
+	now := a.now()
+	today := now.UTC().Format(archiveDayFormat)
+	cutoff := now.Add(-a.maxAge)
+	pruned := 0
+	for _, arc := range archives {
+		expired := !arc.day.AddDate(0, 0, 1).After(cutoff)
+		oversize := a.maxBytes > 0 && total > a.maxBytes
+		if arc.day.Format(archiveDayFormat) == today || (!expired && !oversize) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(a.dir, arc.name)); err != nil {
+			return pruned, fmt.Errorf("remove archive %s: %w", arc.name, err)
+		}
+		a.logger.Debug("removed archive", "archive", arc.name, "expired", expired)
+		total -= arc.size
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readArchive returns the entries of a tar.gz archive by name.
+func readArchive(t *testing.T, path string) map[string]string {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	entries := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		entries[hdr.Name] = string(data)
+	}
+}
+
+func TestArchiver_AppendsToDailyArchive(t *testing.T) {
+	src, dir := t.TempDir(), t.TempDir()
+	a := NewArchiver(dir, testLogger())
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	a.now = func() time.Time { return now }
+	a.SetRetention(7*24*time.Hour, 0)
+
+	first, second := filepath.Join(src, "a.jsonl"), filepath.Join(src, "sub", "b.jsonl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(second), 0755))
+	require.NoError(t, os.WriteFile(first, []byte("first"), 0644))
+	require.NoError(t, os.WriteFile(second, []byte("second"), 0644))
+	require.NoError(t, a.Add(first))
+	require.NoError(t, a.Add(second))
+
+	entries := readArchive(t, filepath.Join(dir, "tokenly-archive-2026-03-10.tar.gz"))
+	assert.Equal(t, map[string]string{
+		filepath.ToSlash(mirroredPath(first)):  "first",
+		filepath.ToSlash(mirroredPath(second)): "second",
+	}, entries)
+
+	assert.Error(t, a.Add(filepath.Join(src, "missing.jsonl")))
+	assert.Len(t, readArchive(t, filepath.Join(dir, "tokenly-archive-2026-03-10.tar.gz")), 2)
+}
+
+func TestArchiver_Disabled(t *testing.T) {
+	src, dir := t.TempDir(), filepath.Join(t.TempDir(), "archive")
+	path := filepath.Join(src, "a.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	a := NewArchiver(dir, testLogger())
+	require.NoError(t, a.Add(path))
+	_, err := os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+	n, err := a.Prune()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestArchiver_Prune(t *testing.T) {
+	dir := t.TempDir()
+	write := func(day string, size int) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "tokenly-archive-"+day+".tar.gz"), make([]byte, size), 0600))
+	}
+	write("2026-03-01", 100)
+	write("2026-03-05", 100)
+	write("2026-03-08", 100)
+	write("2026-03-10", 300)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.txt"), nil, 0600))
+
+	a := NewArchiver(dir, testLogger())
+	a.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC) }
+
+	// Past the age limit: the 1st.
+	a.SetRetention(7*24*time.Hour, 0)
+	n, err := a.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	// Over the size cap: oldest first, but never today's.
+	a.SetRetention(7*24*time.Hour, 350)
+	n, err = a.Prune()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	assert.Equal(t, []string{"other.txt", "tokenly-archive-2026-03-10.tar.gz"}, names)
+}
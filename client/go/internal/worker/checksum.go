@@ -0,0 +1,151 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"lukechampine.com/blake3"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// FileDigest is a file's checksum and the algorithm that produced it.
+type FileDigest struct {
+	Algorithm string
+	Hex       string
+}
+
+// key identifies the content for dedupe. Digests from different algorithms
+// never compare equal.
+func (d FileDigest) key() string {
+	return d.Algorithm + ":" + strings.ToLower(d.Hex)
+}
+
+// resolveChecksum returns the canonical name of a configured checksum
+// algorithm, and false if it is not supported. Empty selects the default.
+func resolveChecksum(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return config.ChecksumSHA256, true
+	}
+	for _, alg := range config.SupportedChecksums() {
+		if name == alg {
+			return alg, true
+		}
+	}
+	return config.ChecksumSHA256, false
+}
+
+// newHash returns a hash.Hash for a supported algorithm.
+func newHash(alg string) (hash.Hash, error) {
+	switch alg {
+	case config.ChecksumSHA256:
+		return sha256.New(), nil
+	case config.ChecksumBLAKE3:
+		return blake3.New(32, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum algorithm %q", alg)
+	}
+}
+
+// digestFile hashes a file and counts its lines in a single read, returning
+// the size of what was hashed. A gzipped file's lines are counted in its
+// decompressed content; with decompress its hash and size are of that content
+// too, otherwise of the bytes on disk.
+func digestFile(path, alg string, decompress bool) (FileDigest, int, int64, error) {
+	h, err := newHash(alg)
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	defer f.Close()
+
+	var lines int
+	var size int64
+	switch {
+	case !isGzip(path):
+		lines, size, err = countLines(io.TeeReader(f, h))
+	case decompress:
+		var zr *gzipReader
+		if zr, err = newGzipReader(f); err == nil {
+			lines, size, err = countLines(io.TeeReader(zr, h))
+			zr.Close()
+		}
+	default:
+		// Hash the bytes on disk as the decompressor reads them.
+		raw := &countingReader{r: io.TeeReader(f, h)}
+		var zr *gzipReader
+		if zr, err = newGzipReader(raw); err == nil {
+			if lines, _, err = countLines(zr); err == nil {
+				_, err = io.Copy(io.Discard, raw)
+			}
+			zr.Close()
+		}
+		size = raw.n
+	}
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	return FileDigest{Algorithm: alg, Hex: hex.EncodeToString(h.Sum(nil))}, lines, size, nil
+}
+
+// digestNormalized is digestFile for a file's content rewritten as rw says,
+// which is what gets uploaded.
+func digestNormalized(path, alg string, rw recordRewrite) (FileDigest, int, int64, error) {
+	h, err := newHash(alg)
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	r, err := openNormalized(path, rw)
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	defer r.Close()
+	lines, size, err := countLines(io.TeeReader(r, h))
+	if err != nil {
+		return FileDigest{}, 0, 0, err
+	}
+	return FileDigest{Algorithm: alg, Hex: hex.EncodeToString(h.Sum(nil))}, lines, size, nil
+}
+
+// countLines counts the newlines in r and the bytes read.
+func countLines(r io.Reader) (int, int64, error) {
+	buf := make([]byte, 32*1024)
+	lines := 0
+	var size int64
+	for {
+		n, err := r.Read(buf)
+		size += int64(n)
+		for i := 0; i < n; i++ {
+			if buf[i] == '\n' {
+				lines++
+			}
+		}
+		if err == io.EOF {
+			return lines, size, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
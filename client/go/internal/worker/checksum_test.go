@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestResolveChecksum(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"", config.ChecksumSHA256, true},
+		{"sha256", config.ChecksumSHA256, true},
+		{" BLAKE3 ", config.ChecksumBLAKE3, true},
+		{"md5", config.ChecksumSHA256, false},
+	}
+	for _, tt := range tests {
+		got, ok := resolveChecksum(tt.name)
+		assert.Equal(t, tt.want, got, tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+	}
+}
+
+func TestDigestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "abc.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("abc"), 0644))
+
+	d, lines, size, err := digestFile(path, config.ChecksumSHA256, false)
+	require.NoError(t, err)
+	assert.Equal(t, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad", d.Hex)
+	assert.Equal(t, config.ChecksumSHA256, d.Algorithm)
+	assert.Zero(t, lines)
+	assert.Equal(t, int64(3), size)
+
+	d, _, _, err = digestFile(path, config.ChecksumBLAKE3, false)
+	require.NoError(t, err)
+	assert.Equal(t, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85", d.Hex)
+
+	_, _, _, err = digestFile(path, "md5", false)
+	assert.Error(t, err)
+}
+
+func TestDigestFile_CountsLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lines.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n{}\n{}\n"), 0644))
+
+	_, lines, _, err := digestFile(path, config.ChecksumSHA256, false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, lines)
+}
+
+func TestFileDigest_KeySeparatesAlgorithms(t *testing.T) {
+	a := FileDigest{Algorithm: "sha256", Hex: "ABC"}
+	b := FileDigest{Algorithm: "blake3", Hex: "abc"}
+	assert.Equal(t, "sha256:abc", a.key())
+	assert.NotEqual(t, a.key(), b.key())
+}
@@ -1,20 +1,65 @@
 package worker
 
 import (
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/platform"
 )
 
-// Cleaner removes uploaded files and empty parent directories.
+// quarantineDayFormat names the quarantine's per-day directories, in UTC.
+const quarantineDayFormat = "2006-01-02"
+
+// Post-upload actions: what the cleaner does with a file once uploaded.
+const (
+	// PostUploadDelete deletes the file, or quarantines it if a quarantine
+	// is set.
+	PostUploadDelete = "delete"
+	// PostUploadTruncate empties the file in place, for producers that hold
+	// it open or expect it to exist.
+	PostUploadTruncate = "truncate"
+	// PostUploadMoveTo moves the file under a configured directory.
+	PostUploadMoveTo = "move_to"
+	// PostUploadKeep leaves the file as it is.
+	PostUploadKeep = "keep"
+	// PostUploadMark leaves the file as it is; the worker records its upload
+	// in a sidecar next to it, which scans check to skip it.
+	PostUploadMark = "mark"
+)
+
+// Cleaner removes uploaded files and empty parent directories. With a
+// quarantine set, files are moved into it instead of deleted, and deleted by
+// PurgeQuarantine once held for the retention period. SetPostUploadAction
+// selects truncating, moving, or keeping files instead.
 type Cleaner struct {
+	discovery      []string // discovery paths as configured; the fence
 	protectedPaths []string
+	agentDirs      []string
+	agentFiles     []string
+	action         string        // one of the PostUpload actions
+	moveTo         string        // destination for PostUploadMoveTo
+	quarantine     string        // holding directory; "" deletes files outright
+	retention      time.Duration // how long quarantined files are held
+	maxBytes       int64         // quarantine size cap; 0 = none
+	secure         bool          // overwrite files before deleting them
+	now            func() time.Time
 	logger         *slog.Logger
+
+	mu      sync.Mutex
+	emptied map[string]bool // directories files were removed from; see SweepEmptyDirs
 }
 
-// NewCleaner creates a Cleaner that will never remove directories in protectedPaths.
+// NewCleaner creates a Cleaner that will never remove directories in
+// protectedPaths, the discovery paths, nor anything outside them.
 func NewCleaner(protectedPaths []string, logger *slog.Logger) *Cleaner {
 	// Normalize protected paths.
 	normalized := make([]string, len(protectedPaths))
@@ -22,56 +67,538 @@ func NewCleaner(protectedPaths []string, logger *slog.Logger) *Cleaner {
 		normalized[i] = filepath.Clean(p)
 	}
 	return &Cleaner{
+		discovery:      append([]string(nil), protectedPaths...),
 		protectedPaths: normalized,
+		action:         PostUploadDelete,
+		now:            time.Now,
 		logger:         logger,
 	}
 }
 
-// CleanupFile deletes the file and removes empty parent directories up to a
-// protected or root boundary.
+// SetQuarantine makes CleanupFile move files into dir instead of deleting
+// them, under a directory per day and their original path, and
+// PurgeQuarantine delete them once held for retention, or sooner while the
+// quarantine holds more than maxBytes. An empty dir or a non-positive
+// retention deletes files outright; a non-positive maxBytes sets no cap.
+func (c *Cleaner) SetQuarantine(dir string, retention time.Duration, maxBytes int64) {
+	if dir == "" || retention <= 0 {
+		c.quarantine, c.retention, c.maxBytes = "", 0, 0
+		return
+	}
+	c.quarantine, c.retention, c.maxBytes = filepath.Clean(dir), retention, max(maxBytes, 0)
+}
+
+// ProtectAgentDirs registers the agent's own directories. Nothing inside them
+// is ever deleted, and they also act as boundaries for empty-directory removal.
+func (c *Cleaner) ProtectAgentDirs(dirs []string) {
+	for _, d := range dirs {
+		if d == "" {
+			continue
+		}
+		d = filepath.Clean(d)
+		c.agentDirs = append(c.agentDirs, d)
+		c.protectedPaths = append(c.protectedPaths, d)
+	}
+}
+
+// ProtectAgentFiles registers the agent's own state files, as paths or glob
+// patterns, which are never deleted wherever they are kept.
+func (c *Cleaner) ProtectAgentFiles(files []string) {
+	c.agentFiles = append(c.agentFiles, files...)
+}
+
+// SetPostUploadAction sets what CleanupFile does with uploaded files. An
+// empty action deletes them. An unknown action, or PostUploadMoveTo without
+// a directory, keeps them: a misconfiguration should not destroy data.
+func (c *Cleaner) SetPostUploadAction(action, moveTo string) {
+	switch action {
+	case "":
+		action = PostUploadDelete
+	case PostUploadDelete, PostUploadTruncate, PostUploadKeep, PostUploadMark:
+	case PostUploadMoveTo:
+		if moveTo == "" {
+			c.logger.Warn("post-upload move_to has no directory, keeping files")
+			action = PostUploadKeep
+		}
+	default:
+		c.logger.Warn("unknown post-upload action, keeping files", "action", action)
+		action = PostUploadKeep
+	}
+	c.action, c.moveTo = action, ""
+	if action == PostUploadMoveTo {
+		c.moveTo = filepath.Clean(moveTo)
+	}
+}
+
+// PostUploadAction returns the action CleanupFile takes.
+func (c *Cleaner) PostUploadAction() string {
+	return c.action
+}
+
+// SetSecureDelete makes the cleaner overwrite files with random bytes before
+// deleting them: uploaded files, the originals of files moved into the
+// quarantine across filesystems, and purged quarantined files.
+func (c *Cleaner) SetSecureDelete(on bool) {
+	c.secure = on
+}
+
+// errFileChanged is returned, wrapped, when a file to truncate is no longer
+// as it was uploaded.
+var errFileChanged = errors.New("file changed since upload")
+
+// CleanupFile applies the post-upload action to the file. Deleting it, or
+// moving it into the quarantine if one is set, or under the move_to
+// directory, leaves its directory for SweepEmptyDirs. Files that are not
+// under a discovery path once symlinks are resolved are refused, whatever
+// the pipeline asks.
 func (c *Cleaner) CleanupFile(path string) error {
-	if err := os.Remove(path); err != nil {
+	return c.cleanup(path, nil)
+}
+
+// CleanupUploaded is CleanupFile for an uploaded candidate. Under the
+// truncate action, a file whose size or mtime no longer match the candidate's
+// is left alone with an error wrapping errFileChanged: emptying it would lose
+// the lines written since.
+func (c *Cleaner) CleanupUploaded(candidate FileCandidate) error {
+	return c.cleanup(candidate.Path, &candidate)
+}
+
+// cleanup implements CleanupFile, checking a file to truncate against
+// uploaded if set.
+func (c *Cleaner) cleanup(path string, uploaded *FileCandidate) error {
+	for _, d := range c.agentDirs {
+		if isWithin(path, d) {
+			return fmt.Errorf("refusing to delete %q inside agent directory %q", path, d)
+		}
+	}
+	if isAgentFile(path, c.agentFiles) {
+		return fmt.Errorf("refusing to delete agent file %q", path)
+	}
+	if c.action == PostUploadKeep || c.action == PostUploadMark {
+		return nil
+	}
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	roots := c.fenceRoots()
+	fenced, err := withinRoots(path, roots, false)
+	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
 		}
-		return fmt.Errorf("remove file %q: %w", path, err)
+		return fmt.Errorf("resolve %q: %w", path, err)
+	}
+	if !fenced {
+		return fmt.Errorf("refusing to delete %q outside the discovery paths", path)
+	}
+
+	switch {
+	case c.action == PostUploadTruncate:
+		if err := c.truncateFile(path, uploaded); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("truncate file %q: %w", path, err)
+		}
+		c.logger.Debug("truncated file", "path", path)
+		return nil
+	case c.action == PostUploadMoveTo:
+		dst, err := c.relocate(path, c.moveTo)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("move file %q: %w", path, err)
+		}
+		c.logger.Debug("moved file", "path", path, "to", dst)
+	case c.quarantine != "":
+		err := c.quarantineFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("quarantine file %q: %w", path, err)
+		}
+	default:
+		if err := c.removeFile(path); err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return fmt.Errorf("remove file %q: %w", path, err)
+		}
+		c.logger.Debug("deleted file", "path", path)
 	}
-	c.logger.Debug("deleted file", "path", path)
 
-	// Walk up parent directories, removing empty ones.
-	dir := filepath.Dir(path)
-	for {
-		dir = filepath.Clean(dir)
+	// A discovery path that names the file itself gives no directory
+	// boundary, so leave its parents alone.
+	if c.isProtectedPath(path) {
+		return nil
+	}
 
-		if c.isProtectedPath(dir) {
-			break
+	c.mu.Lock()
+	if c.emptied == nil {
+		c.emptied = make(map[string]bool)
+	}
+	c.emptied[filepath.Clean(filepath.Dir(path))] = true
+	c.mu.Unlock()
+	return nil
+}
+
+// SweepEmptyDirs removes the directories that cleanups since the last sweep
+// left empty, and parents left empty in turn, up to a protected or root
+// boundary. Directories are visited deepest first, each at most once, so
+// files cleaned up together in one tree cost one read per directory.
+// Returns the number removed.
+func (c *Cleaner) SweepEmptyDirs() int {
+	c.mu.Lock()
+	emptied := c.emptied
+	c.emptied = nil
+	c.mu.Unlock()
+	if len(emptied) == 0 {
+		return 0
+	}
+
+	// A removed directory's parent is shallower, so it is reached after its
+	// other children at that depth.
+	byDepth := make(map[int][]string)
+	deepest := 0
+	for dir := range emptied {
+		d := pathDepth(dir)
+		byDepth[d] = append(byDepth[d], dir)
+		deepest = max(deepest, d)
+	}
+	roots := c.fenceRoots()
+	removed := 0
+	for d := deepest; d >= 0; d-- {
+		for _, dir := range byDepth[d] {
+			if !c.removeIfEmpty(dir, roots) {
+				continue
+			}
+			removed++
+			parent := filepath.Dir(dir)
+			if parent == dir || emptied[parent] {
+				continue
+			}
+			emptied[parent] = true
+			byDepth[pathDepth(parent)] = append(byDepth[pathDepth(parent)], parent)
 		}
+	}
+	return removed
+}
 
-		// Check if directory is empty.
-		entries, err := os.ReadDir(dir)
+// removeIfEmpty removes dir if it is empty and strictly inside one of the
+// fence roots, and not protected or a filesystem root.
+func (c *Cleaner) removeIfEmpty(dir string, roots []string) bool {
+	if c.isProtectedPath(dir) {
+		return false
+	}
+	if ok, _ := withinRoots(dir, roots, true); !ok {
+		return false
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) > 0 {
+		return false
+	}
+	if err := os.Remove(dir); err != nil {
+		return false
+	}
+	c.logger.Debug("removed empty directory", "path", dir)
+	return true
+}
+
+// pathDepth returns how deep a clean path is, counting its separators.
+func pathDepth(path string) int {
+	return strings.Count(path, string(filepath.Separator))
+}
+
+// fenceRoots returns the directories the discovery paths name on this
+// machine, expanding "~" and globs, with symlinks resolved.
+func (c *Cleaner) fenceRoots() []string {
+	var roots []string
+	for _, p := range c.discovery {
+		matches, err := filepath.Glob(filepath.FromSlash(platform.ExpandPath(p)))
 		if err != nil {
-			break
+			continue
 		}
-		if len(entries) > 0 {
-			break
+		for _, m := range matches {
+			if resolved, err := filepath.EvalSymlinks(m); err == nil {
+				roots = append(roots, resolved)
+			}
 		}
+	}
+	return roots
+}
 
-		if err := os.Remove(dir); err != nil {
-			break
+// withinRoots reports whether path is under one of roots once symlinks in
+// its directory are resolved. The last element is not resolved: removing a
+// symlink removes the link, so it is judged by where it is. With strict set,
+// path must not be a root itself.
+func withinRoots(path string, roots []string, strict bool) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(abs))
+	if err != nil {
+		return false, err
+	}
+	resolved := filepath.Join(dir, filepath.Base(abs))
+	for _, root := range roots {
+		if isWithin(resolved, root) && !(strict && resolved == root) {
+			return true, nil
 		}
-		c.logger.Debug("removed empty directory", "path", dir)
+	}
+	return false, nil
+}
 
-		parent := filepath.Dir(dir)
-		if parent == dir {
-			// Reached filesystem root.
-			break
+// PurgeQuarantine deletes the quarantine's day directories whose files have
+// all been held for the retention period, then the oldest ones while the
+// quarantine takes more than the size cap. Today's directory is kept.
+// Returns the number deleted.
+func (c *Cleaner) PurgeQuarantine() (int, error) {
+	if c.quarantine == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(c.quarantine)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read quarantine: %w", err)
+	}
+
+	// Day directories are named so ReadDir lists them oldest first.
+	type held struct {
+		name string
+		day  time.Time
+		size int64
+	}
+	var days []held
+	var total int64
+	for _, entry := range entries {
+		day, err := time.Parse(quarantineDayFormat, entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		size := dirSize(filepath.Join(c.quarantine, entry.Name()))
+		days = append(days, held{entry.Name(), day, size})
+		total += size
+	}
+
+	now := c.now()
+	today := now.UTC().Format(quarantineDayFormat)
+	cutoff := now.Add(-c.retention)
+	purged := 0
+	for _, d := range days {
+		expired := !d.day.AddDate(0, 0, 1).After(cutoff)
+		oversize := c.maxBytes > 0 && total > c.maxBytes
+		if d.name == today || (!expired && !oversize) {
+			continue
+		}
+		if err := c.removeAll(filepath.Join(c.quarantine, d.name)); err != nil {
+			return purged, fmt.Errorf("purge quarantine day %s: %w", d.name, err)
 		}
-		dir = parent
+		c.logger.Debug("purged quarantined files", "day", d.name, "expired", expired)
+		total -= d.size
+		purged++
 	}
+	return purged, nil
+}
 
+// dirSize returns the total size of the regular files under dir, skipping
+// any it cannot read.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// quarantineFile moves the file at path into today's quarantine directory,
+// under its original absolute path, so it can be found and restored.
+func (c *Cleaner) quarantineFile(path string) error {
+	dst, err := c.relocate(path, filepath.Join(c.quarantine, c.now().UTC().Format(quarantineDayFormat)))
+	if err != nil {
+		return err
+	}
+	c.logger.Debug("quarantined file", "path", path, "to", dst)
 	return nil
 }
 
+// relocate moves the file at path under dir, at its original absolute path,
+// and returns where it went. A file already there is kept, and the new one
+// numbered.
+func (c *Cleaner) relocate(path, dir string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return "", err
+	}
+	dst := filepath.Join(dir, mirroredPath(abs))
+	if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+		return "", err
+	}
+	for i, base := 1, dst; ; i++ {
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = fmt.Sprintf("%s.%d", base, i)
+	}
+	if err := moveFile(abs, dst, c.removeFile); err != nil {
+		return "", err
+	}
+	return dst, nil
+}
+
+// truncateFile empties the file at path, first overwriting it if secure
+// delete is on, unless it has changed since uploaded. A producer holding the
+// file open keeps writing to it.
+func (c *Cleaner) truncateFile(path string, uploaded *FileCandidate) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if uploaded != nil && (info.Size() != uploaded.SizeBytes || !info.ModTime().Equal(uploaded.ModifiedAt)) {
+		return errFileChanged
+	}
+	return retryWritable(path, func(path string) error {
+		if c.secure {
+			if err := overwriteFile(path); err != nil {
+				return err
+			}
+		}
+		return os.Truncate(path, 0)
+	})
+}
+
+// mirroredPath returns the absolute path abs as a relative one, for keeping a
+// copy of the file under another directory: the volume name, if any, becomes
+// the first element ("C:\logs\a.jsonl" becomes "C\logs\a.jsonl").
+func mirroredPath(abs string) string {
+	vol := filepath.VolumeName(abs)
+	rest := strings.TrimLeft(abs[len(vol):], `/\`)
+	return filepath.Join(strings.NewReplacer(":", "", `\`, "_", "/", "_").Replace(vol), rest)
+}
+
+// moveFile renames src to dst, copying it and removing src with remove if
+// they are on different filesystems. The copy keeps the modification time.
+func moveFile(src, dst string, remove func(string) error) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	return remove(src)
+}
+
+// removeFile deletes the file at path, first overwriting it if secure delete
+// is on.
+func (c *Cleaner) removeFile(path string) error {
+	return retryWritable(path, func(path string) error {
+		if c.secure {
+			if err := overwriteFile(path); err != nil {
+				return err
+			}
+		}
+		return os.Remove(path)
+	})
+}
+
+// retryWritable runs op on path and, if it is denied, once more with the file
+// and its directory made writable by their owner, where the agent may change
+// their modes. Modes are restored afterwards on whatever is left.
+func retryWritable(path string, op func(string) error) error {
+	err := op(path)
+	if !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+	var restore []func()
+	for _, p := range []string{path, filepath.Dir(path)} {
+		info, err := os.Lstat(p)
+		if err != nil || info.Mode()&fs.ModeSymlink != 0 || info.Mode().Perm()&0200 != 0 {
+			continue
+		}
+		if os.Chmod(p, info.Mode().Perm()|0200) == nil {
+			restore = append(restore, func() { os.Chmod(p, info.Mode().Perm()) })
+		}
+	}
+	if len(restore) == 0 {
+		return err
+	}
+	defer func() {
+		for _, r := range restore {
+			r()
+		}
+	}()
+	return op(path)
+}
+
+// removeAll deletes the directory tree at dir, first overwriting its files if
+// secure delete is on.
+func (c *Cleaner) removeAll(dir string) error {
+	if c.secure {
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return overwriteFile(path)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return os.RemoveAll(dir)
+}
+
+// overwriteFile overwrites a regular file's contents with random bytes and
+// flushes them to disk. A symlink is left alone, so its target is not
+// destroyed. Copy-on-write filesystems and SSDs that remap blocks may keep
+// the old data, so this is a best effort.
+func overwriteFile(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := io.CopyN(f, rand.Reader, info.Size()); err != nil {
+		return fmt.Errorf("overwrite: %w", err)
+	}
+	return f.Sync()
+}
+
 // isProtectedPath returns true if dir is a protected path or a filesystem root.
 func (c *Cleaner) isProtectedPath(dir string) bool {
 	cleaned := filepath.Clean(dir)
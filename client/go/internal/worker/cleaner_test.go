@@ -1,9 +1,12 @@
 package worker
 
 import (
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -32,6 +35,7 @@ func TestCleaner_EmptyParentDirsCleanedUp(t *testing.T) {
 	// Protect base so cleanup stops there.
 	c := NewCleaner([]string{base}, testLogger())
 	require.NoError(t, c.CleanupFile(path))
+	assert.Equal(t, 3, c.SweepEmptyDirs())
 
 	// File removed.
 	_, err := os.Stat(path)
@@ -57,8 +61,9 @@ func TestCleaner_NonEmptyParentNotRemoved(t *testing.T) {
 	path := filepath.Join(subdir, "test.jsonl")
 	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
 
-	c := NewCleaner(nil, testLogger())
+	c := NewCleaner([]string{base}, testLogger())
 	require.NoError(t, c.CleanupFile(path))
+	c.SweepEmptyDirs()
 
 	// subdir is empty and should be removed.
 	_, err := os.Stat(subdir)
@@ -69,6 +74,32 @@ func TestCleaner_NonEmptyParentNotRemoved(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCleaner_SweepEmptyDirsAcrossDepths(t *testing.T) {
+	base := t.TempDir()
+	var paths []string
+	for _, dir := range []string{filepath.Join(base, "a", "x", "y"), filepath.Join(base, "a", "z")} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		for i := range 3 {
+			path := filepath.Join(dir, fmt.Sprintf("%d.jsonl", i))
+			require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+			paths = append(paths, path)
+		}
+	}
+
+	c := NewCleaner([]string{base}, testLogger())
+	for _, p := range paths {
+		require.NoError(t, c.CleanupFile(p))
+	}
+	_, err := os.Stat(filepath.Join(base, "a", "x", "y"))
+	assert.NoError(t, err, "directories are left for the sweep")
+
+	// a is emptied only once both x and z are gone.
+	assert.Equal(t, 4, c.SweepEmptyDirs())
+	_, err = os.Stat(filepath.Join(base, "a"))
+	assert.True(t, os.IsNotExist(err))
+	assert.Zero(t, c.SweepEmptyDirs(), "nothing left to sweep")
+}
+
 func TestCleaner_ProtectedPathNotRemoved(t *testing.T) {
 	base := t.TempDir()
 	protected := filepath.Join(base, "protected")
@@ -80,6 +111,7 @@ func TestCleaner_ProtectedPathNotRemoved(t *testing.T) {
 
 	c := NewCleaner([]string{protected}, testLogger())
 	require.NoError(t, c.CleanupFile(path))
+	c.SweepEmptyDirs()
 
 	// sub is removed (empty).
 	_, err := os.Stat(nested)
@@ -95,3 +127,334 @@ func TestCleaner_FileDoesNotExist(t *testing.T) {
 	err := c.CleanupFile(filepath.Join(t.TempDir(), "nonexistent.jsonl"))
 	assert.NoError(t, err)
 }
+
+func TestCleaner_FileDiscoveryPathKeepsParents(t *testing.T) {
+	base := t.TempDir()
+	nested := filepath.Join(base, "app")
+	require.NoError(t, os.MkdirAll(nested, 0755))
+	path := filepath.Join(nested, "known.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	c := NewCleaner([]string{path}, testLogger())
+	require.NoError(t, c.CleanupFile(path))
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(nested)
+	assert.NoError(t, err, "parent of a file discovery path must not be removed")
+}
+
+func TestCleaner_RefusesAgentDirs(t *testing.T) {
+	base := t.TempDir()
+	own := filepath.Join(base, "tokenly")
+	require.NoError(t, os.MkdirAll(own, 0755))
+	path := filepath.Join(own, "tokenly-state.json")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+
+	c := NewCleaner([]string{base}, testLogger())
+	c.ProtectAgentDirs([]string{own})
+	err := c.CleanupFile(path)
+	assert.Error(t, err)
+
+	_, statErr := os.Stat(path)
+	assert.NoError(t, statErr, "agent files must never be deleted")
+}
+
+func TestCleaner_RefusesAgentFiles(t *testing.T) {
+	base := t.TempDir()
+	path := filepath.Join(base, "tokenly-ledger.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+
+	c := NewCleaner([]string{base}, testLogger())
+	c.ProtectAgentFiles([]string{path})
+	assert.Error(t, c.CleanupFile(path))
+	assert.FileExists(t, path)
+}
+
+func TestCleaner_RefusesOutsideDiscoveryPaths(t *testing.T) {
+	root, outside := t.TempDir(), t.TempDir()
+	stray := filepath.Join(outside, "test.jsonl")
+	require.NoError(t, os.WriteFile(stray, []byte("data"), 0644))
+
+	c := NewCleaner([]string{root}, testLogger())
+	assert.Error(t, c.CleanupFile(stray))
+	assert.FileExists(t, stray)
+
+	// A symlinked directory under the root leads outside it.
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+	assert.Error(t, c.CleanupFile(filepath.Join(root, "link", "test.jsonl")))
+	assert.FileExists(t, stray)
+
+	// A symlinked file is removed as a link; its target is untouched.
+	linked := filepath.Join(root, "linked.jsonl")
+	require.NoError(t, os.Symlink(stray, linked))
+	require.NoError(t, c.CleanupFile(linked))
+	_, err := os.Lstat(linked)
+	assert.True(t, os.IsNotExist(err))
+	assert.FileExists(t, stray)
+}
+
+func TestCleaner_GlobDiscoveryPath(t *testing.T) {
+	base := t.TempDir()
+	path := filepath.Join(base, "app", "logs", "test.jsonl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	c := NewCleaner([]string{filepath.Join(base, "*")}, testLogger())
+	require.NoError(t, c.CleanupFile(path))
+	assert.Equal(t, 1, c.SweepEmptyDirs(), "only logs is removed")
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.DirExists(t, filepath.Join(base, "app"), "the matched root is kept")
+}
+
+func TestRetryWritable(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0444))
+	require.NoError(t, os.Chmod(dir, 0555))
+	defer os.Chmod(dir, 0755)
+
+	calls := 0
+	err := retryWritable(path, func(p string) error {
+		calls++
+		if calls == 1 {
+			return &fs.PathError{Op: "remove", Path: p, Err: fs.ErrPermission}
+		}
+		for _, q := range []string{p, dir} {
+			info, err := os.Stat(q)
+			require.NoError(t, err)
+			assert.NotZero(t, info.Mode().Perm()&0200, "%s made writable", q)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	// Modes are restored afterwards.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0444), info.Mode().Perm())
+	info, err = os.Stat(dir)
+	require.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0555), info.Mode().Perm())
+
+	// Other errors are not retried.
+	calls = 0
+	assert.ErrorIs(t, retryWritable(path, func(string) error { calls++; return fs.ErrNotExist }), fs.ErrNotExist)
+	assert.Equal(t, 1, calls)
+}
+
+func TestCleaner_Quarantine(t *testing.T) {
+	base, quarantine := t.TempDir(), t.TempDir()
+	path := filepath.Join(base, "logs", "test.jsonl")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("first"), 0644))
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	c := NewCleaner([]string{base}, testLogger())
+	c.now = func() time.Time { return now }
+	c.SetQuarantine(quarantine, 2*24*time.Hour, 0)
+	require.NoError(t, c.CleanupFile(path))
+	c.SweepEmptyDirs()
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(base, "logs"))
+	assert.True(t, os.IsNotExist(err), "empty parents are still removed")
+	held := filepath.Join(quarantine, "2026-03-10", mirroredPath(path))
+	data, err := os.ReadFile(held)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(data))
+
+	// The same file quarantined again the same day is kept alongside.
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte("second"), 0644))
+	require.NoError(t, c.CleanupFile(path))
+	data, err = os.ReadFile(held + ".1")
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	// Held for the retention period after the end of the day.
+	now = time.Date(2026, 3, 12, 23, 0, 0, 0, time.UTC)
+	n, err := c.PurgeQuarantine()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+	now = time.Date(2026, 3, 13, 0, 0, 0, 0, time.UTC)
+	n, err = c.PurgeQuarantine()
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = os.Stat(filepath.Join(quarantine, "2026-03-10"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestCleaner_QuarantineSizeCap(t *testing.T) {
+	quarantine := t.TempDir()
+	for _, day := range []string{"2026-03-08", "2026-03-09", "2026-03-10"} {
+		dir := filepath.Join(quarantine, day, "logs")
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "test.jsonl"), make([]byte, 1000), 0644))
+	}
+
+	c := NewCleaner(nil, testLogger())
+	c.now = func() time.Time { return time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC) }
+	c.SetQuarantine(quarantine, 30*24*time.Hour, 1500)
+	n, err := c.PurgeQuarantine()
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	// Today's files are kept even over the cap.
+	entries, err := os.ReadDir(quarantine)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "2026-03-10", entries[0].Name())
+}
+
+func TestCleaner_QuarantineDisabled(t *testing.T) {
+	dir, quarantine := t.TempDir(), t.TempDir()
+	path := filepath.Join(dir, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetQuarantine(quarantine, 0, 0)
+	require.NoError(t, c.CleanupFile(path))
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	entries, err := os.ReadDir(quarantine)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	n, err := c.PurgeQuarantine()
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestCleaner_SecureDelete(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.jsonl")
+	secret := []byte("secret usage data")
+	require.NoError(t, os.WriteFile(path, secret, 0644))
+	// A second link to the same file shows what happened to its contents.
+	witness := filepath.Join(t.TempDir(), "witness")
+	if err := os.Link(path, witness); err != nil {
+		t.Skip("hard links not supported:", err)
+	}
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetSecureDelete(true)
+	require.NoError(t, c.CleanupFile(path))
+
+	_, err := os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	data, err := os.ReadFile(witness)
+	require.NoError(t, err)
+	assert.Len(t, data, len(secret))
+	assert.NotEqual(t, secret, data)
+}
+
+func TestCleaner_SecureDeleteLeavesSymlinkTarget(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(t.TempDir(), "target.jsonl")
+	require.NoError(t, os.WriteFile(target, []byte("keep"), 0644))
+	link := filepath.Join(dir, "link.jsonl")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetSecureDelete(true)
+	require.NoError(t, c.CleanupFile(link))
+
+	data, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "keep", string(data))
+}
+
+func TestCleaner_PostUploadTruncate(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+	path := filepath.Join(sub, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetPostUploadAction(PostUploadTruncate, "")
+	require.NoError(t, c.CleanupFile(path))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+	assert.NoError(t, c.CleanupFile(filepath.Join(sub, "missing.jsonl")))
+}
+
+func TestCleaner_TruncateSkipsChangedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data\n"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	uploaded := FileCandidate{Path: path, SizeBytes: info.Size(), ModifiedAt: info.ModTime()}
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetPostUploadAction(PostUploadTruncate, "")
+	require.NoError(t, os.WriteFile(path, []byte("data\nmore\n"), 0644))
+	assert.ErrorIs(t, c.CleanupUploaded(uploaded), errFileChanged)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "data\nmore\n", string(data), "lines written after the upload are kept")
+
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	uploaded.SizeBytes, uploaded.ModifiedAt = info.Size(), info.ModTime()
+	require.NoError(t, c.CleanupUploaded(uploaded))
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, data)
+}
+
+func TestCleaner_PostUploadMoveTo(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+	path := filepath.Join(sub, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+	dest := t.TempDir()
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetPostUploadAction(PostUploadMoveTo, dest)
+	require.NoError(t, c.CleanupFile(path))
+	c.SweepEmptyDirs()
+
+	_, err := os.Stat(sub)
+	assert.True(t, os.IsNotExist(err), "empty parent removed")
+	data, err := os.ReadFile(filepath.Join(dest, mirroredPath(path)))
+	require.NoError(t, err)
+	assert.Equal(t, "data", string(data))
+}
+
+func TestCleaner_PostUploadKeep(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+
+	c := NewCleaner([]string{dir}, testLogger())
+	c.SetPostUploadAction(PostUploadKeep, "")
+	require.NoError(t, c.CleanupFile(path))
+	assert.FileExists(t, path)
+}
+
+func TestCleaner_PostUploadActionFallbacks(t *testing.T) {
+	c := NewCleaner(nil, testLogger())
+	assert.Equal(t, PostUploadDelete, c.PostUploadAction())
+
+	c.SetPostUploadAction("shred", "")
+	assert.Equal(t, PostUploadKeep, c.PostUploadAction(), "unknown actions keep files")
+	c.SetPostUploadAction(PostUploadMoveTo, "")
+	assert.Equal(t, PostUploadKeep, c.PostUploadAction(), "move_to needs a directory")
+	c.SetPostUploadAction("", "")
+	assert.Equal(t, PostUploadDelete, c.PostUploadAction())
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatCSV marks a CSV usage report converted to JSONL for validation and
+// upload.
+const FormatCSV = "csv"
+
+// csvSuffix marks a CSV file, e.g. usage.csv or usage.csv.gz.
+const csvSuffix = ".csv"
+
+// isCSV reports whether a path names a CSV file, compressed or not.
+func isCSV(path string) bool {
+	return strings.HasSuffix(strings.ToLower(trimGzip(path)), csvSuffix)
+}
+
+// csvTimestampLayouts are the timestamp forms accepted in CSV reports besides
+// Unix epochs. The ones without a zone are taken as UTC.
+var csvTimestampLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// CSVConverter turns CSV usage reports into JSONL records. The first row
+// names the columns; each later row becomes one record.
+type CSVConverter struct {
+	columns map[string]string // lowercased header → record field
+}
+
+// NewCSVConverter creates a CSVConverter with a column mapping from CSV
+// header to record field, e.g. {"Date": "timestamp", "Provider": "service"}.
+// Headers are matched ignoring case and surrounding space; unmapped columns
+// keep their header as the field name.
+func NewCSVConverter(columns map[string]string) *CSVConverter {
+	c := &CSVConverter{columns: make(map[string]string, len(columns))}
+	for header, field := range columns {
+		if field != "" {
+			c.columns[strings.ToLower(strings.TrimSpace(header))] = field
+		}
+	}
+	return c
+}
+
+// field returns the record field for a CSV header. A nil converter keeps
+// every header as it is.
+func (c *CSVConverter) field(header string) string {
+	header = strings.TrimSpace(header)
+	if c != nil {
+		if f, ok := c.columns[strings.ToLower(header)]; ok {
+			return f
+		}
+	}
+	return header
+}
+
+// Convert returns a reader of the CSV report in r as JSONL, converted a row
+// at a time as it is read. Empty cells are left out, numbers become JSON
+// numbers, and the timestamp field is rewritten as RFC 3339 where its form is
+// recognized. Records in a known third-party shape are normalized as well
+// (see FormatAdapter). A malformed report fails the read.
+func (c *CSVConverter) Convert(r io.Reader) io.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1 // tolerate ragged rows
+	cr.ReuseRecord = true
+
+	var fields []string // nil until the header is read
+	return &pullReader{next: func(out *bytes.Buffer) error {
+		if fields == nil {
+			header, err := cr.Read()
+			if errors.Is(err, io.EOF) {
+				return io.EOF
+			}
+			if err != nil {
+				return fmt.Errorf("read csv header: %w", err)
+			}
+			fields = make([]string, len(header))
+			for i, h := range header {
+				fields[i] = c.field(strings.TrimPrefix(h, "\ufeff"))
+			}
+		}
+
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("read csv row: %w", err)
+		}
+		record := make(map[string]any, len(row))
+		for i, cell := range row {
+			if i >= len(fields) || fields[i] == "" {
+				continue
+			}
+			if v, ok := csvValue(fields[i], strings.TrimSpace(cell)); ok {
+				record[fields[i]] = v
+			}
+		}
+		record, _ = adaptRecord(record)
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("marshal csv record: %w", err)
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+		return nil
+	}}
+}
+
+// csvValue converts one CSV cell for the given record field. Returns false
+// for an empty cell.
+func csvValue(field, cell string) (any, bool) {
+	if cell == "" {
+		return nil, false
+	}
+	switch field {
+	case "timestamp":
+		if n, err := strconv.ParseFloat(cell, 64); err == nil {
+			if ts, ok := epochTime(n); ok {
+				return ts.UTC().Format(time.RFC3339), true
+			}
+		}
+		for _, layout := range csvTimestampLayouts {
+			if ts, err := time.Parse(layout, cell); err == nil {
+				return ts.UTC().Format(time.RFC3339), true
+			}
+		}
+		return cell, true
+	case "service", "model":
+		return cell, true
+	}
+	if n, err := strconv.ParseFloat(cell, 64); err == nil {
+		return n, true
+	}
+	return cell, true
+}
+
+// csvUploadName returns the name a converted CSV file is uploaded under,
+// e.g. "usage.jsonl" for "usage.csv.gz".
+func csvUploadName(name string) string {
+	name = trimGzip(name)
+	return name[:len(name)-len(filepath.Ext(name))] + ".jsonl"
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+const usageCSV = "\ufeffDate,Provider,Model,Prompt Tokens,Completion Tokens,Team\n" +
+	"2025-01-15 10:30:00,openai,gpt-4,100,50,search\n" +
+	"1736937000,anthropic,claude-3,200,,\n"
+
+func csvColumns() map[string]string {
+	return map[string]string{
+		"date":              "timestamp",
+		"Provider":          "service",
+		"model":             "model",
+		"prompt tokens":     "input_tokens",
+		"Completion Tokens": "output_tokens",
+	}
+}
+
+func TestCSVConverter_Convert(t *testing.T) {
+	out, err := io.ReadAll(NewCSVConverter(csvColumns()).Convert(strings.NewReader(usageCSV)))
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.Len(t, lines, 2)
+	var first, second map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+
+	assert.Equal(t, map[string]any{
+		"timestamp":     "2025-01-15T10:30:00Z",
+		"service":       "openai",
+		"model":         "gpt-4",
+		"input_tokens":  100.0,
+		"output_tokens": 50.0,
+		"Team":          "search",
+	}, first)
+	assert.Equal(t, "2025-01-15T10:30:00Z", second["timestamp"], "epoch seconds")
+	assert.NotContains(t, second, "output_tokens", "empty cells are left out")
+	assert.True(t, defaultValidator.Valid(first))
+	assert.True(t, defaultValidator.Valid(second))
+}
+
+func TestCSVConverter_UnmappedHeaders(t *testing.T) {
+	var c *CSVConverter
+	out, err := io.ReadAll(c.Convert(strings.NewReader("timestamp,service,model\n2025-01-15T10:30:00Z,openai,gpt-4\n")))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4"}`, string(out))
+
+	out, err = io.ReadAll(c.Convert(strings.NewReader("")))
+	require.NoError(t, err)
+	assert.Empty(t, out)
+
+	_, err = io.ReadAll(c.Convert(strings.NewReader("a,b\n\"unterminated\n")))
+	assert.Error(t, err)
+}
+
+func TestIsCSV(t *testing.T) {
+	assert.True(t, isCSV("/logs/usage.csv"))
+	assert.True(t, isCSV("/logs/USAGE.CSV.gz"))
+	assert.False(t, isCSV("/logs/usage.jsonl"))
+	assert.Equal(t, "usage.jsonl", csvUploadName("usage.csv.gz"))
+}
+
+func TestValidateTaggedJSONLFile_CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.csv")
+	require.NoError(t, os.WriteFile(path, []byte(usageCSV), 0644))
+
+	result, err := ValidateTaggedJSONLFile(path, nil, nil, NewCSVConverter(csvColumns()))
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 2, result.TotalLines, "the header is not a record")
+	assert.Equal(t, FormatCSV, result.Format)
+
+	result, err = ValidateTaggedJSONLFile(path, nil, nil, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Valid, "without the mapping the headers are not record fields")
+}
+
+func TestWorker_UploadsConvertedCSV(t *testing.T) {
+	var body, filename, format string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, hdr, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(f)
+		body, filename = string(data), hdr.Filename
+		var meta struct {
+			FileInfo struct {
+				SourceFormat string `json:"source_format"`
+			} `json:"file_info"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("metadata")), &meta))
+		format = meta.FileInfo.SourceFormat
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.FilePatterns = []string{"*.csv"}
+	cfg.Config.CSVColumns = csvColumns()
+	cfg.ServerURL = srv.URL
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "usage.csv"), []byte(usageCSV), 0644))
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	assert.Equal(t, FormatCSV, format)
+	assert.Equal(t, "usage.jsonl", filename)
+	assert.Contains(t, body, `"input_tokens":100`)
+	assert.NoFileExists(t, filepath.Join(dir, "usage.csv"))
+}
@@ -0,0 +1,50 @@
+package worker
+
+// maxUploadedDigests bounds the uploads remembered for dedupe. Past it the
+// oldest are forgotten first.
+const maxUploadedDigests = 10000
+
+// uploadedSet remembers which content was uploaded from which path, so a file
+// found again unchanged, for example because it could not be deleted, is not
+// sent twice. The same content at another path is a different file and is
+// uploaded. It is not safe for concurrent use.
+type uploadedSet struct {
+	max   int
+	keys  map[string]bool
+	order []string // keys, oldest first
+}
+
+// newUploadedSet creates an uploadedSet holding at most max entries.
+func newUploadedSet(max int) *uploadedSet {
+	return &uploadedSet{max: max, keys: make(map[string]bool)}
+}
+
+// uploadedKey scopes a digest to the path its content was uploaded from.
+func uploadedKey(path string, d FileDigest) string {
+	return path + "\x00" + d.key()
+}
+
+// add records content as uploaded from path, forgetting the oldest entry if
+// the set is full.
+func (s *uploadedSet) add(path string, d FileDigest) {
+	key := uploadedKey(path, d)
+	if s.keys[key] {
+		return
+	}
+	s.keys[key] = true
+	s.order = append(s.order, key)
+	if len(s.order) > s.max {
+		delete(s.keys, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// has reports whether the content was uploaded from path.
+func (s *uploadedSet) has(path string, d FileDigest) bool {
+	return s.keys[uploadedKey(path, d)]
+}
+
+// len returns the number of remembered uploads.
+func (s *uploadedSet) len() int {
+	return len(s.order)
+}
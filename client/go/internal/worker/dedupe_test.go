@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadedSet_ScopedToPath(t *testing.T) {
+	s := newUploadedSet(10)
+	d := FileDigest{Algorithm: "sha256", Hex: "ABC"}
+	s.add("/logs/a.jsonl", d)
+
+	assert.True(t, s.has("/logs/a.jsonl", FileDigest{Algorithm: "sha256", Hex: "abc"}))
+	assert.False(t, s.has("/logs/b.jsonl", d), "the same content at another path is another file")
+	assert.False(t, s.has("/logs/a.jsonl", FileDigest{Algorithm: "blake3", Hex: "abc"}))
+}
+
+func TestUploadedSet_Bounded(t *testing.T) {
+	s := newUploadedSet(2)
+	d := FileDigest{Algorithm: "sha256", Hex: "abc"}
+	s.add("a", d)
+	s.add("b", d)
+	s.add("b", d)
+	s.add("c", d)
+
+	assert.Equal(t, 2, s.len())
+	assert.False(t, s.has("a", d), "the oldest is forgotten first")
+	assert.True(t, s.has("b", d))
+	assert.True(t, s.has("c", d))
+}
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"strings"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// acrossDrives repeats each drive-relative discovery path, one that starts
+// with a separator but names no drive such as `\logs\**`, on every drive in
+// drives. Other paths, and all paths when drives is empty, are kept as they
+// are.
+func acrossDrives(paths []config.DiscoveryPath, drives []string) []config.DiscoveryPath {
+	if len(drives) == 0 {
+		return paths
+	}
+	var out []config.DiscoveryPath
+	for _, dp := range paths {
+		if !driveRelative(dp.Path) {
+			out = append(out, dp)
+			continue
+		}
+		for _, drive := range drives {
+			onDrive := dp
+			onDrive.Path = drive + dp.Path
+			out = append(out, onDrive)
+		}
+	}
+	return out
+}
+
+// driveRelative reports whether a Windows path is rooted but has no drive
+// letter or UNC share, e.g. `\logs` or "/logs".
+func driveRelative(path string) bool {
+	if path == "" || (path[0] != '\\' && path[0] != '/') {
+		return false
+	}
+	return !strings.HasPrefix(path, `\\`) && !strings.HasPrefix(path, "//")
+}
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestAcrossDrives(t *testing.T) {
+	paths := []config.DiscoveryPath{
+		{Path: `\logs\**`, MaxDepth: 2},
+		{Path: `C:\ProgramData\logs`},
+		{Path: `\\server\share\logs`},
+		{Path: "%APPDATA%/logs"},
+	}
+
+	got := acrossDrives(paths, []string{"C:", "D:"})
+	assert.Equal(t, []config.DiscoveryPath{
+		{Path: `C:\logs\**`, MaxDepth: 2},
+		{Path: `D:\logs\**`, MaxDepth: 2},
+		{Path: `C:\ProgramData\logs`},
+		{Path: `\\server\share\logs`},
+		{Path: "%APPDATA%/logs"},
+	}, got)
+
+	assert.Equal(t, paths, acrossDrives(paths, nil), "no drives, e.g. not on Windows")
+}
+
+func TestDriveRelative(t *testing.T) {
+	assert.True(t, driveRelative(`\logs`))
+	assert.True(t, driveRelative("/logs"))
+	assert.False(t, driveRelative(`C:\logs`))
+	assert.False(t, driveRelative(`\\server\share`))
+	assert.False(t, driveRelative("logs"))
+	assert.False(t, driveRelative(""))
+}
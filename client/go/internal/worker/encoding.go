@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Text encodings other than plain UTF-8 that the client reads. A file in one
+// of them is uploaded transcoded to plain UTF-8, with the encoding as its
+// source format.
+const (
+	EncodingUTF8BOM = "utf-8-bom" // UTF-8 with a byte order mark
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+)
+
+// isTextEncoding reports whether a source format names a text encoding.
+func isTextEncoding(format string) bool {
+	switch format {
+	case EncodingUTF8BOM, EncodingUTF16LE, EncodingUTF16BE:
+		return true
+	}
+	return false
+}
+
+// openText opens a file's content as openContent does, as plain UTF-8: a
+// byte order mark is dropped and UTF-16 is transcoded. Also returns the
+// encoding detected, or "" for plain UTF-8.
+func openText(path string) (io.ReadCloser, string, error) {
+	rc, err := openContent(path)
+	if err != nil {
+		return nil, "", err
+	}
+	r, enc := decodeText(rc)
+	return &textFile{Reader: r, c: rc}, enc, nil
+}
+
+// textFile closes the file under a decoding reader.
+type textFile struct {
+	io.Reader
+	c io.Closer
+}
+
+func (t *textFile) Close() error { return t.c.Close() }
+
+// decodeText detects r's encoding from a byte order mark or, for UTF-16
+// without one, from a NUL byte next to an ASCII first character, as in `{`
+// or a CSV header. Returns a reader of r as plain UTF-8 and the encoding.
+func decodeText(r io.Reader) (io.Reader, string) {
+	br := bufio.NewReader(r)
+	head, _ := br.Peek(3)
+	switch {
+	case len(head) >= 3 && head[0] == 0xEF && head[1] == 0xBB && head[2] == 0xBF:
+		br.Discard(3)
+		return br, EncodingUTF8BOM
+	case len(head) >= 2 && head[0] == 0xFF && head[1] == 0xFE:
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.LittleEndian}, EncodingUTF16LE
+	case len(head) >= 2 && head[0] == 0xFE && head[1] == 0xFF:
+		br.Discard(2)
+		return &utf16Reader{r: br, order: binary.BigEndian}, EncodingUTF16BE
+	case len(head) >= 2 && head[0] != 0 && head[0] < utf8.RuneSelf && head[1] == 0:
+		return &utf16Reader{r: br, order: binary.LittleEndian}, EncodingUTF16LE
+	case len(head) >= 2 && head[0] == 0 && head[1] != 0 && head[1] < utf8.RuneSelf:
+		return &utf16Reader{r: br, order: binary.BigEndian}, EncodingUTF16BE
+	}
+	return br, ""
+}
+
+// utf16Reader transcodes UTF-16 to UTF-8. Unpaired surrogates and a trailing
+// odd byte become U+FFFD.
+type utf16Reader struct {
+	r     *bufio.Reader
+	order binary.ByteOrder
+	out   []byte // decoded, not yet read
+	err   error
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) < len(p) && u.err == nil {
+		u.decodeRune()
+	}
+	if len(u.out) == 0 {
+		return 0, u.err
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	return n, nil
+}
+
+// decodeRune decodes one character into out, or sets err.
+func (u *utf16Reader) decodeRune() {
+	c, err := u.unit()
+	if err != nil {
+		u.err = err
+		return
+	}
+	r := rune(c)
+	if utf16.IsSurrogate(r) {
+		next, err := u.r.Peek(2)
+		if err == nil {
+			if r2 := rune(u.order.Uint16(next)); utf16.IsSurrogate(r2) {
+				u.r.Discard(2)
+				r = utf16.DecodeRune(r, r2)
+			} else {
+				r = unicode.ReplacementChar
+			}
+		} else {
+			r = unicode.ReplacementChar
+		}
+	}
+	u.out = utf8.AppendRune(u.out, r)
+}
+
+// unit reads one UTF-16 code unit. A lone final byte reads as U+FFFD.
+func (u *utf16Reader) unit() (uint16, error) {
+	var b [2]byte
+	n, err := io.ReadFull(u.r, b[:])
+	if errors.Is(err, io.ErrUnexpectedEOF) && n == 1 {
+		return unicode.ReplacementChar, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return u.order.Uint16(b[:]), nil
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// encodeUTF16 encodes s as UTF-16 in the given byte order, with a byte order
+// mark if bom is set.
+func encodeUTF16(s string, order binary.ByteOrder, bom bool) []byte {
+	units := utf16.Encode([]rune(s))
+	if bom {
+		units = append([]uint16{0xFEFF}, units...)
+	}
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+func TestDecodeText(t *testing.T) {
+	text := "{\"model\":\"gpt-4\",\"note\":\"héllo 🙂\"}\r\n"
+	tests := []struct {
+		name string
+		in   []byte
+		enc  string
+	}{
+		{"plain", []byte(text), ""},
+		{"utf-8 bom", append([]byte("\ufeff"), text...), EncodingUTF8BOM},
+		{"utf-16le bom", encodeUTF16(text, binary.LittleEndian, true), EncodingUTF16LE},
+		{"utf-16be bom", encodeUTF16(text, binary.BigEndian, true), EncodingUTF16BE},
+		{"utf-16le", encodeUTF16(text, binary.LittleEndian, false), EncodingUTF16LE},
+		{"utf-16be", encodeUTF16(text, binary.BigEndian, false), EncodingUTF16BE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, enc := decodeText(strings.NewReader(string(tt.in)))
+			assert.Equal(t, tt.enc, enc)
+			out, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, text, string(out))
+		})
+	}
+}
+
+func TestDecodeText_Malformed(t *testing.T) {
+	in := encodeUTF16("ab", binary.LittleEndian, true)
+	in = append(in, 0x00, 0xD8, 'c', 0x00, 'd') // lone high surrogate, then a stray byte
+	r, _ := decodeText(strings.NewReader(string(in)))
+	out, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "ab\ufffdc\ufffd", string(out))
+
+	r, enc := decodeText(strings.NewReader(""))
+	assert.Empty(t, enc)
+	out, err = io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, out)
+}
+
+func TestValidateJSONLFile_Encodings(t *testing.T) {
+	dir := t.TempDir()
+	content := validRecord() + "\r\n" + validRecord() + "\r\n"
+	files := map[string][]byte{
+		"bom.jsonl":   append([]byte("\ufeff"), content...),
+		"utf16.jsonl": encodeUTF16(content, binary.LittleEndian, true),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, data, 0644))
+
+		result, err := ValidateJSONLFile(path)
+		require.NoError(t, err)
+		assert.True(t, result.Valid, name)
+		assert.Equal(t, 2, result.ValidRecords, name)
+		assert.True(t, isTextEncoding(result.Format), name)
+		assert.True(t, looksLikeTokenFile(path, 5, nil), name)
+
+		meta, err := buildFileMetadata(path, config.ChecksumSHA256, GzipUploadCompressed, recordRewrite{format: result.Format})
+		require.NoError(t, err)
+		r, err := openUpload(path, meta)
+		require.NoError(t, err)
+		sent, err := io.ReadAll(r)
+		r.Close()
+		require.NoError(t, err)
+		assert.Equal(t, content, string(sent), "%s is uploaded as plain UTF-8", name)
+		assert.Equal(t, int64(len(sent)), meta.SizeBytes)
+	}
+}
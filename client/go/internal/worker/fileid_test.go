@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileKey_HardLinksShareIdentity(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.jsonl")
+	b := filepath.Join(dir, "b.jsonl")
+	c := filepath.Join(dir, "c.jsonl")
+	require.NoError(t, os.WriteFile(a, []byte("{}"), 0644))
+	require.NoError(t, os.Link(a, b))
+	require.NoError(t, os.WriteFile(c, []byte("{}"), 0644))
+
+	stat := func(p string) os.FileInfo {
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		return info
+	}
+	assert.Equal(t, fileKey(a, stat(a)), fileKey(b, stat(b)))
+	assert.NotEqual(t, fileKey(a, stat(a)), fileKey(c, stat(c)))
+}
+
+func TestScan_HardLinkedFileIsOneCandidate(t *testing.T) {
+	rootA, rootB := t.TempDir(), t.TempDir()
+	a := filepath.Join(rootA, "a.jsonl")
+	require.NoError(t, os.WriteFile(a, []byte("{}"), 0644))
+	require.NoError(t, os.Link(a, filepath.Join(rootA, "a-link.jsonl")))
+	if err := os.Link(a, filepath.Join(rootB, "b.jsonl")); err != nil {
+		t.Skipf("temp dirs on different filesystems: %v", err)
+	}
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths: []string{rootA, rootB},
+		FilePatterns:   []string{"*.jsonl"},
+	}, nil, testLogger())
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 1, "three links, one file")
+}
+
+func TestDedupeCandidates(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.jsonl")
+	b := filepath.Join(dir, "b.jsonl")
+	c := filepath.Join(dir, "c.jsonl")
+	require.NoError(t, os.WriteFile(a, []byte("{}"), 0644))
+	require.NoError(t, os.Link(a, b))
+	require.NoError(t, os.WriteFile(c, []byte("{}"), 0644))
+	missing := filepath.Join(dir, "missing.jsonl")
+
+	work := dedupeCandidates([]FileCandidate{{Path: a}, {Path: missing}, {Path: b}, {Path: c}})
+	assert.Equal(t, []string{"a.jsonl", "missing.jsonl", "c.jsonl"}, candidateNames(work))
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package worker
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileKey identifies a file by device and inode number.
+func fileKey(path string, info fs.FileInfo) string {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+	}
+	return resolvedKey(path)
+}
@@ -0,0 +1,34 @@
+//go:build windows
+
+package worker
+
+import (
+	"fmt"
+	"io/fs"
+
+	"golang.org/x/sys/windows"
+)
+
+// fileKey identifies a file by volume serial number and file index, read from
+// an open handle since FileInfo on Windows does not carry them. Falls back to
+// the resolved path if the file cannot be opened.
+func fileKey(path string, _ fs.FileInfo) string {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return resolvedKey(path)
+	}
+	// FILE_FLAG_BACKUP_SEMANTICS is required to open directories.
+	h, err := windows.CreateFile(p, 0,
+		windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+		nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return resolvedKey(path)
+	}
+	defer windows.CloseHandle(h)
+
+	var fi windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(h, &fi); err != nil {
+		return resolvedKey(path)
+	}
+	return fmt.Sprintf("%d:%d:%d", fi.VolumeSerialNumber, fi.FileIndexHigh, fi.FileIndexLow)
+}
@@ -0,0 +1,110 @@
+package worker
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Gzip upload modes.
+const (
+	// GzipUploadCompressed sends a .gz file as-is, marked content_encoding
+	// gzip. Only for servers that accept compressed uploads.
+	GzipUploadCompressed = "compressed"
+	// GzipUploadDecompress decompresses a .gz file while uploading it. It is
+	// the default.
+	GzipUploadDecompress = "decompress"
+)
+
+// maxDecompressedBytes caps how far a .gz file may expand. Nothing larger is
+// a usage log, and stopping there keeps a gzip bomb from tying up the worker.
+const maxDecompressedBytes = 1 << 30
+
+// errGzipTooLarge is returned when a .gz file expands past maxDecompressedBytes.
+var errGzipTooLarge = fmt.Errorf("gzip content exceeds %d MB decompressed", maxDecompressedBytes>>20)
+
+// gzipSuffix marks a gzip-compressed file, e.g. usage.jsonl.gz.
+const gzipSuffix = ".gz"
+
+// isGzip reports whether a path names a gzip-compressed file.
+func isGzip(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), gzipSuffix)
+}
+
+// trimGzip returns a name without its .gz suffix.
+func trimGzip(name string) string {
+	if isGzip(name) {
+		return name[:len(name)-len(gzipSuffix)]
+	}
+	return name
+}
+
+// gzipReader decompresses a gzip stream, failing with errGzipTooLarge once
+// it has produced maxDecompressedBytes.
+type gzipReader struct {
+	zr   *gzip.Reader
+	left int64 // bytes it may still produce
+}
+
+// newGzipReader starts decompressing r.
+func newGzipReader(r io.Reader) (*gzipReader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("open gzip stream: %w", err)
+	}
+	return &gzipReader{zr: zr, left: maxDecompressedBytes}, nil
+}
+
+func (g *gzipReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if g.left <= 0 {
+		// Past the cap; only the end of the stream is still fine.
+		if n, err := g.zr.Read(p[:1]); n == 0 && err == io.EOF {
+			return 0, io.EOF
+		}
+		return 0, errGzipTooLarge
+	}
+	if int64(len(p)) > g.left {
+		p = p[:g.left]
+	}
+	n, err := g.zr.Read(p)
+	g.left -= int64(n)
+	return n, err
+}
+
+func (g *gzipReader) Close() error {
+	return g.zr.Close()
+}
+
+// gzipFile reads a gzip stream and closes the underlying file with it.
+type gzipFile struct {
+	*gzipReader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.gzipReader.Close()
+	return g.f.Close()
+}
+
+// openContent opens a file for reading its JSONL content, transparently
+// decompressing .gz files.
+func openContent(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isGzip(path) {
+		return f, nil
+	}
+	zr, err := newGzipReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{gzipReader: zr, f: f}, nil
+}
@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+const gzipTestContent = `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4"}` + "\n" +
+	`{"timestamp":"2025-01-15T10:31:00Z","service":"openai","model":"gpt-4"}` + "\n"
+
+func writeGzipFile(t *testing.T, dir, name, content string) (string, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path, buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestTrimGzip(t *testing.T) {
+	assert.Equal(t, "usage.jsonl", trimGzip("usage.jsonl.gz"))
+	assert.Equal(t, "usage.jsonl", trimGzip("usage.jsonl.GZ"))
+	assert.Equal(t, "usage.jsonl", trimGzip("usage.jsonl"))
+}
+
+func TestOpenContent_Gzip(t *testing.T) {
+	path, _ := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+	r, err := openContent(path)
+	require.NoError(t, err)
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, gzipTestContent, string(data))
+}
+
+func TestOpenContent_CorruptGzip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.jsonl.gz")
+	require.NoError(t, os.WriteFile(path, []byte("not gzip"), 0644))
+	_, err := openContent(path)
+	assert.Error(t, err)
+}
+
+func TestOpenContent_GzipCapped(t *testing.T) {
+	path, _ := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+	r, err := openContent(path)
+	require.NoError(t, err)
+	defer r.Close()
+
+	r.(*gzipFile).left = int64(len(gzipTestContent))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err, "content that fits exactly is read")
+	assert.Equal(t, gzipTestContent, string(data))
+
+	r2, err := openContent(path)
+	require.NoError(t, err)
+	defer r2.Close()
+	r2.(*gzipFile).left = 10
+	_, err = io.ReadAll(r2)
+	assert.ErrorIs(t, err, errGzipTooLarge)
+}
+
+func TestDigestFile_Gzip(t *testing.T) {
+	path, raw := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+
+	d, lines, size, err := digestFile(path, config.ChecksumSHA256, false)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex(raw), d.Hex, "compressed upload hashes the bytes on disk")
+	assert.Equal(t, 2, lines)
+	assert.Equal(t, int64(len(raw)), size)
+
+	d, lines, size, err = digestFile(path, config.ChecksumSHA256, true)
+	require.NoError(t, err)
+	assert.Equal(t, sha256Hex([]byte(gzipTestContent)), d.Hex)
+	assert.Equal(t, 2, lines)
+	assert.Equal(t, int64(len(gzipTestContent)), size)
+}
+
+func TestValidateJSONLFile_Gzip(t *testing.T) {
+	path, _ := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 2, result.ValidRecords)
+}
+
+func TestScan_MatchesGzippedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeGzipFile(t, dir, "usage.jsonl.gz", gzipTestContent)
+	writeGzipFile(t, dir, "temp.jsonl.gz", gzipTestContent)
+	writeGzipFile(t, dir, "other.txt.gz", "x")
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludePatterns: []string{"*temp*"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.jsonl.gz"}, candidateNames(candidates))
+}
+
+func TestBuildFileMetadata_GzipModes(t *testing.T) {
+	path, raw := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+
+	meta, err := buildFileMetadata(path, config.ChecksumSHA256, GzipUploadCompressed, recordRewrite{})
+	require.NoError(t, err)
+	assert.Equal(t, "usage.jsonl.gz", meta.Filename)
+	assert.Equal(t, "gzip", meta.ContentEncoding)
+	assert.Equal(t, int64(len(raw)), meta.SizeBytes)
+	assert.Equal(t, 2, meta.LineCount)
+	assert.Empty(t, meta.OriginalEncoding)
+
+	meta, err = buildFileMetadata(path, config.ChecksumSHA256, GzipUploadDecompress, recordRewrite{})
+	require.NoError(t, err)
+	assert.Equal(t, "usage.jsonl", meta.Filename)
+	assert.Empty(t, meta.ContentEncoding)
+	assert.Equal(t, "gzip", meta.OriginalEncoding)
+	assert.Equal(t, int64(len(raw)), meta.OriginalSizeBytes)
+	assert.Equal(t, int64(len(gzipTestContent)), meta.SizeBytes)
+
+	meta, err = buildFileMetadata(path, config.ChecksumSHA256, "", recordRewrite{})
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", meta.OriginalEncoding, "decompressing is the default")
+}
+
+func TestUpload_GzipDecompressedOnTheFly(t *testing.T) {
+	path, _ := writeGzipFile(t, t.TempDir(), "usage.jsonl.gz", gzipTestContent)
+	meta, err := buildFileMetadata(path, config.ChecksumSHA256, GzipUploadDecompress, recordRewrite{})
+	require.NoError(t, err)
+
+	var gotContent, gotName string
+	var gotInfo map[string]any
+	var gotLength int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotLength = r.ContentLength
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		require.NoError(t, err)
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			data, _ := io.ReadAll(part)
+			switch part.FormName() {
+			case "metadata":
+				var payload map[string]any
+				require.NoError(t, json.Unmarshal(data, &payload))
+				gotInfo = payload["file_info"].(map[string]any)
+			case "file":
+				gotName = part.FileName()
+				gotContent = string(data)
+			}
+		}
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), path, meta)
+	require.NoError(t, err)
+	assert.True(t, result.ShouldDelete)
+	assert.Equal(t, gzipTestContent, gotContent)
+	assert.Equal(t, "usage.jsonl", gotName)
+	assert.Equal(t, "gzip", gotInfo["original_encoding"])
+	assert.NotContains(t, gotInfo, "content_encoding")
+	assert.Equal(t, int64(-1), gotLength, "the body is streamed, not buffered")
+}
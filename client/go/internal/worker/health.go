@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// aliveInterval is how often the idle main loop records that it is alive.
+const aliveInterval = time.Minute
+
+// touch records that the worker's main loop is making progress.
+func (w *Worker) touch() {
+	w.progress.Store(time.Now().UnixNano())
+}
+
+// healthStatus returns the answer to a health probe.
+func (w *Worker) healthStatus() config.HealthStatus {
+	w.mu.Lock()
+	state := w.state
+	w.mu.Unlock()
+	return config.HealthStatus{
+		PID:          os.Getpid(),
+		State:        state,
+		LastProgress: time.Unix(0, w.progress.Load()).UTC().Format(time.RFC3339),
+	}
+}
+
+// serveHealth answers health probes on a unix socket at path until ctx is
+// done: each connection gets one JSON HealthStatus and is closed. Unix
+// sockets are also available on Windows 10 and later.
+func (w *Worker) serveHealth(ctx context.Context, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("create health socket directory: %w", err)
+	}
+	// A socket left by a crashed run would make Listen fail.
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove stale health socket: %w", err)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return fmt.Errorf("listen on health socket: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	w.logger.Debug("serving health probes", "socket", path)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("accept health probe: %w", err)
+		}
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		json.NewEncoder(conn).Encode(w.healthStatus())
+		conn.Close()
+	}
+}
@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorker_ServesHealthProbes(t *testing.T) {
+	w, err := NewWorker(testWorkerConfig(t), testLogger())
+	require.NoError(t, err)
+	w.touch()
+	path := filepath.Join(t.TempDir(), "run", "worker.sock")
+	// A socket file left by a crashed run is replaced.
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- w.serveHealth(ctx, path) }()
+
+	var conn net.Conn
+	require.Eventually(t, func() bool {
+		var err error
+		conn, err = net.Dial("unix", path)
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	var st config.HealthStatus
+	require.NoError(t, json.NewDecoder(conn).Decode(&st))
+	conn.Close()
+
+	assert.Equal(t, os.Getpid(), st.PID)
+	assert.Equal(t, "idle", st.State)
+	last, err := time.Parse(time.RFC3339, st.LastProgress)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), last, time.Minute)
+
+	cancel()
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileName is the per-directory file listing paths to leave out of
+// discovery, in gitignore syntax. It applies to its directory's subtree.
+const IgnoreFileName = ".tokenlyignore"
+
+// ignoreRule is one pattern line of an ignore file.
+type ignoreRule struct {
+	pattern  string
+	negate   bool // "!pattern" re-includes
+	dirOnly  bool // "pattern/" matches directories only
+	anchored bool // pattern contains a slash: matched against the relative path
+}
+
+// ignoreFile holds the rules of one ignore file and the directory they apply to.
+type ignoreFile struct {
+	base  string
+	rules []ignoreRule
+}
+
+// ignoreStack is the chain of ignore files from a walk's root down to the
+// current directory. Deeper files are consulted last, so they win.
+type ignoreStack []*ignoreFile
+
+// parseIgnore parses gitignore-style content. Blank lines and # comments are
+// skipped; a leading backslash escapes # or !.
+func parseIgnore(base string, data []byte) *ignoreFile {
+	f := &ignoreFile{base: base}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			r.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			r.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		r.pattern = line
+		f.rules = append(f.rules, r)
+	}
+	return f
+}
+
+// loadIgnore reads the ignore file in dir. Returns nil if there is none or it
+// cannot be read.
+func loadIgnore(dir string) (*ignoreFile, error) {
+	data, err := os.ReadFile(filepath.Join(dir, IgnoreFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return parseIgnore(dir, data), nil
+}
+
+// push returns the stack with f added, leaving the receiver unchanged so
+// sibling directories do not see each other's rules.
+func (s ignoreStack) push(f *ignoreFile) ignoreStack {
+	if f == nil {
+		return s
+	}
+	out := make(ignoreStack, len(s), len(s)+1)
+	copy(out, s)
+	return append(out, f)
+}
+
+// ignored reports whether the path is excluded. The last matching rule wins.
+func (s ignoreStack) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, f := range s {
+		rel, err := filepath.Rel(f.base, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		name := rel[strings.LastIndex(rel, "/")+1:]
+
+		for _, r := range f.rules {
+			if r.dirOnly && !isDir {
+				continue
+			}
+			target := name
+			if r.anchored {
+				target = rel
+			}
+			if ok, _ := doublestar.Match(r.pattern, target); ok {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
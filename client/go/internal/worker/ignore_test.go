@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIgnore(t *testing.T) {
+	f := parseIgnore("/base", []byte("# comment\n\n*.tmp\n!keep.tmp\nbuild/\n/root-only.jsonl\nlogs/**/old\n\\#literal\n"))
+	require.Len(t, f.rules, 6)
+
+	assert.Equal(t, ignoreRule{pattern: "*.tmp"}, f.rules[0])
+	assert.Equal(t, ignoreRule{pattern: "keep.tmp", negate: true}, f.rules[1])
+	assert.Equal(t, ignoreRule{pattern: "build", dirOnly: true}, f.rules[2])
+	assert.Equal(t, ignoreRule{pattern: "root-only.jsonl", anchored: true}, f.rules[3])
+	assert.Equal(t, ignoreRule{pattern: "logs/**/old", anchored: true}, f.rules[4])
+	assert.Equal(t, ignoreRule{pattern: "#literal"}, f.rules[5])
+}
+
+func TestIgnoreStack_Ignored(t *testing.T) {
+	base := filepath.FromSlash("/base")
+	s := ignoreStack{}.push(parseIgnore(base, []byte("*.tmp\n!keep.tmp\nbuild/\n/top.jsonl\nlogs/**/old\n")))
+	p := func(rel string) string { return filepath.Join(base, filepath.FromSlash(rel)) }
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.tmp", false, true},
+		{"deep/nested/a.tmp", false, true},
+		{"keep.tmp", false, false},
+		{"build", true, true},
+		{"build", false, false}, // dir-only rule
+		{"top.jsonl", false, true},
+		{"sub/top.jsonl", false, false}, // anchored to the ignore file's directory
+		{"logs/x/y/old", true, true},
+		{"usage.jsonl", false, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, s.ignored(p(tt.path), tt.isDir), tt.path)
+	}
+
+	// A deeper ignore file overrides the one above it.
+	deeper := s.push(parseIgnore(p("sub"), []byte("!*.tmp\n")))
+	assert.False(t, deeper.ignored(p("sub/a.tmp"), false))
+	assert.True(t, deeper.ignored(p("a.tmp"), false))
+	assert.Len(t, s, 1, "push must not modify the receiver")
+}
+
+func TestScan_TokenlyIgnore(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "archive"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "project"), 0755))
+	for _, p := range []string{"a.jsonl", "scratch.jsonl", "archive/old.jsonl", "project/b.jsonl", "project/c.jsonl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, p), []byte("{}"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("archive/\nscratch.jsonl\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "project", IgnoreFileName), []byte("c.jsonl\n"), 0644))
+
+	candidates, _, err := newIndexedScanner(t, dir, nil).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.jsonl", "b.jsonl"}, candidateNames(candidates))
+}
+
+func TestScan_TokenlyIgnoreEditWithIndex(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644))
+	}
+	ignorePath := filepath.Join(dir, IgnoreFileName)
+	require.NoError(t, os.WriteFile(ignorePath, []byte("b.jsonl\n"), 0644))
+
+	index, err := NewScanIndex(filepath.Join(t.TempDir(), "index.json"), time.Hour, testLogger())
+	require.NoError(t, err)
+	candidates, _, err := newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl"}, candidateNames(candidates))
+
+	// Rewriting the ignore file leaves the directory mtime alone, but the
+	// indexed walk still rereads it.
+	info, err := os.Stat(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(ignorePath, []byte("a.jsonl\n"), 0644))
+	require.NoError(t, os.Chtimes(dir, info.ModTime(), info.ModTime()))
+
+	candidates, _, err = newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.jsonl"}, candidateNames(candidates))
+}
@@ -0,0 +1,131 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// ScanIndex remembers each walked directory's mtime, subdirectories, and
+// matching files, so later scans can skip reading directories that have not
+// changed. Files the worker has processed but kept (invalid, rejected) are
+// marked done and skipped while their size and mtime stay the same. Every
+// fullEvery the index is ignored for one scan and rebuilt from scratch. It is
+// safe for concurrent use by parallel walks.
+type ScanIndex struct {
+	mu        sync.Mutex
+	data      *config.ScanIndexFile
+	savePath  string
+	fullEvery time.Duration
+	full      bool // the current scan ignores the index
+}
+
+// NewScanIndex loads the index from savePath, or starts an empty one.
+// A non-positive fullEvery makes every scan a full scan. A corrupt index is
+// discarded, which makes the next scan a full scan.
+func NewScanIndex(savePath string, fullEvery time.Duration, logger *slog.Logger) (*ScanIndex, error) {
+	data, err := config.LoadScanIndex(savePath)
+	switch {
+	case errors.Is(err, config.ErrCacheCorrupt):
+		logger.Warn("scan index corrupt, rescanning in full", "path", savePath, "error", err)
+		data = config.NewScanIndexFile()
+	case err != nil:
+		return nil, fmt.Errorf("load scan index: %w", err)
+	}
+	return &ScanIndex{data: data, savePath: savePath, fullEvery: fullEvery}, nil
+}
+
+// beginScan decides whether the scan starting now is a full scan, and if so
+// discards the previous index.
+func (x *ScanIndex) beginScan(now time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	last, err := time.Parse(time.RFC3339, x.data.LastFullScan)
+	x.full = x.fullEvery <= 0 || err != nil || now.Sub(last) >= x.fullEvery
+	if x.full {
+		x.data = config.NewScanIndexFile()
+		x.data.LastFullScan = now.UTC().Format(time.RFC3339)
+	}
+}
+
+// unchanged returns the indexed entry for dir if its mtime matches, or nil
+// if the directory must be read.
+func (x *ScanIndex) unchanged(dir string, modTime time.Time) *config.IndexedDir {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.full {
+		return nil
+	}
+	entry, ok := x.data.Directories[dir]
+	if !ok || !entry.ModTime.Equal(modTime) {
+		return nil
+	}
+	// Copy, since MarkDone updates the stored file map.
+	cp := &config.IndexedDir{ModTime: entry.ModTime, Subdirs: entry.Subdirs, HasIgnore: entry.HasIgnore,
+		Files: make(map[string]config.IndexedFile, len(entry.Files))}
+	for name, f := range entry.Files {
+		cp.Files[name] = f
+	}
+	return cp
+}
+
+// isDone reports whether a file was marked done with the same size and mtime.
+func (x *ScanIndex) isDone(path string, size int64, modTime time.Time) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry, ok := x.data.Directories[filepath.Dir(path)]
+	if !ok {
+		return false
+	}
+	f, ok := entry.Files[filepath.Base(path)]
+	return ok && f.Done && f.Size == size && f.ModTime.Equal(modTime)
+}
+
+// record stores a directory after it has been read completely. Done marks
+// carry over for files whose size and mtime are unchanged.
+func (x *ScanIndex) record(dir string, modTime time.Time, subdirs []string, files map[string]config.IndexedFile, hasIgnore bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if prev, ok := x.data.Directories[dir]; ok {
+		for name, f := range files {
+			if old, ok := prev.Files[name]; ok && old.Done && old.Size == f.Size && old.ModTime.Equal(f.ModTime) {
+				f.Done = true
+				files[name] = f
+			}
+		}
+	}
+	x.data.Directories[dir] = &config.IndexedDir{ModTime: modTime, Subdirs: subdirs, Files: files, HasIgnore: hasIgnore}
+}
+
+// MarkDone records that a file was processed and kept, so it is skipped until
+// it changes. It is a no-op if the file's indexed size or mtime differ.
+func (x *ScanIndex) MarkDone(path string, size int64, modTime time.Time) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	entry, ok := x.data.Directories[filepath.Dir(path)]
+	if !ok {
+		return
+	}
+	name := filepath.Base(path)
+	if f, ok := entry.Files[name]; ok && f.Size == size && f.ModTime.Equal(modTime) {
+		f.Done = true
+		entry.Files[name] = f
+	}
+}
+
+// Save persists the index.
+func (x *ScanIndex) Save() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.data.Save(x.savePath)
+}
@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIndexedScanner(t *testing.T, dir string, index *ScanIndex) *Scanner {
+	t.Helper()
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	sc.SetIndex(index)
+	return sc
+}
+
+func candidateNames(candidates []FileCandidate) []string {
+	var names []string
+	for _, c := range candidates {
+		names = append(names, filepath.Base(c.Path))
+	}
+	return names
+}
+
+func TestScanIndex_SkipsUnchangedDirectories(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.MkdirAll(sub, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "a.jsonl"), []byte("{}"), 0644))
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+
+	index, err := NewScanIndex(indexPath, time.Hour, testLogger())
+	require.NoError(t, err)
+	candidates, _, err := newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl"}, candidateNames(candidates))
+	require.NoError(t, index.Save())
+
+	// Add a file but restore the directory mtime: an incremental scan trusts
+	// the index and does not read the directory.
+	info, err := os.Stat(sub)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "hidden.jsonl"), []byte("{}"), 0644))
+	require.NoError(t, os.Chtimes(sub, info.ModTime(), info.ModTime()))
+
+	index, err = NewScanIndex(indexPath, time.Hour, testLogger())
+	require.NoError(t, err)
+	candidates, _, err = newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl"}, candidateNames(candidates))
+
+	// A full scan reads everything again.
+	index.fullEvery = 0
+	candidates, _, err = newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.jsonl", "hidden.jsonl"}, candidateNames(candidates))
+}
+
+func TestNewScanIndex_CorruptForcesFullScan(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte("{}"), 0644))
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	require.NoError(t, os.WriteFile(indexPath, []byte("{truncated"), 0644))
+
+	index, err := NewScanIndex(indexPath, time.Hour, testLogger())
+	require.NoError(t, err)
+	candidates, _, err := newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl"}, candidateNames(candidates))
+	assert.True(t, index.full)
+
+	require.NoError(t, index.Save())
+	_, err = NewScanIndex(indexPath, time.Hour, testLogger())
+	require.NoError(t, err)
+	data, err := os.ReadFile(indexPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "last_full_scan", "the rebuilt index replaces the corrupt one")
+}
+
+func TestScanIndex_DoneFilesSkippedUntilChanged(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "invalid.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+
+	index, err := NewScanIndex(filepath.Join(t.TempDir(), "index.json"), time.Hour, testLogger())
+	require.NoError(t, err)
+	sc := newIndexedScanner(t, dir, index)
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	index.MarkDone(path, candidates[0].SizeBytes, candidates[0].ModifiedAt)
+
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates, "done file in unchanged directory is skipped")
+
+	// Rewriting a file leaves the directory mtime alone, so a done file is
+	// only noticed again by the next full scan.
+	require.NoError(t, os.WriteFile(path, []byte("{}\n{}"), 0644))
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+
+	index.fullEvery = 0
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 1)
+}
+
+func TestScanIndex_PendingFilesRestatted(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+
+	index, err := NewScanIndex(filepath.Join(t.TempDir(), "index.json"), time.Hour, testLogger())
+	require.NoError(t, err)
+	sc := newIndexedScanner(t, dir, index)
+	_, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+
+	// A file not marked done is stat'ed on each scan, so growth is seen
+	// without reading the directory.
+	require.NoError(t, os.WriteFile(path, []byte("{}\n{}\n"), 0644))
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, int64(6), candidates[0].SizeBytes)
+}
+
+func TestScanIndex_MarkDoneRequiresMatchingFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	index, err := NewScanIndex(filepath.Join(t.TempDir(), "index.json"), time.Hour, testLogger())
+	require.NoError(t, err)
+	_, _, err = newIndexedScanner(t, dir, index).Scan(context.Background())
+	require.NoError(t, err)
+
+	index.MarkDone(path, info.Size()+1, info.ModTime())
+	assert.False(t, index.isDone(path, info.Size(), info.ModTime()))
+	index.MarkDone(path, info.Size(), info.ModTime())
+	assert.True(t, index.isDone(path, info.Size(), info.ModTime()))
+}
@@ -1,13 +1,65 @@
 package worker
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"os"
+	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
+)
+
+// Default negative cache timing; see Learner.SetNegativeCacheTiming.
+const (
+	defaultNegativeCacheReprobe = 24 * time.Hour
+	defaultNegativeCacheTTL     = 7 * 24 * time.Hour
+)
+
+// defaultMaxDirectories caps the learned directories when no cap is set.
+const defaultMaxDirectories = 10000
+
+// defaultHalfLifeScans is the success rate's half-life when none is set.
+const defaultHalfLifeScans = 24
+
+// Pruning thresholds; see Learner.Prune.
+const (
+	defaultPruneAfter = 30 * 24 * time.Hour
+	pruneGoneAfter    = 24 * time.Hour
+	minPruneScore     = 0.01
+)
+
+// A file pattern that has matched nothing in a tree after minPatternScans
+// scans is skipped there, except on every patternRecheck-th scan, which
+// revives it if it matches again.
+const (
+	minPatternScans = 20
+	patternRecheck  = 10
+)
+
+// A directory is productive at an hour of day, and gets focused scans then,
+// once it scores at least minFocusScore, has yielded minHourlySamples files,
+// and yields at least twice its hourly average in that hour.
+const (
+	minFocusScore    = 1.0
+	minHourlySamples = 20
+)
+
+// A directory with minNegativeChildren negative-cached subdirectories, and
+// no files found anywhere under it, is cached as a negative subtree instead.
+const minNegativeChildren = 10
+
+// Reasons a scan of a learned directory found no files, as recorded in
+// config.DirectoryStats.LastFailure.
+const (
+	FailureEmpty            = "empty"             // walked, and no file name matched
+	FailurePermissionDenied = "permission_denied" // the directory could not be read
+	FailureExcluded         = "excluded"          // an exclude rule covers the directory
 )
 
 // Learner tracks directory success rates and provides prioritized scan paths.
@@ -15,23 +67,159 @@ type Learner struct {
 	data     *config.LearningFile
 	savePath string
 	logger   *slog.Logger
+	reprobe  time.Duration
+	ttl      time.Duration
+	maxDirs  int
+	halfLife int // of the success rate, in scans
+	pruneAge time.Duration
+	now      func() time.Time
+
+	// patternMu guards data.Patterns, which scans of different trees update
+	// concurrently.
+	patternMu sync.Mutex
 }
 
 // NewLearner loads existing learning data from savePath or creates an empty set.
+// Corrupt learning data is replaced by the backup of the save before it, or
+// by an empty set if that cannot be read either; see loadLearning.
 func NewLearner(savePath string, logger *slog.Logger) (*Learner, error) {
-	data, err := config.LoadLearning(savePath)
+	data, err := loadLearning(savePath, logger)
 	if err != nil {
 		return nil, fmt.Errorf("load learning data: %w", err)
 	}
-	return &Learner{
+	l := &Learner{
 		data:     data,
 		savePath: savePath,
 		logger:   logger,
-	}, nil
+		reprobe:  defaultNegativeCacheReprobe,
+		ttl:      defaultNegativeCacheTTL,
+		maxDirs:  defaultMaxDirectories,
+		halfLife: defaultHalfLifeScans,
+		pruneAge: defaultPruneAfter,
+		now:      time.Now,
+	}
+	// Entries saved before they were timed start their TTL now.
+	for _, path := range data.NegativeCache {
+		l.negativeEntry(path)
+	}
+	return l, nil
+}
+
+// loadLearning loads the learning file at savePath. A corrupt file is
+// removed, so the next save does not back it up, and the backup loaded in its
+// place; so is a missing file, which a save interrupted between its renames
+// leaves. Without a usable backup, learning starts over. Only a file that
+// cannot be read at all is an error.
+func loadLearning(savePath string, logger *slog.Logger) (*config.LearningFile, error) {
+	data, err := config.LoadLearning(savePath)
+	switch {
+	case errors.Is(err, config.ErrLearningCorrupt):
+		logger.Warn("learning file corrupt, falling back to its backup", "path", savePath, "error", err)
+		os.Remove(savePath)
+	case err != nil:
+		return nil, err
+	default:
+		if _, err := os.Stat(savePath); !os.IsNotExist(err) {
+			return data, nil
+		}
+	}
+
+	backup := config.LearningBackupPath(savePath)
+	restored, err := config.LoadLearning(backup)
+	if err != nil {
+		logger.Warn("learning backup unreadable, starting over", "path", backup, "error", err)
+		return config.NewLearningFile(), nil
+	}
+	if restored.LastUpdated != "" {
+		logger.Warn("learning data restored from backup", "path", backup, "last_updated", restored.LastUpdated)
+	}
+	return restored, nil
+}
+
+// SetNegativeCacheTiming sets how often negative-cached directories are
+// re-probed and how long they stay cached. Non-positive values select the
+// defaults of 24 hours and 7 days.
+func (l *Learner) SetNegativeCacheTiming(reprobe, ttl time.Duration) {
+	if reprobe <= 0 {
+		reprobe = defaultNegativeCacheReprobe
+	}
+	if ttl <= 0 {
+		ttl = defaultNegativeCacheTTL
+	}
+	l.reprobe, l.ttl = reprobe, ttl
+}
+
+// SetMaxDirectories caps the directories kept at n, applied when saving. A
+// non-positive n selects the default of 10000.
+func (l *Learner) SetMaxDirectories(n int) {
+	if n <= 0 {
+		n = defaultMaxDirectories
+	}
+	l.maxDirs = n
+}
+
+// SetSuccessRateHalfLife sets the number of scans after which a directory's
+// past yield counts half as much in its success rate. A non-positive value
+// selects the default of 24.
+func (l *Learner) SetSuccessRateHalfLife(scans int) {
+	if scans <= 0 {
+		scans = defaultHalfLifeScans
+	}
+	l.halfLife = scans
+}
+
+// SetPruneAfter sets how long a directory goes without files before Prune may
+// drop it. A non-positive value selects the default of 30 days.
+func (l *Learner) SetPruneAfter(d time.Duration) {
+	if d <= 0 {
+		d = defaultPruneAfter
+	}
+	l.pruneAge = d
 }
 
-// UpdateAfterScan updates directory statistics after a scan of dirPath found filesFound files.
-func (l *Learner) UpdateAfterScan(dirPath string, filesFound int) {
+// Prune drops stale directories: those that have not yielded files for the
+// prune age and whose score is vanishingly small, unless negative-cached,
+// which expire on their own, or unreadable, which are left for an admin to
+// fix; and those that no longer exist and have not
+// yielded files for a day. Returns the number dropped.
+func (l *Learner) Prune() int {
+	now := l.now()
+	var stale []string
+	for path, stats := range l.data.Directories {
+		idle := idleFor(stats.LastSuccess, now)
+		switch {
+		case idle >= l.pruneAge && l.Score(stats) < minPruneScore && !l.IsNegativeCached(path) &&
+			stats.LastFailure != FailurePermissionDenied:
+			stale = append(stale, path)
+		case idle >= pruneGoneAfter:
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				stale = append(stale, path)
+			}
+		}
+	}
+	for _, path := range stale {
+		delete(l.data.Directories, path)
+		l.removeFromNegativeCache(path)
+	}
+	if len(stale) > 0 {
+		l.logger.Debug("pruned stale learned directories", "pruned", len(stale))
+	}
+	return len(stale)
+}
+
+// idleFor returns how long before now a directory last yielded files, given
+// its LastSuccess; forever if it never has.
+func idleFor(lastSuccess string, now time.Time) time.Duration {
+	t, err := time.Parse(time.RFC3339, lastSuccess)
+	if err != nil {
+		return math.MaxInt64
+	}
+	return now.Sub(t)
+}
+
+// UpdateAfterScan updates directory statistics after a scan of dirPath found
+// filesFound files totalling bytesFound bytes.
+func (l *Learner) UpdateAfterScan(dirPath string, filesFound int, bytesFound int64) {
 	stats, exists := l.data.Directories[dirPath]
 	if !exists {
 		stats = &config.DirectoryStats{Path: dirPath}
@@ -40,19 +228,97 @@ func (l *Learner) UpdateAfterScan(dirPath string, filesFound int) {
 
 	stats.ScanCount++
 	stats.FileCount += filesFound
+	stats.BytesFound += bytesFound
+	if stats.FileCount > 0 {
+		stats.AvgFileSize = float64(stats.BytesFound) / float64(stats.FileCount)
+	}
 
 	if filesFound > 0 {
-		stats.LastSuccess = time.Now().UTC().Format(time.RFC3339)
+		stats.LastSuccess = l.timestamp()
+		stats.LastFailure = ""
+		if len(stats.HourlyYield) != 24 {
+			stats.HourlyYield = make([]int, 24)
+		}
+		stats.HourlyYield[l.now().Hour()] += filesFound
 		l.removeFromNegativeCache(dirPath)
+		if root := l.NegativeSubtree(dirPath); root != "" {
+			l.removeFromNegativeCache(root)
+		}
 	} else if stats.ScanCount >= 5 && stats.FileCount == 0 {
 		l.addToNegativeCache(dirPath)
 	}
 
-	if stats.ScanCount > 0 {
-		stats.SuccessRate = float64(stats.FileCount) / float64(stats.ScanCount)
+	// The success rate is an exponential moving average of files per scan,
+	// so a directory's recent yield outweighs its history; the first scan
+	// replaces any seeded rate.
+	rate := float64(filesFound)
+	if stats.ScanCount > 1 {
+		alpha := 1 - math.Exp2(-1/float64(l.halfLife))
+		rate = stats.SuccessRate + alpha*(rate-stats.SuccessRate)
+	}
+	stats.SuccessRate = rate
+	stats.AvgFilesPerScan = float64(stats.FileCount) / float64(stats.ScanCount)
+
+	l.data.LastUpdated = l.timestamp()
+}
+
+// RecordFailure records why a scan of a learned directory found no files.
+// Only an empty scan counts as a scan toward its success rate and the
+// negative cache: a directory that could not be read or is excluded keeps
+// its statistics, so it is reported rather than cached and dropped. Unknown
+// directories are ignored.
+func (l *Learner) RecordFailure(dirPath, reason string) {
+	stats, ok := l.data.Directories[dirPath]
+	if !ok {
+		return
+	}
+	if reason == FailureEmpty {
+		l.UpdateAfterScan(dirPath, 0, 0)
+	}
+	stats.LastFailure = reason
+	if stats.Failures == nil {
+		stats.Failures = make(map[string]int)
+	}
+	stats.Failures[reason]++
+}
+
+// ExpireNegativeCache drops directories cached longer than the TTL, along
+// with their statistics, so they are treated as new directories and only
+// cached again after as many empty scans. Returns the number dropped.
+func (l *Learner) ExpireNegativeCache() int {
+	now := l.now()
+	var expired []string
+	for _, path := range l.data.NegativeCache {
+		if since(l.negativeEntry(path).CachedAt, now) >= l.ttl {
+			expired = append(expired, path)
+		}
+	}
+	for _, path := range expired {
+		l.removeFromNegativeCache(path)
+		delete(l.data.Directories, path)
+		l.logger.Debug("negative cache entry expired", "path", path)
 	}
+	return len(expired)
+}
 
-	l.data.LastUpdated = time.Now().UTC().Format(time.RFC3339)
+// DueProbes returns the negative-cached directories not scanned for the
+// re-probe interval and marks them probed. A probe that finds files takes the
+// directory out of the cache through UpdateAfterScan.
+func (l *Learner) DueProbes() []string {
+	now := l.now()
+	var due []string
+	for _, path := range l.data.NegativeCache {
+		entry := l.negativeEntry(path)
+		last := entry.LastProbed
+		if last == "" {
+			last = entry.CachedAt
+		}
+		if since(last, now) >= l.reprobe {
+			entry.LastProbed = l.timestamp()
+			due = append(due, path)
+		}
+	}
+	return due
 }
 
 // GetPriorityPaths returns directory paths sorted by score (descending),
@@ -82,29 +348,239 @@ func (l *Learner) GetPriorityPaths() []string {
 	return result
 }
 
-// IsNegativeCached returns true if the path is in the negative cache.
+// ProductiveDirs returns the high-yield directories that usually yield files
+// in the given local hour of day, highest score first.
+func (l *Learner) ProductiveDirs(hour int) []string {
+	var dirs []string
+	for _, path := range l.GetPriorityPaths() {
+		stats := l.data.Directories[path]
+		if l.Score(stats) < minFocusScore || len(stats.HourlyYield) != 24 {
+			continue
+		}
+		total := 0
+		for _, n := range stats.HourlyYield {
+			total += n
+		}
+		if total >= minHourlySamples && stats.HourlyYield[hour]*24 >= 2*total {
+			dirs = append(dirs, path)
+		}
+	}
+	return dirs
+}
+
+// Seed adds a directory suggested by the server, with the success rate seen
+// across the fleet, if it has no statistics yet. It is scanned like a learned
+// directory, and its own scans replace the seeded rate once it yields files.
+// Reports whether it was added.
+func (l *Learner) Seed(path string, successRate float64) bool {
+	if _, ok := l.data.Directories[path]; ok {
+		return false
+	}
+	l.data.Directories[path] = &config.DirectoryStats{Path: path, SuccessRate: successRate}
+	return true
+}
+
+// Shared returns the stats of the highest-scoring directories that have
+// yielded files, to share with the server. Home directories are written as
+// "~" and directory names not in names as "*"; of directories that then share
+// a path, the highest scoring is sent.
+func (l *Learner) Shared(names map[string]bool) []SharedDirectoryStats {
+	home, _ := os.UserHomeDir()
+	var shared []SharedDirectoryStats
+	seen := make(map[string]bool)
+	for _, path := range l.GetPriorityPaths() {
+		stats := l.data.Directories[path]
+		if stats.FileCount == 0 {
+			continue
+		}
+		p := generalizePath(anonymizePath(path, home, platform.UsersDir()), names)
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		shared = append(shared, SharedDirectoryStats{
+			Path:        p,
+			ScanCount:   stats.ScanCount,
+			FileCount:   stats.FileCount,
+			SuccessRate: stats.SuccessRate,
+		})
+		if len(shared) == maxSharedDirectories {
+			break
+		}
+	}
+	return shared
+}
+
+// LivePatterns returns the file patterns worth evaluating in the tree at
+// root: those not yet dead there, or all of them on a recheck scan.
+func (l *Learner) LivePatterns(root string, patterns []string) []string {
+	l.patternMu.Lock()
+	defer l.patternMu.Unlock()
+	tree := l.data.Patterns[root]
+	var live []string
+	for _, p := range patterns {
+		st := tree[p]
+		if st == nil || st.Files > 0 || st.Scans < minPatternScans || st.Scans%patternRecheck == 0 {
+			live = append(live, p)
+		}
+	}
+	return live
+}
+
+// UpdatePatterns counts a scan of the tree at root with the given file
+// patterns configured, and the files each matched.
+func (l *Learner) UpdatePatterns(root string, patterns []string, hits map[string]int) {
+	l.patternMu.Lock()
+	defer l.patternMu.Unlock()
+	tree := l.data.Patterns[root]
+	if tree == nil {
+		tree = make(map[string]*config.PatternStats)
+		l.data.Patterns[root] = tree
+	}
+	for _, p := range patterns {
+		st := tree[p]
+		if st == nil {
+			st = &config.PatternStats{}
+			tree[p] = st
+		}
+		st.Scans++
+		st.Files += hits[p]
+	}
+}
+
+// MarkNegativeSubtree caches the whole tree under path as negative. Entries
+// for directories inside it, and their statistics, are dropped; the subtree
+// entry covers them.
+func (l *Learner) MarkNegativeSubtree(path string) {
+	if root := l.NegativeSubtree(path); root != "" && root != path {
+		return
+	}
+	for _, p := range append([]string(nil), l.data.NegativeCache...) {
+		if p != path && isWithin(p, path) {
+			l.removeFromNegativeCache(p)
+			delete(l.data.Directories, p)
+		}
+	}
+	l.removeFromNegativeCache(path)
+	l.data.NegativeCache = append(l.data.NegativeCache, path)
+	l.data.NegativeCacheTimes[path] = &config.NegativeCacheEntry{CachedAt: l.timestamp(), Subtree: true}
+	l.logger.Debug("negative cache subtree marked", "path", path)
+}
+
+// NegativeSubtree returns the negative-cached subtree containing path, or ""
+// if there is none.
+func (l *Learner) NegativeSubtree(path string) string {
+	for dir := filepath.Clean(path); ; {
+		if entry := l.data.NegativeCacheTimes[dir]; entry != nil && entry.Subtree {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// NegativeCacheSize returns the number of directories in the negative cache.
+func (l *Learner) NegativeCacheSize() int {
+	return len(l.data.NegativeCache)
+}
+
+// IsNegativeCached returns true if the path is in the negative cache, or
+// inside a negative-cached subtree.
 func (l *Learner) IsNegativeCached(path string) bool {
 	for _, p := range l.data.NegativeCache {
 		if p == path {
 			return true
 		}
 	}
-	return false
+	return l.NegativeSubtree(path) != ""
+}
+
+// DirScore returns the score of a directory, or 0 if it has no statistics.
+func (l *Learner) DirScore(path string) float64 {
+	stats, ok := l.data.Directories[path]
+	if !ok {
+		return 0
+	}
+	return l.Score(stats)
+}
+
+// RecordUploads counts files of a learned directory that the server accepted
+// and rejected. Unknown directories are ignored.
+func (l *Learner) RecordUploads(dirPath string, accepted, rejected int) {
+	stats, ok := l.data.Directories[dirPath]
+	if !ok {
+		return
+	}
+	stats.FilesUploaded += accepted
+	stats.FilesRejected += rejected
 }
 
 // Score calculates a priority score for the given directory stats.
 func (l *Learner) Score(stats *config.DirectoryStats) float64 {
-	return stats.SuccessRate * recencyMultiplier(stats.LastSuccess)
+	return stats.SuccessRate * recencyMultiplier(stats.LastSuccess) * sizeMultiplier(stats.AvgFileSize) *
+		acceptanceMultiplier(stats.FilesUploaded, stats.FilesRejected)
 }
 
-// Save persists the learning data to disk.
+// Save persists the learning data to disk, first evicting directories over
+// the cap.
 func (l *Learner) Save() error {
+	l.evict()
 	if err := l.data.Save(l.savePath); err != nil {
 		return fmt.Errorf("save learning data: %w", err)
 	}
 	return nil
 }
 
+// evict drops the least valuable directories over the cap: those that have
+// not yielded files for the prune age, then negative-cached ones, which are
+// walked again once dropped, then the rest. Within each group the lowest
+// scoring go first, and of those the longest since they yielded files.
+func (l *Learner) evict() {
+	excess := len(l.data.Directories) - l.maxDirs
+	if excess <= 0 {
+		return
+	}
+	negative := make(map[string]bool, len(l.data.NegativeCache))
+	for _, p := range l.data.NegativeCache {
+		negative[p] = true
+	}
+	now := l.now()
+	group := func(s *config.DirectoryStats) int {
+		switch {
+		case negative[s.Path]:
+			return 1
+		case idleFor(s.LastSuccess, now) >= l.pruneAge:
+			return 0
+		}
+		return 2
+	}
+	stats := make([]*config.DirectoryStats, 0, len(l.data.Directories))
+	for _, s := range l.data.Directories {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if gi, gj := group(stats[i]), group(stats[j]); gi != gj {
+			return gi < gj
+		}
+		si, sj := l.Score(stats[i]), l.Score(stats[j])
+		if si != sj {
+			return si < sj
+		}
+		if stats[i].LastSuccess != stats[j].LastSuccess {
+			return stats[i].LastSuccess < stats[j].LastSuccess
+		}
+		return stats[i].Path < stats[j].Path
+	})
+	for _, s := range stats[:excess] {
+		delete(l.data.Directories, s.Path)
+		l.removeFromNegativeCache(s.Path)
+	}
+	l.logger.Debug("evicted learned directories over cap", "evicted", excess, "max", l.maxDirs)
+}
+
 // recencyMultiplier returns a value between 0.1 and 1.0 based on how recently
 // a directory yielded files. 1.0 within 24h, linear decay to 0.1 over 30 days.
 func recencyMultiplier(lastSuccess string) float64 {
@@ -132,12 +608,62 @@ func recencyMultiplier(lastSuccess string) float64 {
 	return math.Max(0.1, 1.0-fraction*0.9)
 }
 
+// sizeMultiplier returns a value between 0.5 and 1.0 based on a directory's
+// average file size, so directories of substantial files outrank ones of many
+// tiny files. 0.5 at 1 KB or less, rising with the log of the size to 1.0 at
+// 64 KB; 1.0 when no sizes are known.
+func sizeMultiplier(avgFileSize float64) float64 {
+	if avgFileSize <= 0 {
+		return 1.0
+	}
+	const small, large = 1024.0, 64 * 1024.0
+	fraction := math.Log2(avgFileSize/small) / math.Log2(large/small)
+	return 0.5 + 0.5*math.Max(0, math.Min(1, fraction))
+}
+
+// acceptanceMultiplier returns a value between 0.1 and 1.0 from the share of
+// a directory's uploads the server accepted, smoothed so a single rejection
+// does not sink it. 1.0 when nothing has been rejected.
+func acceptanceMultiplier(uploaded, rejected int) float64 {
+	if rejected == 0 {
+		return 1.0
+	}
+	share := float64(uploaded+1) / float64(uploaded+rejected+1)
+	return math.Max(0.1, share)
+}
+
 func (l *Learner) addToNegativeCache(path string) {
 	if !l.IsNegativeCached(path) {
 		l.data.NegativeCache = append(l.data.NegativeCache, path)
+		l.data.NegativeCacheTimes[path] = &config.NegativeCacheEntry{CachedAt: l.timestamp()}
+		l.collapseNegative(filepath.Dir(path))
 	}
 }
 
+// collapseNegative caches dir as a negative subtree once enough of its
+// subdirectories are negative-cached and nothing under it has yielded files.
+// A filesystem root is never collapsed.
+func (l *Learner) collapseNegative(dir string) {
+	if filepath.Dir(dir) == dir {
+		return
+	}
+	children := 0
+	for _, p := range l.data.NegativeCache {
+		if filepath.Dir(p) == dir {
+			children++
+		}
+	}
+	if children < minNegativeChildren {
+		return
+	}
+	for path, stats := range l.data.Directories {
+		if stats.FileCount > 0 && isWithin(path, dir) {
+			return
+		}
+	}
+	l.MarkNegativeSubtree(dir)
+}
+
 func (l *Learner) removeFromNegativeCache(path string) {
 	filtered := l.data.NegativeCache[:0]
 	for _, p := range l.data.NegativeCache {
@@ -146,4 +672,31 @@ func (l *Learner) removeFromNegativeCache(path string) {
 		}
 	}
 	l.data.NegativeCache = filtered
+	delete(l.data.NegativeCacheTimes, path)
+}
+
+// negativeEntry returns the times of a negative-cached directory, starting
+// them now if it has none.
+func (l *Learner) negativeEntry(path string) *config.NegativeCacheEntry {
+	entry, ok := l.data.NegativeCacheTimes[path]
+	if !ok {
+		entry = &config.NegativeCacheEntry{CachedAt: l.timestamp()}
+		l.data.NegativeCacheTimes[path] = entry
+	}
+	return entry
+}
+
+// timestamp returns the current time in RFC 3339, as learning data stores it.
+func (l *Learner) timestamp() string {
+	return l.now().UTC().Format(time.RFC3339)
+}
+
+// since returns how long before now the RFC 3339 time ts was. An unreadable
+// time reads as now, so it never expires anything early.
+func since(ts string, now time.Time) time.Duration {
+	t, err := time.Parse(time.RFC3339, ts)
+	if err != nil {
+		return 0
+	}
+	return now.Sub(t)
 }
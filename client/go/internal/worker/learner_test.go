@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -22,7 +23,7 @@ func newTestLearner(t *testing.T) (*Learner, string) {
 
 func TestLearner_UpdateAfterScan_FilesFound(t *testing.T) {
 	l, _ := newTestLearner(t)
-	l.UpdateAfterScan("/var/log", 5)
+	l.UpdateAfterScan("/var/log", 5, 0)
 
 	paths := l.GetPriorityPaths()
 	assert.Contains(t, paths, "/var/log")
@@ -38,7 +39,7 @@ func TestLearner_UpdateAfterScan_NoFiles_LessThan5Scans(t *testing.T) {
 	l, _ := newTestLearner(t)
 
 	for i := 0; i < 4; i++ {
-		l.UpdateAfterScan("/empty/dir", 0)
+		l.UpdateAfterScan("/empty/dir", 0, 0)
 	}
 
 	assert.False(t, l.IsNegativeCached("/empty/dir"))
@@ -48,7 +49,7 @@ func TestLearner_UpdateAfterScan_NoFiles_5OrMoreScans(t *testing.T) {
 	l, _ := newTestLearner(t)
 
 	for i := 0; i < 5; i++ {
-		l.UpdateAfterScan("/empty/dir", 0)
+		l.UpdateAfterScan("/empty/dir", 0, 0)
 	}
 
 	assert.True(t, l.IsNegativeCached("/empty/dir"))
@@ -59,25 +60,191 @@ func TestLearner_FilesFoundRemovesNegativeCache(t *testing.T) {
 
 	// Build up negative cache.
 	for i := 0; i < 5; i++ {
-		l.UpdateAfterScan("/was/empty", 0)
+		l.UpdateAfterScan("/was/empty", 0, 0)
 	}
 	assert.True(t, l.IsNegativeCached("/was/empty"))
 
 	// Finding files should remove from negative cache.
-	l.UpdateAfterScan("/was/empty", 3)
+	l.UpdateAfterScan("/was/empty", 3, 0)
 	assert.False(t, l.IsNegativeCached("/was/empty"))
 }
 
+func TestNewLearner_RecoversFromBackup(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "learning.json")
+	lf := config.NewLearningFile()
+	lf.Directories["/logs"] = &config.DirectoryStats{Path: "/logs", FileCount: 3}
+	lf.LastUpdated = "2026-01-01T00:00:00Z"
+	require.NoError(t, lf.Save(savePath))
+	require.NoError(t, lf.Save(savePath))
+
+	// A truncated file falls back to the backup and is not backed up itself.
+	require.NoError(t, os.WriteFile(savePath, []byte(`{"directories": {"/lo`), 0644))
+	l, err := NewLearner(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Contains(t, l.data.Directories, "/logs")
+	require.NoError(t, l.Save())
+	backup, err := config.LoadLearning(config.LearningBackupPath(savePath))
+	require.NoError(t, err)
+	assert.Contains(t, backup.Directories, "/logs")
+
+	// So does a file missing after an interrupted save.
+	require.NoError(t, os.Remove(savePath))
+	l, err = NewLearner(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Contains(t, l.data.Directories, "/logs")
+
+	// Without a usable backup, learning starts over.
+	require.NoError(t, os.WriteFile(savePath, []byte("not json"), 0644))
+	require.NoError(t, os.WriteFile(config.LearningBackupPath(savePath), []byte("not json"), 0644))
+	l, err = NewLearner(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Empty(t, l.data.Directories)
+}
+
+func TestLearner_NegativeCacheReprobe(t *testing.T) {
+	l, _ := newTestLearner(t)
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		l.UpdateAfterScan("/quiet", 0, 0)
+	}
+	require.True(t, l.IsNegativeCached("/quiet"))
+	assert.Empty(t, l.DueProbes())
+
+	now = now.Add(24 * time.Hour)
+	assert.Equal(t, []string{"/quiet"}, l.DueProbes())
+	assert.Empty(t, l.DueProbes(), "probed again only after another interval")
+
+	// A probe that finds files takes the directory out of the cache.
+	now = now.Add(24 * time.Hour)
+	require.Equal(t, []string{"/quiet"}, l.DueProbes())
+	l.UpdateAfterScan("/quiet", 2, 0)
+	assert.False(t, l.IsNegativeCached("/quiet"))
+	assert.Contains(t, l.GetPriorityPaths(), "/quiet")
+}
+
+func TestLearner_NegativeSubtree(t *testing.T) {
+	l, _ := newTestLearner(t)
+	cache := filepath.Join("/home", "user", ".cache")
+	empty := func(dir string) {
+		for i := 0; i < 5; i++ {
+			l.UpdateAfterScan(dir, 0, 0)
+		}
+	}
+
+	for i := 0; i < minNegativeChildren-1; i++ {
+		empty(filepath.Join(cache, fmt.Sprint(i)))
+	}
+	assert.Equal(t, minNegativeChildren-1, l.NegativeCacheSize())
+	assert.Empty(t, l.NegativeSubtree(filepath.Join(cache, "0")))
+
+	// One more empty subdirectory collapses them into a subtree entry.
+	empty(filepath.Join(cache, "last"))
+	assert.Equal(t, []string{cache}, l.data.NegativeCache)
+	assert.Equal(t, cache, l.NegativeSubtree(filepath.Join(cache, "new", "deep")))
+	assert.True(t, l.IsNegativeCached(filepath.Join(cache, "0")))
+	assert.Empty(t, l.data.Directories, "covered directories' stats are dropped")
+	assert.Empty(t, l.NegativeSubtree("/home/user"))
+
+	// Files found anywhere inside lift it.
+	l.UpdateAfterScan(filepath.Join(cache, "tool"), 1, 0)
+	assert.Empty(t, l.NegativeSubtree(filepath.Join(cache, "tool")))
+	assert.Zero(t, l.NegativeCacheSize())
+}
+
+func TestLearner_NegativeSubtreeNotCollapsedOverFiles(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.UpdateAfterScan("/data/logs", 3, 0)
+	for i := 0; i < minNegativeChildren; i++ {
+		for j := 0; j < 5; j++ {
+			l.UpdateAfterScan(fmt.Sprintf("/data/%d", i), 0, 0)
+		}
+	}
+	assert.Equal(t, minNegativeChildren, l.NegativeCacheSize())
+	assert.Empty(t, l.NegativeSubtree("/data/0"))
+}
+
+func TestLearner_RecordFailure(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.Seed("/locked", 1)
+	for i := 0; i < 5; i++ {
+		l.RecordFailure("/locked", FailurePermissionDenied)
+	}
+	stats := l.data.Directories["/locked"]
+	assert.False(t, l.IsNegativeCached("/locked"), "an unreadable directory is not empty")
+	assert.Zero(t, stats.ScanCount)
+	assert.Equal(t, FailurePermissionDenied, stats.LastFailure)
+
+	for i := 0; i < 5; i++ {
+		l.RecordFailure("/locked", FailureEmpty)
+	}
+	assert.True(t, l.IsNegativeCached("/locked"))
+	assert.Equal(t, map[string]int{FailurePermissionDenied: 5, FailureEmpty: 5}, stats.Failures)
+
+	l.UpdateAfterScan("/locked", 1, 0)
+	assert.Empty(t, stats.LastFailure)
+
+	l.RecordFailure("/unknown", FailureEmpty)
+	assert.NotContains(t, l.data.Directories, "/unknown")
+}
+
+func TestLearner_NegativeCacheExpires(t *testing.T) {
+	l, savePath := newTestLearner(t)
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	l.SetNegativeCacheTiming(time.Hour, 48*time.Hour)
+
+	for i := 0; i < 5; i++ {
+		l.UpdateAfterScan("/quiet", 0, 0)
+	}
+	now = now.Add(47 * time.Hour)
+	assert.Zero(t, l.ExpireNegativeCache())
+	now = now.Add(time.Hour)
+	assert.Equal(t, 1, l.ExpireNegativeCache())
+	assert.False(t, l.IsNegativeCached("/quiet"))
+	assert.NotContains(t, l.data.Directories, "/quiet", "statistics start over")
+
+	// Entries from files without times start their TTL when loaded.
+	lf := config.NewLearningFile()
+	lf.NegativeCache = []string{"/old"}
+	require.NoError(t, lf.Save(savePath))
+	l2, err := NewLearner(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Zero(t, l2.ExpireNegativeCache())
+	assert.NotEmpty(t, l2.data.NegativeCacheTimes["/old"].CachedAt)
+}
+
+func TestLearner_SuccessRateFavorsRecentYield(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.SetSuccessRateHalfLife(2)
+
+	// /old was hot for a long time, then cooled; /new has just become active.
+	for i := 0; i < 50; i++ {
+		l.UpdateAfterScan("/old", 10, 0)
+	}
+	for i := 0; i < 6; i++ {
+		l.UpdateAfterScan("/old", 1, 0)
+		l.UpdateAfterScan("/new", 4, 0)
+	}
+
+	old := l.data.Directories["/old"]
+	assert.InDelta(t, 1+9*0.125, old.SuccessRate, 0.001, "three half-lives since it cooled")
+	assert.InDelta(t, 506/56.0, old.AvgFilesPerScan, 0.001, "the all-time average is kept")
+	assert.Equal(t, 4.0, l.data.Directories["/new"].SuccessRate)
+	assert.Equal(t, []string{"/new", "/old"}, l.GetPriorityPaths())
+}
+
 func TestLearner_GetPriorityPaths_SortedByScore(t *testing.T) {
 	l, _ := newTestLearner(t)
 
 	// Path A: high success, recent.
-	l.UpdateAfterScan("/high/success", 10)
-	l.UpdateAfterScan("/high/success", 8)
+	l.UpdateAfterScan("/high/success", 10, 0)
+	l.UpdateAfterScan("/high/success", 8, 0)
 
 	// Path B: low success, recent.
-	l.UpdateAfterScan("/low/success", 1)
-	l.UpdateAfterScan("/low/success", 0)
+	l.UpdateAfterScan("/low/success", 1, 0)
+	l.UpdateAfterScan("/low/success", 0, 0)
 
 	paths := l.GetPriorityPaths()
 	require.Len(t, paths, 2)
@@ -122,7 +289,7 @@ func TestLearner_Score_OldSuccess(t *testing.T) {
 func TestLearner_SaveLoadRoundTrip(t *testing.T) {
 	l, savePath := newTestLearner(t)
 
-	l.UpdateAfterScan("/test/dir", 3)
+	l.UpdateAfterScan("/test/dir", 3, 0)
 	require.NoError(t, l.Save())
 
 	// Verify file exists.
@@ -139,6 +306,187 @@ func TestLearner_SaveLoadRoundTrip(t *testing.T) {
 	assert.Equal(t, 3, stats.FileCount)
 }
 
+func TestLearner_ProductiveDirs(t *testing.T) {
+	l, _ := newTestLearner(t)
+	base := time.Now().Truncate(time.Hour) // recent, so scores are not decayed
+	now := base
+	l.now = func() time.Time { return now }
+	peak, later := base.Hour(), base.Add(3*time.Hour).Hour()
+
+	// /office yields mostly at its peak hour, /flat every hour, /rare too little.
+	for i := 0; i < 4; i++ {
+		l.UpdateAfterScan("/office", 5, 0)
+	}
+	now = base.Add(3 * time.Hour)
+	l.UpdateAfterScan("/office", 1, 0)
+	for h := 0; h < 24; h++ {
+		now = base.Add(time.Duration(h) * time.Hour)
+		l.UpdateAfterScan("/flat", 2, 0)
+	}
+	now = base
+	l.UpdateAfterScan("/rare", 3, 0)
+
+	assert.Equal(t, 20, l.data.Directories["/office"].HourlyYield[peak])
+	assert.Equal(t, []string{"/office"}, l.ProductiveDirs(peak))
+	assert.Empty(t, l.ProductiveDirs(later), "1 of 21 files is under twice the hourly average")
+	assert.Empty(t, l.ProductiveDirs(base.Add(12*time.Hour).Hour()))
+}
+
+func TestLearner_SaveEvictsOverCap(t *testing.T) {
+	l, savePath := newTestLearner(t)
+	l.SetMaxDirectories(3)
+
+	l.UpdateAfterScan("/busy", 10, 0)
+	l.UpdateAfterScan("/steady", 2, 0)
+	l.data.Directories["/stale"] = &config.DirectoryStats{
+		Path: "/stale", ScanCount: 1, FileCount: 2, SuccessRate: 2,
+		LastSuccess: time.Now().Add(-40 * 24 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	for i := 0; i < 5; i++ {
+		l.UpdateAfterScan("/empty", 0, 0)
+	}
+	require.True(t, l.IsNegativeCached("/empty"))
+	require.NoError(t, l.Save())
+
+	assert.Len(t, l.data.Directories, 3)
+	assert.NotContains(t, l.data.Directories, "/stale", "cold directories go first")
+	assert.True(t, l.IsNegativeCached("/empty"), "negative-cached directories are kept over cold ones")
+
+	l.SetMaxDirectories(2)
+	require.NoError(t, l.Save())
+	loaded, err := config.LoadLearning(savePath)
+	require.NoError(t, err)
+	assert.Len(t, loaded.Directories, 2)
+	assert.NotContains(t, loaded.Directories, "/empty", "then negative-cached ones")
+	assert.False(t, l.IsNegativeCached("/empty"))
+
+	l.SetMaxDirectories(1)
+	require.NoError(t, l.Save())
+	assert.Contains(t, l.data.Directories, "/busy", "then the lowest scoring")
+}
+
+func TestLearner_SeedAndShare(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.UpdateAfterScan("/var/log/openai", 4, 0)
+
+	assert.True(t, l.Seed("/opt/tool/logs", 3))
+	assert.False(t, l.Seed("/var/log/openai", 9), "learned stats are kept")
+	assert.Contains(t, l.GetPriorityPaths(), "/opt/tool/logs")
+	assert.Equal(t, 4.0, l.data.Directories["/var/log/openai"].SuccessRate)
+
+	shared := l.Shared(sharedNames(nil))
+	require.Len(t, shared, 1, "seeded directories have not yielded files here")
+	assert.Equal(t, SharedDirectoryStats{Path: "/var/log/openai", ScanCount: 1, FileCount: 4, SuccessRate: 4}, shared[0])
+
+	l.UpdateAfterScan("/srv/acme-billing/logs", 9, 0)
+	l.UpdateAfterScan("/srv/acme-payroll/logs", 2, 0)
+	shared = l.Shared(sharedNames(nil))
+	require.Len(t, shared, 2, "directories generalized to the same path are shared once")
+	assert.Equal(t, SharedDirectoryStats{Path: "/srv/*/logs", ScanCount: 1, FileCount: 9, SuccessRate: 9}, shared[0])
+
+	l.UpdateAfterScan("/opt/tool/logs", 1, 0)
+	assert.Equal(t, 1.0, l.data.Directories["/opt/tool/logs"].SuccessRate, "its own scans replace the seeded rate")
+}
+
+func TestLearner_LivePatterns(t *testing.T) {
+	l, savePath := newTestLearner(t)
+	patterns := []string{"*.jsonl", "*usage*.log"}
+	assert.Equal(t, patterns, l.LivePatterns("/logs", patterns))
+
+	for i := 0; i < minPatternScans; i++ {
+		l.UpdatePatterns("/logs", patterns, map[string]int{"*.jsonl": 1})
+	}
+	assert.Equal(t, patterns, l.LivePatterns("/logs", patterns), "rechecked on the 20th scan")
+	l.UpdatePatterns("/logs", patterns, nil)
+	assert.Equal(t, []string{"*.jsonl"}, l.LivePatterns("/logs", patterns))
+	assert.Equal(t, patterns, l.LivePatterns("/other", patterns), "tracked per tree")
+	assert.Equal(t, []string{"*.csv"}, l.LivePatterns("/logs", []string{"*.csv"}), "new patterns start over")
+
+	require.NoError(t, l.Save())
+	loaded, err := config.LoadLearning(savePath)
+	require.NoError(t, err)
+	assert.Equal(t, &config.PatternStats{Scans: 21, Files: 0}, loaded.Patterns["/logs"]["*usage*.log"])
+}
+
+func TestLearner_TracksBytes(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.UpdateAfterScan("/big", 2, 256*1024)
+	l.UpdateAfterScan("/big", 2, 64*1024)
+	l.UpdateAfterScan("/tiny", 3, 600)
+
+	stats := l.data.Directories["/big"]
+	assert.Equal(t, int64(320*1024), stats.BytesFound)
+	assert.Equal(t, 80*1024.0, stats.AvgFileSize)
+
+	// Fewer files per scan, but substantial ones, outrank many tiny files.
+	assert.Equal(t, []string{"/big", "/tiny"}, l.GetPriorityPaths())
+}
+
+func TestSizeMultiplier(t *testing.T) {
+	assert.Equal(t, 1.0, sizeMultiplier(0), "unknown sizes")
+	assert.Equal(t, 0.5, sizeMultiplier(100))
+	assert.Equal(t, 0.5, sizeMultiplier(1024))
+	assert.InDelta(t, 0.75, sizeMultiplier(8*1024), 0.001)
+	assert.Equal(t, 1.0, sizeMultiplier(64*1024))
+	assert.Equal(t, 1.0, sizeMultiplier(10*1024*1024))
+}
+
+func TestLearner_RecordUploads(t *testing.T) {
+	l, _ := newTestLearner(t)
+	l.UpdateAfterScan("/kept", 2, 0)
+	l.UpdateAfterScan("/rejected", 2, 0)
+	l.RecordUploads("/kept", 2, 0)
+	l.RecordUploads("/rejected", 0, 5)
+	l.RecordUploads("/unknown", 1, 0)
+
+	assert.Equal(t, 5, l.data.Directories["/rejected"].FilesRejected)
+	assert.NotContains(t, l.data.Directories, "/unknown")
+	assert.Equal(t, []string{"/kept", "/rejected"}, l.GetPriorityPaths())
+}
+
+func TestAcceptanceMultiplier(t *testing.T) {
+	assert.Equal(t, 1.0, acceptanceMultiplier(0, 0))
+	assert.Equal(t, 1.0, acceptanceMultiplier(7, 0))
+	assert.Equal(t, 0.5, acceptanceMultiplier(0, 1), "one rejection does not sink a directory")
+	assert.InDelta(t, 0.9, acceptanceMultiplier(8, 1), 0.001)
+	assert.Equal(t, 0.1, acceptanceMultiplier(0, 50))
+}
+
+func TestLearner_Prune(t *testing.T) {
+	l, _ := newTestLearner(t)
+	now := time.Now()
+	ago := func(d time.Duration) string { return now.Add(-d).UTC().Format(time.RFC3339) }
+	day := 24 * time.Hour
+	live, gone := t.TempDir(), filepath.Join(t.TempDir(), "gone")
+	l.data.Directories = map[string]*config.DirectoryStats{
+		live:               {Path: live, SuccessRate: 0.05, LastSuccess: ago(31 * day)},
+		live + "/active":   {Path: live + "/active", SuccessRate: 0.005, LastSuccess: ago(2 * day)},
+		live + "/seeded":   {Path: live + "/seeded", SuccessRate: 2},
+		gone:               {Path: gone, SuccessRate: 5, LastSuccess: ago(2 * day)},
+		gone + "/fresh":    {Path: gone + "/fresh", SuccessRate: 5, LastSuccess: ago(time.Hour)},
+		live + "/negative": {Path: live + "/negative"},
+		live + "/locked":   {Path: live + "/locked", LastFailure: FailurePermissionDenied},
+	}
+	l.data.NegativeCache = []string{live + "/negative"}
+	require.NoError(t, os.Mkdir(live+"/negative", 0755))
+	require.NoError(t, os.Mkdir(live+"/seeded", 0755))
+	require.NoError(t, os.Mkdir(live+"/active", 0755))
+	require.NoError(t, os.Mkdir(live+"/locked", 0755))
+
+	assert.Equal(t, 2, l.Prune())
+	assert.NotContains(t, l.data.Directories, live, "no success in 30 days and a tiny score")
+	assert.NotContains(t, l.data.Directories, gone, "no longer exists")
+	assert.Contains(t, l.data.Directories, live+"/active")
+	assert.Contains(t, l.data.Directories, live+"/seeded", "its seeded rate still scores")
+	assert.Contains(t, l.data.Directories, gone+"/fresh", "yielded files within a day")
+	assert.True(t, l.IsNegativeCached(live+"/negative"), "negative cache entries expire on their own")
+	assert.Contains(t, l.data.Directories, live+"/locked", "unreadable directories are left for an admin")
+
+	l.SetPruneAfter(day)
+	assert.Equal(t, 1, l.Prune())
+	assert.NotContains(t, l.data.Directories, live+"/active")
+}
+
 func TestRecencyMultiplier(t *testing.T) {
 	tests := []struct {
 		name     string
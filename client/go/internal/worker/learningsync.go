@@ -0,0 +1,228 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
+)
+
+// Learning sync endpoint paths, relative to the server URL.
+const (
+	learningHintsPath = "/api/learning/hints"
+	learningStatsPath = "/api/learning/stats"
+)
+
+// maxSharedDirectories caps the directories shared with the server per sync.
+const maxSharedDirectories = 100
+
+// DirectoryHint is a directory clients across the fleet have found usage
+// logs in. Paths under a user's home directory start with "~".
+type DirectoryHint struct {
+	Path        string  `json:"path"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// SharedDirectoryStats is a directory's learning data as shared with the
+// server: counts only, with the home directory written as "~" and other
+// directory names generalized (see generalizePath), so it names neither the
+// host nor its users.
+type SharedDirectoryStats struct {
+	Path        string  `json:"path"`
+	ScanCount   int     `json:"scan_count"`
+	FileCount   int     `json:"file_count"`
+	SuccessRate float64 `json:"success_rate"`
+}
+
+// LearningSync exchanges learning data with the server: it downloads
+// directory hints learned across the fleet, so a new client starts with
+// somewhere to look, and shares the client's own directory stats.
+type LearningSync struct {
+	serverURL  string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+// NewLearningSync creates a LearningSync for the given server.
+func NewLearningSync(serverURL string) *LearningSync {
+	return &LearningSync{
+		serverURL:  serverURL,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// SetTransport sets the HTTP transport requests use. Nil keeps the default.
+func (s *LearningSync) SetTransport(rt http.RoundTripper) {
+	s.httpClient.Transport = rt
+}
+
+// SetHeaders sets extra headers sent with every request.
+func (s *LearningSync) SetHeaders(headers map[string]string) {
+	s.headers = headers
+}
+
+// Hints downloads the directory hints for a platform. A server without the
+// endpoint has none to give.
+func (s *LearningSync) Hints(ctx context.Context, osName string) ([]DirectoryHint, error) {
+	u := config.JoinURL(s.serverURL, learningHintsPath) + "?platform=" + url.QueryEscape(osName)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("create hints request: %w", err)
+	}
+	body, err := s.do(req)
+	if err != nil || body == nil {
+		return nil, err
+	}
+	var resp struct {
+		Hints []DirectoryHint `json:"hints"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("parse hints response: %w", err)
+	}
+	return resp.Hints, nil
+}
+
+// Share uploads the client's directory stats for a platform. A server
+// without the endpoint is not sent anything.
+func (s *LearningSync) Share(ctx context.Context, osName string, dirs []SharedDirectoryStats) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		Platform    string                 `json:"platform"`
+		Directories []SharedDirectoryStats `json:"directories"`
+	}{osName, dirs})
+	if err != nil {
+		return fmt.Errorf("marshal directory stats: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.JoinURL(s.serverURL, learningStatsPath), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("create stats request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	_, err = s.do(req)
+	return err
+}
+
+// do sends a request and returns its response body, or nil for a 404.
+func (s *LearningSync) do(req *http.Request) ([]byte, error) {
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("send %s: %w", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := config.ReadLimited(resp.Body, defaultMaxResponseBytes)
+	if err != nil {
+		return nil, fmt.Errorf("read %s response: %w", req.URL.Path, err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return nil, fmt.Errorf("%s returned status %d", req.URL.Path, resp.StatusCode)
+	}
+	return body, nil
+}
+
+// anonymizePath writes a directory under home, or under any user's home
+// directory in usersDir, as "~/rest" with forward slashes. Other paths are
+// returned with forward slashes.
+func anonymizePath(path, home, usersDir string) string {
+	if rel, ok := under(path, home); ok {
+		return "~/" + rel
+	}
+	if rel, ok := under(path, usersDir); ok {
+		if _, rest, found := strings.Cut(rel, "/"); found {
+			return "~/" + rest
+		}
+	}
+	return filepath.ToSlash(path)
+}
+
+// wellKnownDirNames are directory names found on many machines, which say
+// nothing about a host or its users. Shared paths keep them; see sharedNames.
+var wellKnownDirNames = []string{
+	"var", "log", "logs", "opt", "usr", "local", "srv", "tmp", "share", "state",
+	"Library", "Logs", "Application Support", "Containers", "Data",
+	"AppData", "Roaming", "Local", "ProgramData",
+	".config", ".local", ".cache",
+	"openai", "anthropic", ".openai", ".anthropic", ".claude", ".codex", ".gemini", ".cursor", ".aider",
+	"projects", "sessions", "history", "usage",
+}
+
+// sharedNames returns the directory names kept in shared paths: the
+// well-known ones and the literal names in the discovery paths, which the
+// server configured.
+func sharedNames(paths []config.DiscoveryPath) map[string]bool {
+	names := make(map[string]bool, len(wellKnownDirNames))
+	for _, n := range wellKnownDirNames {
+		names[n] = true
+	}
+	for _, p := range paths {
+		for _, n := range strings.Split(filepath.ToSlash(p.Path), "/") {
+			if n != "" && !strings.ContainsAny(n, "*?[~%$") {
+				names[n] = true
+			}
+		}
+	}
+	return names
+}
+
+// generalizePath writes each component of an anonymized path that is not in
+// names as "*", leaving a leading "~" and drive letter, so a shared path
+// names only directories common to many machines. As a hint, the glob still
+// matches the directory it came from.
+func generalizePath(path string, names map[string]bool) string {
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		drive := i == 0 && len(p) == 2 && p[1] == ':'
+		if p != "" && p != "~" && !drive && !names[p] {
+			parts[i] = "*"
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// under returns path relative to dir, with forward slashes, if it is inside dir.
+func under(path, dir string) (string, bool) {
+	if dir == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// localHintDirs resolves hints to the directories they name on this machine,
+// expanding "~" and globs, and keeps those that exist. Each maps to its
+// hint's success rate.
+func localHintDirs(hints []DirectoryHint) map[string]float64 {
+	dirs := make(map[string]float64)
+	for _, h := range hints {
+		matches, err := filepath.Glob(filepath.FromSlash(platform.ExpandPath(h.Path)))
+		if err != nil {
+			continue
+		}
+		for _, m := range matches {
+			if info, err := os.Stat(m); err == nil && info.IsDir() {
+				dirs[m] = h.SuccessRate
+			}
+		}
+	}
+	return dirs
+}
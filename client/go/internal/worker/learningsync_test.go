@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestLearningSync_Hints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, learningHintsPath, r.URL.Path)
+		assert.Equal(t, "linux", r.URL.Query().Get("platform"))
+		assert.Equal(t, "Bearer x", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"hints":[{"path":"~/.claude/projects","success_rate":3.5}]}`))
+	}))
+	defer srv.Close()
+
+	s := NewLearningSync(srv.URL)
+	s.SetHeaders(map[string]string{"Authorization": "Bearer x"})
+	hints, err := s.Hints(context.Background(), "linux")
+	require.NoError(t, err)
+	assert.Equal(t, []DirectoryHint{{Path: "~/.claude/projects", SuccessRate: 3.5}}, hints)
+}
+
+func TestLearningSync_Share(t *testing.T) {
+	var got struct {
+		Platform    string                 `json:"platform"`
+		Directories []SharedDirectoryStats `json:"directories"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, learningStatsPath, r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+	}))
+	defer srv.Close()
+
+	dirs := []SharedDirectoryStats{{Path: "~/logs", ScanCount: 4, FileCount: 8, SuccessRate: 2}}
+	require.NoError(t, NewLearningSync(srv.URL).Share(context.Background(), "darwin", dirs))
+	assert.Equal(t, "darwin", got.Platform)
+	assert.Equal(t, dirs, got.Directories)
+}
+
+func TestLearningSync_ServerWithoutEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	s := NewLearningSync(srv.URL)
+	hints, err := s.Hints(context.Background(), "linux")
+	assert.NoError(t, err)
+	assert.Nil(t, hints)
+	assert.NoError(t, s.Share(context.Background(), "linux", []SharedDirectoryStats{{Path: "/var/log"}}))
+}
+
+func TestLearningSync_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	_, err := NewLearningSync(srv.URL).Hints(context.Background(), "linux")
+	assert.ErrorContains(t, err, "status 500")
+}
+
+func TestAnonymizePath(t *testing.T) {
+	home := filepath.FromSlash("/home/alice")
+	users := filepath.FromSlash("/home")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/home/alice/.claude/projects", "~/.claude/projects"},
+		{"/home/bob/logs", "~/logs"},
+		{"/home/bob", "/home/bob"},
+		{"/var/log/openai", "/var/log/openai"},
+		{"/home/alice", "/home/alice"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, anonymizePath(filepath.FromSlash(tt.path), home, users), tt.path)
+	}
+}
+
+func TestGeneralizePath(t *testing.T) {
+	names := sharedNames(config.PlainPaths("/opt/*/tokens", "%APPDATA%/logs"))
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"~/.claude/projects/-home-alice-secret/logs", "~/.claude/projects/*/logs"},
+		{"/var/log/openai", "/var/log/openai"},
+		{"/opt/acme/tokens", "/opt/*/tokens"},
+		{"C:/Users/Public/AppData/Roaming/logs", "C:/*/*/AppData/Roaming/logs"},
+		{"~/clients/initech", "~/*/*"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, generalizePath(tt.path, names), tt.path)
+	}
+}
+
+func TestLocalHintDirs(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "logs"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "b", "logs"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "c"), nil, 0644))
+
+	got := localHintDirs([]DirectoryHint{
+		{Path: filepath.ToSlash(dir) + "/*/logs", SuccessRate: 2},
+		{Path: filepath.ToSlash(dir) + "/c", SuccessRate: 1},
+		{Path: filepath.ToSlash(dir) + "/missing", SuccessRate: 1},
+	})
+	assert.Equal(t, map[string]float64{
+		filepath.Join(dir, "a", "logs"): 2,
+		filepath.Join(dir, "b", "logs"): 2,
+	}, got)
+}
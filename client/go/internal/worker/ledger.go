@@ -0,0 +1,207 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// defaultLedgerMaxBytes is the size at which the ledger is rotated to path + ".1".
+const defaultLedgerMaxBytes = 5 * 1024 * 1024
+
+// FileTimeline records when a file passed each stage of the pipeline.
+type FileTimeline struct {
+	ModifiedAt   time.Time
+	DiscoveredAt time.Time
+	ValidatedAt  time.Time
+	UploadedAt   time.Time
+}
+
+// payload renders the timeline for the upload metadata. UploadedAt is not
+// known yet at that point; the server uses collected_at instead.
+func (t FileTimeline) payload() map[string]any {
+	p := map[string]any{}
+	if !t.DiscoveredAt.IsZero() {
+		p["discovered_at"] = t.DiscoveredAt.UTC().Format(time.RFC3339)
+		if !t.ModifiedAt.IsZero() {
+			p["discovery_latency_ms"] = t.DiscoveredAt.Sub(t.ModifiedAt).Milliseconds()
+		}
+	}
+	if !t.ValidatedAt.IsZero() {
+		p["validated_at"] = t.ValidatedAt.UTC().Format(time.RFC3339)
+		if !t.DiscoveredAt.IsZero() {
+			p["validation_latency_ms"] = t.ValidatedAt.Sub(t.DiscoveredAt).Milliseconds()
+		}
+	}
+	return p
+}
+
+// LedgerEntry records the outcome and timeline of one upload attempt.
+type LedgerEntry struct {
+	Path          string `json:"path"`
+	FileHash      string `json:"file_hash,omitempty"`
+	HashAlgorithm string `json:"hash_algorithm,omitempty"`
+	SizeBytes     int64  `json:"size_bytes"`
+	StatusCode    int    `json:"status_code"`
+	Outcome       string `json:"outcome"` // "uploaded", "duplicate", "retry", "rejected", "stopped"
+	Error         string `json:"error,omitempty"`
+	ModifiedAt    string `json:"modified_at"`
+	DiscoveredAt  string `json:"discovered_at"`
+	ValidatedAt   string `json:"validated_at"`
+	UploadedAt    string `json:"uploaded_at"`
+	EndToEndMs    int64  `json:"end_to_end_ms"` // modified_at → uploaded_at
+	PendingMs     int64  `json:"pending_ms"`    // discovered_at → uploaded_at
+
+	BytesSent     int64 `json:"bytes_sent"`
+	UploadMs      int64 `json:"upload_ms"`
+	ThroughputBps int64 `json:"throughput_bps"`
+}
+
+// newLedgerEntry builds a LedgerEntry from a file's metadata, timeline, and upload result.
+func newLedgerEntry(meta *FileMetadata, tl FileTimeline, result *UploadResult) LedgerEntry {
+	entry := LedgerEntry{
+		Path:          meta.OriginalPath,
+		FileHash:      meta.FileHash,
+		HashAlgorithm: meta.HashAlgorithm,
+		SizeBytes:     meta.SizeBytes,
+		StatusCode:    result.StatusCode,
+		Error:         result.Error,
+		ModifiedAt:    tl.ModifiedAt.UTC().Format(time.RFC3339),
+		DiscoveredAt:  tl.DiscoveredAt.UTC().Format(time.RFC3339),
+		ValidatedAt:   tl.ValidatedAt.UTC().Format(time.RFC3339),
+		UploadedAt:    tl.UploadedAt.UTC().Format(time.RFC3339),
+		EndToEndMs:    tl.UploadedAt.Sub(tl.ModifiedAt).Milliseconds(),
+		PendingMs:     tl.UploadedAt.Sub(tl.DiscoveredAt).Milliseconds(),
+
+		BytesSent:     result.BytesSent,
+		UploadMs:      result.Duration.Milliseconds(),
+		ThroughputBps: int64(result.Throughput()),
+	}
+	switch {
+	case result.ShouldDelete:
+		entry.Outcome = "uploaded"
+	case result.ShouldStopUploads:
+		entry.Outcome = "stopped"
+	case result.ShouldRetry:
+		entry.Outcome = "retry"
+	default:
+		entry.Outcome = "rejected"
+	}
+	return entry
+}
+
+// Ledger is an append-only JSONL log of upload attempts kept on the client.
+type Ledger struct {
+	path     string
+	maxBytes int64
+
+	mu sync.Mutex
+}
+
+// NewLedger creates a Ledger writing to path.
+func NewLedger(path string) *Ledger {
+	return &Ledger{path: path, maxBytes: defaultLedgerMaxBytes}
+}
+
+// UploadedSince totals the successful uploads recorded at or after since.
+// Only the current ledger file is read. A missing ledger yields zeros.
+func (l *Ledger) UploadedSince(since time.Time) (files int, bytes int64, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, 0, nil
+		}
+		return 0, 0, fmt.Errorf("open ledger: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e LedgerEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.Outcome != "uploaded" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, e.UploadedAt)
+		if err != nil || t.Before(since) {
+			continue
+		}
+		files++
+		bytes += e.SizeBytes
+	}
+	if err := sc.Err(); err != nil {
+		return files, bytes, fmt.Errorf("read ledger: %w", err)
+	}
+	return files, bytes, nil
+}
+
+// uploadedDigests returns the uploads recorded in the ledger, by path and
+// digest, keeping the most recent max. Only the current ledger file is read.
+// Entries without an algorithm are SHA-256.
+func (l *Ledger) uploadedDigests(max int) (*uploadedSet, error) {
+	digests := newUploadedSet(max)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return digests, nil
+		}
+		return digests, fmt.Errorf("open ledger: %w", err)
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e LedgerEntry
+		if json.Unmarshal(sc.Bytes(), &e) != nil || e.Outcome != "uploaded" || e.FileHash == "" {
+			continue
+		}
+		meta := FileMetadata{FileHash: e.FileHash, HashAlgorithm: e.HashAlgorithm}
+		digests.add(e.Path, meta.Digest())
+	}
+	if err := sc.Err(); err != nil {
+		return digests, fmt.Errorf("read ledger: %w", err)
+	}
+	return digests, nil
+}
+
+// Append writes one entry to the ledger, rotating the file first if it has
+// grown past its size limit.
+func (l *Ledger) Append(entry LedgerEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("marshal ledger entry: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(l.path), 0755); err != nil {
+		return fmt.Errorf("create ledger dir: %w", err)
+	}
+	if info, err := os.Stat(l.path); err == nil && info.Size() >= l.maxBytes {
+		if err := os.Rename(l.path, l.path+".1"); err != nil {
+			return fmt.Errorf("rotate ledger: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open ledger: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("write ledger entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package worker
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readLedger(t *testing.T, path string) []LedgerEntry {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var entries []LedgerEntry
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e LedgerEntry
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+func TestLedger_AppendAndRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "ledger.jsonl")
+	l := NewLedger(path)
+	l.maxBytes = 1
+
+	require.NoError(t, l.Append(LedgerEntry{Path: "/a.jsonl", Outcome: "uploaded"}))
+	require.NoError(t, l.Append(LedgerEntry{Path: "/b.jsonl", Outcome: "retry"}))
+
+	current := readLedger(t, path)
+	require.Len(t, current, 1)
+	assert.Equal(t, "/b.jsonl", current[0].Path)
+
+	rotated := readLedger(t, path+".1")
+	require.Len(t, rotated, 1)
+	assert.Equal(t, "/a.jsonl", rotated[0].Path)
+}
+
+func TestNewLedgerEntry_Timeline(t *testing.T) {
+	modified := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	tl := FileTimeline{
+		ModifiedAt:   modified,
+		DiscoveredAt: modified.Add(time.Hour),
+		ValidatedAt:  modified.Add(time.Hour + time.Second),
+		UploadedAt:   modified.Add(2 * time.Hour),
+	}
+
+	entry := newLedgerEntry(testMeta(), tl, &UploadResult{StatusCode: 200, ShouldDelete: true})
+	assert.Equal(t, "uploaded", entry.Outcome)
+	assert.Equal(t, "2026-01-01T11:00:00Z", entry.DiscoveredAt)
+	assert.Equal(t, int64(2*time.Hour/time.Millisecond), entry.EndToEndMs)
+	assert.Equal(t, int64(time.Hour/time.Millisecond), entry.PendingMs)
+
+	entry = newLedgerEntry(testMeta(), tl, &UploadResult{StatusCode: 503, ShouldRetry: true})
+	assert.Equal(t, "retry", entry.Outcome)
+}
+
+func TestFileTimeline_Payload(t *testing.T) {
+	modified := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	tl := FileTimeline{
+		ModifiedAt:   modified,
+		DiscoveredAt: modified.Add(time.Minute),
+		ValidatedAt:  modified.Add(time.Minute + 500*time.Millisecond),
+	}
+
+	p := tl.payload()
+	assert.Equal(t, "2026-01-01T10:01:00Z", p["discovered_at"])
+	assert.Equal(t, int64(60000), p["discovery_latency_ms"])
+	assert.Equal(t, int64(500), p["validation_latency_ms"])
+
+	assert.Empty(t, FileTimeline{}.payload())
+}
+
+func TestLedger_UploadedDigests(t *testing.T) {
+	l := NewLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	digests, err := l.uploadedDigests(10)
+	require.NoError(t, err)
+	assert.Zero(t, digests.len())
+
+	require.NoError(t, l.Append(LedgerEntry{Path: "/a", Outcome: "uploaded", FileHash: "AAA"}))
+	require.NoError(t, l.Append(LedgerEntry{Path: "/b", Outcome: "uploaded", FileHash: "bbb", HashAlgorithm: "blake3"}))
+	require.NoError(t, l.Append(LedgerEntry{Path: "/c", Outcome: "retry", FileHash: "ccc", HashAlgorithm: "sha256"}))
+
+	digests, err = l.uploadedDigests(10)
+	require.NoError(t, err)
+	assert.Equal(t, 2, digests.len())
+	assert.True(t, digests.has("/a", FileDigest{Algorithm: "sha256", Hex: "aaa"}))
+	assert.True(t, digests.has("/b", FileDigest{Algorithm: "blake3", Hex: "bbb"}))
+
+	digests, err = l.uploadedDigests(1)
+	require.NoError(t, err)
+	assert.False(t, digests.has("/a", FileDigest{Algorithm: "sha256", Hex: "aaa"}), "only the most recent are kept")
+}
+
+func TestLedger_UploadedSince(t *testing.T) {
+	l := NewLedger(filepath.Join(t.TempDir(), "ledger.jsonl"))
+	files, bytes, err := l.UploadedSince(time.Time{})
+	require.NoError(t, err)
+	assert.Zero(t, files)
+	assert.Zero(t, bytes)
+
+	require.NoError(t, l.Append(LedgerEntry{Outcome: "uploaded", SizeBytes: 100, UploadedAt: "2026-03-01T10:00:00Z"}))
+	require.NoError(t, l.Append(LedgerEntry{Outcome: "uploaded", SizeBytes: 200, UploadedAt: "2026-03-02T10:00:00Z"}))
+	require.NoError(t, l.Append(LedgerEntry{Outcome: "retry", SizeBytes: 400, UploadedAt: "2026-03-02T11:00:00Z"}))
+
+	files, bytes, err = l.UploadedSince(time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	assert.Equal(t, 1, files)
+	assert.Equal(t, int64(200), bytes)
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+)
+
+// defaultMaxLineBytes is the longest line validated when no limit is set.
+const defaultMaxLineBytes = 1024 * 1024
+
+// lineReader splits content into lines like bufio.Scanner, but reads past a
+// line longer than its limit instead of failing, so one oversized line does
+// not stop a whole file being read.
+type lineReader struct {
+	r     *bufio.Reader
+	limit int
+	buf   []byte
+}
+
+// newLineReader returns a lineReader for r that reports lines over limit bytes,
+// not counting the line ending, as too long. A non-positive limit selects
+// defaultMaxLineBytes.
+func newLineReader(r io.Reader, limit int) *lineReader {
+	if limit <= 0 {
+		limit = defaultMaxLineBytes
+	}
+	return &lineReader{r: bufio.NewReader(r), limit: limit}
+}
+
+// next returns the next line without its line ending, valid until the next
+// call. A line over the limit is consumed and returned as nil with tooLong
+// set. Returns io.EOF after the last line.
+func (lr *lineReader) next() (line []byte, tooLong bool, err error) {
+	lr.buf = lr.buf[:0]
+	read := 0
+	for {
+		chunk, err := lr.r.ReadSlice('\n')
+		read += len(chunk)
+		if !tooLong {
+			lr.buf = append(lr.buf, chunk...)
+			if len(lr.buf) > lr.limit+len("\r\n") {
+				tooLong, lr.buf = true, lr.buf[:0]
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err != nil && (!errors.Is(err, io.EOF) || read == 0) {
+			return nil, false, err
+		}
+		break
+	}
+	if tooLong {
+		return nil, true, nil
+	}
+	line = bytes.TrimSuffix(lr.buf, []byte("\n"))
+	line = bytes.TrimSuffix(line, []byte("\r"))
+	if len(line) > lr.limit {
+		return nil, true, nil
+	}
+	return line, false, nil
+}
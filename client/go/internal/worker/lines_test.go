@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAllLines(t *testing.T, lr *lineReader) []string {
+	t.Helper()
+	var out []string
+	for {
+		line, tooLong, err := lr.next()
+		if errors.Is(err, io.EOF) {
+			return out
+		}
+		require.NoError(t, err)
+		if tooLong {
+			out = append(out, "<too long>")
+		} else {
+			out = append(out, string(line))
+		}
+	}
+}
+
+func TestLineReader(t *testing.T) {
+	in := "short\r\n" + strings.Repeat("x", 11) + "\n\n" + "exactly10!\nlast"
+	assert.Equal(t, []string{"short", "<too long>", "", "exactly10!", "last"},
+		readAllLines(t, newLineReader(strings.NewReader(in), 10)))
+	assert.Empty(t, readAllLines(t, newLineReader(strings.NewReader(""), 10)))
+}
+
+func TestLineReader_BeyondBuffer(t *testing.T) {
+	// Longer than bufio's default buffer, on both sides of the limit.
+	long := strings.Repeat("y", 3*4096)
+	in := long + "\n" + long + "z\nok"
+	assert.Equal(t, []string{long, "<too long>", "ok"},
+		readAllLines(t, newLineReader(strings.NewReader(in), len(long))))
+
+	assert.Equal(t, defaultMaxLineBytes, newLineReader(strings.NewReader(""), 0).limit)
+	assert.Greater(t, defaultMaxLineBytes, bufio.MaxScanTokenSize)
+}
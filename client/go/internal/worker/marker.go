@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// UploadedMarkerSuffix is appended to a file's name to name the sidecar that
+// records its upload under the mark post-upload action.
+const UploadedMarkerSuffix = ".tokenly-uploaded"
+
+// UploadedMarker is the content of an uploaded-marker sidecar. Scans skip a
+// file while its size and mtime still match the marker's.
+type UploadedMarker struct {
+	UploadedAt    time.Time `json:"uploaded_at"`
+	HashAlgorithm string    `json:"hash_algorithm"`
+	FileHash      string    `json:"file_hash"`
+	SizeBytes     int64     `json:"size_bytes"`
+	ModifiedAt    time.Time `json:"modified_at"`
+}
+
+// markerPath returns the path of the sidecar for the file at path.
+func markerPath(path string) string {
+	return path + UploadedMarkerSuffix
+}
+
+// writeUploadedMarker writes the sidecar for the file at path, replacing any
+// earlier one.
+func writeUploadedMarker(path string, m UploadedMarker) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal uploaded marker: %w", err)
+	}
+	if err := os.WriteFile(markerPath(path), data, 0644); err != nil {
+		return fmt.Errorf("write uploaded marker: %w", err)
+	}
+	return nil
+}
+
+// hasUploadedMarker reports whether the file at path has a sidecar recording
+// an upload of it at this size and mtime. A missing or unreadable sidecar
+// counts as none.
+func hasUploadedMarker(path string, size int64, modTime time.Time) bool {
+	data, err := os.ReadFile(markerPath(path))
+	if err != nil {
+		return false
+	}
+	var m UploadedMarker
+	if err := json.Unmarshal(data, &m); err != nil {
+		return false
+	}
+	return m.SizeBytes == size && m.ModifiedAt.Equal(modTime)
+}
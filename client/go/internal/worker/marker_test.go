@@ -0,0 +1,34 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadedMarker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(validRecord()+"\n"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.False(t, hasUploadedMarker(path, info.Size(), info.ModTime()))
+
+	require.NoError(t, writeUploadedMarker(path, UploadedMarker{
+		UploadedAt:    time.Now().UTC(),
+		HashAlgorithm: "sha256",
+		FileHash:      "abc",
+		SizeBytes:     info.Size(),
+		ModifiedAt:    info.ModTime(),
+	}))
+	assert.FileExists(t, path+UploadedMarkerSuffix)
+	assert.True(t, hasUploadedMarker(path, info.Size(), info.ModTime()))
+	assert.False(t, hasUploadedMarker(path, info.Size()+1, info.ModTime()), "grown since upload")
+	assert.False(t, hasUploadedMarker(path, info.Size(), info.ModTime().Add(time.Second)))
+
+	require.NoError(t, os.WriteFile(markerPath(path), []byte("{"), 0644))
+	assert.False(t, hasUploadedMarker(path, info.Size(), info.ModTime()), "corrupt markers are ignored")
+}
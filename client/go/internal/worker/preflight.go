@@ -0,0 +1,145 @@
+package worker
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/ComputClaw/tokenly-client/internal/platform"
+)
+
+// Discovery path preflight statuses.
+const (
+	PathOK         = "ok"
+	PathMissing    = "missing"    // does not exist, or a glob with no matches
+	PathUnreadable = "unreadable" // exists but cannot be listed or opened
+)
+
+// PathCheck is the preflight result for one configured discovery path.
+type PathCheck struct {
+	Path     string // as configured, before env and ~ expansion
+	Status   string
+	Matches  int    // paths the glob expanded to (1 for literal paths)
+	Readable int    // matches that could be listed or opened
+	Error    string // first error seen, if any
+}
+
+// PreflightReport summarizes the reachability of the discovery paths.
+type PreflightReport struct {
+	CheckedAt time.Time
+	Paths     []PathCheck
+}
+
+// Unreachable returns the number of paths that are missing or unreadable.
+func (r *PreflightReport) Unreachable() int {
+	n := 0
+	for _, p := range r.Paths {
+		if p.Status != PathOK {
+			n++
+		}
+	}
+	return n
+}
+
+// Preflight checks that each discovery path exists and is readable, so
+// misconfiguration shows up at startup instead of as scans that silently
+// find nothing.
+func Preflight(paths []string) *PreflightReport {
+	report := &PreflightReport{CheckedAt: time.Now()}
+	for _, raw := range paths {
+		report.Paths = append(report.Paths, checkPath(raw))
+	}
+	return report
+}
+
+// checkPath expands and checks a single discovery path.
+func checkPath(raw string) PathCheck {
+	check := PathCheck{Path: raw, Status: PathMissing}
+
+	expanded := platform.ExpandPath(raw)
+	matches, err := doublestar.FilepathGlob(expanded)
+	if err != nil {
+		check.Error = err.Error()
+		return check
+	}
+	if len(matches) == 0 && !hasGlobMeta(expanded) {
+		matches = []string{expanded}
+	}
+
+	for _, m := range matches {
+		err := checkReadable(m)
+		if errors.Is(err, os.ErrNotExist) {
+			if check.Error == "" {
+				check.Error = err.Error()
+			}
+			continue
+		}
+		check.Matches++
+		if err != nil {
+			if check.Error == "" {
+				check.Error = err.Error()
+				if platform.IsPrivacyDenied(err) {
+					check.Error += " (macOS privacy protection; grant the agent Full Disk Access)"
+				}
+			}
+			continue
+		}
+		check.Readable++
+	}
+
+	switch {
+	case check.Readable > 0:
+		check.Status = PathOK
+	case check.Matches > 0:
+		check.Status = PathUnreadable
+	}
+	return check
+}
+
+// checkReadable lists a directory's first entry, or opens a file.
+func checkReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if _, err := f.Readdirnames(1); err != nil && err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasGlobMeta returns true if a path contains glob metacharacters.
+func hasGlobMeta(path string) bool {
+	for _, c := range path {
+		switch c {
+		case '*', '?', '[', '{':
+			return true
+		}
+	}
+	return false
+}
+
+// logPreflight writes a summary line and one warning per unreachable path.
+func logPreflight(logger *slog.Logger, report *PreflightReport) {
+	for _, p := range report.Paths {
+		if p.Status == PathOK {
+			continue
+		}
+		logger.Warn("discovery path unreachable", "path", p.Path, "status", p.Status,
+			"matches", p.Matches, "error", p.Error)
+	}
+	logger.Info("discovery path preflight", "paths", len(report.Paths),
+		"reachable", len(report.Paths)-report.Unreachable(), "unreachable", report.Unreachable())
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestPreflight(t *testing.T) {
+	base := t.TempDir()
+	logs := filepath.Join(base, "logs")
+	require.NoError(t, os.MkdirAll(filepath.Join(base, "opt", "app", "logs"), 0755))
+	require.NoError(t, os.MkdirAll(logs, 0755))
+	file := filepath.Join(base, "usage.jsonl")
+	require.NoError(t, os.WriteFile(file, []byte("{}"), 0644))
+
+	report := Preflight([]string{
+		logs,
+		file,
+		filepath.Join(base, "opt", "*", "logs"),
+		filepath.Join(base, "missing"),
+		filepath.Join(base, "srv", "*", "logs"),
+	})
+	require.Len(t, report.Paths, 5)
+
+	assert.Equal(t, PathOK, report.Paths[0].Status)
+	assert.Equal(t, PathOK, report.Paths[1].Status)
+	assert.Equal(t, PathOK, report.Paths[2].Status)
+	assert.Equal(t, 1, report.Paths[2].Matches)
+	assert.Equal(t, PathMissing, report.Paths[3].Status)
+	assert.NotEmpty(t, report.Paths[3].Error)
+	assert.Equal(t, PathMissing, report.Paths[4].Status, "glob with no matches")
+	assert.Equal(t, 2, report.Unreachable())
+}
+
+func TestPreflight_Unreadable(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("needs POSIX permissions and a non-root user")
+	}
+	dir := filepath.Join(t.TempDir(), "locked")
+	require.NoError(t, os.MkdirAll(dir, 0000))
+	t.Cleanup(func() { os.Chmod(dir, 0755) })
+
+	report := Preflight([]string{dir})
+	assert.Equal(t, PathUnreadable, report.Paths[0].Status)
+	assert.Equal(t, 1, report.Unreachable())
+}
+
+func TestWorker_PreflightReported(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	missing := filepath.Join(t.TempDir(), "missing")
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{
+		Linux:   config.PlainPaths(t.TempDir(), missing),
+		Windows: config.PlainPaths(t.TempDir(), missing),
+		Darwin:  config.PlainPaths(t.TempDir(), missing),
+	}
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+
+	w.runPreflight(cfg.Config)
+
+	st := w.Status()
+	assert.Len(t, st.DiscoveryPaths, 2)
+	assert.Equal(t, 1, st.UnreachablePaths)
+
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 2, report.DiscoveryPaths)
+	assert.Equal(t, 1, report.UnreachablePaths)
+}
@@ -0,0 +1,182 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// Upload modes.
+const (
+	// UploadModeDirect sends metadata and content to the ingest endpoint in one
+	// multipart request.
+	UploadModeDirect = "direct"
+	// UploadModePresigned asks the server for a pre-signed object storage URL,
+	// PUTs the content there, then confirms the upload with the API.
+	UploadModePresigned = "presigned"
+)
+
+// presignResponse is the server's answer to a presign request.
+type presignResponse struct {
+	UploadID  string            `json:"upload_id"`
+	UploadURL string            `json:"upload_url"`
+	Method    string            `json:"method,omitempty"`  // defaults to PUT
+	Headers   map[string]string `json:"headers,omitempty"` // must be sent with the object PUT
+	ExpiresAt string            `json:"expires_at,omitempty"`
+}
+
+// uploadPresigned performs the two-phase upload: presign, PUT to object
+// storage, confirm. If the server does not offer presigned uploads the file
+// is sent directly instead.
+func (u *Uploader) uploadPresigned(ctx context.Context, filePath string, meta *FileMetadata, metaJSON []byte) (*UploadResult, error) {
+	// Phase 1: request a pre-signed URL.
+	presign, result, err := u.requestPresign(ctx, metaJSON)
+	if err != nil || result != nil {
+		if result != nil && isPresignUnsupported(result.StatusCode) {
+			u.logger.Debug("presigned uploads not supported by server, sending directly",
+				"status", result.StatusCode)
+			return u.uploadMultipart(ctx, filePath, meta, metaJSON)
+		}
+		return result, err
+	}
+
+	// Phase 2: send the content to object storage.
+	sent, result := u.putObject(ctx, filePath, meta, presign)
+	if result != nil {
+		return result, nil
+	}
+
+	// Phase 3: confirm with the API so the server ingests the object.
+	body, err := json.Marshal(map[string]any{
+		"upload_id": presign.UploadID,
+		"metadata":  json.RawMessage(metaJSON),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal confirm request: %w", err)
+	}
+	req, err := u.newJSONRequest(ctx, u.ingestPath+"/confirm", body)
+	if err != nil {
+		return nil, fmt.Errorf("create confirm request: %w", err)
+	}
+
+	u.logger.Debug("confirming presigned upload", "path", filePath, "upload_id", presign.UploadID)
+	result, err = u.send(req)
+	if result != nil && result.StatusCode != 0 {
+		result.BytesSent = sent
+	}
+	return result, err
+}
+
+// requestPresign asks the server for an object storage URL. On anything other
+// than a usable 200 response it returns the mapped UploadResult instead.
+func (u *Uploader) requestPresign(ctx context.Context, metaJSON []byte) (*presignResponse, *UploadResult, error) {
+	body, err := json.Marshal(map[string]any{"metadata": json.RawMessage(metaJSON)})
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal presign request: %w", err)
+	}
+	req, err := u.newJSONRequest(ctx, u.ingestPath+"/presign", body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create presign request: %w", err)
+	}
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return nil, &UploadResult{ShouldRetry: true, Error: err.Error()}, nil
+	}
+	defer resp.Body.Close()
+
+	data, err := config.ReadLimited(resp.Body, u.maxResp)
+	if errors.Is(err, config.ErrResponseTooLarge) {
+		return nil, oversizedResult(resp.StatusCode, err), nil
+	}
+
+	if resp.StatusCode != 200 {
+		result := mapUploadResponse(resp)
+		result.ServerError = parseServerError(bytes.NewReader(data))
+		applyServerError(result)
+		return nil, result, nil
+	}
+
+	var presign presignResponse
+	if err := json.Unmarshal(data, &presign); err != nil ||
+		presign.UploadURL == "" || presign.UploadID == "" {
+		return nil, &UploadResult{
+			StatusCode:  resp.StatusCode,
+			ShouldRetry: true,
+			Error:       "invalid presign response",
+		}, nil
+	}
+	return &presign, nil, nil
+}
+
+// putObject uploads the file content to the pre-signed URL. Returns the
+// content bytes sent on success, or a retryable UploadResult describing the
+// failure. The client's extra API headers are deliberately not sent to
+// object storage.
+func (u *Uploader) putObject(ctx context.Context, filePath string, meta *FileMetadata, presign *presignResponse) (int64, *UploadResult) {
+	f, err := openUpload(filePath, meta)
+	if err != nil {
+		return 0, &UploadResult{Error: fmt.Sprintf("open file for upload: %v", err)}
+	}
+	defer f.Close()
+	content := &countingReader{r: u.watch(f)}
+
+	method := presign.Method
+	if method == "" {
+		method = http.MethodPut
+	}
+	req, err := http.NewRequestWithContext(ctx, method, presign.UploadURL, content)
+	if err != nil {
+		return 0, &UploadResult{Error: fmt.Sprintf("create object request: %v", err)}
+	}
+	req.ContentLength = meta.SizeBytes
+	for k, v := range presign.Headers {
+		req.Header.Set(k, v)
+	}
+
+	u.logger.Debug("uploading to object storage", "path", filePath, "upload_id", presign.UploadID)
+
+	resp, err := u.httpClient.Do(req)
+	if err != nil {
+		return 0, &UploadResult{ShouldRetry: true, Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	if _, err := config.ReadLimited(resp.Body, u.maxResp); errors.Is(err, config.ErrResponseTooLarge) {
+		return 0, oversizedResult(resp.StatusCode, err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// Expired or rejected URLs are recovered by presigning again next time.
+		return 0, &UploadResult{
+			StatusCode:  resp.StatusCode,
+			ShouldRetry: true,
+			Error:       fmt.Sprintf("object storage upload failed (%d)", resp.StatusCode),
+		}
+	}
+	return content.n, nil
+}
+
+// newJSONRequest builds a POST to an API path with the client's extra headers.
+func (u *Uploader) newJSONRequest(ctx context.Context, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, config.JoinURL(u.serverURL, path), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range u.headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// isPresignUnsupported reports whether a presign status means the server has
+// no presigned upload support.
+func isPresignUnsupported(status int) bool {
+	return status == http.StatusNotFound || status == http.StatusMethodNotAllowed ||
+		status == http.StatusNotImplemented
+}
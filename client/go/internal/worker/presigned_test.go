@@ -0,0 +1,144 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadPresigned_FullFlow(t *testing.T) {
+	var stored string
+	var confirmedID string
+	var storageGotTenant string
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "application/x-ndjson", r.Header.Get("Content-Type"))
+		storageGotTenant = r.Header.Get("X-Tenant-ID")
+		data, _ := io.ReadAll(r.Body)
+		stored = string(data)
+		w.WriteHeader(200)
+	}))
+	defer storage.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "acme", r.Header.Get("X-Tenant-ID"))
+		switch r.URL.Path {
+		case "/api/ingest/presign":
+			json.NewEncoder(w).Encode(presignResponse{
+				UploadID:  "up-1",
+				UploadURL: storage.URL + "/bucket/obj",
+				Headers:   map[string]string{"Content-Type": "application/x-ndjson"},
+			})
+		case "/api/ingest/confirm":
+			var body map[string]any
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			confirmedID, _ = body["upload_id"].(string)
+			assert.Contains(t, body, "metadata")
+			w.WriteHeader(200)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+			w.WriteHeader(500)
+		}
+	}))
+	defer api.Close()
+
+	u := NewUploader(api.URL, "test-host", testLogger())
+	u.SetUploadMode(UploadModePresigned)
+	u.SetHeaders(map[string]string{"X-Tenant-ID": "acme"})
+
+	path := createTestJSONLFile(t)
+	meta := testMeta()
+	meta.SizeBytes = 11
+	result, err := u.Upload(context.Background(), path, meta)
+	require.NoError(t, err)
+	assert.True(t, result.ShouldDelete)
+	assert.Equal(t, `{"line":1}`+"\n", stored)
+	assert.Equal(t, "up-1", confirmedID)
+	assert.Equal(t, int64(len(stored)), result.BytesSent)
+	assert.Empty(t, storageGotTenant, "API headers must not leak to object storage")
+}
+
+func TestUploadPresigned_FallsBackWhenUnsupported(t *testing.T) {
+	// 501 is what the reference server answers.
+	for _, status := range []int{404, 501} {
+		var direct bool
+		api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/api/ingest/presign":
+				w.WriteHeader(status)
+				w.Write([]byte(`{"error":"presign_not_supported","message":"use POST /api/ingest"}`))
+			case "/api/ingest":
+				direct = true
+				w.WriteHeader(200)
+			}
+		}))
+
+		u := NewUploader(api.URL, "test-host", testLogger())
+		u.SetUploadMode(UploadModePresigned)
+		result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+		api.Close()
+		require.NoError(t, err)
+		assert.True(t, direct, "status %d", status)
+		assert.True(t, result.ShouldDelete)
+	}
+}
+
+func TestUploadPresigned_StorageFailureRetries(t *testing.T) {
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(403)
+	}))
+	defer storage.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/ingest/confirm" {
+			t.Error("confirm must not be called after a failed object upload")
+		}
+		json.NewEncoder(w).Encode(presignResponse{UploadID: "up-1", UploadURL: storage.URL})
+	}))
+	defer api.Close()
+
+	u := NewUploader(api.URL, "test-host", testLogger())
+	u.SetUploadMode(UploadModePresigned)
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.True(t, result.ShouldRetry)
+	assert.False(t, result.ShouldDelete)
+}
+
+func TestUploadPresigned_OversizedPresignRetries(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"upload_id":"` + strings.Repeat("x", 2048) + `"}`))
+	}))
+	defer api.Close()
+
+	u := NewUploader(api.URL, "test-host", testLogger())
+	u.SetUploadMode(UploadModePresigned)
+	u.SetMaxResponseKB(1)
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.True(t, result.ShouldRetry)
+	assert.False(t, result.ShouldDelete)
+	assert.Contains(t, result.Error, "protocol error")
+}
+
+func TestUploadPresigned_AuthFailureStops(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(401)
+	}))
+	defer api.Close()
+
+	u := NewUploader(api.URL, "test-host", testLogger())
+	u.SetUploadMode(UploadModePresigned)
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.True(t, result.ShouldStopUploads)
+}
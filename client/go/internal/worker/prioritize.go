@@ -0,0 +1,118 @@
+package worker
+
+import (
+	"math"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Prioritization strategies for scan candidates.
+const (
+	// PrioritizeOldest processes the least recently modified files first, for
+	// strict chronological backfill.
+	PrioritizeOldest = "oldest"
+	// PrioritizeNewest processes the most recently modified files first, to
+	// get fresh data to the server soonest.
+	PrioritizeNewest = "newest"
+	// PrioritizeLargest processes the largest files first.
+	PrioritizeLargest = "largest"
+	// PrioritizeSmallest processes the smallest files first.
+	PrioritizeSmallest = "smallest"
+	// PrioritizeWeighted processes files from high-yield directories first;
+	// see WeightedPrioritizer.
+	PrioritizeWeighted = "weighted"
+)
+
+// Prioritizer orders scan candidates, most important first. When a scan finds
+// more than MaxFiles candidates, only the first MaxFiles are kept.
+type Prioritizer interface {
+	Prioritize(candidates []FileCandidate, now time.Time)
+}
+
+// newPrioritizer returns the prioritizer for a strategy name, defaulting to
+// PrioritizeOldest.
+func newPrioritizer(strategy string, learner *Learner) Prioritizer {
+	switch strategy {
+	case PrioritizeWeighted:
+		return &WeightedPrioritizer{Learner: learner, DirWeight: 0.5, SizeWeight: 0.2, AgeWeight: 0.3}
+	case PrioritizeNewest:
+		return SortedBy(func(a, b FileCandidate) bool { return a.ModifiedAt.After(b.ModifiedAt) })
+	case PrioritizeLargest:
+		return SortedBy(func(a, b FileCandidate) bool { return a.SizeBytes > b.SizeBytes })
+	case PrioritizeSmallest:
+		return SortedBy(func(a, b FileCandidate) bool { return a.SizeBytes < b.SizeBytes })
+	default:
+		return OldestFirst{}
+	}
+}
+
+// OldestFirst orders candidates by modification time, oldest first.
+type OldestFirst struct{}
+
+// Prioritize implements Prioritizer.
+func (OldestFirst) Prioritize(candidates []FileCandidate, _ time.Time) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].ModifiedAt.Before(candidates[j].ModifiedAt)
+	})
+}
+
+// SortedBy orders candidates so that a comes before b when less(a, b).
+// Candidates less does not order are kept oldest first.
+type SortedBy func(a, b FileCandidate) bool
+
+// Prioritize implements Prioritizer.
+func (less SortedBy) Prioritize(candidates []FileCandidate, now time.Time) {
+	OldestFirst{}.Prioritize(candidates, now)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return less(candidates[i], candidates[j])
+	})
+}
+
+// WeightedPrioritizer orders candidates by a weighted sum of three scores in
+// [0, 1]: the learner's score for the parent directory, the file size, and
+// the file age, each relative to the largest in the batch. Larger and older
+// files rank higher; ties fall back to oldest first.
+type WeightedPrioritizer struct {
+	Learner    *Learner // nil scores every directory 0
+	DirWeight  float64
+	SizeWeight float64
+	AgeWeight  float64
+}
+
+// Prioritize implements Prioritizer.
+func (p *WeightedPrioritizer) Prioritize(candidates []FileCandidate, now time.Time) {
+	var maxSize int64
+	var maxAge time.Duration
+	dirScores := make(map[string]float64)
+	for _, c := range candidates {
+		maxSize = max(maxSize, c.SizeBytes)
+		maxAge = max(maxAge, now.Sub(c.ModifiedAt))
+		dir := filepath.Dir(c.Path)
+		if _, ok := dirScores[dir]; !ok && p.Learner != nil {
+			// Squash the unbounded files-per-scan score into [0, 1).
+			s := p.Learner.DirScore(dir)
+			dirScores[dir] = s / (1 + s)
+		}
+	}
+
+	scores := make(map[string]float64, len(candidates))
+	for _, c := range candidates {
+		score := p.DirWeight * dirScores[filepath.Dir(c.Path)]
+		if maxSize > 0 {
+			score += p.SizeWeight * math.Log1p(float64(c.SizeBytes)) / math.Log1p(float64(maxSize))
+		}
+		if maxAge > 0 {
+			score += p.AgeWeight * max(0, float64(now.Sub(c.ModifiedAt))) / float64(maxAge)
+		}
+		scores[c.Path] = score
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		si, sj := scores[candidates[i].Path], scores[candidates[j].Path]
+		if si != sj {
+			return si > sj
+		}
+		return candidates[i].ModifiedAt.Before(candidates[j].ModifiedAt)
+	})
+}
@@ -0,0 +1,109 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOldestFirst(t *testing.T) {
+	now := time.Now()
+	c := []FileCandidate{
+		{Path: "/b", ModifiedAt: now.Add(-time.Hour)},
+		{Path: "/a", ModifiedAt: now.Add(-2 * time.Hour)},
+		{Path: "/c", ModifiedAt: now},
+	}
+	OldestFirst{}.Prioritize(c, now)
+	assert.Equal(t, []string{"a", "b", "c"}, candidateNames(c))
+}
+
+func TestWeightedPrioritizer_PrefersHighYieldDirectories(t *testing.T) {
+	learner, err := NewLearner(filepath.Join(t.TempDir(), "learning.json"), testLogger())
+	require.NoError(t, err)
+	learner.UpdateAfterScan("/busy", 10, 0)
+	learner.UpdateAfterScan("/quiet", 0, 0)
+
+	now := time.Now()
+	c := []FileCandidate{
+		{Path: "/quiet/old.jsonl", SizeBytes: 100, ModifiedAt: now.Add(-time.Hour)},
+		{Path: "/busy/new.jsonl", SizeBytes: 100, ModifiedAt: now},
+	}
+	p := newPrioritizer(PrioritizeWeighted, learner)
+	p.Prioritize(c, now)
+	assert.Equal(t, []string{"new.jsonl", "old.jsonl"}, candidateNames(c))
+
+	// Without learner data, larger and older files go first.
+	c = []FileCandidate{
+		{Path: "/x/small.jsonl", SizeBytes: 10, ModifiedAt: now},
+		{Path: "/x/large.jsonl", SizeBytes: 10000, ModifiedAt: now},
+		{Path: "/x/old.jsonl", SizeBytes: 10000, ModifiedAt: now.Add(-time.Hour)},
+	}
+	(&WeightedPrioritizer{SizeWeight: 0.2, AgeWeight: 0.3}).Prioritize(c, now)
+	assert.Equal(t, []string{"old.jsonl", "large.jsonl", "small.jsonl"}, candidateNames(c))
+}
+
+func TestScan_UsesPrioritizer(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"c.jsonl", "a.jsonl", "b.jsonl"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+		mt := now.Add(-time.Duration(i+1) * time.Minute)
+		require.NoError(t, os.Chtimes(path, mt, mt))
+	}
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths: []string{dir},
+		FilePatterns:   []string{"*.jsonl"},
+	}, nil, testLogger())
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.jsonl", "a.jsonl", "c.jsonl"}, candidateNames(candidates), "oldest first by default")
+
+	sc.SetPrioritizer(byName{})
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl", "b.jsonl", "c.jsonl"}, candidateNames(candidates))
+}
+
+// byName orders candidates by path, to check that Scan honors the prioritizer.
+type byName struct{}
+
+func (byName) Prioritize(c []FileCandidate, _ time.Time) {
+	for i := range c {
+		for j := i + 1; j < len(c); j++ {
+			if c[j].Path < c[i].Path {
+				c[i], c[j] = c[j], c[i]
+			}
+		}
+	}
+}
+
+func TestNewPrioritizer_Orders(t *testing.T) {
+	now := time.Now()
+	batch := func() []FileCandidate {
+		return []FileCandidate{
+			{Path: "/mid", SizeBytes: 20, ModifiedAt: now.Add(-2 * time.Hour)},
+			{Path: "/new", SizeBytes: 10, ModifiedAt: now},
+			{Path: "/old", SizeBytes: 30, ModifiedAt: now.Add(-3 * time.Hour)},
+			{Path: "/old-small", SizeBytes: 10, ModifiedAt: now.Add(-4 * time.Hour)},
+		}
+	}
+	tests := map[string][]string{
+		PrioritizeOldest:   {"old-small", "old", "mid", "new"},
+		PrioritizeNewest:   {"new", "mid", "old", "old-small"},
+		PrioritizeLargest:  {"old", "mid", "old-small", "new"},
+		PrioritizeSmallest: {"old-small", "new", "mid", "old"},
+		"unknown":          {"old-small", "old", "mid", "new"},
+	}
+	for strategy, want := range tests {
+		c := batch()
+		newPrioritizer(strategy, nil).Prioritize(c, now)
+		assert.Equal(t, want, candidateNames(c), strategy)
+	}
+}
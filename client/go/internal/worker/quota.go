@@ -0,0 +1,73 @@
+package worker
+
+import "time"
+
+// dailyQuota tracks uploads against the per-day file and byte caps. Days roll
+// over at midnight UTC. Files are reserved before their upload starts so that
+// concurrent uploads cannot overshoot the cap. It is not safe for concurrent
+// use; the Worker guards it with its mutex.
+type dailyQuota struct {
+	maxFiles int
+	maxBytes int64
+
+	day      string
+	files    int
+	bytes    int64
+	capped   bool             // a file was refused today
+	reserved map[string]int64 // in-flight uploads: path → size
+}
+
+func newDailyQuota(maxFiles, maxMB int) *dailyQuota {
+	return &dailyQuota{
+		maxFiles: maxFiles,
+		maxBytes: int64(maxMB) * 1024 * 1024,
+		reserved: make(map[string]int64),
+	}
+}
+
+// roll resets the counters when the UTC day changes. In-flight reservations
+// carry over.
+func (q *dailyQuota) roll(now time.Time) {
+	day := now.UTC().Format("2006-01-02")
+	if day != q.day {
+		q.day = day
+		q.files = 0
+		q.bytes = 0
+		q.capped = false
+	}
+}
+
+// reserve claims room for a file under today's caps. It returns false, and
+// marks the day as capped, if the file would exceed either cap.
+func (q *dailyQuota) reserve(path string, size int64, now time.Time) bool {
+	q.roll(now)
+
+	files, bytes := q.files+len(q.reserved), q.bytes
+	for _, s := range q.reserved {
+		bytes += s
+	}
+	if (q.maxFiles > 0 && files+1 > q.maxFiles) || (q.maxBytes > 0 && bytes+size > q.maxBytes) {
+		q.capped = true
+		return false
+	}
+	q.reserved[path] = size
+	return true
+}
+
+// commit counts a reserved file as uploaded.
+func (q *dailyQuota) commit(path string, now time.Time) {
+	size, ok := q.reserved[path]
+	if !ok {
+		return
+	}
+	delete(q.reserved, path)
+	q.roll(now)
+	q.files++
+	q.bytes += size
+}
+
+// release drops a reservation that did not result in an upload. It is a
+// no-op for files already committed.
+func (q *dailyQuota) release(path string) {
+	delete(q.reserved, path)
+}
@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDailyQuota_FileCap(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newDailyQuota(2, 0)
+
+	assert.True(t, q.reserve("/a", 10, now))
+	q.commit("/a", now)
+	assert.True(t, q.reserve("/b", 10, now))
+	q.commit("/b", now)
+	assert.False(t, q.reserve("/c", 10, now))
+	assert.True(t, q.capped)
+	assert.Equal(t, 2, q.files)
+}
+
+func TestDailyQuota_ReservationsCountTowardCap(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newDailyQuota(1, 0)
+
+	assert.True(t, q.reserve("/a", 10, now))
+	assert.False(t, q.reserve("/b", 10, now), "in-flight upload must count")
+
+	q.release("/a")
+	assert.True(t, q.reserve("/b", 10, now))
+	assert.Zero(t, q.files)
+}
+
+func TestDailyQuota_ByteCap(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	q := newDailyQuota(0, 1)
+
+	assert.True(t, q.reserve("/a", 512*1024, now))
+	q.commit("/a", now)
+	assert.False(t, q.reserve("/b", 600*1024, now))
+	assert.True(t, q.reserve("/c", 100*1024, now))
+}
+
+func TestDailyQuota_RollsOverAtMidnightUTC(t *testing.T) {
+	day1 := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	q := newDailyQuota(1, 0)
+	q.reserve("/a", 10, day1)
+	q.commit("/a", day1)
+	assert.False(t, q.reserve("/b", 10, day1))
+
+	day2 := day1.Add(2 * time.Minute)
+	assert.True(t, q.reserve("/b", 10, day2))
+	assert.False(t, q.capped)
+	assert.Zero(t, q.files)
+}
+
+func TestDailyQuota_Unlimited(t *testing.T) {
+	q := newDailyQuota(0, 0)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		path := string(rune('a' + i%26))
+		q.reserve(path, 1<<30, now)
+		q.commit(path, now)
+	}
+	assert.True(t, q.reserve("/z", 1<<30, now))
+}
@@ -0,0 +1,61 @@
+package worker
+
+import (
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// rotation splits a file name following the numbered rotation convention,
+// e.g. "usage.jsonl.2.gz", into the live file's name ("usage.jsonl") and the
+// rotation number (2). Names without a rotation number return themselves and
+// 0.
+func rotation(name string) (string, int) {
+	plain := trimGzip(name)
+	i := strings.LastIndexByte(plain, '.')
+	if i <= 0 {
+		return plain, 0
+	}
+	suffix := plain[i+1:]
+	n, err := strconv.Atoi(suffix)
+	if err != nil || n <= 0 || suffix[0] == '+' {
+		return plain, 0
+	}
+	return plain[:i], n
+}
+
+// orderRotations reorders rotations of the same log among the positions they
+// already hold, so higher-numbered (older) rotations come first and the live
+// file last. Records then reach the server roughly in the order written,
+// while the prioritizer still decides where in the list each log goes.
+func orderRotations(candidates []FileCandidate) {
+	type member struct {
+		pos int
+		n   int
+	}
+	groups := make(map[string][]member)
+	for i, c := range candidates {
+		base, n := rotation(filepath.Base(c.Path))
+		key := filepath.Join(filepath.Dir(c.Path), base)
+		groups[key] = append(groups[key], member{pos: i, n: n})
+	}
+
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		files := make([]FileCandidate, len(members))
+		for i, m := range members {
+			files[i] = candidates[m.pos]
+		}
+		sort.SliceStable(files, func(i, j int) bool {
+			_, ni := rotation(filepath.Base(files[i].Path))
+			_, nj := rotation(filepath.Base(files[j].Path))
+			return ni > nj
+		})
+		for i, m := range members {
+			candidates[m.pos] = files[i]
+		}
+	}
+}
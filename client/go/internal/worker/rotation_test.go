@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		live string
+		n    int
+	}{
+		{"usage.jsonl", "usage.jsonl", 0},
+		{"usage.jsonl.1", "usage.jsonl", 1},
+		{"usage.jsonl.12.gz", "usage.jsonl", 12},
+		{"usage.jsonl.gz", "usage.jsonl", 0},
+		{"usage.jsonl.0", "usage.jsonl.0", 0},
+		{"usage.jsonl.+1", "usage.jsonl.+1", 0},
+		{".1", ".1", 0},
+	}
+	for _, tt := range tests {
+		live, n := rotation(tt.name)
+		assert.Equal(t, tt.live, live, tt.name)
+		assert.Equal(t, tt.n, n, tt.name)
+	}
+}
+
+func TestOrderRotations(t *testing.T) {
+	c := []FileCandidate{
+		{Path: "/logs/usage.jsonl"},
+		{Path: "/logs/other.jsonl"},
+		{Path: "/logs/usage.jsonl.1"},
+		{Path: "/logs/usage.jsonl.2.gz"},
+		{Path: "/elsewhere/usage.jsonl.3"},
+	}
+	orderRotations(c)
+	assert.Equal(t, []string{"/logs/usage.jsonl.2.gz", "/logs/other.jsonl", "/logs/usage.jsonl.1", "/logs/usage.jsonl",
+		"/elsewhere/usage.jsonl.3"}, candidatePaths(c))
+}
+
+func TestScan_MatchRotated(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	// The live file gets the oldest mtime, so mtime order alone would send it
+	// first.
+	for i, name := range []string{"usage.jsonl", "usage.jsonl.1", "usage.jsonl.2.gz", "usage.jsonl.bak"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+		mt := now.Add(-time.Duration(10-i) * time.Minute)
+		require.NoError(t, os.Chtimes(path, mt, mt))
+	}
+
+	cfg := ScannerConfig{DiscoveryPaths: []string{dir}, FilePatterns: []string{"*.jsonl"}}
+	candidates, _, err := NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.jsonl"}, candidateNames(candidates))
+
+	cfg.MatchRotated = true
+	candidates, _, err = NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.jsonl.2.gz", "usage.jsonl.1", "usage.jsonl"}, candidateNames(candidates))
+}
+
+func candidatePaths(candidates []FileCandidate) []string {
+	var paths []string
+	for _, c := range candidates {
+		paths = append(paths, c.Path)
+	}
+	return paths
+}
@@ -0,0 +1,89 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// sanitizedPattern names the sanitized copies written by sanitizeFile.
+const sanitizedPattern = "tokenly-sanitized-*.jsonl"
+
+// sanitizeFile writes the valid records of a partially valid file after its
+// first skip lines, which were sent before, to a new JSONL file in dir and
+// returns its path, with the validation result for the lines it covers; the
+// caller removes it. The original is not modified. Records are checked as
+// ValidateTaggedJSONLFile does.
+func sanitizeFile(dir, path string, tagger *ProviderTagger, rules *RecordValidator, conv *CSVConverter, skip int) (string, *ValidationResult, error) {
+	tmp, err := os.CreateTemp(dir, sanitizedPattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("create sanitized copy: %w", err)
+	}
+	w := bufio.NewWriter(tmp)
+	result, err := validateRecords(path, tagger, rules, conv, w, skip)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", nil, fmt.Errorf("write sanitized copy: %w", err)
+	}
+	return tmp.Name(), result, nil
+}
+
+// resumes reports whether a sanitized copy made after skipping the lines
+// recorded in done follows on from them: the file grew rather than being
+// rewritten.
+func (r *ValidationResult) resumes(done config.SanitizedEntry) bool {
+	return r.skipped == done.Lines && r.prefixHash == done.LinesHash
+}
+
+// removeStaleCopies deletes the sanitized copies in dir older than maxAge,
+// left behind by a worker that stopped mid-upload. Returns the number
+// deleted.
+func removeStaleCopies(dir string, maxAge time.Duration, now time.Time) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("read scratch dir: %w", err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if ok, _ := filepath.Match(sanitizedPattern, entry.Name()); !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return removed, fmt.Errorf("remove stale copy: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// describeOriginal points metadata built from a sanitized copy back at the
+// file it was made from, so the server sees the original's name and times.
+func describeOriginal(meta *FileMetadata, original FileCandidate) {
+	name := trimGzip(filepath.Base(original.Path))
+	if isCSV(original.Path) {
+		name = csvUploadName(name)
+	}
+	meta.OriginalPath = original.Path
+	meta.Directory = filepath.Dir(original.Path)
+	meta.Filename = name
+	meta.ModifiedAt = original.ModifiedAt.UTC().Format(time.RFC3339)
+	meta.CreatedAt = meta.ModifiedAt
+	meta.Sanitized = true
+}
@@ -0,0 +1,178 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestSanitizeFile(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "mixed.jsonl", []string{invalidRecord(), validRecord(), "junk", invalidRecord()})
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	copyPath, result, err := sanitizeFile(t.TempDir(), path, nil, nil, nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 4, result.lines)
+	data, err := os.ReadFile(copyPath)
+	require.NoError(t, err)
+	assert.Equal(t, validRecord()+"\n", string(data))
+
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, original, after, "the original is not modified")
+
+	_, _, err = sanitizeFile(t.TempDir(), filepath.Join(dir, "missing.jsonl"), nil, nil, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestSanitizeFile_Resumes(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "mixed.jsonl", []string{validRecord(), "junk"})
+	_, first, err := sanitizeFile(t.TempDir(), path, nil, nil, nil, 0)
+	require.NoError(t, err)
+	done := config.SanitizedEntry{Lines: first.lines, LinesHash: first.linesHash}
+
+	writeJSONLFile(t, dir, "mixed.jsonl", []string{validRecord(), "junk", invalidRecord(), validRecord()})
+	copyPath, part, err := sanitizeFile(t.TempDir(), path, nil, nil, nil, done.Lines)
+	require.NoError(t, err)
+	assert.True(t, part.resumes(done), "the file grew")
+	assert.Equal(t, 1, part.ValidRecords)
+	require.Len(t, part.Rejections, 1)
+	assert.Equal(t, 3, part.Rejections[0].Line, "line numbers are in the original file")
+	data, err := os.ReadFile(copyPath)
+	require.NoError(t, err)
+	assert.Equal(t, validRecord()+"\n", string(data))
+
+	writeJSONLFile(t, dir, "mixed.jsonl", []string{"junk", validRecord(), validRecord()})
+	_, part, err = sanitizeFile(t.TempDir(), path, nil, nil, nil, done.Lines)
+	require.NoError(t, err)
+	assert.False(t, part.resumes(done), "the file was rewritten")
+
+	writeJSONLFile(t, dir, "mixed.jsonl", []string{validRecord()})
+	_, part, err = sanitizeFile(t.TempDir(), path, nil, nil, nil, done.Lines)
+	require.NoError(t, err)
+	assert.False(t, part.resumes(done), "the file shrank")
+}
+
+func TestRemoveStaleCopies(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	stale := filepath.Join(dir, "tokenly-sanitized-1.jsonl")
+	fresh := filepath.Join(dir, "tokenly-sanitized-2.jsonl")
+	other := filepath.Join(dir, "state.json")
+	for _, p := range []string{stale, fresh, other} {
+		require.NoError(t, os.WriteFile(p, []byte("x"), 0644))
+		require.NoError(t, os.Chtimes(p, now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	}
+	require.NoError(t, os.Chtimes(fresh, now, now))
+
+	n, err := removeStaleCopies(dir, time.Hour, now)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh)
+	assert.FileExists(t, other)
+
+	n, err = removeStaleCopies(filepath.Join(dir, "missing"), time.Hour, now)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestDescribeOriginal(t *testing.T) {
+	meta := &FileMetadata{OriginalPath: "/state/tokenly-sanitized-1.jsonl", Filename: "tokenly-sanitized-1.jsonl"}
+	candidate := FileCandidate{Path: filepath.Join("logs", "usage.csv.gz")}
+	describeOriginal(meta, candidate)
+	assert.Equal(t, candidate.Path, meta.OriginalPath)
+	assert.Equal(t, "logs", meta.Directory)
+	assert.Equal(t, "usage.jsonl", meta.Filename)
+	assert.True(t, meta.Sanitized)
+}
+
+func TestWorker_SanitizesPartiallyValidFiles(t *testing.T) {
+	var bodies []string
+	var sanitized []bool
+	var rejected [][]int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(f)
+		bodies = append(bodies, string(data))
+		var meta struct {
+			FileInfo struct {
+				Sanitized bool `json:"sanitized"`
+			} `json:"file_info"`
+			Validation struct {
+				RejectedLines []struct {
+					Line int `json:"line"`
+				} `json:"rejected_lines"`
+			} `json:"validation"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("metadata")), &meta))
+		sanitized = append(sanitized, meta.FileInfo.Sanitized)
+		var lines []int
+		for _, rl := range meta.Validation.RejectedLines {
+			lines = append(lines, rl.Line)
+		}
+		rejected = append(rejected, lines)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	path := writeJSONLFile(t, dir, "mostly-junk.jsonl", []string{"junk", invalidRecord(), invalidRecord(), validRecord()})
+
+	// Below the validity threshold and not sanitizing: nothing is sent.
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+	assert.Empty(t, bodies)
+
+	cfg.Config.SanitizeInvalidLines = true
+	w, err = NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	require.Len(t, bodies, 1)
+	assert.Equal(t, validRecord()+"\n", bodies[0])
+	assert.Equal(t, []bool{true}, sanitized)
+	assert.Equal(t, []int{1, 2, 3}, rejected[0])
+	assert.FileExists(t, path, "the original is left in place")
+
+	leftovers, err := filepath.Glob(filepath.Join(filepath.Dir(cfg.StatePath), "tokenly-sanitized-*"))
+	require.NoError(t, err)
+	assert.Empty(t, leftovers, "the sanitized copy is removed")
+
+	// The next cycle finds the same valid content and does not send it again.
+	w.runScanCycle(context.Background())
+	assert.Len(t, bodies, 1)
+	assert.False(t, strings.Contains(bodies[0], "junk"))
+
+	// Once the file grows, only its new valid lines are sent.
+	writeJSONLFile(t, dir, "mostly-junk.jsonl", []string{"junk", invalidRecord(), invalidRecord(), validRecord(),
+		validRecord(), "more junk"})
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, later, later))
+	w, err = NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+	require.Len(t, bodies, 2)
+	assert.Equal(t, validRecord()+"\n", bodies[1])
+	assert.Equal(t, []int{6}, rejected[1], "line numbers are in the original file")
+}
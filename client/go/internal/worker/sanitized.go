@@ -0,0 +1,91 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// maxSanitizedEntries caps the files whose sanitized upload progress is kept;
+// the ones uploaded longest ago are dropped first.
+const maxSanitizedEntries = 1000
+
+// SanitizedProgress remembers how many lines of each file kept in place after
+// a sanitized upload have been sent, so that when the file grows only its new
+// lines are. It is safe for concurrent use.
+type SanitizedProgress struct {
+	mu       sync.Mutex
+	data     *config.SanitizedFile
+	savePath string
+	dirty    bool
+}
+
+// OpenSanitizedProgress loads the progress saved at savePath, or starts empty.
+// Corrupt progress is discarded: files are then sent in full once more.
+func OpenSanitizedProgress(savePath string, logger *slog.Logger) (*SanitizedProgress, error) {
+	data, err := config.LoadSanitized(savePath)
+	switch {
+	case errors.Is(err, config.ErrCacheCorrupt):
+		logger.Warn("sanitized upload progress corrupt, starting empty", "path", savePath, "error", err)
+		return &SanitizedProgress{data: config.NewSanitizedFile(), savePath: savePath, dirty: true}, nil
+	case err != nil:
+		return nil, fmt.Errorf("load sanitized progress: %w", err)
+	}
+	return &SanitizedProgress{data: data, savePath: savePath}, nil
+}
+
+// Get returns the progress recorded for path; the zero entry if none.
+func (p *SanitizedProgress) Get(path string) config.SanitizedEntry {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.data.Files[path]
+}
+
+// Set records that the first lines of path, hashing to linesHash, are sent.
+func (p *SanitizedProgress) Set(path string, lines int, linesHash string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.data.Files[path] = config.SanitizedEntry{Lines: lines, LinesHash: linesHash, UploadedAt: time.Now().UTC()}
+	for len(p.data.Files) > maxSanitizedEntries {
+		p.evictOldest()
+	}
+	p.dirty = true
+}
+
+// evictOldest drops the entry uploaded longest ago. Callers hold mu.
+func (p *SanitizedProgress) evictOldest() {
+	var oldest string
+	var at time.Time
+	for path, entry := range p.data.Files {
+		if oldest == "" || entry.UploadedAt.Before(at) {
+			oldest, at = path, entry.UploadedAt
+		}
+	}
+	delete(p.data.Files, oldest)
+}
+
+// Save drops entries for files that no longer exist and persists the
+// progress if it changed since it was loaded or last saved.
+func (p *SanitizedProgress) Save() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for path := range p.data.Files {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			delete(p.data.Files, path)
+			p.dirty = true
+		}
+	}
+	if !p.dirty {
+		return nil
+	}
+	if err := p.data.Save(p.savePath); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
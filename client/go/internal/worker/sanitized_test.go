@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSanitizedProgress_PersistsAndForgetsMissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	savePath := filepath.Join(dir, "sanitized.json")
+	kept := writeJSONLFile(t, dir, "kept.jsonl", []string{validRecord()})
+	gone := filepath.Join(dir, "gone.jsonl")
+
+	p, err := OpenSanitizedProgress(savePath, testLogger())
+	require.NoError(t, err)
+	p.Set(kept, 1, "h1")
+	p.Set(gone, 3, "h3")
+	require.NoError(t, p.Save())
+
+	p, err = OpenSanitizedProgress(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Equal(t, 1, p.Get(kept).Lines)
+	assert.Equal(t, "h1", p.Get(kept).LinesHash)
+	assert.Zero(t, p.Get(gone), "progress for a file that no longer exists is dropped")
+}
+
+func TestSanitizedProgress_CorruptStartsEmpty(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "sanitized.json")
+	require.NoError(t, os.WriteFile(savePath, []byte("{nope"), 0644))
+
+	p, err := OpenSanitizedProgress(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Zero(t, p.Get("/var/log/usage.jsonl"))
+	require.NoError(t, p.Save())
+	_, err = OpenSanitizedProgress(savePath, testLogger())
+	assert.NoError(t, err, "the corrupt file is replaced")
+}
+
+func TestSanitizedProgress_EvictsOldest(t *testing.T) {
+	p, err := OpenSanitizedProgress(filepath.Join(t.TempDir(), "sanitized.json"), testLogger())
+	require.NoError(t, err)
+	for i := 0; i <= maxSanitizedEntries; i++ {
+		p.Set(fmt.Sprintf("/logs/%d.jsonl", i), i, "")
+	}
+	assert.Len(t, p.data.Files, maxSanitizedEntries)
+}
@@ -3,39 +3,120 @@ package worker
 import (
 	"context"
 	"fmt"
+	"io/fs"
 	"log/slog"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/ComputClaw/tokenly-client/internal/platform"
 )
 
 // FileCandidate represents a file discovered during scanning.
 type FileCandidate struct {
-	Path       string
-	SizeBytes  int64
-	ModifiedAt time.Time
+	Path         string
+	SizeBytes    int64
+	ModifiedAt   time.Time
+	DiscoveredAt time.Time
 }
 
 // ScannerConfig holds settings that control file discovery.
 type ScannerConfig struct {
 	DiscoveryPaths  []string
 	FilePatterns    []string
-	ExcludePatterns []string
+	ExcludePatterns []string // patterns containing "/" match the full path; see excludedPath
 	MaxFileAgeHours int
 	MaxFileSizeMB   int
 	MaxDepth        int
 	MaxFiles        int
+	ExcludeDirs     []string // directories never descended into, e.g. the agent's own
+	ExcludeFiles    []string // files never collected, as paths or glob patterns
+	SymlinkPolicy   string   // SymlinkFollow (default) or SymlinkSkip
+	Parallelism     int      // discovery roots walked concurrently (default 4)
+
+	// QuiescenceSeconds holds back recently modified files that may still be
+	// being written; see settleTracker. 0 disables the check.
+	QuiescenceSeconds int
+
+	// SniffMaxBytes enables content sniffing: files matching no file pattern
+	// but at most this large are included if their first SniffLines lines
+	// look like token records under Schema (nil for the default schema).
+	// 0 disables sniffing.
+	SniffMaxBytes int64
+	SniffLines    int
+	Schema        *config.ValidationSchema
+
+	// NetworkFSPolicy decides how directories on network or FUSE filesystems
+	// are walked: NetworkFSLimit (default), NetworkFSSkip, or NetworkFSScan.
+	// Under NetworkFSLimit the walk stops NetworkMaxDepth levels below the
+	// mount, or NetworkMaxTime after entering it.
+	NetworkFSPolicy string
+	NetworkMaxDepth int
+	NetworkMaxTime  time.Duration
+
+	// MatchRotated makes numbered rotations of a matching file match too, e.g.
+	// "usage.jsonl.1" and "usage.jsonl.2.gz" for "*.jsonl", and processes
+	// rotations of one log oldest first.
+	MatchRotated bool
+
+	// CaseInsensitive matches file and exclude patterns ignoring case, e.g.
+	// "*.jsonl" matches "USAGE.JSONL". See CaseInsensitivePatterns.
+	CaseInsensitive bool
+
+	// Prioritization names the strategy ordering candidates: PrioritizeOldest
+	// (default), PrioritizeNewest, PrioritizeLargest, PrioritizeSmallest, or
+	// PrioritizeWeighted. See also Scanner.SetPrioritizer.
+	Prioritization string
+
+	// PathOverrides replace MaxDepth and the patterns under specific
+	// discovery paths; see Scanner.rulesFor.
+	PathOverrides []config.DiscoveryPath
 }
 
+// Symlink policies for entries found while walking directories. Discovery
+// paths that are themselves symlinks are always followed.
+const (
+	// SymlinkFollow follows symlinked files and directories. Loops and files
+	// reachable by several paths are detected by filesystem identity.
+	SymlinkFollow = "follow"
+	// SymlinkSkip ignores symlinked files and directories.
+	SymlinkSkip = "skip"
+)
+
+// Network filesystem policies. Walking mounted shares is slow, so by default
+// the walk through one is cut short.
+const (
+	// NetworkFSLimit walks network filesystems with tighter depth and time
+	// limits.
+	NetworkFSLimit = "limit"
+	// NetworkFSSkip never walks directories on network filesystems.
+	NetworkFSSkip = "skip"
+	// NetworkFSScan walks network filesystems like local ones.
+	NetworkFSScan = "scan"
+)
+
 // Scanner discovers JSONL files on the local filesystem.
 type Scanner struct {
-	config  ScannerConfig
-	learner *Learner
-	logger  *slog.Logger
+	config   ScannerConfig
+	learner  *Learner
+	spool    *RetrySpool
+	index    *ScanIndex
+	unclean  *UncleanableList
+	settle   *settleTracker // nil when the quiescence check is disabled
+	priority Prioritizer
+	records  *RecordValidator // for content sniffing
+	logger   *slog.Logger
+
+	remoteFS func(path string) string // platform.RemoteFSType; replaced in tests
+	progress func()                   // called for each directory walked; nil for none
 }
 
 // NewScanner creates a Scanner with the given configuration.
@@ -46,93 +127,300 @@ func NewScanner(cfg ScannerConfig, learner *Learner, logger *slog.Logger) *Scann
 	if cfg.MaxFiles <= 0 {
 		cfg.MaxFiles = 1000
 	}
-	return &Scanner{config: cfg, learner: learner, logger: logger}
+	if cfg.Parallelism <= 0 {
+		cfg.Parallelism = 4
+	}
+	if cfg.SymlinkPolicy != SymlinkSkip {
+		cfg.SymlinkPolicy = SymlinkFollow
+	}
+	if cfg.SniffLines <= 0 {
+		cfg.SniffLines = defaultSniffLines
+	}
+	if cfg.NetworkFSPolicy != NetworkFSSkip && cfg.NetworkFSPolicy != NetworkFSScan {
+		cfg.NetworkFSPolicy = NetworkFSLimit
+	}
+	if cfg.NetworkMaxDepth <= 0 {
+		cfg.NetworkMaxDepth = 3
+	}
+	if cfg.NetworkMaxTime <= 0 {
+		cfg.NetworkMaxTime = time.Minute
+	}
+	s := &Scanner{
+		config:   cfg,
+		learner:  learner,
+		priority: newPrioritizer(cfg.Prioritization, learner),
+		records:  NewRecordValidator(cfg.Schema),
+		logger:   logger,
+		remoteFS: platform.RemoteFSType,
+	}
+	if cfg.QuiescenceSeconds > 0 {
+		s.settle = newSettleTracker(time.Duration(cfg.QuiescenceSeconds) * time.Second)
+	}
+	return s
+}
+
+// SetSpool attaches the retry spool. While the spool is full, Scan returns
+// ErrSpoolFull without walking any paths; files already queued are skipped.
+func (s *Scanner) SetSpool(spool *RetrySpool) {
+	s.spool = spool
+}
+
+// SetPrioritizer replaces the strategy that orders candidates and decides
+// which are kept when a scan finds more than MaxFiles.
+func (s *Scanner) SetPrioritizer(p Prioritizer) {
+	s.priority = p
+}
+
+// SetIndex attaches a scan index, making scans incremental: directories whose
+// mtime has not changed since the last scan are not read again.
+func (s *Scanner) SetIndex(index *ScanIndex) {
+	s.index = index
+}
+
+// SetUncleanable attaches the list of uploaded files that could not be
+// cleaned up; scans skip them while unchanged.
+func (s *Scanner) SetUncleanable(list *UncleanableList) {
+	s.unclean = list
+}
+
+// SetProgress sets a function called as each directory is walked, so a long
+// walk shows the worker is not stuck. Nil disables it.
+func (s *Scanner) SetProgress(fn func()) {
+	s.progress = fn
+}
+
+// Scan discovers file candidates across configured and learned paths. The
+// report says what was walked and why files were passed over.
+func (s *Scanner) Scan(ctx context.Context) ([]FileCandidate, *config.ScanReport, error) {
+	return s.scan(ctx, nil)
+}
+
+// ScanDirs is Scan limited to the given directories, for focused scans of
+// learned directories between full scans.
+func (s *Scanner) ScanDirs(ctx context.Context, dirs []string) ([]FileCandidate, *config.ScanReport, error) {
+	if len(dirs) == 0 {
+		return nil, newScanReport(time.Now()), nil
+	}
+	return s.scan(ctx, dirs)
 }
 
-// Scan discovers file candidates across configured and learned paths.
-func (s *Scanner) Scan(ctx context.Context) ([]FileCandidate, error) {
+// scan runs the scan phases, or walks only focus when it is set.
+func (s *Scanner) scan(ctx context.Context, focus []string) ([]FileCandidate, *config.ScanReport, error) {
+	if s.spool != nil && s.spool.Full() {
+		return nil, nil, ErrSpoolFull
+	}
+	start := time.Now()
+	report := newScanReport(start)
+
+	if s.index != nil {
+		s.index.beginScan(time.Now())
+	}
+	if s.settle != nil {
+		s.settle.begin()
+	}
+
 	var candidates []FileCandidate
 	seen := make(map[string]bool)
+	visited := newVisitSet()
 
-	// Phase 1: Priority paths from learner (skip negative cached).
-	if s.learner != nil {
-		for _, p := range s.learner.GetPriorityPaths() {
-			if err := ctx.Err(); err != nil {
-				return candidates, nil
-			}
-			found, err := s.scanPath(ctx, p, seen)
-			if err != nil {
-				s.logger.Warn("error scanning priority path", "path", p, "error", err)
-				continue
-			}
-			candidates = append(candidates, found...)
-			if len(candidates) >= s.config.MaxFiles {
-				break
-			}
-		}
+	if focus != nil {
+		report.Focused = true
+		candidates = s.scanRoots(ctx, unseen(seen, focus, func(p string) string { return p }), visited, "focused", report)
+	}
+
+	// Phase 1: Priority paths from learner (skip negative cached, except
+	// those due a re-probe).
+	if s.learner != nil && focus == nil {
+		s.learner.ExpireNegativeCache()
+		probes := s.learner.DueProbes()
+		report.NegativeCached = s.learner.NegativeCacheSize() - len(probes)
+		report.Reprobed = len(probes)
+		roots := unseen(seen, append(s.learner.GetPriorityPaths(), probes...), func(p string) string { return p })
+		candidates = append(candidates, s.scanRoots(ctx, roots, visited, "priority", report)...)
 	}
 
 	// Phase 2: Base paths from config (skip already scanned in phase 1).
-	if len(candidates) < s.config.MaxFiles {
-		for _, rawPath := range s.config.DiscoveryPaths {
-			if err := ctx.Err(); err != nil {
-				return candidates, nil
-			}
-			expanded := os.ExpandEnv(rawPath)
-			if seen[expanded] {
-				continue
-			}
-			found, err := s.scanPath(ctx, expanded, seen)
-			if err != nil {
-				s.logger.Warn("error scanning config path", "path", expanded, "error", err)
-				continue
-			}
-			candidates = append(candidates, found...)
-			if len(candidates) >= s.config.MaxFiles {
-				break
-			}
-		}
+	if len(candidates) < s.config.MaxFiles && ctx.Err() == nil && focus == nil {
+		roots := unseen(seen, s.config.DiscoveryPaths, platform.ExpandPath)
+		candidates = append(candidates, s.scanRoots(ctx, roots, visited, "config", report)...)
 	}
 
 	// Phase 3: Exploratory — 10% chance to try parent dirs of known paths.
-	if len(candidates) < s.config.MaxFiles && s.learner != nil && rand.Float64() < 0.1 {
-		for _, p := range s.learner.GetPriorityPaths() {
-			if err := ctx.Err(); err != nil {
-				return candidates, nil
-			}
-			parent := filepath.Dir(p)
-			if seen[parent] || parent == p {
-				continue
-			}
-			found, err := s.scanPath(ctx, parent, seen)
+	if len(candidates) < s.config.MaxFiles && ctx.Err() == nil && s.learner != nil && focus == nil && rand.Float64() < 0.1 {
+		roots := unseen(seen, s.learner.GetPriorityPaths(), parentDir)
+		candidates = append(candidates, s.scanRoots(ctx, roots, visited, "exploratory", report)...)
+	}
+
+	// Prioritize, then cap at MaxFiles.
+	s.priority.Prioritize(candidates, time.Now())
+	if s.config.MatchRotated {
+		orderRotations(candidates)
+	}
+	if len(candidates) > s.config.MaxFiles {
+		report.Filtered[FilterMaxFiles] += len(candidates) - s.config.MaxFiles
+		candidates = candidates[:s.config.MaxFiles]
+	}
+
+	report.Candidates = len(candidates)
+	report.DurationMs = time.Since(start).Milliseconds()
+	return candidates, report, nil
+}
+
+// unseen maps paths through fn and returns those not yet in seen, marking
+// them as seen. Paths fn maps to "" are dropped.
+func unseen(seen map[string]bool, paths []string, fn func(string) string) []string {
+	var out []string
+	for _, p := range paths {
+		root := fn(p)
+		if root == "" || seen[root] {
+			continue
+		}
+		seen[root] = true
+		out = append(out, root)
+	}
+	return out
+}
+
+// parentDir returns the directory above p, or "" if p is a filesystem root
+// and has none; exploring "/" would walk the whole disk.
+func parentDir(p string) string {
+	parent := filepath.Dir(p)
+	if parent == p {
+		return ""
+	}
+	return parent
+}
+
+// scanRoots scans base paths with up to Parallelism walks in flight, so slow
+// filesystems such as NFS mounts are traversed concurrently. Results keep the
+// order of roots. Roots not yet started once MaxFiles candidates have been
+// found are skipped. Each walk's counts are added to report.
+func (s *Scanner) scanRoots(ctx context.Context, roots []string, visited *visitSet, kind string, report *config.ScanReport) []FileCandidate {
+	results := make([][]FileCandidate, len(roots))
+	reports := make([]*config.ScanReport, len(roots))
+	sem := make(chan struct{}, s.config.Parallelism)
+	var wg sync.WaitGroup
+	var found atomic.Int64
+
+	for i, root := range roots {
+		sem <- struct{}{}
+		if ctx.Err() != nil || found.Load() >= int64(s.config.MaxFiles) {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(i int, root string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			reports[i] = newScanReport(time.Now())
+			c, err := s.scanPath(ctx, root, visited, reports[i])
 			if err != nil {
-				s.logger.Warn("error scanning exploratory path", "path", parent, "error", err)
-				continue
-			}
-			candidates = append(candidates, found...)
-			if len(candidates) >= s.config.MaxFiles {
-				break
+				s.logger.Warn("error scanning "+kind+" path", "path", root, "error", err)
+				return
 			}
+			results[i] = c
+			found.Add(int64(len(c)))
+		}(i, root)
+	}
+	wg.Wait()
+
+	learned := s.learner != nil && (kind == "priority" || kind == "focused")
+	var all []FileCandidate
+	for i, c := range results {
+		all = append(all, c...)
+		if reports[i] == nil {
+			continue
+		}
+		mergeScanReport(report, reports[i])
+		if learned && len(c) == 0 && ctx.Err() == nil {
+			s.recordFailure(roots[i], failureReason(reports[i]), report)
 		}
 	}
+	return all
+}
 
-	// Cap at MaxFiles.
-	if len(candidates) > s.config.MaxFiles {
-		candidates = candidates[:s.config.MaxFiles]
+// recordFailure records why a learned directory yielded no files, if known,
+// and lists it in report if it could not be scanned at all.
+func (s *Scanner) recordFailure(dir, reason string, report *config.ScanReport) {
+	if reason == "" {
+		return
 	}
+	s.learner.RecordFailure(dir, reason)
+	if reason == FailureEmpty {
+		return
+	}
+	s.logger.Warn("learned directory could not be scanned", "path", dir, "reason", reason)
+	if report.Blocked == nil {
+		report.Blocked = make(map[string]string)
+	}
+	if len(report.Blocked) < maxReportedPaths {
+		report.Blocked[dir] = reason
+	}
+}
 
-	// Sort by ModifiedAt ascending (oldest first).
-	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].ModifiedAt.Before(candidates[j].ModifiedAt)
-	})
+// failureReason returns why the walk of one root, as counted in its report,
+// found no files: the root could not be read or was excluded, or it was
+// walked and no file name matched. Returns "" if files matched but were
+// passed over, as processed files are, or the root was not walked for
+// another reason.
+func failureReason(r *config.ScanReport) string {
+	walked := r.DirsWalked+r.DirsFromIndex > 0
+	switch {
+	case !walked && r.PermissionDenied > 0:
+		return FailurePermissionDenied
+	case !walked && r.Filtered[FilterAgentDir]+r.Filtered[FilterExcludePattern] > 0:
+		return FailureExcluded
+	case walked && len(r.PatternHits) == 0:
+		return FailureEmpty
+	}
+	return ""
+}
 
-	return candidates, nil
+// scanRules are the depth, name, and path filters applied under one discovery
+// path.
+type scanRules struct {
+	maxDepth        int
+	filePatterns    []string
+	excludePatterns []string // matched against base names
+	excludePaths    []string // matched against slash-separated full paths
+	matchRotated    bool     // see ScannerConfig.MatchRotated
+	foldCase        bool     // patterns are lowercased; lowercase names before matching
+}
+
+// walkState carries the settings and results of walking one directory tree.
+type walkState struct {
+	rules      scanRules
+	now        time.Time
+	maxAge     time.Duration
+	maxSize    int64
+	visited    *visitSet
+	candidates []FileCandidate
+	report     *config.ScanReport // this walk's counts, merged by scanRoots
+	hits       map[string]int     // files matched, by file pattern
+	inNegative bool               // the walk started inside a negative-cached subtree
 }
 
-// scanPath walks a single base path, expanding globs and collecting matching files.
-func (s *Scanner) scanPath(ctx context.Context, basePath string, seen map[string]bool) ([]FileCandidate, error) {
-	seen[basePath] = true
+// walkItem is a directory queued for the breadth-first walk, with the state
+// inherited from its parents.
+type walkItem struct {
+	dir     string
+	modTime time.Time
+	depth   int
+	ignores ignoreStack  // .tokenlyignore files in this directory's parents
+	remote  *remoteLimit // set inside a network filesystem under NetworkFSLimit
+}
+
+// remoteLimit bounds the walk through one network filesystem: the depth of
+// its mount point and when to stop walking it.
+type remoteLimit struct {
+	depth    int
+	deadline time.Time
+}
 
+// scanPath walks a single base path, expanding globs and collecting matching
+// files, and counts what it walked and passed over in report.
+func (s *Scanner) scanPath(ctx context.Context, basePath string, visited *visitSet, report *config.ScanReport) ([]FileCandidate, error) {
 	var candidates []FileCandidate
 	now := time.Now()
 	maxAge := time.Duration(s.config.MaxFileAgeHours) * time.Hour
@@ -141,6 +429,7 @@ func (s *Scanner) scanPath(ctx context.Context, basePath string, seen map[string
 	// Expand glob patterns in the base path itself (e.g., /opt/*/logs).
 	expanded, err := doublestar.FilepathGlob(basePath)
 	if err != nil {
+		report.GlobErrors++
 		return nil, fmt.Errorf("expand glob %q: %w", basePath, err)
 	}
 	if len(expanded) == 0 {
@@ -153,98 +442,728 @@ func (s *Scanner) scanPath(ctx context.Context, basePath string, seen map[string
 			return candidates, nil
 		}
 
+		if s.isExcludedDir(dir) {
+			s.logger.Debug("skipping excluded directory", "path", dir)
+			report.Filtered[FilterAgentDir]++
+			continue
+		}
+
 		info, err := os.Stat(dir)
 		if err != nil {
-			if os.IsNotExist(err) || os.IsPermission(err) {
+			if os.IsPermission(err) {
+				s.logDenied(dir, err)
+				addPermissionDenied(report, dir)
+				continue
+			}
+			if os.IsNotExist(err) {
 				s.logger.Warn("cannot access path", "path", dir, "error", err)
 				continue
 			}
 			return nil, fmt.Errorf("stat %q: %w", dir, err)
 		}
+		rules := s.rulesFor(dir)
+		if info.IsDir() && excludedPath(dir, rules) {
+			s.logger.Debug("skipping excluded directory", "path", dir)
+			report.Filtered[FilterExcludePattern]++
+			continue
+		}
+		patterns := rules.filePatterns
+		if s.learner != nil && info.IsDir() {
+			rules.filePatterns = s.learner.LivePatterns(dir, patterns)
+		}
+
+		ws := &walkState{
+			rules:      rules,
+			now:        now,
+			maxAge:     maxAge,
+			maxSize:    maxSize,
+			visited:    visited,
+			candidates: candidates,
+			report:     report,
+			inNegative: s.learner != nil && s.learner.NegativeSubtree(dir) != "",
+		}
 		if !info.IsDir() {
+			// A path naming a file directly is a single candidate, subject to
+			// the same pattern, age, and size checks as discovered files.
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			if !matchesRules(dir, rules) {
+				ws.filtered(s.nameFilter(dir, rules))
+				continue
+			}
+			s.collect(ws, dir, info)
+			candidates = ws.candidates
+			continue
+		}
+		if !visited.firstDir(dir, info) {
+			report.Filtered[FilterDuplicate]++
 			continue
 		}
 
-		err = s.walkDir(ctx, dir, 0, now, maxAge, maxSize, &candidates)
+		err = s.walkTree(ctx, ws, dir, info.ModTime())
+		candidates = ws.candidates
 		if err != nil {
 			s.logger.Warn("error walking directory", "path", dir, "error", err)
 		}
+		for p, n := range ws.hits {
+			addPatternHits(report, p, n)
+		}
+		// A walk cut short may not have reached a pattern's files.
+		if s.learner != nil && err == nil && ctx.Err() == nil && len(candidates) < s.config.MaxFiles {
+			s.learner.UpdatePatterns(dir, patterns, ws.hits)
+		}
 	}
 
 	return candidates, nil
 }
 
-// walkDir recursively walks a directory up to MaxDepth, collecting matching files.
-func (s *Scanner) walkDir(ctx context.Context, dir string, depth int, now time.Time, maxAge time.Duration, maxSize int64, candidates *[]FileCandidate) error {
-	if depth > s.config.MaxDepth {
-		return nil
+// walkTree walks a directory tree breadth first, up to the path's max depth,
+// collecting matching files. Shallow files, usually the freshest, are found
+// before MaxFiles is reached deep in one subtree. The walk stops between
+// directories once the context is cancelled or MaxFiles is reached.
+func (s *Scanner) walkTree(ctx context.Context, ws *walkState, root string, modTime time.Time) error {
+	queue := []walkItem{{dir: root, modTime: modTime}}
+	for len(queue) > 0 {
+		if ctx.Err() != nil || len(ws.candidates) >= s.config.MaxFiles {
+			return nil
+		}
+		item := queue[0]
+		queue = queue[1:]
+		subdirs, err := s.walkDir(ctx, ws, item)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, subdirs...)
+	}
+	return nil
+}
+
+// walkDir collects the matching files in one directory and returns its
+// subdirectories to walk next. Symlinks are handled according to the scanner's
+// SymlinkPolicy, and network filesystems according to its NetworkFSPolicy.
+// Entries matched by a .tokenlyignore file in this directory or one above it
+// (within the walk) are skipped. With a scan index, a directory whose mtime is
+// unchanged is not read; see walkIndexed.
+func (s *Scanner) walkDir(ctx context.Context, ws *walkState, item walkItem) ([]walkItem, error) {
+	dir, depth, ignores := item.dir, item.depth, item.ignores
+	if s.progress != nil {
+		s.progress()
+	}
+	if depth > ws.rules.maxDepth {
+		ws.filtered(FilterMaxDepth)
+		return nil, nil
 	}
-	if err := ctx.Err(); err != nil {
-		return nil
+	if item.remote == nil && s.config.NetworkFSPolicy != NetworkFSScan {
+		if fsType := s.remoteFS(dir); fsType != "" {
+			if s.config.NetworkFSPolicy == NetworkFSSkip {
+				s.logger.Info("skipping network filesystem", "path", dir, "type", fsType)
+				ws.filtered(FilterNetworkFS)
+				return nil, nil
+			}
+			s.logger.Debug("walking network filesystem with limits", "path", dir, "type", fsType)
+			item.remote = &remoteLimit{depth: depth, deadline: time.Now().Add(s.config.NetworkMaxTime)}
+		}
+	}
+	if item.remote != nil {
+		if depth-item.remote.depth > s.config.NetworkMaxDepth {
+			ws.filtered(FilterNetworkFS)
+			return nil, nil
+		}
+		if time.Now().After(item.remote.deadline) {
+			s.logger.Debug("network filesystem time limit reached", "path", dir)
+			ws.filtered(FilterNetworkFS)
+			return nil, nil
+		}
+	}
+	if s.index != nil {
+		if indexed := s.index.unchanged(dir, item.modTime); indexed != nil {
+			ws.report.DirsFromIndex++
+			if indexed.HasIgnore {
+				item.ignores = ignores.push(s.loadIgnore(dir))
+			}
+			return s.walkIndexed(ctx, ws, item, indexed)
+		}
 	}
 
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsPermission(err) {
-			s.logger.Warn("permission denied", "path", dir)
-			return nil
+			s.logDenied(dir, err)
+			ws.permissionDenied(dir)
+			return nil, nil
 		}
-		return fmt.Errorf("read dir %q: %w", dir, err)
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
 	}
+	ws.report.DirsWalked++
+
+	// The ignore file applies to its siblings, so read it before the loop.
+	hasIgnore := false
+	for _, entry := range entries {
+		if entry.Name() == IgnoreFileName && entry.Type().IsRegular() {
+			hasIgnore = true
+			ignores = ignores.push(s.loadIgnore(dir))
+			break
+		}
+	}
+
+	item.ignores = ignores
+
+	// What this directory holds, for the index. Only recorded if every entry
+	// was looked at. Ignored entries are recorded too, so that editing the
+	// ignore file (which leaves the directory mtime alone) takes effect.
+	var subdirs []string
+	files := make(map[string]config.IndexedFile)
+	var next []walkItem
 
 	for _, entry := range entries {
 		if err := ctx.Err(); err != nil {
-			return nil
+			return nil, nil
 		}
-		if len(*candidates) >= s.config.MaxFiles {
-			return nil
+		if len(ws.candidates) >= s.config.MaxFiles {
+			return nil, nil
 		}
 
 		fullPath := filepath.Join(dir, entry.Name())
 
-		if entry.IsDir() {
-			if err := s.walkDir(ctx, fullPath, depth+1, now, maxAge, maxSize, candidates); err != nil {
-				return err
+		isDir := entry.IsDir()
+		var info fs.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			if s.config.SymlinkPolicy == SymlinkSkip {
+				ws.filtered(FilterSymlink)
+				continue
+			}
+			target, err := os.Stat(fullPath)
+			if err != nil {
+				s.logger.Debug("skipping broken symlink", "path", fullPath, "error", err)
+				ws.filtered(FilterSymlink)
+				continue
+			}
+			info, isDir = target, target.IsDir()
+			if isDir && s.linksIntoExcludedDir(fullPath) {
+				ws.filtered(FilterAgentDir)
+				continue
+			}
+		}
+
+		if isDir {
+			if s.isExcludedDir(fullPath) {
+				ws.filtered(FilterAgentDir)
+				continue
+			}
+			if info == nil {
+				if info, err = entry.Info(); err != nil {
+					s.logger.Warn("cannot stat directory", "path", fullPath, "error", err)
+					continue
+				}
+			}
+			subdirs = append(subdirs, entry.Name())
+			if !s.walkable(ws, fullPath, ignores) {
+				continue
 			}
+			next = s.queueSubdir(ws, next, item, fullPath, info)
 			continue
 		}
 
-		name := entry.Name()
+		matched := matchesRules(fullPath, ws.rules)
+		if matched {
+			ws.hit(fullPath)
+		}
+		if !matched && (s.config.SniffMaxBytes <= 0 || excluded(fullPath, ws.rules)) {
+			ws.filtered(s.nameFilter(fullPath, ws.rules))
+			continue
+		}
 
-		// Check exclude patterns first.
-		if matchesAny(name, s.config.ExcludePatterns) {
+		if info == nil {
+			if info, err = entry.Info(); err != nil {
+				s.logger.Warn("cannot stat file", "path", fullPath, "error", err)
+				continue
+			}
+		}
+		if !info.Mode().IsRegular() {
 			continue
 		}
+		if !matched && !s.sniffCandidate(ws, fullPath, info) {
+			ws.filtered(FilterFilePattern)
+			continue
+		}
+		files[entry.Name()] = config.IndexedFile{Size: info.Size(), ModTime: info.ModTime(), Sniffed: !matched}
 
-		// Check file patterns.
-		if !matchesAny(name, s.config.FilePatterns) {
+		if ignores.ignored(fullPath, false) {
+			ws.filtered(FilterIgnoreFile)
 			continue
 		}
+		s.collect(ws, fullPath, info)
+	}
 
-		info, err := entry.Info()
-		if err != nil {
-			s.logger.Warn("cannot stat file", "path", fullPath, "error", err)
+	if s.index != nil {
+		s.index.record(dir, item.modTime, subdirs, files, hasIgnore)
+	}
+	return next, nil
+}
+
+// walkIndexed walks an unchanged directory from its index entry: listed
+// subdirectories are stat'ed and walked, and listed files not marked done are
+// stat'ed, which catches appends that leave the directory mtime alone. Files
+// included by content sniffing are kept while sniffing stays enabled.
+func (s *Scanner) walkIndexed(ctx context.Context, ws *walkState, item walkItem, indexed *config.IndexedDir) ([]walkItem, error) {
+	dir, ignores := item.dir, item.ignores
+	var next []walkItem
+	for _, name := range indexed.Subdirs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil
+		}
+		fullPath := filepath.Join(dir, name)
+		if s.isExcludedDir(fullPath) {
+			ws.filtered(FilterAgentDir)
+			continue
+		}
+		if !s.walkable(ws, fullPath, ignores) {
+			continue
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil || !info.IsDir() {
 			continue
 		}
+		next = s.queueSubdir(ws, next, item, fullPath, info)
+	}
 
-		// Filter by age.
-		if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+	names := make([]string, 0, len(indexed.Files))
+	for name, f := range indexed.Files {
+		if !f.Done {
+			names = append(names, name)
+		} else if fullPath := filepath.Join(dir, name); matchesRules(fullPath, ws.rules) {
+			ws.hit(fullPath)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return nil, nil
+		}
+		if len(ws.candidates) >= s.config.MaxFiles {
+			return nil, nil
+		}
+		fullPath := filepath.Join(dir, name)
+		named := matchesRules(fullPath, ws.rules)
+		if named {
+			ws.hit(fullPath)
+		}
+		matched := named ||
+			(indexed.Files[name].Sniffed && s.config.SniffMaxBytes > 0 && !excluded(fullPath, ws.rules))
+		if !matched {
+			ws.filtered(s.nameFilter(fullPath, ws.rules))
+			continue
+		}
+		if ignores.ignored(fullPath, false) {
+			ws.filtered(FilterIgnoreFile)
+			continue
+		}
+		info, err := os.Stat(fullPath)
+		if err != nil || !info.Mode().IsRegular() {
 			continue
 		}
+		s.collect(ws, fullPath, info)
+	}
+	return next, nil
+}
+
+// queueSubdir appends a subdirectory of parent to next unless it was already
+// visited.
+func (s *Scanner) queueSubdir(ws *walkState, next []walkItem, parent walkItem, path string, info fs.FileInfo) []walkItem {
+	if !ws.visited.firstDir(path, info) {
+		s.logger.Debug("skipping already visited directory", "path", path)
+		ws.filtered(FilterDuplicate)
+		return next
+	}
+	return append(next, walkItem{
+		dir:     path,
+		modTime: info.ModTime(),
+		depth:   parent.depth + 1,
+		ignores: parent.ignores,
+		remote:  parent.remote,
+	})
+}
+
+// logDenied logs a path that could not be read. macOS privacy protection
+// denies most apps' sandbox containers to an agent without Full Disk Access,
+// so those denials are expected and only logged at debug level.
+func (s *Scanner) logDenied(path string, err error) {
+	if platform.IsPrivacyDenied(err) {
+		s.logger.Debug("skipping privacy-protected path", "path", path)
+		return
+	}
+	s.logger.Warn("permission denied", "path", path)
+}
 
-		// Filter by size.
-		if maxSize > 0 && info.Size() > maxSize {
+// loadIgnore reads the ignore file in dir, logging and returning nil if it
+// cannot be read.
+func (s *Scanner) loadIgnore(dir string) *ignoreFile {
+	f, err := loadIgnore(dir)
+	if err != nil {
+		s.logger.Warn("cannot read ignore file", "path", filepath.Join(dir, IgnoreFileName), "error", err)
+	}
+	return f
+}
+
+// walkable reports whether a subdirectory passes the ignore file and exclude
+// patterns, and is not inside a negative-cached subtree, counting it as
+// filtered if not. A walk that starts inside such a subtree, such as its
+// re-probe, walks all of it.
+func (s *Scanner) walkable(ws *walkState, path string, ignores ignoreStack) bool {
+	if ignores.ignored(path, true) {
+		ws.filtered(FilterIgnoreFile)
+		return false
+	}
+	if excludedPath(path, ws.rules) {
+		ws.filtered(FilterExcludePattern)
+		return false
+	}
+	if s.learner != nil && !ws.inNegative && s.learner.NegativeSubtree(path) != "" {
+		ws.filtered(FilterNegativeCache)
+		return false
+	}
+	return true
+}
+
+// nameFilter returns why a file failed the name-based rules.
+func (s *Scanner) nameFilter(path string, rules scanRules) string {
+	if excluded(path, rules) {
+		return FilterExcludePattern
+	}
+	return FilterFilePattern
+}
+
+// collect adds a matching regular file to the walk's candidates if it passes
+// the agent file, spool, age, size, done, uploaded marker, uncleanable,
+// quiescence, and duplicate checks.
+func (s *Scanner) collect(ws *walkState, path string, info fs.FileInfo) {
+	if isAgentFile(path, s.config.ExcludeFiles) {
+		ws.filtered(FilterAgentFile)
+		return
+	}
+	if s.spooled(path) {
+		ws.filtered(FilterSpooled)
+		return
+	}
+	if reason := infoFilter(info, ws.now, ws.maxAge, ws.maxSize); reason != "" {
+		ws.filtered(reason)
+		return
+	}
+	if s.index != nil && s.index.isDone(path, info.Size(), info.ModTime()) {
+		ws.filtered(FilterDone)
+		return
+	}
+	if hasUploadedMarker(path, info.Size(), info.ModTime()) {
+		ws.filtered(FilterMarked)
+		return
+	}
+	if s.unclean != nil && s.unclean.Contains(path, info.Size(), info.ModTime()) {
+		ws.filtered(FilterUncleanable)
+		return
+	}
+	if !s.settled(path, info, ws.now) {
+		ws.filtered(FilterSettling)
+		return
+	}
+	if !ws.visited.firstFile(path, info) {
+		ws.filtered(FilterDuplicate)
+		return
+	}
+	ws.candidates = append(ws.candidates, newCandidate(path, info))
+}
+
+// settled reports whether a file has stopped changing, logging files held back.
+func (s *Scanner) settled(path string, info fs.FileInfo, now time.Time) bool {
+	if s.settle == nil || s.settle.settled(path, info, now) {
+		return true
+	}
+	s.logger.Debug("file still changing, deferring", "path", path, "modified_at", info.ModTime())
+	return false
+}
+
+// rulesFor returns the scan rules for a path: the global settings, replaced
+// field by field by the most specific PathOverrides entry whose path (after
+// env and ~ expansion, globs allowed) equals or contains it.
+func (s *Scanner) rulesFor(path string) scanRules {
+	rules := scanRules{
+		maxDepth:        s.config.MaxDepth,
+		filePatterns:    s.config.FilePatterns,
+		excludePatterns: s.config.ExcludePatterns,
+		matchRotated:    s.config.MatchRotated,
+	}
+
+	var best *config.DiscoveryPath
+	for i := range s.config.PathOverrides {
+		o := &s.config.PathOverrides[i]
+		root := filepath.Clean(platform.ExpandPath(o.Path))
+		if !matchesRoot(root, path) {
 			continue
 		}
+		if best == nil || len(root) > len(filepath.Clean(platform.ExpandPath(best.Path))) {
+			best = o
+		}
+	}
+	if best != nil {
+		if best.MaxDepth > 0 {
+			rules.maxDepth = best.MaxDepth
+		}
+		if len(best.FilePatterns) > 0 {
+			rules.filePatterns = best.FilePatterns
+		}
+		if len(best.ExcludePatterns) > 0 {
+			rules.excludePatterns = best.ExcludePatterns
+		}
+	}
 
-		*candidates = append(*candidates, FileCandidate{
-			Path:       fullPath,
-			SizeBytes:  info.Size(),
-			ModifiedAt: info.ModTime(),
-		})
+	rules = splitExcludes(rules)
+	if s.config.CaseInsensitive {
+		rules.foldCase = true
+		rules.filePatterns = lowerAll(rules.filePatterns)
+		rules.excludePatterns = lowerAll(rules.excludePatterns)
+		rules.excludePaths = lowerAll(rules.excludePaths)
 	}
+	return rules
+}
 
-	return nil
+// lowerAll returns a lowercased copy of patterns.
+func lowerAll(patterns []string) []string {
+	out := make([]string, len(patterns))
+	for i, p := range patterns {
+		out[i] = strings.ToLower(p)
+	}
+	return out
+}
+
+// splitExcludes moves exclude patterns containing a "/" from the base name
+// patterns to the full path patterns, expanding environment variables and ~
+// in them.
+func splitExcludes(rules scanRules) scanRules {
+	var names, paths []string
+	for _, p := range rules.excludePatterns {
+		if strings.Contains(p, "/") {
+			paths = append(paths, filepath.ToSlash(platform.ExpandPath(p)))
+		} else {
+			names = append(names, p)
+		}
+	}
+	rules.excludePatterns, rules.excludePaths = names, paths
+	return rules
+}
+
+// matchesRoot returns true if path equals root or lies beneath it, where root
+// may contain glob patterns.
+func matchesRoot(root, path string) bool {
+	if isWithin(path, root) {
+		return true
+	}
+	if ok, _ := doublestar.PathMatch(root, path); ok {
+		return true
+	}
+	ok, _ := doublestar.PathMatch(filepath.Join(root, "**"), path)
+	return ok
+}
+
+// isExcludedDir returns true if path is inside one of the excluded directories.
+func (s *Scanner) isExcludedDir(path string) bool {
+	for _, dir := range s.config.ExcludeDirs {
+		if isWithin(path, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAgentFile returns true if path is one of files, given as paths or glob
+// patterns.
+func isAgentFile(path string, files []string) bool {
+	path = filepath.Clean(path)
+	for _, f := range files {
+		if path == f {
+			return true
+		}
+		if ok, _ := filepath.Match(f, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// linksIntoExcludedDir returns true if a symlink resolves into an excluded
+// directory.
+func (s *Scanner) linksIntoExcludedDir(path string) bool {
+	resolved, err := filepath.EvalSymlinks(path)
+	return err == nil && s.isExcludedDir(resolved)
+}
+
+// matchesRules applies the exclude patterns, then the file patterns to a
+// path's base name. A gzipped file also matches on its name without the .gz
+// suffix, so "*.jsonl" picks up rotated "*.jsonl.gz" files.
+func matchesRules(path string, rules scanRules) bool {
+	// Check exclude patterns first.
+	if excluded(path, rules) {
+		return false
+	}
+
+	// Check file patterns.
+	return matchesName(path, rules, rules.filePatterns)
+}
+
+// matchedPattern returns the first file pattern a path's name matches, or ""
+// if it matches none.
+func matchedPattern(path string, rules scanRules) string {
+	for _, p := range rules.filePatterns {
+		if matchesName(path, rules, []string{p}) {
+			return p
+		}
+	}
+	return ""
+}
+
+// excluded returns true if a file's base name or full path matches an
+// exclude pattern.
+func excluded(path string, rules scanRules) bool {
+	return matchesName(path, rules, rules.excludePatterns) || excludedPath(path, rules)
+}
+
+// matchesName matches a path's base name against patterns, also trying the
+// name without a .gz suffix and, with matchRotated, without a rotation number.
+func matchesName(path string, rules scanRules, patterns []string) bool {
+	name := filepath.Base(path)
+	if rules.foldCase {
+		name = strings.ToLower(name)
+	}
+	if matchesAny(name, patterns) || matchesAny(trimGzip(name), patterns) {
+		return true
+	}
+	if rules.matchRotated {
+		if live, n := rotation(name); n > 0 {
+			return matchesAny(live, patterns)
+		}
+	}
+	return false
+}
+
+// excludedPath returns true if the slash-separated full path matches one of
+// the path exclude patterns, e.g. "**/node_modules/**". A pattern ending in
+// "/**" also matches the directory itself, so the walk prunes it without
+// reading it.
+func excludedPath(path string, rules scanRules) bool {
+	if len(rules.excludePaths) == 0 {
+		return false
+	}
+	path = filepath.ToSlash(path)
+	if rules.foldCase {
+		path = strings.ToLower(path)
+	}
+	return matchesAny(path, rules.excludePaths)
+}
+
+// sniffCandidate reports whether a file matching no file pattern should be
+// scanned anyway because its first lines look like token records. Only small
+// files that pass the age and size checks are probed.
+func (s *Scanner) sniffCandidate(ws *walkState, path string, info fs.FileInfo) bool {
+	if info.Size() == 0 || info.Size() > s.config.SniffMaxBytes || !acceptInfo(info, ws.now, ws.maxAge, ws.maxSize) {
+		return false
+	}
+	if s.index != nil && s.index.isDone(path, info.Size(), info.ModTime()) {
+		return true // sniffed when it was first processed
+	}
+	if !looksLikeTokenFile(path, s.config.SniffLines, s.records) {
+		return false
+	}
+	s.logger.Debug("including file by content", "path", path)
+	return true
+}
+
+// spooled returns true if the path is queued for retry; the worker re-sends
+// it from the spool.
+func (s *Scanner) spooled(path string) bool {
+	return s.spool != nil && s.spool.Contains(path)
+}
+
+// acceptInfo filters a file by age and size.
+func acceptInfo(info fs.FileInfo, now time.Time, maxAge time.Duration, maxSize int64) bool {
+	return infoFilter(info, now, maxAge, maxSize) == ""
+}
+
+// infoFilter returns FilterMaxAge or FilterMaxSize if a file fails that check,
+// or "" if it passes both.
+func infoFilter(info fs.FileInfo, now time.Time, maxAge time.Duration, maxSize int64) string {
+	if maxAge > 0 && now.Sub(info.ModTime()) > maxAge {
+		return FilterMaxAge
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		return FilterMaxSize
+	}
+	return ""
+}
+
+// newCandidate builds a FileCandidate from a file's stat info.
+func newCandidate(path string, info fs.FileInfo) FileCandidate {
+	return FileCandidate{
+		Path:         path,
+		SizeBytes:    info.Size(),
+		ModifiedAt:   info.ModTime(),
+		DiscoveredAt: time.Now(),
+	}
+}
+
+// visitSet records the directories and files seen during one scan by
+// filesystem identity, so symlink loops terminate and a file reachable by
+// several paths is reported once. It is shared by concurrent walks.
+type visitSet struct {
+	mu    sync.Mutex
+	dirs  map[string]bool
+	files map[string]bool
+}
+
+func newVisitSet() *visitSet {
+	return &visitSet{dirs: make(map[string]bool), files: make(map[string]bool)}
+}
+
+// firstDir marks a directory as visited, returning false if it already was.
+func (v *visitSet) firstDir(path string, info fs.FileInfo) bool {
+	return v.mark(v.dirs, fileKey(path, info))
+}
+
+// firstFile marks a file as seen, returning false if it already was.
+func (v *visitSet) firstFile(path string, info fs.FileInfo) bool {
+	return v.mark(v.files, fileKey(path, info))
+}
+
+func (v *visitSet) mark(set map[string]bool, key string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if set[key] {
+		return false
+	}
+	set[key] = true
+	return true
+}
+
+// resolvedKey identifies a file by its symlink-free absolute path, for
+// platforms without usable device and inode numbers.
+func resolvedKey(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return path
+}
+
+// isWithin returns true if path equals dir or lies beneath it.
+func isWithin(path, dir string) bool {
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
 }
 
 // matchesAny returns true if name matches any of the given glob patterns.
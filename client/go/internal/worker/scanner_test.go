@@ -6,11 +6,16 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
 )
 
 func testLogger() *slog.Logger {
@@ -29,9 +34,163 @@ func TestScan_FindsJSONLFiles(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 2)
+}
+
+func TestScan_ReportsProgress(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a", "b"), 0755))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	var walked atomic.Int32
+	sc.SetProgress(func() { walked.Add(1) })
+
+	_, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, walked.Load(), "once per directory walked")
+}
+
+func TestScanDirs_WalksOnlyGivenDirs(t *testing.T) {
+	focus, other := t.TempDir(), t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(focus, "a.jsonl"), []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "b.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{focus, other},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, report, err := sc.ScanDirs(context.Background(), []string{focus})
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, filepath.Join(focus, "a.jsonl"), candidates[0].Path)
+	assert.True(t, report.Focused)
+
+	candidates, _, err = sc.ScanDirs(context.Background(), nil)
 	require.NoError(t, err)
+	assert.Empty(t, candidates)
+}
+
+func TestScan_SkipsDeadPatterns(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte("{}"), 0644))
+	learner, err := NewLearner(filepath.Join(t.TempDir(), "learning.json"), testLogger())
+	require.NoError(t, err)
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl", "*usage*.log"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, learner, testLogger())
+	scan := func() ([]FileCandidate, *config.ScanReport) {
+		candidates, report, err := sc.Scan(context.Background())
+		require.NoError(t, err)
+		return candidates, report
+	}
+
+	for i := 0; i < minPatternScans; i++ {
+		_, report := scan()
+		assert.Equal(t, map[string]int{"*.jsonl": 1}, report.PatternHits)
+	}
+	assert.Equal(t, &config.PatternStats{Scans: 20}, learner.data.Patterns[dir]["*usage*.log"])
+
+	scan() // a recheck, finding nothing
+
+	// The dead pattern is skipped until the next recheck, which revives it.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "usage.log"), []byte("{}"), 0644))
+	for learner.data.Patterns[dir]["*usage*.log"].Scans%patternRecheck != 0 {
+		candidates, _ := scan()
+		assert.Len(t, candidates, 1)
+	}
+	candidates, _ := scan()
 	assert.Len(t, candidates, 2)
+	candidates, _ = scan()
+	assert.Len(t, candidates, 2)
+	assert.Equal(t, 2, learner.data.Patterns[dir]["*usage*.log"].Files)
+}
+
+func TestScan_SkipsNegativeSubtrees(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "cache")
+	require.NoError(t, os.MkdirAll(filepath.Join(cache, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(cache, "sub", "a.jsonl"), []byte("{}"), 0644))
+	learner, err := NewLearner(filepath.Join(t.TempDir(), "learning.json"), testLogger())
+	require.NoError(t, err)
+	now := time.Now()
+	learner.now = func() time.Time { return now }
+	learner.MarkNegativeSubtree(cache)
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, learner, testLogger())
+
+	candidates, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+	assert.Equal(t, 1, report.Filtered[FilterNegativeCache])
+
+	// The re-probe walks the whole subtree.
+	now = now.Add(24 * time.Hour)
+	candidates, report, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, 1, report.Reprobed)
+}
+
+func TestScan_RecordsLearnedFailures(t *testing.T) {
+	empty, excluded := t.TempDir(), t.TempDir()
+	learner, err := NewLearner(filepath.Join(t.TempDir(), "learning.json"), testLogger())
+	require.NoError(t, err)
+	learner.Seed(empty, 1)
+	learner.Seed(excluded, 1)
+
+	sc := NewScanner(ScannerConfig{
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludeDirs:     []string{excluded},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, learner, testLogger())
+	_, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{excluded: FailureExcluded}, report.Blocked)
+	assert.Equal(t, FailureEmpty, learner.data.Directories[empty].LastFailure)
+	assert.Equal(t, 1, learner.data.Directories[empty].ScanCount)
+	assert.Equal(t, FailureExcluded, learner.data.Directories[excluded].LastFailure)
+	assert.Zero(t, learner.data.Directories[excluded].ScanCount, "not counted toward the negative cache")
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		name   string
+		report config.ScanReport
+		want   string
+	}{
+		{"unreadable", config.ScanReport{PermissionDenied: 1}, FailurePermissionDenied},
+		{"excluded", config.ScanReport{Filtered: map[string]int{FilterExcludePattern: 1}}, FailureExcluded},
+		{"empty", config.ScanReport{DirsWalked: 3}, FailureEmpty},
+		{"from the index", config.ScanReport{DirsFromIndex: 1}, FailureEmpty},
+		{"files passed over", config.ScanReport{DirsWalked: 1, PatternHits: map[string]int{"*.jsonl": 2}}, ""},
+		{"missing", config.ScanReport{}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, failureReason(&tt.report))
+		})
+	}
 }
 
 func TestScan_FilesTooOld(t *testing.T) {
@@ -50,7 +209,7 @@ func TestScan_FilesTooOld(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.Empty(t, candidates)
 }
@@ -69,7 +228,7 @@ func TestScan_FilesTooLarge(t *testing.T) {
 		MaxFileSizeMB:   1, // 1 MB limit
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.Empty(t, candidates)
 }
@@ -87,7 +246,7 @@ func TestScan_ExcludePatterns(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, candidates, 1)
 	assert.Contains(t, candidates[0].Path, "data.jsonl")
@@ -105,7 +264,7 @@ func TestScan_FilePatterns(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.Len(t, candidates, 1)
 	assert.Contains(t, candidates[0].Path, "data.jsonl")
@@ -126,11 +285,35 @@ func TestScan_MaxFilesLimit(t *testing.T) {
 		MaxFiles:        3,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.LessOrEqual(t, len(candidates), 3)
 }
 
+func TestScan_MaxFilesKeepsShallowFiles(t *testing.T) {
+	dir := t.TempDir()
+	deep := filepath.Join(dir, "a", "deep")
+	require.NoError(t, os.MkdirAll(deep, 0755))
+	for i := 0; i < 5; i++ {
+		require.NoError(t, os.WriteFile(filepath.Join(deep, fmt.Sprintf("file%d.jsonl", i)), []byte("{}"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "z.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		MaxDepth:        5,
+		MaxFiles:        2,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 2)
+	assert.Contains(t, candidateNames(candidates), "z.jsonl", "shallow files are found before deep subtrees fill MaxFiles")
+}
+
 func TestScan_ContextCancellation(t *testing.T) {
 	dir := t.TempDir()
 	for i := 0; i < 5; i++ {
@@ -148,7 +331,7 @@ func TestScan_ContextCancellation(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(ctx)
+	candidates, _, err := sc.Scan(ctx)
 	require.NoError(t, err)
 	// With immediate cancellation, we expect few or no results.
 	assert.LessOrEqual(t, len(candidates), 5)
@@ -164,7 +347,7 @@ func TestScan_EmptyDirectory(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	assert.Empty(t, candidates)
 }
@@ -194,7 +377,7 @@ func TestScan_SortedByModifiedAtAscending(t *testing.T) {
 		MaxFileSizeMB:   10,
 	}, nil, testLogger())
 
-	candidates, err := sc.Scan(context.Background())
+	candidates, _, err := sc.Scan(context.Background())
 	require.NoError(t, err)
 	require.Len(t, candidates, 3)
 
@@ -203,3 +386,428 @@ func TestScan_SortedByModifiedAtAscending(t *testing.T) {
 	assert.Contains(t, candidates[1].Path, "middle.jsonl")
 	assert.Contains(t, candidates[2].Path, "newest.jsonl")
 }
+
+func TestScan_DiscoveryPathIsFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "known.jsonl")
+	require.NoError(t, os.WriteFile(target, []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{target},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, target, candidates[0].Path)
+}
+
+func TestScan_DiscoveryPathIsFile_Filtered(t *testing.T) {
+	dir := t.TempDir()
+	wrongPattern := filepath.Join(dir, "notes.txt")
+	tooOld := filepath.Join(dir, "old.jsonl")
+	require.NoError(t, os.WriteFile(wrongPattern, []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(tooOld, []byte("{}"), 0644))
+	oldTime := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(tooOld, oldTime, oldTime))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{wrongPattern, tooOld},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+}
+
+func TestScan_ExcludeDirs(t *testing.T) {
+	dir := t.TempDir()
+	own := filepath.Join(dir, "tokenly")
+	require.NoError(t, os.MkdirAll(own, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.jsonl"), []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(own, "tokenly-ledger.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir, own},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		ExcludeDirs:     []string{own},
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Contains(t, candidates[0].Path, "app.jsonl")
+}
+
+func TestScan_ExcludeFilesLeavesTheirDirectory(t *testing.T) {
+	dir := t.TempDir()
+	ledger := filepath.Join(dir, "tokenly-ledger.jsonl")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.jsonl"), []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(ledger, []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tokenly-sanitized-1.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		ExcludeFiles:    []string{ledger, filepath.Join(dir, sanitizedPattern)},
+	}, nil, testLogger())
+
+	candidates, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Contains(t, candidates[0].Path, "app.jsonl")
+	assert.Equal(t, 2, report.Filtered[FilterAgentFile])
+}
+
+// symlinkTree creates logs/app.jsonl outside the scan root and a root
+// directory containing a symlink to logs plus a symlink back to the root.
+func symlinkTree(t *testing.T) (root string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+	base := t.TempDir()
+	logs := filepath.Join(base, "logs")
+	root = filepath.Join(base, "root")
+	require.NoError(t, os.MkdirAll(logs, 0755))
+	require.NoError(t, os.MkdirAll(root, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(logs, "app.jsonl"), []byte("{}"), 0644))
+	require.NoError(t, os.Symlink(logs, filepath.Join(root, "app-logs")))
+	require.NoError(t, os.Symlink(root, filepath.Join(root, "loop")))
+	return root
+}
+
+func TestScan_FollowsSymlinkedDirs(t *testing.T) {
+	root := symlinkTree(t)
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{root},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1, "loop must terminate and the file be found once")
+	assert.Equal(t, filepath.Join(root, "app-logs", "app.jsonl"), candidates[0].Path)
+}
+
+func TestScan_SkipsSymlinksWhenConfigured(t *testing.T) {
+	root := symlinkTree(t)
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{root},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		SymlinkPolicy:   SymlinkSkip,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+}
+
+func TestScan_SymlinkedFileCountedOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require elevated privileges on Windows")
+	}
+	dir := t.TempDir()
+	target := filepath.Join(dir, "usage.jsonl")
+	require.NoError(t, os.WriteFile(target, []byte("{}\n"), 0644))
+	require.NoError(t, os.Symlink(target, filepath.Join(dir, "latest.jsonl")))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, int64(3), candidates[0].SizeBytes, "size is the target's, not the link's")
+}
+
+func TestScan_PathOverrides(t *testing.T) {
+	base := t.TempDir()
+	shallow := filepath.Join(base, "opt", "app", "logs")
+	deep := filepath.Join(base, "home", "u")
+	require.NoError(t, os.MkdirAll(filepath.Join(shallow, "a", "b"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(deep, "a", "b"), 0755))
+	for _, d := range []string{shallow, deep} {
+		require.NoError(t, os.WriteFile(filepath.Join(d, "top.jsonl"), []byte("{}"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(d, "a", "b", "deep.jsonl"), []byte("{}"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(d, "usage.log"), []byte("{}"), 0644))
+	}
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{filepath.Join(base, "opt", "*", "logs"), deep},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		PathOverrides: []config.DiscoveryPath{
+			{Path: filepath.Join(base, "opt", "*", "logs"), MaxDepth: 1},
+			{Path: deep, FilePatterns: []string{"*.jsonl", "*.log"}},
+		},
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+
+	var got []string
+	for _, c := range candidates {
+		rel, err := filepath.Rel(base, c.Path)
+		require.NoError(t, err)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	assert.ElementsMatch(t, []string{
+		"opt/app/logs/top.jsonl",
+		"home/u/top.jsonl",
+		"home/u/a/b/deep.jsonl",
+		"home/u/usage.log",
+	}, got)
+}
+
+func TestScanner_RulesForMostSpecificOverride(t *testing.T) {
+	sc := NewScanner(ScannerConfig{
+		MaxDepth:     10,
+		FilePatterns: []string{"*.jsonl"},
+		PathOverrides: []config.DiscoveryPath{
+			{Path: "/home", MaxDepth: 6},
+			{Path: "/home/*/logs", MaxDepth: 2},
+		},
+	}, nil, testLogger())
+
+	assert.Equal(t, 2, sc.rulesFor(filepath.FromSlash("/home/u/logs/sub")).maxDepth)
+	assert.Equal(t, 6, sc.rulesFor(filepath.FromSlash("/home/u")).maxDepth)
+	assert.Equal(t, 10, sc.rulesFor(filepath.FromSlash("/var/log")).maxDepth)
+	assert.Equal(t, []string{"*.jsonl"}, sc.rulesFor(filepath.FromSlash("/home/u")).filePatterns)
+}
+
+func TestIsWithin(t *testing.T) {
+	base := filepath.Join(string(filepath.Separator), "var", "lib", "tokenly")
+	assert.True(t, isWithin(base, base))
+	assert.True(t, isWithin(filepath.Join(base, "sub", "f.jsonl"), base))
+	assert.False(t, isWithin(base+"-other", base))
+	assert.False(t, isWithin(filepath.Dir(base), base))
+	assert.False(t, isWithin(base, ""))
+}
+
+func TestScan_ParallelRoots(t *testing.T) {
+	base := t.TempDir()
+	var roots []string
+	for i := 0; i < 8; i++ {
+		root := filepath.Join(base, fmt.Sprintf("root%d", i))
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "sub"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "a.jsonl"), []byte("{}"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "b.jsonl"), []byte("{}"), 0644))
+		roots = append(roots, root)
+	}
+	// An overlapping root must not produce duplicates.
+	roots = append(roots, filepath.Join(base, "root0", "sub"))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  roots,
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		Parallelism:     3,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 16)
+
+	paths := make(map[string]bool)
+	for _, c := range candidates {
+		assert.False(t, paths[c.Path], "duplicate %s", c.Path)
+		paths[c.Path] = true
+	}
+}
+
+func TestScan_ParallelRootsStopAtMaxFiles(t *testing.T) {
+	base := t.TempDir()
+	var roots []string
+	for i := 0; i < 6; i++ {
+		root := filepath.Join(base, fmt.Sprintf("root%d", i))
+		require.NoError(t, os.MkdirAll(root, 0755))
+		for j := 0; j < 3; j++ {
+			require.NoError(t, os.WriteFile(filepath.Join(root, fmt.Sprintf("%d.jsonl", j)), []byte("{}"), 0644))
+		}
+		roots = append(roots, root)
+	}
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  roots,
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+		MaxFiles:        4,
+		Parallelism:     2,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 4)
+}
+
+func TestScan_ContentSniffing(t *testing.T) {
+	dir := t.TempDir()
+	record := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":100,"output_tokens":50}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "usage.log"), []byte(record), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte("starting up\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.log"), []byte(strings.Repeat(record, 20)), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "skip.log"), []byte(record), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte("{}\n"), 0644))
+
+	cfg := ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludePatterns: []string{"skip.*"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}
+	candidates, _, err := NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.jsonl"}, candidateNames(candidates), "sniffing is off by default")
+
+	cfg.SniffMaxBytes = 1024
+	candidates, _, err = NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.jsonl", "usage.log"}, candidateNames(candidates))
+}
+
+func TestScan_ContentSniffingWithIndex(t *testing.T) {
+	dir := t.TempDir()
+	record := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":100,"output_tokens":50}` + "\n"
+	path := filepath.Join(dir, "usage.log")
+	require.NoError(t, os.WriteFile(path, []byte(record), 0644))
+
+	index, err := NewScanIndex(filepath.Join(t.TempDir(), "index.json"), time.Hour, testLogger())
+	require.NoError(t, err)
+	sc := newIndexedScanner(t, dir, index)
+	sc.config.SniffMaxBytes = 1024
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.log"}, candidateNames(candidates))
+
+	// The directory is unchanged, so the file comes from the index.
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"usage.log"}, candidateNames(candidates))
+}
+
+func TestScan_PathExcludePatternsPruneSubtrees(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{
+		"a.jsonl",
+		"node_modules/pkg/b.jsonl",
+		"project/node_modules/c.jsonl",
+		"archive/2024/d.jsonl",
+		"logs/archive.jsonl",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	}
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludePatterns: []string{"**/node_modules/**", filepath.ToSlash(dir) + "/archive/**"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a.jsonl", "archive.jsonl"}, candidateNames(candidates))
+}
+
+func TestSplitExcludes(t *testing.T) {
+	t.Setenv("TOKENLY_TEST_DIR", "/data")
+	rules := splitExcludes(scanRules{excludePatterns: []string{"*temp*", "**/cache/**", "$TOKENLY_TEST_DIR/old/**"}})
+	assert.Equal(t, []string{"*temp*"}, rules.excludePatterns)
+	assert.Equal(t, []string{"**/cache/**", "/data/old/**"}, rules.excludePaths)
+
+	assert.True(t, excludedPath("/home/u/cache", rules))
+	assert.True(t, excludedPath("/home/u/cache/x.jsonl", rules))
+	assert.False(t, excludedPath("/home/u/cached/x.jsonl", rules))
+	assert.True(t, excluded("/home/u/temp.jsonl", rules))
+}
+
+func TestScan_NetworkFSPolicy(t *testing.T) {
+	dir := t.TempDir()
+	share := filepath.Join(dir, "share")
+	for _, rel := range []string{"local.jsonl", "share/a.jsonl", "share/1/b.jsonl", "share/1/2/c.jsonl"} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	}
+
+	scan := func(cfg ScannerConfig) []string {
+		cfg.DiscoveryPaths = []string{dir}
+		cfg.FilePatterns = []string{"*.jsonl"}
+		sc := NewScanner(cfg, nil, testLogger())
+		sc.remoteFS = func(path string) string {
+			if isWithin(path, share) {
+				return "nfs"
+			}
+			return ""
+		}
+		candidates, _, err := sc.Scan(context.Background())
+		require.NoError(t, err)
+		return candidateNames(candidates)
+	}
+
+	assert.ElementsMatch(t, []string{"local.jsonl", "a.jsonl", "b.jsonl", "c.jsonl"}, scan(ScannerConfig{NetworkFSPolicy: NetworkFSScan}))
+	assert.ElementsMatch(t, []string{"local.jsonl"}, scan(ScannerConfig{NetworkFSPolicy: NetworkFSSkip}))
+	assert.ElementsMatch(t, []string{"local.jsonl", "a.jsonl", "b.jsonl"}, scan(ScannerConfig{NetworkMaxDepth: 1}),
+		"limited to one level below the mount by default policy")
+	assert.ElementsMatch(t, []string{"local.jsonl"}, scan(ScannerConfig{NetworkMaxTime: time.Nanosecond}))
+}
+
+func TestScan_CaseInsensitivePatterns(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{"USAGE.JSONL", "usage.jsonl.GZ", "Temp-Usage.jsonl", "Archive/old.jsonl"} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	}
+
+	cfg := ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludePatterns: []string{"*temp*", "**/archive/**"},
+	}
+	candidates, _, err := NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"usage.jsonl.GZ", "Temp-Usage.jsonl", "old.jsonl"}, candidateNames(candidates),
+		"the .gz suffix is always case insensitive")
+
+	cfg.CaseInsensitive = true
+	candidates, _, err = NewScanner(cfg, nil, testLogger()).Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"USAGE.JSONL", "usage.jsonl.GZ"}, candidateNames(candidates))
+}
+
+func TestUnseen_ExploresNoParentOfRoot(t *testing.T) {
+	root := filepath.VolumeName(t.TempDir()) + string(filepath.Separator)
+	dir := filepath.Join(root, "logs", "app")
+	seen := map[string]bool{}
+	assert.Equal(t, []string{filepath.Dir(dir)}, unseen(seen, []string{root, dir, dir}, parentDir))
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// Reasons a scan passes over a file or directory, as counted in
+// config.ScanReport.Filtered.
+const (
+	FilterFilePattern    = "file_pattern"    // file matches no file pattern
+	FilterExcludePattern = "exclude_pattern" // file or directory matches an exclude pattern
+	FilterIgnoreFile     = "ignore_file"     // matched by a .tokenlyignore file
+	FilterAgentDir       = "agent_dir"       // one of the agent's own directories
+	FilterAgentFile      = "agent_file"      // one of the agent's own state files
+	FilterMaxDepth       = "max_depth"       // directory below the path's max depth
+	FilterSymlink        = "symlink"         // symlink skipped by policy, or broken
+	FilterNetworkFS      = "network_fs"      // directory on a network filesystem, skipped or past its limits
+	FilterNegativeCache  = "negative_cache"  // directory inside a negative-cached subtree
+	FilterMaxAge         = "max_age"         // file older than MaxFileAgeHours
+	FilterMaxSize        = "max_size"        // file larger than MaxFileSizeMB
+	FilterSpooled        = "spooled"         // queued in the retry spool
+	FilterDone           = "done"            // processed and unchanged since
+	FilterMarked         = "marked"          // has a matching uploaded marker
+	FilterUncleanable    = "uncleanable"     // uploaded, but could not be cleaned up
+	FilterSettling       = "settling"        // still being written
+	FilterDuplicate      = "duplicate"       // already reached by another path
+	FilterMaxFiles       = "max_files"       // dropped when the scan hit MaxFiles
+)
+
+// maxReportedPaths caps the paths listed in ScanReport.PermissionErrors.
+const maxReportedPaths = 20
+
+func newScanReport(start time.Time) *config.ScanReport {
+	return &config.ScanReport{
+		StartedAt: start.UTC().Format(time.RFC3339),
+		Filtered:  make(map[string]int),
+	}
+}
+
+// filtered counts a file or directory passed over for reason.
+func (ws *walkState) filtered(reason string) {
+	ws.report.Filtered[reason]++
+}
+
+// permissionDenied records a path that could not be read.
+func (ws *walkState) permissionDenied(path string) {
+	addPermissionDenied(ws.report, path)
+}
+
+func addPermissionDenied(r *config.ScanReport, path string) {
+	r.PermissionDenied++
+	if len(r.PermissionErrors) < maxReportedPaths {
+		r.PermissionErrors = append(r.PermissionErrors, path)
+	}
+}
+
+// mergeScanReport adds the walk counts of src to dst.
+func mergeScanReport(dst, src *config.ScanReport) {
+	dst.DirsWalked += src.DirsWalked
+	dst.DirsFromIndex += src.DirsFromIndex
+	for _, p := range src.PermissionErrors {
+		addPermissionDenied(dst, p)
+	}
+	dst.PermissionDenied += src.PermissionDenied - len(src.PermissionErrors)
+	dst.GlobErrors += src.GlobErrors
+	for reason, n := range src.Filtered {
+		dst.Filtered[reason] += n
+	}
+	for pattern, n := range src.PatternHits {
+		addPatternHits(dst, pattern, n)
+	}
+}
+
+// hit counts a file whose name matched one of the walk's file patterns.
+func (ws *walkState) hit(path string) {
+	if ws.hits == nil {
+		ws.hits = make(map[string]int)
+	}
+	ws.hits[matchedPattern(path, ws.rules)]++
+}
+
+// addPatternHits counts n files found by a file pattern.
+func addPatternHits(report *config.ScanReport, pattern string, n int) {
+	if report.PatternHits == nil {
+		report.PatternHits = make(map[string]int)
+	}
+	report.PatternHits[pattern] += n
+}
@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestScan_Report(t *testing.T) {
+	dir := t.TempDir()
+	for _, rel := range []string{
+		"a.jsonl",
+		"notes.txt",
+		"temp.jsonl",
+		"old.jsonl",
+		"ignored.jsonl",
+		"sub/b.jsonl",
+		"sub/deep/c.jsonl",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(rel))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "old.jsonl"), past, past))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, IgnoreFileName), []byte("ignored.jsonl\n"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		ExcludePatterns: []string{"temp*"},
+		MaxFileAgeHours: 24,
+		MaxDepth:        1,
+	}, nil, testLogger())
+
+	candidates, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.ElementsMatch(t, []string{"a.jsonl", "b.jsonl"}, candidateNames(candidates))
+	assert.Equal(t, 2, report.Candidates)
+	assert.Equal(t, 2, report.DirsWalked)
+	assert.NotEmpty(t, report.StartedAt)
+	assert.Equal(t, map[string]int{
+		FilterFilePattern:    2, // notes.txt and the ignore file itself
+		FilterExcludePattern: 1,
+		FilterMaxAge:         1,
+		FilterIgnoreFile:     1,
+		FilterMaxDepth:       1,
+	}, report.Filtered)
+}
+
+func TestMergeScanReport(t *testing.T) {
+	dst := newScanReport(time.Now())
+	src := newScanReport(time.Now())
+	for i := 0; i < maxReportedPaths+5; i++ {
+		addPermissionDenied(src, "/p")
+	}
+	src.DirsWalked = 3
+	src.GlobErrors = 1
+	src.Filtered[FilterMaxAge] = 2
+
+	mergeScanReport(dst, src)
+	mergeScanReport(dst, src)
+	assert.Equal(t, 2*(maxReportedPaths+5), dst.PermissionDenied)
+	assert.Len(t, dst.PermissionErrors, maxReportedPaths)
+	assert.Equal(t, 6, dst.DirsWalked)
+	assert.Equal(t, 2, dst.GlobErrors)
+	assert.Equal(t, map[string]int{FilterMaxAge: 4}, dst.Filtered)
+}
+
+func TestScan_ReportCountsGlobErrors(t *testing.T) {
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{filepath.Join(t.TempDir(), "[")},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+	}, nil, testLogger())
+
+	_, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, report.GlobErrors)
+}
+
+func TestWalkState_Counts(t *testing.T) {
+	report := &config.ScanReport{Filtered: map[string]int{}}
+	ws := &walkState{report: report}
+	ws.filtered(FilterDuplicate)
+	ws.permissionDenied("/root")
+	assert.Equal(t, 1, report.Filtered[FilterDuplicate])
+	assert.Equal(t, []string{"/root"}, report.PermissionErrors)
+}
@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"io/fs"
+	"sync"
+	"time"
+)
+
+// fileStamp is the size and mtime of a file as seen by one scan.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// settleTracker holds back files that may still be being written. A file is
+// settled once its mtime is older than the quiescence window, or once two
+// consecutive scans saw the same size and mtime.
+type settleTracker struct {
+	window time.Duration
+
+	mu   sync.Mutex
+	prev map[string]fileStamp // recently modified files seen by the previous scan
+	cur  map[string]fileStamp // recently modified files seen by this scan
+}
+
+// newSettleTracker creates a settleTracker for the given quiescence window.
+func newSettleTracker(window time.Duration) *settleTracker {
+	return &settleTracker{
+		window: window,
+		prev:   make(map[string]fileStamp),
+		cur:    make(map[string]fileStamp),
+	}
+}
+
+// begin starts a new scan; stamps from the scan before last are forgotten.
+func (t *settleTracker) begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.prev, t.cur = t.cur, make(map[string]fileStamp)
+}
+
+// settled reports whether a file is safe to pick up.
+func (t *settleTracker) settled(path string, info fs.FileInfo, now time.Time) bool {
+	if now.Sub(info.ModTime()) >= t.window {
+		return true
+	}
+	stamp := fileStamp{size: info.Size(), modTime: info.ModTime()}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cur[path] = stamp
+	prev, ok := t.prev[path]
+	return ok && prev.size == stamp.size && prev.modTime.Equal(stamp.modTime)
+}
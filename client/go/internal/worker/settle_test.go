@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettleTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	now := info.ModTime().Add(time.Second)
+
+	tr := newSettleTracker(time.Minute)
+	tr.begin()
+	assert.False(t, tr.settled(path, info, now), "recently modified and not seen before")
+
+	tr.begin()
+	assert.True(t, tr.settled(path, info, now), "unchanged across two scans")
+
+	// Old enough files settle without a previous sighting.
+	tr = newSettleTracker(time.Minute)
+	tr.begin()
+	assert.True(t, tr.settled(path, info, info.ModTime().Add(2*time.Minute)))
+}
+
+func TestScan_QuiescenceDefersGrowingFiles(t *testing.T) {
+	dir := t.TempDir()
+	growing := filepath.Join(dir, "growing.jsonl")
+	old := filepath.Join(dir, "old.jsonl")
+	require.NoError(t, os.WriteFile(growing, []byte("{}\n"), 0644))
+	require.NoError(t, os.WriteFile(old, []byte("{}\n"), 0644))
+	past := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, os.Chtimes(old, past, past))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:    []string{dir},
+		FilePatterns:      []string{"*.jsonl"},
+		MaxFileAgeHours:   24,
+		MaxFileSizeMB:     10,
+		QuiescenceSeconds: 300,
+	}, nil, testLogger())
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old.jsonl"}, candidateNames(candidates))
+
+	// Still being appended to: held back again.
+	f, err := os.OpenFile(growing, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString("{}\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"old.jsonl"}, candidateNames(candidates))
+
+	// Unchanged since the last scan: picked up.
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"old.jsonl", "growing.jsonl"}, candidateNames(candidates))
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// ErrSpoolFull is returned by Scanner.Scan when the retry spool has reached
+// its file or byte budget and no new candidates should be produced.
+var ErrSpoolFull = errors.New("retry spool full")
+
+// RetrySpool tracks files whose uploads failed with a retryable error. It is
+// bounded by a file count and a byte budget; while either limit is reached the
+// scanner stops discovering new files until the backlog drains. A spool with
+// a save path survives restarts and --once runs.
+type RetrySpool struct {
+	maxFiles int
+	maxBytes int64
+	savePath string
+
+	mu    sync.Mutex
+	data  *config.SpoolFile
+	bytes int64
+	dirty bool
+}
+
+// NewRetrySpool creates an in-memory RetrySpool. Non-positive limits disable
+// that limit.
+func NewRetrySpool(maxFiles, maxMB int) *RetrySpool {
+	return &RetrySpool{
+		maxFiles: maxFiles,
+		maxBytes: int64(maxMB) * 1024 * 1024,
+		data:     config.NewSpoolFile(),
+	}
+}
+
+// OpenRetrySpool creates a RetrySpool saved at savePath, loading the files
+// queued there. A corrupt spool is discarded: the files it held are found
+// again by the next scan.
+func OpenRetrySpool(savePath string, maxFiles, maxMB int, logger *slog.Logger) (*RetrySpool, error) {
+	s := NewRetrySpool(maxFiles, maxMB)
+	s.savePath = savePath
+	data, err := config.LoadSpool(savePath)
+	switch {
+	case errors.Is(err, config.ErrCacheCorrupt):
+		logger.Warn("retry spool corrupt, starting empty", "path", savePath, "error", err)
+		s.dirty = true
+		return s, nil
+	case err != nil:
+		return nil, fmt.Errorf("load retry spool: %w", err)
+	}
+	s.data = data
+	for _, entry := range data.Files {
+		s.bytes += entry.SizeBytes
+	}
+	return s, nil
+}
+
+// Add queues a candidate for retry after the given delay. Re-adding a path
+// already queued updates its entry and increments its attempt count.
+func (s *RetrySpool) Add(c FileCandidate, delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.data.Files[c.Path]
+	if exists {
+		s.bytes -= entry.SizeBytes
+	} else {
+		entry.DiscoveredAt = c.DiscoveredAt
+	}
+	entry.SizeBytes = c.SizeBytes
+	entry.ModifiedAt = c.ModifiedAt
+	entry.Attempts++
+	entry.NextAttempt = time.Now().Add(delay)
+	s.data.Files[c.Path] = entry
+	s.bytes += entry.SizeBytes
+	s.dirty = true
+}
+
+// Remove drops a path from the spool. It is a no-op if the path is not queued.
+func (s *RetrySpool) Remove(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.data.Files[path]; ok {
+		s.bytes -= entry.SizeBytes
+		delete(s.data.Files, path)
+		s.dirty = true
+	}
+}
+
+// Contains returns true if the path is queued for retry.
+func (s *RetrySpool) Contains(path string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.data.Files[path]
+	return ok
+}
+
+// Attempts returns how many uploads of the path have failed so far, or 0 if
+// it is not queued.
+func (s *RetrySpool) Attempts(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.data.Files[path].Attempts
+}
+
+// Due returns the queued files whose retry time has passed, oldest first.
+func (s *RetrySpool) Due(now time.Time) []FileCandidate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []FileCandidate
+	for path, e := range s.data.Files {
+		if !e.NextAttempt.After(now) {
+			due = append(due, FileCandidate{
+				Path:         path,
+				SizeBytes:    e.SizeBytes,
+				ModifiedAt:   e.ModifiedAt,
+				DiscoveredAt: e.DiscoveredAt,
+			})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].ModifiedAt.Before(due[j].ModifiedAt)
+	})
+	return due
+}
+
+// Full returns true if the spool has reached its file count or byte budget.
+func (s *RetrySpool) Full() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxFiles > 0 && len(s.data.Files) >= s.maxFiles {
+		return true
+	}
+	return s.maxBytes > 0 && s.bytes >= s.maxBytes
+}
+
+// Len returns the number of queued files.
+func (s *RetrySpool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data.Files)
+}
+
+// Bytes returns the total size of queued files.
+func (s *RetrySpool) Bytes() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bytes
+}
+
+// Save persists the spool if it has a save path and changed since it was
+// loaded or last saved.
+func (s *RetrySpool) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.savePath == "" || !s.dirty {
+		return nil
+	}
+	if err := s.data.Save(s.savePath); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrySpool_AddRemove(t *testing.T) {
+	s := NewRetrySpool(10, 1)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 100}, 0)
+	s.Add(FileCandidate{Path: "/b.jsonl", SizeBytes: 50}, 0)
+
+	assert.Equal(t, 2, s.Len())
+	assert.Equal(t, int64(150), s.Bytes())
+	assert.True(t, s.Contains("/a.jsonl"))
+
+	s.Remove("/a.jsonl")
+	assert.Equal(t, 1, s.Len())
+	assert.Equal(t, int64(50), s.Bytes())
+	assert.False(t, s.Contains("/a.jsonl"))
+}
+
+func TestRetrySpool_ReAddCountsAttempts(t *testing.T) {
+	s := NewRetrySpool(10, 1)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 100}, 0)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 120}, 0)
+
+	assert.Equal(t, 1, s.Len())
+	assert.Equal(t, int64(120), s.Bytes())
+	assert.Equal(t, 2, s.Attempts("/a.jsonl"))
+}
+
+func TestOpenRetrySpool_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.json")
+	s, err := OpenRetrySpool(path, 10, 1, testLogger())
+	require.NoError(t, err)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 100}, time.Hour)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 100}, time.Hour)
+	require.NoError(t, s.Save())
+
+	reopened, err := OpenRetrySpool(path, 10, 1, testLogger())
+	require.NoError(t, err)
+	assert.True(t, reopened.Contains("/a.jsonl"))
+	assert.Equal(t, 2, reopened.Attempts("/a.jsonl"))
+	assert.Equal(t, int64(100), reopened.Bytes())
+}
+
+func TestOpenRetrySpool_CorruptStartsEmpty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spool.json")
+	require.NoError(t, os.WriteFile(path, []byte("{nope"), 0644))
+
+	s, err := OpenRetrySpool(path, 10, 1, testLogger())
+	require.NoError(t, err)
+	assert.Zero(t, s.Len())
+
+	require.NoError(t, s.Save())
+	_, err = config.LoadSpool(path)
+	assert.NoError(t, err, "the corrupt file is replaced on the next save")
+}
+
+func TestRetrySpool_Due(t *testing.T) {
+	s := NewRetrySpool(10, 1)
+	s.Add(FileCandidate{Path: "/now.jsonl"}, 0)
+	s.Add(FileCandidate{Path: "/later.jsonl"}, time.Hour)
+
+	due := s.Due(time.Now())
+	require.Len(t, due, 1)
+	assert.Equal(t, "/now.jsonl", due[0].Path)
+}
+
+func TestRetrySpool_FullByCount(t *testing.T) {
+	s := NewRetrySpool(2, 0)
+	s.Add(FileCandidate{Path: "/a.jsonl"}, 0)
+	assert.False(t, s.Full())
+	s.Add(FileCandidate{Path: "/b.jsonl"}, 0)
+	assert.True(t, s.Full())
+
+	s.Remove("/a.jsonl")
+	assert.False(t, s.Full())
+}
+
+func TestRetrySpool_FullByBytes(t *testing.T) {
+	s := NewRetrySpool(0, 1)
+	s.Add(FileCandidate{Path: "/a.jsonl", SizeBytes: 1024 * 1024}, 0)
+	assert.True(t, s.Full())
+}
+
+func TestScan_SpoolFullStopsDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	spool := NewRetrySpool(1, 0)
+	spool.Add(FileCandidate{Path: "/elsewhere.jsonl"}, 0)
+	sc.SetSpool(spool)
+
+	candidates, _, err := sc.Scan(context.Background())
+	assert.ErrorIs(t, err, ErrSpoolFull)
+	assert.Empty(t, candidates)
+
+	// Resumes once the backlog drains.
+	spool.Remove("/elsewhere.jsonl")
+	candidates, _, err = sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, candidates, 1)
+}
+
+func TestScan_SkipsSpooledFiles(t *testing.T) {
+	dir := t.TempDir()
+	spooled := filepath.Join(dir, "a.jsonl")
+	require.NoError(t, os.WriteFile(spooled, []byte("{}"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.jsonl"), []byte("{}"), 0644))
+
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	spool := NewRetrySpool(10, 0)
+	spool.Add(FileCandidate{Path: spooled}, time.Hour)
+	sc.SetSpool(spool)
+
+	candidates, _, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	require.Len(t, candidates, 1)
+	assert.Contains(t, candidates[0].Path, "b.jsonl")
+}
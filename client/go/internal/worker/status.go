@@ -0,0 +1,152 @@
+package worker
+
+import (
+	"maps"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// maxRecentErrors bounds how many errors Status reports.
+const maxRecentErrors = 10
+
+// ErrorRecord is a single error observed by the worker.
+type ErrorRecord struct {
+	Time    time.Time `json:"time"`
+	Path    string    `json:"path,omitempty"`
+	Message string    `json:"message"`
+}
+
+// WorkerStatus is a point-in-time snapshot of the worker's state, safe to
+// hand to other goroutines (status endpoint, CLI).
+type WorkerStatus struct {
+	State          string        `json:"state"`
+	LastScan       time.Time     `json:"last_scan"`
+	CycleStarted   time.Time     `json:"cycle_started"`
+	CycleTotal     int           `json:"cycle_total"`     // files queued for processing this cycle
+	CycleProcessed int           `json:"cycle_processed"` // files finished this cycle
+	FilesFound     int           `json:"files_found"`
+	FilesUploaded  int           `json:"files_uploaded"`
+	TotalUploaded  int           `json:"total_uploaded"`
+	SpooledFiles   int           `json:"spooled_files"`
+	SpooledBytes   int64         `json:"spooled_bytes"`
+	RecentErrors   []ErrorRecord `json:"recent_errors"`
+	Uploads        UploadStats   `json:"uploads"`
+
+	FilesUploadedToday int   `json:"files_uploaded_today"`
+	BytesUploadedToday int64 `json:"bytes_uploaded_today"`
+	DailyCapReached    bool  `json:"daily_cap_reached"`
+
+	DiscoveryPaths   []PathCheck `json:"discovery_paths,omitempty"` // latest preflight results
+	UnreachablePaths int         `json:"unreachable_paths"`
+
+	LastScanReport *config.ScanReport `json:"last_scan_report,omitempty"`
+
+	// Invalid records in the last completed cycle by kind of failure.
+	ValidationFailures map[string]int `json:"validation_failures,omitempty"`
+}
+
+// UploadStats aggregates upload volume and speed. Cycle fields cover the
+// current (or most recent) cycle; Total fields cover the worker's lifetime.
+// Throughput is bytes over summed per-upload time, so it is not inflated by
+// concurrent uploads.
+type UploadStats struct {
+	CycleAttempts      int     `json:"cycle_attempts"`
+	CycleBytes         int64   `json:"cycle_bytes"`
+	CycleUploadMs      int64   `json:"cycle_upload_ms"`
+	CycleThroughputBps float64 `json:"cycle_throughput_bps"`
+	TotalAttempts      int     `json:"total_attempts"`
+	TotalBytes         int64   `json:"total_bytes"`
+	TotalUploadMs      int64   `json:"total_upload_ms"`
+	TotalThroughputBps float64 `json:"total_throughput_bps"`
+	LargestFileBytes   int64   `json:"largest_file_bytes"`
+	SlowestUploadMs    int64   `json:"slowest_upload_ms"`
+}
+
+// record adds one upload attempt to the stats.
+func (s *UploadStats) record(result *UploadResult) {
+	ms := result.Duration.Milliseconds()
+	s.CycleAttempts++
+	s.CycleBytes += result.BytesSent
+	s.CycleUploadMs += ms
+	s.TotalAttempts++
+	s.TotalBytes += result.BytesSent
+	s.TotalUploadMs += ms
+	s.CycleThroughputBps = throughputBps(s.CycleBytes, s.CycleUploadMs)
+	s.TotalThroughputBps = throughputBps(s.TotalBytes, s.TotalUploadMs)
+	if result.BytesSent > s.LargestFileBytes {
+		s.LargestFileBytes = result.BytesSent
+	}
+	if ms > s.SlowestUploadMs {
+		s.SlowestUploadMs = ms
+	}
+}
+
+// resetCycle clears the per-cycle fields at the start of a cycle.
+func (s *UploadStats) resetCycle() {
+	s.CycleAttempts = 0
+	s.CycleBytes = 0
+	s.CycleUploadMs = 0
+	s.CycleThroughputBps = 0
+}
+
+func throughputBps(bytes, ms int64) float64 {
+	if ms <= 0 {
+		return 0
+	}
+	return float64(bytes) / (float64(ms) / 1000)
+}
+
+// Status returns a snapshot of the worker's current state.
+func (w *Worker) Status() WorkerStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	errs := make([]ErrorRecord, len(w.recentErrors))
+	copy(errs, w.recentErrors)
+	w.quota.roll(time.Now())
+
+	var paths []PathCheck
+	unreachable := 0
+	if w.preflight != nil {
+		paths = append(paths, w.preflight.Paths...)
+		unreachable = w.preflight.Unreachable()
+	}
+
+	return WorkerStatus{
+		State:          w.state,
+		LastScan:       w.lastScan,
+		CycleStarted:   w.cycleStarted,
+		CycleTotal:     w.cycleTotal,
+		CycleProcessed: w.cycleProcessed,
+		FilesFound:     w.filesFound,
+		FilesUploaded:  w.filesUploaded,
+		TotalUploaded:  w.totalUploaded,
+		SpooledFiles:   w.spool.Len(),
+		SpooledBytes:   w.spool.Bytes(),
+		RecentErrors:   errs,
+		Uploads:        w.uploadStats,
+
+		FilesUploadedToday: w.quota.files,
+		BytesUploadedToday: w.quota.bytes,
+		DailyCapReached:    w.quota.capped,
+
+		DiscoveryPaths:   paths,
+		UnreachablePaths: unreachable,
+
+		LastScanReport: w.scanReport,
+
+		ValidationFailures: maps.Clone(w.lastFailures),
+	}
+}
+
+// recordError appends to the bounded recent-errors list. Newest last.
+func (w *Worker) recordError(path, message string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.recentErrors = append(w.recentErrors, ErrorRecord{Time: time.Now(), Path: path, Message: message})
+	if len(w.recentErrors) > maxRecentErrors {
+		w.recentErrors = w.recentErrors[len(w.recentErrors)-maxRecentErrors:]
+	}
+}
@@ -0,0 +1,137 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestWorker_StatusInitial(t *testing.T) {
+	w, err := NewWorker(testWorkerConfig(t), testLogger())
+	require.NoError(t, err)
+
+	st := w.Status()
+	assert.Equal(t, "idle", st.State)
+	assert.True(t, st.LastScan.IsZero())
+	assert.Empty(t, st.RecentErrors)
+}
+
+func TestWorker_StatusAfterCycle(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	dir := cfg.Config.DiscoveryPaths.Linux[0].Path
+	cfg.Config.DiscoveryPaths.Windows = config.PlainPaths(dir)
+	cfg.Config.DiscoveryPaths.Darwin = config.PlainPaths(dir)
+	cfg.ServerURL = "http://localhost:0"
+	content := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4"}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "usage.jsonl"), []byte(content), 0644))
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	st := w.Status()
+	assert.Equal(t, "idle", st.State)
+	assert.False(t, st.LastScan.IsZero())
+	assert.Equal(t, 1, st.FilesFound)
+	assert.Equal(t, 1, st.CycleTotal)
+	assert.Equal(t, 1, st.CycleProcessed)
+	require.NotEmpty(t, st.RecentErrors)
+	assert.Contains(t, st.RecentErrors[0].Path, "usage.jsonl")
+}
+
+func TestWorker_StatusCountsAcceptedUploadsOnly(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		f.Close()
+		switch header.Filename {
+		case "rejected.jsonl":
+			w.WriteHeader(http.StatusBadRequest)
+		case "retried.jsonl":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	for _, name := range []string{"accepted", "rejected", "retried"} {
+		writeJSONLFile(t, dir, name+".jsonl", []string{validRecord()})
+	}
+	writeJSONLFile(t, dir, "invalid.jsonl", []string{invalidRecord()})
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	st := w.Status()
+	assert.Equal(t, 4, st.CycleProcessed)
+	assert.Equal(t, 1, st.FilesUploaded, "invalid, rejected, and retried files aren't uploads")
+	assert.Equal(t, 1, st.TotalUploaded)
+}
+
+func TestWorker_RecentErrorsBounded(t *testing.T) {
+	w, err := NewWorker(testWorkerConfig(t), testLogger())
+	require.NoError(t, err)
+
+	for i := 0; i < maxRecentErrors+5; i++ {
+		w.recordError("", fmt.Sprintf("err %d", i))
+	}
+
+	st := w.Status()
+	require.Len(t, st.RecentErrors, maxRecentErrors)
+	assert.Equal(t, fmt.Sprintf("err %d", maxRecentErrors+4), st.RecentErrors[maxRecentErrors-1].Message)
+}
+
+func TestWorker_StatusConcurrentAccess(t *testing.T) {
+	w, err := NewWorker(testWorkerConfig(t), testLogger())
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			w.runScanCycle(context.Background())
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = w.Status()
+		}
+	}()
+	wg.Wait()
+}
+
+func TestUploadStats_Record(t *testing.T) {
+	var s UploadStats
+	s.record(&UploadResult{BytesSent: 1000, Duration: time.Second})
+	s.record(&UploadResult{BytesSent: 3000, Duration: time.Second})
+
+	assert.Equal(t, 2, s.CycleAttempts)
+	assert.Equal(t, int64(4000), s.CycleBytes)
+	assert.Equal(t, 2000.0, s.CycleThroughputBps)
+	assert.Equal(t, int64(3000), s.LargestFileBytes)
+	assert.Equal(t, int64(1000), s.SlowestUploadMs)
+
+	s.resetCycle()
+	assert.Zero(t, s.CycleBytes)
+	assert.Equal(t, int64(4000), s.TotalBytes)
+	assert.Equal(t, 2, s.TotalAttempts)
+}
@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// ProviderTagger infers the service and model of records that lack a service
+// field, from the file's path or the record's raw content.
+type ProviderTagger struct {
+	tags []config.ProviderTag
+}
+
+// NewProviderTagger creates a ProviderTagger. Mappings without a service, or
+// with neither a path pattern nor a content match, are ignored.
+func NewProviderTagger(tags []config.ProviderTag) *ProviderTagger {
+	t := &ProviderTagger{}
+	for _, tag := range tags {
+		if tag.Service == "" || (tag.PathPattern == "" && tag.ContentMatch == "") {
+			continue
+		}
+		t.tags = append(t.tags, tag)
+	}
+	return t
+}
+
+// matchPath returns the first mapping whose path pattern matches the file, or
+// nil. The match is case-insensitive and uses forward slashes on all platforms.
+func (t *ProviderTagger) matchPath(path string) *config.ProviderTag {
+	if t == nil {
+		return nil
+	}
+	slashed := strings.ToLower(filepath.ToSlash(path))
+	for i := range t.tags {
+		pattern := t.tags[i].PathPattern
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := doublestar.Match(strings.ToLower(pattern), slashed); ok {
+			return &t.tags[i]
+		}
+	}
+	return nil
+}
+
+// fill tags a parsed record that has no service. A content match on the line
+// takes precedence over the file's path match. Returns the mapping applied,
+// or nil if the record was left alone.
+func (t *ProviderTagger) fill(data map[string]any, line string, pathTag *config.ProviderTag) *config.ProviderTag {
+	if t == nil {
+		return nil
+	}
+	if svc, ok := data["service"].(string); ok && svc != "" {
+		return nil
+	}
+
+	tag := pathTag
+	for i := range t.tags {
+		if m := t.tags[i].ContentMatch; m != "" && strings.Contains(line, m) {
+			tag = &t.tags[i]
+			break
+		}
+	}
+	if tag == nil {
+		return nil
+	}
+
+	data["service"] = tag.Service
+	if mdl, ok := data["model"].(string); (!ok || mdl == "") && tag.Model != "" {
+		data["model"] = tag.Model
+	}
+	return tag
+}
@@ -0,0 +1,101 @@
+package worker
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestProviderTagger_MatchPath(t *testing.T) {
+	tagger := NewProviderTagger([]config.ProviderTag{
+		{PathPattern: "**/.claude/**", Service: "anthropic"},
+		{PathPattern: "", Service: "ignored"},
+		{PathPattern: "**/x/**"}, // no service; ignored
+	})
+	require.Len(t, tagger.tags, 1)
+
+	tag := tagger.matchPath("/home/u/.claude/projects/a/session.jsonl")
+	require.NotNil(t, tag)
+	assert.Equal(t, "anthropic", tag.Service)
+	assert.Nil(t, tagger.matchPath("/home/u/logs/usage.jsonl"))
+}
+
+func TestProviderTagger_FillsMissingServiceAndModel(t *testing.T) {
+	tagger := NewProviderTagger([]config.ProviderTag{
+		{PathPattern: "**/.codex/**", Service: "openai", Model: "unknown"},
+	})
+	pathTag := tagger.matchPath("/home/u/.codex/log.jsonl")
+
+	data := map[string]any{"timestamp": "2025-01-15T10:30:00Z"}
+	assert.NotNil(t, tagger.fill(data, "", pathTag))
+	assert.Equal(t, "openai", data["service"])
+	assert.Equal(t, "unknown", data["model"])
+
+	data = map[string]any{"model": "gpt-4"}
+	tagger.fill(data, "", pathTag)
+	assert.Equal(t, "gpt-4", data["model"], "existing model is kept")
+}
+
+func TestProviderTagger_KeepsExistingService(t *testing.T) {
+	tagger := NewProviderTagger([]config.ProviderTag{{PathPattern: "**", Service: "anthropic"}})
+	data := map[string]any{"service": "openai"}
+	assert.Nil(t, tagger.fill(data, "", tagger.matchPath("/a/b.jsonl")))
+	assert.Equal(t, "openai", data["service"])
+}
+
+func TestProviderTagger_ContentMatchWinsOverPath(t *testing.T) {
+	tagger := NewProviderTagger([]config.ProviderTag{
+		{PathPattern: "**/logs/**", Service: "generic"},
+		{ContentMatch: `"model":"claude-`, Service: "anthropic"},
+	})
+	pathTag := tagger.matchPath("/var/logs/usage.jsonl")
+
+	line := `{"model":"claude-sonnet","timestamp":"2025-01-15T10:30:00Z"}`
+	data := map[string]any{"model": "claude-sonnet"}
+	tag := tagger.fill(data, line, pathTag)
+	require.NotNil(t, tag)
+	assert.Equal(t, "anthropic", data["service"])
+}
+
+func TestValidateTaggedJSONLFile(t *testing.T) {
+	dir := t.TempDir()
+	untagged := `{"timestamp":"2025-01-15T10:30:00Z","model":"claude-sonnet","input_tokens":10}`
+	path := writeJSONLFile(t, dir, "session.jsonl", []string{untagged, untagged})
+
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+
+	tagger := NewProviderTagger([]config.ProviderTag{{PathPattern: dir + "/**", Service: "anthropic"}})
+	result, err = ValidateTaggedJSONLFile(path, tagger, nil, nil)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, 2, result.TaggedRecords)
+	require.NotNil(t, result.Tag)
+	assert.Equal(t, "anthropic", result.Tag.Service)
+}
+
+func TestBuildFileMetadata_WritesInferredService(t *testing.T) {
+	dir := t.TempDir()
+	untagged := `{"timestamp":"2025-01-15T10:30:00Z","model":"claude-sonnet","input_tokens":10}`
+	path := writeJSONLFile(t, dir, "session.jsonl", []string{untagged})
+
+	tagger := NewProviderTagger([]config.ProviderTag{{PathPattern: dir + "/**", Service: "anthropic"}})
+	rw := recordRewrite{tagger: tagger, pathTag: tagger.matchPath(path)}
+	meta, err := buildFileMetadata(path, config.ChecksumSHA256, GzipUploadCompressed, rw)
+	require.NoError(t, err)
+	assert.Empty(t, meta.SourceFormat, "tagging alone is not a source format")
+
+	r, err := openUpload(path, meta)
+	require.NoError(t, err)
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timestamp":"2025-01-15T10:30:00Z","service":"anthropic","model":"claude-sonnet","input_tokens":10}`,
+		string(body))
+	assert.Equal(t, int64(len(body)), meta.SizeBytes)
+}
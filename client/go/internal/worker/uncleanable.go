@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// maxUncleanableEntries caps the uncleanable list; the entries that failed
+// longest ago are dropped first.
+const maxUncleanableEntries = 1000
+
+// UncleanableList remembers uploaded files whose cleanup failed because the
+// agent may not remove them, so scans skip them rather than upload them again
+// every cycle. An entry applies while the file's size and mtime match. It is
+// safe for concurrent use.
+type UncleanableList struct {
+	mu       sync.Mutex
+	data     *config.UncleanableFile
+	savePath string
+	dirty    bool
+}
+
+// NewUncleanableList loads the list from savePath, or starts an empty one.
+// A corrupt list is discarded: cleaning up the files it listed is tried again.
+func NewUncleanableList(savePath string, logger *slog.Logger) (*UncleanableList, error) {
+	data, err := config.LoadUncleanable(savePath)
+	switch {
+	case errors.Is(err, config.ErrCacheCorrupt):
+		logger.Warn("uncleanable list corrupt, starting empty", "path", savePath, "error", err)
+		data = config.NewUncleanableFile()
+	case err != nil:
+		return nil, fmt.Errorf("load uncleanable list: %w", err)
+	}
+	return &UncleanableList{data: data, savePath: savePath}, nil
+}
+
+// Contains reports whether the file at path could not be cleaned up when it
+// last had this size and mtime. A stale entry is dropped.
+func (l *UncleanableList) Contains(path string, size int64, modTime time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	entry, ok := l.data.Files[path]
+	if !ok {
+		return false
+	}
+	if entry.Size == size && entry.ModTime.Equal(modTime) {
+		return true
+	}
+	delete(l.data.Files, path)
+	l.dirty = true
+	return false
+}
+
+// Remember records that the file at path, at this size and mtime, could not
+// be cleaned up.
+func (l *UncleanableList) Remember(path string, size int64, modTime time.Time, cause error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.data.Files[path] = config.UncleanableEntry{
+		Size:     size,
+		ModTime:  modTime,
+		Error:    cause.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+	for len(l.data.Files) > maxUncleanableEntries {
+		l.evictOldest()
+	}
+	l.dirty = true
+}
+
+// evictOldest drops the entry that failed longest ago. Callers hold mu.
+func (l *UncleanableList) evictOldest() {
+	var oldest string
+	var at time.Time
+	for path, entry := range l.data.Files {
+		if oldest == "" || entry.FailedAt.Before(at) {
+			oldest, at = path, entry.FailedAt
+		}
+	}
+	delete(l.data.Files, oldest)
+}
+
+// Save drops entries for files that no longer exist and persists the list if
+// it changed since it was loaded or last saved.
+func (l *UncleanableList) Save() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for path := range l.data.Files {
+		if _, err := os.Lstat(path); os.IsNotExist(err) {
+			delete(l.data.Files, path)
+			l.dirty = true
+		}
+	}
+	if !l.dirty {
+		return nil
+	}
+	if err := l.data.Save(l.savePath); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
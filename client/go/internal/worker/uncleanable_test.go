@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUncleanableList(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "uncleanable.json")
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("x"), 0644))
+	mtime := time.Now()
+
+	l, err := NewUncleanableList(savePath, testLogger())
+	require.NoError(t, err)
+	assert.False(t, l.Contains(path, 1, mtime))
+	l.Remember(path, 1, mtime, fs.ErrPermission)
+	assert.True(t, l.Contains(path, 1, mtime))
+	require.NoError(t, l.Save())
+
+	loaded, err := NewUncleanableList(savePath, testLogger())
+	require.NoError(t, err)
+	assert.True(t, loaded.Contains(path, 1, mtime))
+	assert.False(t, loaded.Contains(path, 2, mtime), "changed files are cleaned up again")
+	assert.False(t, loaded.Contains(path, 1, mtime), "stale entries are dropped")
+
+	// Entries for files that are gone are dropped on save.
+	loaded.Remember(path, 1, mtime, fs.ErrPermission)
+	require.NoError(t, os.Remove(path))
+	require.NoError(t, loaded.Save())
+	reloaded, err := NewUncleanableList(savePath, testLogger())
+	require.NoError(t, err)
+	assert.False(t, reloaded.Contains(path, 1, mtime))
+}
+
+func TestScan_SkipsUncleanableFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0644))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	l, err := NewUncleanableList(filepath.Join(t.TempDir(), "uncleanable.json"), testLogger())
+	require.NoError(t, err)
+	l.Remember(path, info.Size(), info.ModTime(), fs.ErrPermission)
+	sc := NewScanner(ScannerConfig{
+		DiscoveryPaths:  []string{dir},
+		FilePatterns:    []string{"*.jsonl"},
+		MaxFileAgeHours: 24,
+		MaxFileSizeMB:   10,
+	}, nil, testLogger())
+	sc.SetUncleanable(l)
+
+	candidates, report, err := sc.Scan(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, candidates)
+	assert.Equal(t, 1, report.Filtered[FilterUncleanable])
+}
+
+func TestUncleanableList_CorruptStartsEmpty(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "uncleanable.json")
+	require.NoError(t, os.WriteFile(savePath, []byte("{nope"), 0644))
+
+	l, err := NewUncleanableList(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Empty(t, l.data.Files)
+}
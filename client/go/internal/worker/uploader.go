@@ -4,27 +4,59 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
 )
 
 // FileMetadata describes the file being uploaded.
 type FileMetadata struct {
-	OriginalPath string `json:"original_path"`
-	Directory    string `json:"directory"`
-	Filename     string `json:"filename"`
-	SizeBytes    int64  `json:"size_bytes"`
-	ModifiedAt   string `json:"modified_at"`
-	CreatedAt    string `json:"created_at"`
-	LineCount    int    `json:"line_count"`
-	FileHash     string `json:"file_hash"`
+	OriginalPath  string `json:"original_path"`
+	Directory     string `json:"directory"`
+	Filename      string `json:"filename"`
+	SizeBytes     int64  `json:"size_bytes"`
+	ModifiedAt    string `json:"modified_at"`
+	CreatedAt     string `json:"created_at"`
+	LineCount     int    `json:"line_count"`
+	FileHash      string `json:"file_hash"`
+	HashAlgorithm string `json:"hash_algorithm"`
+
+	// Set for gzipped files: ContentEncoding when the compressed bytes are
+	// sent, the Original fields when they are decompressed on the fly.
+	ContentEncoding   string `json:"content_encoding,omitempty"`
+	OriginalEncoding  string `json:"original_encoding,omitempty"`
+	OriginalSizeBytes int64  `json:"original_size_bytes,omitempty"`
+
+	// Set when records are normalized from a third-party format on the fly;
+	// the size, hash, and line count are then of the normalized content.
+	SourceFormat string        `json:"source_format,omitempty"`
+	rewrite      recordRewrite // how records are rewritten as uploaded
+
+	// Set when invalid lines were stripped into a sanitized copy, which is
+	// what was hashed and sent; the original is left in place.
+	Sanitized bool `json:"sanitized,omitempty"`
+
+	Timeline   FileTimeline      `json:"-"`
+	Validation *ValidationResult `json:"-"` // summarized in the payload if records were rejected
+}
+
+// Digest returns the file's checksum with its algorithm. Metadata without an
+// algorithm predates the choice and is SHA-256.
+func (m *FileMetadata) Digest() FileDigest {
+	alg := m.HashAlgorithm
+	if alg == "" {
+		alg = config.ChecksumSHA256
+	}
+	return FileDigest{Algorithm: alg, Hex: m.FileHash}
 }
 
 // UploadResult describes the outcome of a single upload attempt.
@@ -33,14 +65,80 @@ type UploadResult struct {
 	ShouldDelete      bool
 	ShouldRetry       bool
 	ShouldStopUploads bool
+	Invalid           bool // the server refused the content itself; it is not sent again unchanged
 	RetryAfter        time.Duration
 	Error             string
+	ServerError       *ServerError // parsed error payload, nil if the body was not a JSON error
+	Ack               *UploadAck   // server acknowledgement of a 200, nil if the body had none
+
+	BytesSent int64         // file content bytes sent, without metadata or multipart framing
+	Duration  time.Duration // wall time of the whole upload attempt
+}
+
+// Throughput returns the upload rate in bytes per second, or 0 if unknown.
+func (r *UploadResult) Throughput() float64 {
+	if r.BytesSent <= 0 || r.Duration <= 0 {
+		return 0
+	}
+	return float64(r.BytesSent) / r.Duration.Seconds()
+}
+
+// UploadAck is the body of a successful ingest response, as in specs/03:
+// what the server received. FileHash is in the upload's hash_algorithm.
+type UploadAck struct {
+	IngestionID   string  `json:"ingestion_id"`
+	FileSizeBytes *int64  `json:"file_size_bytes"`
+	LineCount     *int    `json:"line_count"`
+	FileHash      *string `json:"file_hash"`
+}
+
+// ServerError is the JSON error payload returned by the ingest endpoint.
+type ServerError struct {
+	Code      string             `json:"error"`
+	Message   string             `json:"message"`
+	Details   ServerErrorDetails `json:"details"`
+	RequestID string             `json:"request_id,omitempty"`
+
+	// Set on a 413 file_too_large response, at the top level as in
+	// specs/03.
+	MaxSizeMB    float64 `json:"max_size_mb,omitempty"`
+	ActualSizeMB float64 `json:"actual_size_mb,omitempty"`
 }
 
+// ServerErrorDetails holds the optional details of a ServerError.
+type ServerErrorDetails struct {
+	RejectedLines []LineRejection `json:"rejected_lines,omitempty"`
+}
+
+// LineRejection describes a single line the server refused to ingest.
+type LineRejection struct {
+	Line   int    `json:"line"`
+	Reason string `json:"reason"`
+}
+
+// defaultMaxResponseBytes caps how much of an API response body is read.
+// Larger bodies are protocol errors.
+const defaultMaxResponseBytes = 64 * 1024
+
+// Upload timeout bounds. The per-upload timeout is the base plus the time the
+// file takes at the minimum acceptable throughput, clamped to the maximum.
+const (
+	baseUploadTimeout     = 30 * time.Second
+	maxUploadTimeout      = 60 * time.Minute
+	defaultUploadMinBytes = 32 * 1024 // bytes per second
+)
+
 // Uploader sends files to the server's ingest endpoint.
 type Uploader struct {
 	serverURL  string
+	ingestPath string
+	mode       string
+	minBps     int64 // minimum acceptable throughput used to size timeouts
+	maxResp    int64 // response body cap in bytes
+	headers    map[string]string
 	hostname   string
+	clockSkew  time.Duration // added to local time in generated timestamps
+	progress   func()        // called as file content is read; nil for none
 	httpClient *http.Client
 	logger     *slog.Logger
 }
@@ -48,72 +146,268 @@ type Uploader struct {
 // NewUploader creates an Uploader for the given server.
 func NewUploader(serverURL, hostname string, logger *slog.Logger) *Uploader {
 	return &Uploader{
-		serverURL: serverURL,
-		hostname:  hostname,
-		httpClient: &http.Client{
-			Timeout: 120 * time.Second,
-		},
-		logger: logger,
+		serverURL:  serverURL,
+		ingestPath: "/api/ingest",
+		mode:       UploadModeDirect,
+		minBps:     defaultUploadMinBytes,
+		maxResp:    defaultMaxResponseBytes,
+		hostname:   hostname,
+		// No client-wide timeout; each upload gets one sized to the file.
+		httpClient: &http.Client{},
+		logger:     logger,
 	}
 }
 
-// Upload sends a file to the server with its metadata.
-func (u *Uploader) Upload(ctx context.Context, filePath string, meta *FileMetadata) (*UploadResult, error) {
-	// Build multipart body.
-	var buf bytes.Buffer
-	writer := multipart.NewWriter(&buf)
+// SetTransport sets the HTTP transport uploads use, e.g. one configured with
+// a proxy or custom TLS. Nil keeps the default.
+func (u *Uploader) SetTransport(rt http.RoundTripper) {
+	u.httpClient.Transport = rt
+}
 
-	// Part 1: metadata JSON field.
-	metadataPayload := map[string]any{
-		"client_hostname": u.hostname,
-		"collected_at":    time.Now().UTC().Format(time.RFC3339),
-		"file_info": map[string]any{
-			"original_path": meta.OriginalPath,
-			"directory":     meta.Directory,
-			"filename":      meta.Filename,
-			"size_bytes":    meta.SizeBytes,
-			"modified_at":   meta.ModifiedAt,
-			"created_at":    meta.CreatedAt,
-			"line_count":    meta.LineCount,
-			"file_hash":     meta.FileHash,
-		},
-	}
-	metaJSON, err := json.Marshal(metadataPayload)
+// SetClockOffset sets the offset added to local time for the collected_at
+// timestamp, compensating for a host clock that is off from the server's.
+func (u *Uploader) SetClockOffset(d time.Duration) {
+	u.clockSkew = d
+}
+
+// SetIngestPath overrides the ingest endpoint path (default "/api/ingest").
+func (u *Uploader) SetIngestPath(path string) {
+	if path == "" {
+		return
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u.ingestPath = path
+}
+
+// SetUploadMode selects how file content is sent: UploadModeDirect (default)
+// or UploadModePresigned. Unknown modes fall back to direct.
+func (u *Uploader) SetUploadMode(mode string) {
+	if mode == UploadModePresigned {
+		u.mode = mode
+		return
+	}
+	u.mode = UploadModeDirect
+}
+
+// SetMinThroughput sets the slowest acceptable upload rate in KB/s, which
+// determines per-upload timeouts. Non-positive values keep the default.
+func (u *Uploader) SetMinThroughput(kbps int) {
+	if kbps > 0 {
+		u.minBps = int64(kbps) * 1024
+	}
+}
+
+// SetMaxResponseKB caps the size of server responses in KB. Non-positive
+// values keep the default.
+func (u *Uploader) SetMaxResponseKB(kb int) {
+	if kb > 0 {
+		u.maxResp = int64(kb) * 1024
+	}
+}
+
+// uploadTimeout returns the timeout for uploading a file of the given size.
+func (u *Uploader) uploadTimeout(size int64) time.Duration {
+	timeout := baseUploadTimeout
+	if size > 0 && u.minBps > 0 {
+		timeout += time.Duration(float64(size) / float64(u.minBps) * float64(time.Second))
+	}
+	if timeout > maxUploadTimeout {
+		return maxUploadTimeout
+	}
+	return timeout
+}
+
+// SetProgress sets a function called as file content is read for upload, so
+// a long upload shows the worker is not stuck. Nil disables it.
+func (u *Uploader) SetProgress(fn func()) {
+	u.progress = fn
+}
+
+// watch returns r reporting its reads to the progress function, if any.
+func (u *Uploader) watch(r io.Reader) io.Reader {
+	if u.progress == nil {
+		return r
+	}
+	return &progressReader{r: r, touch: u.progress}
+}
+
+// progressReader calls touch after each read.
+type progressReader struct {
+	r     io.Reader
+	touch func()
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.touch()
+	return n, err
+}
+
+// SetHeaders sets extra headers sent with every upload request, e.g. for
+// gateway routing or tenant identification.
+func (u *Uploader) SetHeaders(headers map[string]string) {
+	u.headers = headers
+}
+
+// Upload sends a file to the server with its metadata, using the configured
+// upload mode.
+func (u *Uploader) Upload(ctx context.Context, filePath string, meta *FileMetadata) (*UploadResult, error) {
+	metaJSON, err := json.Marshal(u.metadataPayload(meta))
 	if err != nil {
 		return nil, fmt.Errorf("marshal upload metadata: %w", err)
 	}
-	if err := writer.WriteField("metadata", string(metaJSON)); err != nil {
-		return nil, fmt.Errorf("write metadata field: %w", err)
+
+	timeout := u.uploadTimeout(meta.SizeBytes)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	var result *UploadResult
+	if u.mode == UploadModePresigned {
+		result, err = u.uploadPresigned(ctx, filePath, meta, metaJSON)
+	} else {
+		result, err = u.uploadMultipart(ctx, filePath, meta, metaJSON)
 	}
+	if result != nil {
+		result.Duration = time.Since(start)
+		verifyAck(result, meta)
+		if result.Ack != nil && result.Ack.FileHash == nil {
+			u.logger.Debug("server acknowledgement has no hash, content not verified", "path", filePath)
+		}
+		u.logger.Debug("upload finished", "path", filePath, "status", result.StatusCode,
+			"bytes_sent", result.BytesSent, "duration", result.Duration, "timeout", timeout,
+			"throughput_bps", int64(result.Throughput()))
+	}
+	return result, err
+}
 
-	// Part 2: file content.
-	filePart, err := writer.CreateFormFile("file", filepath.Base(filePath))
-	if err != nil {
-		return nil, fmt.Errorf("create file form part: %w", err)
+// metadataPayload builds the metadata object sent alongside a file.
+func (u *Uploader) metadataPayload(meta *FileMetadata) map[string]any {
+	info := map[string]any{
+		"original_path":  meta.OriginalPath,
+		"directory":      meta.Directory,
+		"filename":       meta.Filename,
+		"size_bytes":     meta.SizeBytes,
+		"modified_at":    meta.ModifiedAt,
+		"created_at":     meta.CreatedAt,
+		"line_count":     meta.LineCount,
+		"file_hash":      meta.FileHash,
+		"hash_algorithm": meta.HashAlgorithm,
+	}
+	if meta.ContentEncoding != "" {
+		info["content_encoding"] = meta.ContentEncoding
+	}
+	if meta.OriginalEncoding != "" {
+		info["original_encoding"] = meta.OriginalEncoding
+		info["original_size_bytes"] = meta.OriginalSizeBytes
 	}
-	f, err := os.Open(filePath)
+	if meta.SourceFormat != "" {
+		info["source_format"] = meta.SourceFormat
+	}
+	if meta.Sanitized {
+		info["sanitized"] = true
+	}
+	if v := meta.Validation; v != nil && v.SchemaVersion > 0 {
+		info["schema_version"] = v.SchemaVersion
+	}
+	payload := map[string]any{
+		"client_hostname": u.hostname,
+		"collected_at":    time.Now().Add(u.clockSkew).UTC().Format(time.RFC3339),
+		"file_info":       info,
+	}
+	if tl := meta.Timeline.payload(); len(tl) > 0 {
+		payload["timeline"] = tl
+	}
+	if v := meta.Validation; v != nil && v.InvalidRecords > 0 {
+		payload["validation"] = map[string]any{
+			"total_lines":     v.TotalLines,
+			"valid_records":   v.ValidRecords,
+			"invalid_records": v.InvalidRecords,
+			"rejected_lines":  v.Rejections,
+
+			"implausible_timestamps": v.ImplausibleTimestamps,
+		}
+	}
+	return payload
+}
+
+// uploadMultipart POSTs the metadata and file content to the ingest endpoint
+// as a single multipart/form-data request. The body is streamed from the file
+// as it is sent, so large files are never held in memory.
+func (u *Uploader) uploadMultipart(ctx context.Context, filePath string, meta *FileMetadata, metaJSON []byte) (*UploadResult, error) {
+	f, err := openUpload(filePath, meta)
 	if err != nil {
 		return nil, fmt.Errorf("open file for upload: %w", err)
 	}
 	defer f.Close()
-	if _, err := io.Copy(filePart, f); err != nil {
-		return nil, fmt.Errorf("copy file to multipart: %w", err)
-	}
 
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("close multipart writer: %w", err)
-	}
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	var content int64
+	var werr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		content, werr = writeMultipart(writer, metaJSON, meta.Filename, u.watch(f))
+		pw.CloseWithError(werr)
+	}()
 
 	// Build HTTP request.
-	url := u.serverURL + "/api/ingest"
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &buf)
+	url := config.JoinURL(u.serverURL, u.ingestPath)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, pr)
 	if err != nil {
+		pr.Close()
+		<-done
 		return nil, fmt.Errorf("create upload request: %w", err)
 	}
+	for k, v := range u.headers {
+		req.Header.Set(k, v)
+	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
 	u.logger.Debug("uploading file", "path", filePath, "url", url)
 
+	result, err := u.send(req)
+	// The transport has closed the body by now, which ends the writer.
+	pr.Close()
+	<-done
+	if werr != nil && !errors.Is(werr, io.ErrClosedPipe) {
+		return nil, fmt.Errorf("copy file to multipart: %w", werr)
+	}
+	if result != nil && result.StatusCode != 0 {
+		result.BytesSent = content
+	}
+	return result, err
+}
+
+// writeMultipart writes the metadata and file parts of an upload to w and
+// closes it. Returns the file content bytes written.
+func writeMultipart(w *multipart.Writer, metaJSON []byte, filename string, content io.Reader) (int64, error) {
+	// Part 1: metadata JSON field.
+	if err := w.WriteField("metadata", string(metaJSON)); err != nil {
+		return 0, fmt.Errorf("write metadata field: %w", err)
+	}
+
+	// Part 2: file content.
+	filePart, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return 0, fmt.Errorf("create file form part: %w", err)
+	}
+	n, err := io.Copy(filePart, content)
+	if err != nil {
+		return n, err
+	}
+	if err := w.Close(); err != nil {
+		return n, fmt.Errorf("close multipart writer: %w", err)
+	}
+	return n, nil
+}
+
+// send performs an API request and maps the response to an UploadResult.
+// Network errors are reported as retryable results rather than errors.
+func (u *Uploader) send(req *http.Request) (*UploadResult, error) {
 	resp, err := u.httpClient.Do(req)
 	if err != nil {
 		// Network error.
@@ -123,10 +417,42 @@ func (u *Uploader) Upload(ctx context.Context, filePath string, meta *FileMetada
 		}, nil
 	}
 	defer resp.Body.Close()
-	// Drain body to allow connection reuse.
-	io.Copy(io.Discard, resp.Body)
 
-	return mapUploadResponse(resp), nil
+	body, err := config.ReadLimited(resp.Body, u.maxResp)
+	if errors.Is(err, config.ErrResponseTooLarge) {
+		return oversizedResult(resp.StatusCode, err), nil
+	}
+
+	result := mapUploadResponse(resp)
+	if resp.StatusCode == 200 {
+		result.Ack = parseUploadAck(bytes.NewReader(body))
+	} else {
+		result.ServerError = parseServerError(bytes.NewReader(body))
+		applyServerError(result)
+	}
+	return result, nil
+}
+
+// openUpload opens a file's content as it is to be sent: normalized or
+// decompressed if the metadata says so, otherwise the bytes on disk.
+func openUpload(path string, meta *FileMetadata) (io.ReadCloser, error) {
+	if !meta.rewrite.none() {
+		return openNormalized(path, meta.rewrite)
+	}
+	if meta.OriginalEncoding == "gzip" {
+		return openContent(path)
+	}
+	return os.Open(path)
+}
+
+// oversizedResult reports a response body over the size cap. Whatever the
+// status, the response cannot be trusted, so the file is kept and retried.
+func oversizedResult(status int, err error) *UploadResult {
+	return &UploadResult{
+		StatusCode:  status,
+		ShouldRetry: true,
+		Error:       fmt.Sprintf("protocol error (%d): %v", status, err),
+	}
 }
 
 // mapUploadResponse converts an HTTP response to an UploadResult.
@@ -158,6 +484,104 @@ func mapUploadResponse(resp *http.Response) *UploadResult {
 	return result
 }
 
+// parseUploadAck decodes a success body. Returns nil if the body is empty or
+// carries no size, line count, or hash, as with older servers.
+func parseUploadAck(r io.Reader) *UploadAck {
+	var ack UploadAck
+	if err := json.NewDecoder(r).Decode(&ack); err != nil {
+		return nil
+	}
+	if ack.FileSizeBytes == nil && ack.LineCount == nil && ack.FileHash == nil {
+		return nil
+	}
+	return &ack
+}
+
+// verifyAck checks the server's acknowledgement against the local metadata.
+// On a mismatch the file is kept and retried instead of deleted, since the
+// server did not receive what was hashed, e.g. because the file grew in
+// between. Missing fields are not checked: current servers echo no hash, and
+// refusing to delete until they do would keep every uploaded file forever,
+// so without one the size and line count are all there is to go on.
+func verifyAck(result *UploadResult, meta *FileMetadata) {
+	ack := result.Ack
+	if ack == nil || !result.ShouldDelete {
+		return
+	}
+
+	var mismatch string
+	switch {
+	case ack.FileHash != nil && !strings.EqualFold(*ack.FileHash, meta.FileHash):
+		mismatch = fmt.Sprintf("%s hash %s received, expected %s", meta.Digest().Algorithm, *ack.FileHash, meta.FileHash)
+	case ack.FileSizeBytes != nil && *ack.FileSizeBytes != meta.SizeBytes:
+		mismatch = fmt.Sprintf("%d bytes received, expected %d", *ack.FileSizeBytes, meta.SizeBytes)
+	case ack.LineCount != nil && *ack.LineCount != meta.LineCount:
+		mismatch = fmt.Sprintf("%d lines received, expected %d", *ack.LineCount, meta.LineCount)
+	default:
+		return
+	}
+
+	result.ShouldDelete = false
+	result.ShouldRetry = true
+	result.Error = "server acknowledgement mismatch: " + mismatch
+}
+
+// parseServerError decodes a JSON error payload. Returns nil if the body is
+// empty or not a recognizable error object.
+func parseServerError(r io.Reader) *ServerError {
+	var se ServerError
+	if err := json.NewDecoder(r).Decode(&se); err != nil {
+		return nil
+	}
+	if se.Code == "" && se.Message == "" {
+		return nil
+	}
+	return &se
+}
+
+// Server error codes whose outcome doesn't follow from the status alone.
+// Anything else keeps the status's outcome.
+var (
+	// The content was refused and would be refused again.
+	invalidContentCodes = map[string]bool{"validation_failed": true, "invalid_records": true}
+	// The server couldn't take the file just then.
+	transientErrorCodes = map[string]bool{"storage_unavailable": true, "service_unavailable": true, "rate_limited": true}
+	// The client may not upload at all.
+	clientRefusedCodes = map[string]bool{"unknown_client": true, "client_not_approved": true}
+)
+
+// applyServerError refines an UploadResult using the server's error payload:
+// its code, or rejected lines, decide between marking the file invalid,
+// retrying it, and stopping uploads, and the error message names them.
+func applyServerError(result *UploadResult) {
+	se := result.ServerError
+	if se == nil {
+		return
+	}
+
+	switch {
+	case clientRefusedCodes[se.Code]:
+		result.ShouldStopUploads = true
+		result.ShouldRetry = false
+	case invalidContentCodes[se.Code]:
+		result.Invalid = true
+		result.ShouldRetry = false
+	case transientErrorCodes[se.Code]:
+		result.ShouldRetry = true
+	case len(se.Details.RejectedLines) > 0 && result.StatusCode < 500:
+		result.Invalid = true
+		result.ShouldRetry = false
+	}
+
+	result.Error = fmt.Sprintf("%s: %s", result.Error, se.Code)
+	if se.Message != "" {
+		result.Error += ": " + se.Message
+	}
+	if se.MaxSizeMB > 0 {
+		result.Error += fmt.Sprintf(" (%g MB, limit %g MB)", se.ActualSizeMB, se.MaxSizeMB)
+	}
+}
+
 // parseRetryAfter parses the Retry-After header as seconds.
 func parseRetryAfter(val string) time.Duration {
 	if val == "" {
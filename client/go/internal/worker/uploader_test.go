@@ -2,6 +2,7 @@ package worker
 
 import (
 	"context"
+	"encoding/json"
 	"io"
 	"mime"
 	"mime/multipart"
@@ -9,10 +10,15 @@ import (
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
 )
 
 func createTestJSONLFile(t *testing.T) string {
@@ -50,6 +56,21 @@ func TestUpload_Success200(t *testing.T) {
 	assert.Equal(t, 200, result.StatusCode)
 }
 
+func TestUpload_ReportsProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	var reads atomic.Int32
+	u.SetProgress(func() { reads.Add(1) })
+	_, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Positive(t, reads.Load(), "reading the file counts as progress")
+}
+
 func TestUpload_BadRequest400(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(400)
@@ -180,3 +201,351 @@ func TestUpload_MultipartStructure(t *testing.T) {
 	assert.Contains(t, metadataContent, "file_info")
 	assert.Contains(t, fileContent, `{"line":1}`)
 }
+
+func TestUpload_ParsesServerErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		w.Write([]byte(`{"error":"validation_failed","message":"No records provided",` +
+			`"details":{"rejected_lines":[{"line":1,"reason":"missing model"}]},"request_id":"req-1"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	require.NotNil(t, result.ServerError)
+	assert.Equal(t, "validation_failed", result.ServerError.Code)
+	assert.Equal(t, "No records provided", result.ServerError.Message)
+	assert.Equal(t, "req-1", result.ServerError.RequestID)
+	require.Len(t, result.ServerError.Details.RejectedLines, 1)
+	assert.Equal(t, 1, result.ServerError.Details.RejectedLines[0].Line)
+	assert.Equal(t, "missing model", result.ServerError.Details.RejectedLines[0].Reason)
+	assert.Contains(t, result.Error, "validation_failed")
+	assert.True(t, result.Invalid)
+	assert.False(t, result.ShouldDelete)
+}
+
+func TestUpload_ServerErrorCodeDecidesOutcome(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		invalid bool
+		retry   bool
+		stop    bool
+	}{
+		{"validation failed", 400, `{"error":"validation_failed"}`, true, false, false},
+		{"invalid records on 422", 422, `{"error":"invalid_records"}`, true, false, false},
+		{"rejected lines", 400, `{"error":"bad_request","details":{"rejected_lines":[{"line":2,"reason":"x"}]}}`, true, false, false},
+		{"rejected lines on 5xx", 500, `{"error":"internal","details":{"rejected_lines":[{"line":2,"reason":"x"}]}}`, false, true, false},
+		{"transient on 400", 400, `{"error":"storage_unavailable"}`, false, true, false},
+		{"transient on 503", 503, `{"error":"service_unavailable"}`, false, true, false},
+		{"client not approved", 400, `{"error":"client_not_approved"}`, false, false, true},
+		{"unknown client on 500", 500, `{"error":"unknown_client"}`, false, false, true},
+		{"unknown code keeps 400", 400, `{"error":"something_new"}`, false, false, false},
+		{"unknown code keeps 500", 500, `{"error":"something_new"}`, false, true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tc.status)
+				w.Write([]byte(tc.body))
+			}))
+			defer srv.Close()
+
+			u := NewUploader(srv.URL, "test-host", testLogger())
+			result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+			require.NoError(t, err)
+			require.NotNil(t, result.ServerError)
+			assert.Equal(t, tc.invalid, result.Invalid, "invalid")
+			assert.Equal(t, tc.retry, result.ShouldRetry, "retry")
+			assert.Equal(t, tc.stop, result.ShouldStopUploads, "stop uploads")
+			assert.False(t, result.ShouldDelete)
+		})
+	}
+}
+
+func TestUpload_NonJSONErrorBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(502)
+		w.Write([]byte("<html>bad gateway</html>"))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Nil(t, result.ServerError)
+	assert.True(t, result.ShouldRetry)
+	assert.Equal(t, "server error (502)", result.Error)
+}
+
+func TestUpload_ParsesFileTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(413)
+		w.Write([]byte(`{"error":"file_too_large","message":"File size exceeds maximum allowed limit",` +
+			`"max_size_mb":50,"actual_size_mb":55}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	require.NotNil(t, result.ServerError)
+	assert.Equal(t, float64(50), result.ServerError.MaxSizeMB)
+	assert.Equal(t, float64(55), result.ServerError.ActualSizeMB)
+	assert.Contains(t, result.Error, "limit 50 MB")
+	assert.False(t, result.ShouldDelete)
+	assert.False(t, result.ShouldRetry)
+}
+
+func TestUpload_ConflictIsNotDelivery(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(409)
+		w.Write([]byte(`{"error":"conflict","message":"ingestion already exists"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.False(t, result.ShouldDelete, "409 is not part of the ingest contract")
+	assert.Equal(t, 409, result.StatusCode)
+}
+
+func TestUpload_CustomPathAndHeaders(t *testing.T) {
+	var gotPath, gotTenant string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		gotTenant = r.Header.Get("X-Tenant-ID")
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	u.SetIngestPath("gw/v1/ingest")
+	u.SetHeaders(map[string]string{"X-Tenant-ID": "acme"})
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "/gw/v1/ingest", gotPath)
+	assert.Equal(t, "acme", gotTenant)
+}
+
+func TestUpload_RecordsBytesAndDuration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(`{"line":1}`+"\n")), result.BytesSent, "file content only")
+	assert.Greater(t, result.Duration, time.Duration(0))
+	assert.Greater(t, result.Throughput(), 0.0)
+}
+
+func TestUploader_TimeoutScalesWithSize(t *testing.T) {
+	u := NewUploader("http://example", "test-host", testLogger())
+	u.SetMinThroughput(100) // 100 KB/s
+
+	assert.Equal(t, baseUploadTimeout, u.uploadTimeout(0))
+	assert.Equal(t, baseUploadTimeout+10*time.Second, u.uploadTimeout(1000*1024))
+	assert.Equal(t, maxUploadTimeout, u.uploadTimeout(1<<40))
+}
+
+func TestUpload_TimeoutIsRetryable(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	result, err := u.Upload(ctx, createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.True(t, result.ShouldRetry)
+	assert.NotEmpty(t, result.Error)
+}
+
+func TestUpload_AckMatchDeletes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"ingestion_id":"ing-1","status":"accepted","file_size_bytes":12,"line_count":1,"file_hash":"ABC123"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	require.NotNil(t, result.Ack)
+	assert.True(t, result.ShouldDelete)
+	assert.Empty(t, result.Error)
+}
+
+func TestUpload_AckHashMismatchRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"ingestion_id":"ing-1","status":"accepted","file_size_bytes":12,"line_count":1,"file_hash":"def456"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.False(t, result.ShouldDelete)
+	assert.True(t, result.ShouldRetry)
+	assert.Contains(t, result.Error, "hash def456 received, expected abc123")
+}
+
+func TestUpload_AckWithoutHashTrustsSizeAndLines(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"ingestion_id":"ing-1","file_size_bytes":12,"line_count":1}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	require.NotNil(t, result.Ack)
+	assert.Nil(t, result.Ack.FileHash)
+	assert.True(t, result.ShouldDelete, "no hash to check fails open")
+}
+
+func TestParseUploadAck_HashOnly(t *testing.T) {
+	ack := parseUploadAck(strings.NewReader(`{"file_hash":"abc123"}`))
+	require.NotNil(t, ack)
+	require.NotNil(t, ack.FileHash)
+	assert.Equal(t, "abc123", *ack.FileHash)
+}
+
+func TestUpload_AckSizeMismatchRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"ingestion_id":"ing-1","status":"accepted","file_size_bytes":40,"line_count":1}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.False(t, result.ShouldDelete)
+	assert.True(t, result.ShouldRetry)
+	assert.Contains(t, result.Error, "40 bytes received, expected 12")
+}
+
+func TestUpload_OversizedResponseRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"line_count":1,"padding":"` + strings.Repeat("x", 2048) + `"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	u.SetMaxResponseKB(1)
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.False(t, result.ShouldDelete)
+	assert.True(t, result.ShouldRetry)
+	assert.Contains(t, result.Error, "protocol error")
+}
+
+func TestUpload_AckLineCountMismatchRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"line_count":0}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.False(t, result.ShouldDelete)
+	assert.True(t, result.ShouldRetry)
+	assert.Contains(t, result.Error, "0 lines received, expected 1")
+}
+
+func TestUpload_NoAckTrustsStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL, "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Nil(t, result.Ack)
+	assert.True(t, result.ShouldDelete)
+}
+
+func TestUploader_MetadataIncludesValidationSummary(t *testing.T) {
+	u := NewUploader("http://example", "test-host", testLogger())
+	meta := testMeta()
+	meta.Validation = &ValidationResult{TotalLines: 3, ValidRecords: 3}
+	assert.NotContains(t, u.metadataPayload(meta), "validation", "only sent when records were rejected")
+
+	meta.Validation = &ValidationResult{TotalLines: 3, ValidRecords: 2, InvalidRecords: 1,
+		Rejections: []LineRejection{{Line: 2, Reason: `missing field "model"`}}}
+	data, err := json.Marshal(u.metadataPayload(meta)["validation"])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"total_lines":3,"valid_records":2,"invalid_records":1,"implausible_timestamps":0,
+		"rejected_lines":[{"line":2,"reason":"missing field \"model\""}]}`, string(data))
+}
+
+func TestUploader_CollectedAtAppliesClockOffset(t *testing.T) {
+	u := NewUploader("http://example", "test-host", testLogger())
+	u.SetClockOffset(2 * time.Hour)
+
+	collected, err := time.Parse(time.RFC3339, u.metadataPayload(testMeta())["collected_at"].(string))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(2*time.Hour), collected, 5*time.Second)
+}
+
+func TestUploader_MetadataIncludesSchemaVersion(t *testing.T) {
+	u := NewUploader("http://example", "test-host", testLogger())
+	meta := testMeta()
+	meta.Validation = &ValidationResult{TotalLines: 1, ValidRecords: 1}
+	assert.NotContains(t, u.metadataPayload(meta)["file_info"], "schema_version")
+
+	meta.Validation.SchemaVersion = 3
+	assert.Equal(t, 3, u.metadataPayload(meta)["file_info"].(map[string]any)["schema_version"])
+}
+
+func TestUploader_MetadataIncludesHashAlgorithm(t *testing.T) {
+	u := NewUploader("http://example", "test-host", testLogger())
+	meta := testMeta()
+	meta.HashAlgorithm = config.ChecksumBLAKE3
+	info := u.metadataPayload(meta)["file_info"].(map[string]any)
+	assert.Equal(t, "blake3", info["hash_algorithm"])
+	assert.Equal(t, "abc123", info["file_hash"])
+}
+
+func TestFileMetadata_DigestDefaultsToSHA256(t *testing.T) {
+	meta := testMeta()
+	assert.Equal(t, FileDigest{Algorithm: config.ChecksumSHA256, Hex: "abc123"}, meta.Digest())
+}
+
+func TestUpload_ServerBasePath(t *testing.T) {
+	var gotPath string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	u := NewUploader(srv.URL+"/tokenly/", "test-host", testLogger())
+	result, err := u.Upload(context.Background(), createTestJSONLFile(t), testMeta())
+	require.NoError(t, err)
+	assert.Equal(t, 200, result.StatusCode)
+	assert.Equal(t, "/tokenly/api/ingest", gotPath)
+}
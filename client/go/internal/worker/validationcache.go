@@ -0,0 +1,156 @@
+package worker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+// maxValidationCacheEntries caps the validation cache; the entries checked
+// longest ago are dropped first.
+const maxValidationCacheEntries = 1000
+
+// ValidationCache remembers files that failed validation, so an unchanged
+// invalid file is skipped without being parsed again every cycle. An entry
+// applies while the file's size, mtime, and content hash match and the
+// validation settings are the same. It is safe for concurrent use.
+type ValidationCache struct {
+	mu       sync.Mutex
+	data     *config.ValidationCacheFile
+	savePath string
+	dirty    bool
+}
+
+// NewValidationCache loads the cache from savePath, or starts an empty one.
+// A corrupt cache is discarded: the files it listed are validated again.
+func NewValidationCache(savePath string, logger *slog.Logger) (*ValidationCache, error) {
+	data, err := config.LoadValidationCache(savePath)
+	switch {
+	case errors.Is(err, config.ErrCacheCorrupt):
+		logger.Warn("validation cache corrupt, starting empty", "path", savePath, "error", err)
+		data = config.NewValidationCacheFile()
+	case err != nil:
+		return nil, fmt.Errorf("load validation cache: %w", err)
+	}
+	return &ValidationCache{data: data, savePath: savePath}, nil
+}
+
+// KnownInvalid reports whether the file at path failed validation under the
+// same rules when it last had this size and mtime, and its content is still
+// the same. Stale entries are dropped.
+func (c *ValidationCache) KnownInvalid(path string, size int64, modTime time.Time, rules string) bool {
+	c.mu.Lock()
+	entry, ok := c.data.Files[path]
+	c.mu.Unlock()
+	if !ok {
+		return false
+	}
+	// The content is hashed as it was when remembered, whatever checksum
+	// uploads use now.
+	alg, _, _ := strings.Cut(entry.Hash, ":")
+	if entry.Size == size && entry.ModTime.Equal(modTime) && entry.Rules == rules {
+		if d, _, _, err := digestFile(path, alg, false); err == nil && d.key() == entry.Hash {
+			return true
+		}
+	}
+	c.forget(path)
+	return false
+}
+
+// Remember records that the file at path failed validation under rules,
+// identifying its content by the checksum alg that uploads use.
+func (c *ValidationCache) Remember(path string, size int64, modTime time.Time, rules, alg string, result *ValidationResult) error {
+	d, _, _, err := digestFile(path, alg, false)
+	if err != nil {
+		return fmt.Errorf("hash %q: %w", path, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.data.Files[path] = config.CachedValidation{
+		Size:           size,
+		ModTime:        modTime,
+		Hash:           d.key(),
+		Rules:          rules,
+		TotalLines:     result.TotalLines,
+		InvalidRecords: result.InvalidRecords,
+		CheckedAt:      time.Now().UTC(),
+	}
+	for len(c.data.Files) > maxValidationCacheEntries {
+		c.evictOldest()
+	}
+	c.dirty = true
+	return nil
+}
+
+// forget drops the entry for path, if any.
+func (c *ValidationCache) forget(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.data.Files[path]; ok {
+		delete(c.data.Files, path)
+		c.dirty = true
+	}
+}
+
+// evictOldest drops the entry checked longest ago. Callers hold mu.
+func (c *ValidationCache) evictOldest() {
+	var oldest string
+	var at time.Time
+	for path, entry := range c.data.Files {
+		if oldest == "" || entry.CheckedAt.Before(at) {
+			oldest, at = path, entry.CheckedAt
+		}
+	}
+	delete(c.data.Files, oldest)
+}
+
+// Save persists the cache if it changed since it was loaded or last saved.
+func (c *ValidationCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	if err := c.data.Save(c.savePath); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
+
+// validationRules fingerprints the config settings that decide whether a
+// file is valid, along with the client version and the record formats it can
+// normalize, so cached results are discarded when any of them change.
+func validationRules(cfg *config.ClientConfig, version string) string {
+	adapters := make([]string, len(formatAdapters))
+	for i, a := range formatAdapters {
+		adapters[i] = a.Name()
+	}
+	data, _ := json.Marshal(struct {
+		Schema   *config.ValidationSchema
+		Skew     int
+		Horizon  int
+		Tags     []config.ProviderTag
+		CSV      map[string]string
+		Sanitize bool
+		MaxLine  int
+		Allowed  []string
+		Blocked  []string
+		Required []string
+		Adapters []string
+		Version  string
+	}{cfg.ValidationSchema, cfg.TimestampSkewMinutes, cfg.TimestampHorizonDays,
+		cfg.ProviderTags, cfg.CSVColumns, cfg.SanitizeInvalidLines, cfg.MaxLineKB,
+		cfg.AllowedServices, cfg.BlockedServices, cfg.RequiredFields, adapters, version})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
+)
+
+func TestValidationCache_KnownInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "bad.jsonl", []string{invalidRecord()})
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	savePath := filepath.Join(dir, "cache.json")
+
+	c, err := NewValidationCache(savePath, testLogger())
+	require.NoError(t, err)
+	assert.False(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r1"))
+	require.NoError(t, c.Remember(path, info.Size(), info.ModTime(), "r1", config.ChecksumSHA256, &ValidationResult{TotalLines: 1, InvalidRecords: 1}))
+	require.NoError(t, c.Save())
+
+	c, err = NewValidationCache(savePath, testLogger())
+	require.NoError(t, err)
+	assert.True(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r1"), "survives a restart")
+	assert.False(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r2"), "other rules")
+	assert.False(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r1"), "stale entries are dropped")
+}
+
+func TestValidationCache_ContentChange(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "bad.jsonl", []string{invalidRecord()})
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	c, err := NewValidationCache(filepath.Join(dir, "cache.json"), testLogger())
+	require.NoError(t, err)
+	require.NoError(t, c.Remember(path, info.Size(), info.ModTime(), "r1", config.ChecksumSHA256, &ValidationResult{}))
+
+	// Same size, restored mtime, different bytes.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[0] = ' '
+	require.NoError(t, os.WriteFile(path, data, 0644))
+	require.NoError(t, os.Chtimes(path, info.ModTime(), info.ModTime()))
+	assert.False(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r1"))
+}
+
+func TestValidationCache_Evicts(t *testing.T) {
+	c, err := NewValidationCache(filepath.Join(t.TempDir(), "cache.json"), testLogger())
+	require.NoError(t, err)
+	path := writeJSONLFile(t, t.TempDir(), "bad.jsonl", []string{invalidRecord()})
+	for i := range maxValidationCacheEntries {
+		c.data.Files[fmt.Sprintf("/logs/%d.jsonl", i)] = config.CachedValidation{CheckedAt: time.Unix(int64(i), 0)}
+	}
+	require.NoError(t, c.Remember(path, 1, time.Now(), "r1", config.ChecksumSHA256, &ValidationResult{}))
+	assert.Len(t, c.data.Files, maxValidationCacheEntries)
+	assert.Contains(t, c.data.Files, path)
+	assert.NotContains(t, c.data.Files, "/logs/0.jsonl", "the oldest entry is dropped")
+}
+
+func TestValidationRules(t *testing.T) {
+	cfg := config.DefaultConfig()
+	before := validationRules(&cfg, "1.0.0")
+	assert.Equal(t, before, validationRules(&cfg, "1.0.0"))
+	assert.NotEqual(t, before, validationRules(&cfg, "1.1.0"), "a new client may validate differently")
+	cfg.TimestampHorizonDays = 30
+	assert.NotEqual(t, before, validationRules(&cfg, "1.0.0"))
+}
+
+func TestValidationCache_CorruptStartsEmpty(t *testing.T) {
+	savePath := filepath.Join(t.TempDir(), "cache.json")
+	require.NoError(t, os.WriteFile(savePath, []byte("{nope"), 0644))
+
+	c, err := NewValidationCache(savePath, testLogger())
+	require.NoError(t, err)
+	assert.Empty(t, c.data.Files)
+}
+
+func TestValidationCache_HashesWithRememberedAlgorithm(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "bad.jsonl", []string{invalidRecord()})
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	c, err := NewValidationCache(filepath.Join(dir, "cache.json"), testLogger())
+	require.NoError(t, err)
+	require.NoError(t, c.Remember(path, info.Size(), info.ModTime(), "r1", config.ChecksumBLAKE3, &ValidationResult{}))
+	assert.True(t, strings.HasPrefix(c.data.Files[path].Hash, config.ChecksumBLAKE3+":"))
+	assert.True(t, c.KnownInvalid(path, info.Size(), info.ModTime(), "r1"))
+}
+
+func TestWorker_SkipsKnownInvalidFiles(t *testing.T) {
+	var uploads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	path := writeJSONLFile(t, dir, "bad.jsonl", []string{invalidRecord(), invalidRecord()})
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.True(t, w.invalid.KnownInvalid(path, info.Size(), info.ModTime(), w.rules))
+	assert.FileExists(t, cfg.CachePath, "saved at the end of the cycle")
+
+	w.runScanCycle(context.Background())
+	assert.Zero(t, uploads.Load())
+	assert.FileExists(t, path)
+}
@@ -1,11 +1,19 @@
 package worker
 
 import (
-	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
 )
 
 // ValidationResult holds the outcome of validating a JSONL file.
@@ -14,22 +22,133 @@ type ValidationResult struct {
 	ValidRecords   int
 	InvalidRecords int
 	Valid          bool
+
+	TaggedRecords int                 // records whose service was inferred
+	Tag           *config.ProviderTag // first mapping applied, nil if none
+
+	AdaptedRecords int    // records normalized by a FormatAdapter
+	Format         string // first adapter applied, else FormatCSV or a text encoding, else ""
+
+	// Rejections lists the first invalid records by line number in the
+	// original file, with the reason each was rejected. A sanitized copy
+	// leaves these lines out.
+	Rejections []LineRejection
+
+	// ImplausibleTimestamps counts the invalid records rejected only because
+	// their timestamp was too far in the future or the past.
+	ImplausibleTimestamps int
+
+	// SchemaVersion is the highest schema_version of any record, 0 if none
+	// has one.
+	SchemaVersion int
+
+	// Failures counts the invalid records by kind of failure, e.g.
+	// "missing_field:model". Unlike the reasons in Rejections, kinds hold no
+	// record content.
+	Failures map[string]int
+
+	skipped    int    // leading lines passed over unvalidated
+	prefixHash string // SHA-256 of the skipped lines; "" if fewer were read
+	lines      int    // lines read, including skipped ones
+	linesHash  string // SHA-256 of all lines read
+}
+
+// Kinds of record failure counted in ValidationResult.Failures. Kinds about
+// a field are suffixed with ":" and the field's name.
+const (
+	failNotJSON        = "not_json"
+	failLineTooLong    = "line_too_long"
+	failSchemaVersion  = "bad_schema_version"
+	failMissingField   = "missing_field"
+	failWrongType      = "wrong_type"
+	failOutOfRange     = "out_of_range"
+	failInconsistent   = "inconsistent"
+	failServiceBlocked = "service_not_allowed"
+	failFutureTime     = "future_timestamp"
+	failOldTime        = "old_timestamp"
+)
+
+// fieldFailure returns the failure kind for a field.
+func fieldFailure(kind, field string) string {
+	return kind + ":" + field
+}
+
+// maxLineRejections caps ValidationResult.Rejections.
+const maxLineRejections = 20
+
+// reject counts an invalid record and its kind of failure, and notes why, up
+// to maxLineRejections.
+func (r *ValidationResult) reject(line int, reason, kind string) {
+	r.InvalidRecords++
+	if r.Failures == nil {
+		r.Failures = make(map[string]int)
+	}
+	r.Failures[kind]++
+	if len(r.Rejections) < maxLineRejections {
+		r.Rejections = append(r.Rejections, LineRejection{Line: line, Reason: reason})
+	}
 }
 
 // ValidateJSONLFile opens the file at path and validates each non-empty line
-// as a token-usage JSON record. The file is considered valid if at least 50%
-// of its non-empty lines are valid records.
+// as a token-usage JSON record under the default schema. The file is
+// considered valid if at least 50% of its non-empty lines are valid records.
 func ValidateJSONLFile(path string) (*ValidationResult, error) {
-	f, err := os.Open(path)
+	return ValidateTaggedJSONLFile(path, nil, nil, nil)
+}
+
+// ValidateTaggedJSONLFile is ValidateJSONLFile with records in a known
+// third-party format normalized (see FormatAdapter), records lacking a service
+// field tagged by the given ProviderTagger, and all of them checked by the given
+// RecordValidator. CSV files are first converted to JSONL by conv. A nil
+// tagger disables tagging; a nil validator applies the default schema; a nil
+// converter keeps CSV headers as field names.
+func ValidateTaggedJSONLFile(path string, tagger *ProviderTagger, rules *RecordValidator, conv *CSVConverter) (*ValidationResult, error) {
+	return validateRecords(path, tagger, rules, conv, nil, 0)
+}
+
+// validateRecords implements ValidateTaggedJSONLFile, also copying each valid
+// line as read (after CSV conversion, before normalization) to keep, if set.
+// The first skip lines are only hashed, so that a caller can tell whether
+// they are the lines it saw before.
+func validateRecords(path string, tagger *ProviderTagger, rules *RecordValidator, conv *CSVConverter, keep io.Writer, skip int) (*ValidationResult, error) {
+	f, enc, err := openRecords(path, conv)
 	if err != nil {
 		return nil, fmt.Errorf("open file for validation: %w", err)
 	}
 	defer f.Close()
 
-	result := &ValidationResult{}
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
+	result := &ValidationResult{skipped: skip}
+	h := sha256.New()
+	if isCSV(path) {
+		result.Format = FormatCSV
+	}
+	pathTag := tagger.matchPath(path)
+	lines := newLineReader(f, rules.lineLimit())
+	lineNo := 0
+	var adapter FormatAdapter
+	for {
+		raw, tooLong, err := lines.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read line: %w", err)
+		}
+		lineNo++
+		h.Write(raw)
+		h.Write([]byte{'\n'})
+		if lineNo <= skip {
+			if lineNo == skip {
+				result.prefixHash = hex.EncodeToString(h.Sum(nil))
+			}
+			continue
+		}
+		if tooLong {
+			result.TotalLines++
+			result.reject(lineNo, fmt.Sprintf("line is longer than %d bytes", lines.limit), failLineTooLong)
+			continue
+		}
+		line := string(raw)
 		if line == "" {
 			continue
 		}
@@ -37,19 +156,53 @@ func ValidateJSONLFile(path string) (*ValidationResult, error) {
 
 		var data map[string]any
 		if err := json.Unmarshal([]byte(line), &data); err != nil {
-			result.InvalidRecords++
+			result.reject(lineNo, "not a JSON object", failNotJSON)
 			continue
 		}
 
-		if validateRecord(data) {
-			result.ValidRecords++
-		} else {
-			result.InvalidRecords++
+		// The first record an adapter matches selects it for the whole file,
+		// as uploads are normalized with a single adapter.
+		if adapter == nil {
+			adapter = matchAdapter(data)
+		}
+		if adapter != nil && adapter.Match(data) {
+			data = adapter.Normalize(data)
+			result.AdaptedRecords++
+			if result.Format == "" {
+				result.Format = adapter.Name()
+			}
+		}
+
+		if tag := tagger.fill(data, line, pathTag); tag != nil {
+			result.TaggedRecords++
+			if result.Tag == nil {
+				result.Tag = tag
+			}
+		}
+
+		if n, _ := schemaVersion(data); n > result.SchemaVersion {
+			result.SchemaVersion = n
+		}
+
+		if reason, kind := rules.check(data); reason != "" {
+			result.reject(lineNo, reason, kind)
+			if implausibleTime(kind) {
+				result.ImplausibleTimestamps++
+			}
+			continue
+		}
+		result.ValidRecords++
+		if keep != nil {
+			if _, err := io.WriteString(keep, line+"\n"); err != nil {
+				return nil, fmt.Errorf("write valid line: %w", err)
+			}
 		}
 	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scan file: %w", err)
+	if result.Format == "" {
+		result.Format = enc
 	}
+	result.lines = lineNo
+	result.linesHash = hex.EncodeToString(h.Sum(nil))
 
 	if result.TotalLines == 0 {
 		result.Valid = false
@@ -60,65 +213,348 @@ func ValidateJSONLFile(path string) (*ValidationResult, error) {
 	return result, nil
 }
 
-// validateRecord checks that a single parsed JSON record has the required
-// fields and that optional numeric fields are within bounds.
-func validateRecord(data map[string]any) bool {
-	// timestamp: required, string, RFC 3339
-	tsRaw, ok := data["timestamp"]
-	if !ok {
-		return false
-	}
-	ts, ok := tsRaw.(string)
-	if !ok || ts == "" {
+// defaultSniffLines is how many lines content sniffing probes by default.
+const defaultSniffLines = 5
+
+// looksLikeTokenFile probes up to maxLines non-empty lines at the start of a
+// file and reports whether at least half are valid token records under rules,
+// the same threshold ValidateJSONLFile applies to whole files.
+func looksLikeTokenFile(path string, maxLines int, rules *RecordValidator) bool {
+	r, _, err := openText(path)
+	if err != nil {
 		return false
 	}
-	if _, err := time.Parse(time.RFC3339, ts); err != nil {
-		return false
+	defer r.Close()
+
+	probed, valid := 0, 0
+	lines := newLineReader(r, rules.lineLimit())
+	for probed < maxLines {
+		line, tooLong, err := lines.next()
+		if err != nil {
+			break
+		}
+		if len(line) == 0 && !tooLong {
+			continue
+		}
+		probed++
+		if tooLong {
+			continue
+		}
+		var data map[string]any
+		if json.Unmarshal(line, &data) != nil {
+			continue
+		}
+		if data, _ = adaptRecord(data); rules.Valid(data) {
+			valid++
+		}
 	}
+	return probed > 0 && valid*2 >= probed
+}
 
-	// service: required, non-empty string
-	svcRaw, ok := data["service"]
-	if !ok {
-		return false
+// RecordValidator checks parsed JSON records against a validation schema.
+type RecordValidator struct {
+	ruleSet
+	versions map[int]ruleSet // by schema_version
+
+	// Plausibility bounds on timestamp fields; 0 disables each.
+	maxSkew time.Duration // how far in the future a timestamp may be
+	horizon time.Duration // how far in the past a timestamp may be
+	now     func() time.Time
+
+	maxLine int // longest line in bytes; 0 selects defaultMaxLineBytes
+
+	allowed []string // services accepted; empty accepts any
+	blocked []string // services rejected
+}
+
+// ruleSet is the field and cross-field rules of one schema (version).
+type ruleSet struct {
+	fields []config.FieldRule
+	checks []config.CrossFieldRule
+}
+
+// newRuleSet collects a schema's rules, ignoring rules without a name and
+// cross-field checks without fields.
+func newRuleSet(schema *config.ValidationSchema) ruleSet {
+	var rs ruleSet
+	for _, f := range schema.Fields {
+		if f.Name != "" {
+			rs.fields = append(rs.fields, f)
+		}
 	}
-	svc, ok := svcRaw.(string)
-	if !ok || svc == "" {
-		return false
+	for _, c := range schema.Checks {
+		if c.Field != "" && len(c.Fields) > 0 {
+			rs.checks = append(rs.checks, c)
+		}
 	}
+	return rs
+}
 
-	// model: required, non-empty string
-	modelRaw, ok := data["model"]
-	if !ok {
-		return false
+// defaultValidator applies config.DefaultValidationSchema.
+var defaultValidator = NewRecordValidator(nil)
+
+// NewRecordValidator creates a RecordValidator for the schema. A nil schema,
+// or one without fields, selects config.DefaultValidationSchema. Rules
+// without a name, cross-field checks without fields, and versions that are
+// not positive integers or have no fields are ignored.
+func NewRecordValidator(schema *config.ValidationSchema) *RecordValidator {
+	if schema == nil || len(schema.Fields) == 0 {
+		schema = config.DefaultValidationSchema()
 	}
-	mdl, ok := modelRaw.(string)
-	if !ok || mdl == "" {
-		return false
+	v := &RecordValidator{ruleSet: newRuleSet(schema), now: time.Now}
+	for key, vs := range schema.Versions {
+		n, err := strconv.Atoi(key)
+		if err != nil || n <= 0 || vs == nil || len(vs.Fields) == 0 {
+			continue
+		}
+		if v.versions == nil {
+			v.versions = make(map[int]ruleSet)
+		}
+		v.versions[n] = newRuleSet(vs)
 	}
+	return v
+}
 
-	// input_tokens: optional, but if present must be a non-negative number <= 1,000,000
-	if v, exists := data["input_tokens"]; exists {
-		if !isValidTokenCount(v) {
-			return false
+// schemaVersion returns a record's schema_version: 0 if it has none, or
+// false if it is not a positive integer, as a number or a string.
+func schemaVersion(data map[string]any) (int, bool) {
+	switch val := data["schema_version"].(type) {
+	case nil:
+		return 0, true
+	case float64:
+		if val >= 1 && val == math.Trunc(val) && val <= math.MaxInt32 {
+			return int(val), true
 		}
+	case string:
+		if n, err := strconv.Atoi(val); err == nil && n >= 1 {
+			return n, true
+		}
+	}
+	return 0, false
+}
+
+// SetTimestampBounds rejects records with a timestamp more than maxSkew in
+// the future or more than horizon in the past. 0 disables either check.
+func (v *RecordValidator) SetTimestampBounds(maxSkew, horizon time.Duration) {
+	v.maxSkew = maxSkew
+	v.horizon = horizon
+}
+
+// SetRequiredFields replaces the schema's required fields, in every version,
+// with the named ones. Named fields the schema does not list only need to be
+// present. A nil list keeps the schema's.
+func (v *RecordValidator) SetRequiredFields(names []string) {
+	if names == nil {
+		return
+	}
+	v.ruleSet = v.ruleSet.requiring(names)
+	for n, rs := range v.versions {
+		v.versions[n] = rs.requiring(names)
 	}
+}
 
-	// output_tokens: optional, but if present must be a non-negative number <= 1,000,000
-	if v, exists := data["output_tokens"]; exists {
-		if !isValidTokenCount(v) {
-			return false
+// requiring returns a copy of the rule set requiring exactly the named fields.
+func (rs ruleSet) requiring(names []string) ruleSet {
+	out := ruleSet{checks: rs.checks}
+	listed := make(map[string]bool, len(rs.fields))
+	for _, f := range rs.fields {
+		f.Required = slices.Contains(names, f.Name)
+		listed[f.Name] = true
+		out.fields = append(out.fields, f)
+	}
+	for _, name := range names {
+		if name != "" && !listed[name] {
+			out.fields = append(out.fields, config.FieldRule{Name: name, Required: true})
+			listed[name] = true
 		}
 	}
+	return out
+}
+
+// SetMaxLineBytes sets the longest line checked; longer lines are counted as
+// invalid records without being parsed. 0 selects the default of 1 MB.
+func (v *RecordValidator) SetMaxLineBytes(n int) {
+	v.maxLine = n
+}
 
-	return true
+// SetServiceFilter rejects records whose service is not in allowed, unless
+// allowed is empty, or is in blocked. Services are matched ignoring case.
+func (v *RecordValidator) SetServiceFilter(allowed, blocked []string) {
+	v.allowed = allowed
+	v.blocked = blocked
 }
 
-// isValidTokenCount checks that v is a number, non-negative, and <= 1,000,000.
-// JSON numbers are decoded as float64 by encoding/json into map[string]any.
-func isValidTokenCount(v any) bool {
-	n, ok := v.(float64)
+// lineLimit returns the line length limit. A nil validator has the default.
+func (v *RecordValidator) lineLimit() int {
+	if v == nil || v.maxLine <= 0 {
+		return defaultMaxLineBytes
+	}
+	return v.maxLine
+}
+
+// Valid reports whether a record has every required field, every present
+// field has the declared type and lies within its bounds, and the fields are
+// consistent with each other. A nil validator applies the default schema.
+func (v *RecordValidator) Valid(data map[string]any) bool {
+	return v.Check(data) == ""
+}
+
+// Check is Valid returning why the record is invalid, e.g. `missing field
+// "model"`, or "" if it is valid.
+func (v *RecordValidator) Check(data map[string]any) string {
+	reason, _ := v.check(data)
+	return reason
+}
+
+// check implements Check, also returning the kind of failure.
+func (v *RecordValidator) check(data map[string]any) (reason, kind string) {
+	if v == nil {
+		v = defaultValidator
+	}
+	version, ok := schemaVersion(data)
 	if !ok {
+		return `field "schema_version" is not a version number`, failSchemaVersion
+	}
+	rs := v.ruleSet
+	if versioned, ok := v.versions[version]; ok {
+		rs = versioned
+	}
+	for _, f := range rs.fields {
+		val, ok := data[f.Name]
+		if !ok {
+			if f.Required {
+				return fmt.Sprintf("missing field %q", f.Name), fieldFailure(failMissingField, f.Name)
+			}
+			continue
+		}
+		if problem := checkField(val, f); problem != "" {
+			kind := failWrongType
+			if problem == outOfRange {
+				kind = failOutOfRange
+			}
+			return fmt.Sprintf("field %q %s", f.Name, problem), fieldFailure(kind, f.Name)
+		}
+	}
+	for _, c := range rs.checks {
+		if problem := checkCrossField(data, c); problem != "" {
+			return fmt.Sprintf("field %q %s", c.Field, problem), fieldFailure(failInconsistent, c.Field)
+		}
+	}
+	if service, ok := data["service"].(string); ok && !v.serviceAllowed(service) {
+		return fmt.Sprintf("service %q is not allowed", service), failServiceBlocked
+	}
+	for _, f := range rs.fields {
+		if f.Type != config.FieldTimestamp {
+			continue
+		}
+		if problem, kind := v.checkTime(data[f.Name]); problem != "" {
+			return fmt.Sprintf("field %q %s", f.Name, problem), fieldFailure(kind, f.Name)
+		}
+	}
+	return "", ""
+}
+
+// implausibleTime reports whether a failure kind is a timestamp outside the
+// plausibility bounds.
+func implausibleTime(kind string) bool {
+	return strings.HasPrefix(kind, failFutureTime+":") || strings.HasPrefix(kind, failOldTime+":")
+}
+
+// serviceAllowed applies the service filter.
+func (v *RecordValidator) serviceAllowed(service string) bool {
+	match := func(s string) bool { return strings.EqualFold(s, service) }
+	if len(v.allowed) > 0 && !slices.ContainsFunc(v.allowed, match) {
 		return false
 	}
-	return n >= 0 && n <= 1_000_000
+	return !slices.ContainsFunc(v.blocked, match)
+}
+
+// checkTime applies the plausibility bounds to a timestamp field that passed
+// checkField, or is absent. Returns what is wrong and the kind of failure, or
+// empty strings.
+func (v *RecordValidator) checkTime(val any) (problem, kind string) {
+	s, ok := val.(string)
+	if !ok || (v.maxSkew <= 0 && v.horizon <= 0) {
+		return "", ""
+	}
+	ts, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", ""
+	}
+	now := v.now()
+	if v.maxSkew > 0 && ts.After(now.Add(v.maxSkew)) {
+		return "is in the future", failFutureTime
+	}
+	if v.horizon > 0 && ts.Before(now.Add(-v.horizon)) {
+		return "is too old", failOldTime
+	}
+	return "", ""
+}
+
+// checkCrossField applies one cross-field rule and returns what is wrong, or
+// "". Rules of a kind this client does not know pass.
+func checkCrossField(data map[string]any, c config.CrossFieldRule) string {
+	n, ok := data[c.Field].(float64)
+	if !ok {
+		return ""
+	}
+	var sum float64
+	for _, name := range c.Fields {
+		part, ok := data[name].(float64)
+		if !ok {
+			return ""
+		}
+		sum += part
+	}
+	switch c.Check {
+	case config.CheckSum:
+		if n != sum {
+			return "is not the sum of " + strings.Join(c.Fields, " + ")
+		}
+	case config.CheckAtMost:
+		if n > sum {
+			return "exceeds " + strings.Join(c.Fields, " + ")
+		}
+	}
+	return ""
+}
+
+// outOfRange is checkField's problem for a number outside its bounds.
+const outOfRange = "is out of range"
+
+// checkField checks one field value against its rule and returns what is
+// wrong with it, or "". Types this client does not know only require the
+// field to be present, so a newer server's schema does not reject everything.
+func checkField(val any, f config.FieldRule) string {
+	switch f.Type {
+	case config.FieldString:
+		if s, ok := val.(string); !ok || s == "" {
+			return "is not a non-empty string"
+		}
+	case config.FieldTimestamp:
+		s, ok := val.(string)
+		if !ok {
+			return "is not an RFC 3339 timestamp"
+		}
+		if _, err := time.Parse(time.RFC3339, s); err != nil {
+			return "is not an RFC 3339 timestamp"
+		}
+	case config.FieldBool:
+		if _, ok := val.(bool); !ok {
+			return "is not a boolean"
+		}
+	case config.FieldNumber, config.FieldInteger:
+		// JSON numbers are decoded as float64 by encoding/json into map[string]any.
+		n, ok := val.(float64)
+		if !ok {
+			return "is not a number"
+		}
+		if f.Type == config.FieldInteger && n != math.Trunc(n) {
+			return "is not an integer"
+		}
+		if (f.Min != nil && n < *f.Min) || (f.Max != nil && n > *f.Max) {
+			return outOfRange
+		}
+	}
+	return ""
 }
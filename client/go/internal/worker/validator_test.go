@@ -5,9 +5,12 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/ComputClaw/tokenly-client/internal/config"
 )
 
 func writeJSONLFile(t *testing.T, dir, name string, lines []string) string {
@@ -209,3 +212,311 @@ func TestValidateJSONLFile_FileNotFound(t *testing.T) {
 	_, err := ValidateJSONLFile("/nonexistent/path/file.jsonl")
 	assert.Error(t, err)
 }
+
+func TestLooksLikeTokenFile(t *testing.T) {
+	dir := t.TempDir()
+
+	tokens := writeJSONLFile(t, dir, "usage.log", []string{validRecord(), "", validRecord(), invalidRecord()})
+	assert.True(t, looksLikeTokenFile(tokens, 5, nil))
+
+	other := writeJSONLFile(t, dir, "app.log", []string{`{"level":"info","msg":"started"}`, "plain text"})
+	assert.False(t, looksLikeTokenFile(other, 5, nil))
+
+	// Only the first lines are probed.
+	late := writeJSONLFile(t, dir, "late.log", []string{"header", "header", validRecord(), validRecord(), validRecord()})
+	assert.False(t, looksLikeTokenFile(late, 2, nil))
+	assert.True(t, looksLikeTokenFile(late, 5, nil))
+
+	assert.False(t, looksLikeTokenFile(filepath.Join(dir, "missing.log"), 5, nil))
+}
+
+func TestRecordValidator_Schema(t *testing.T) {
+	maxCost := 100.0
+	rules := NewRecordValidator(&config.ValidationSchema{Fields: []config.FieldRule{
+		{Name: "timestamp", Type: config.FieldTimestamp, Required: true},
+		{Name: "cost_usd", Type: config.FieldNumber, Required: true, Max: &maxCost},
+		{Name: "requests", Type: config.FieldInteger},
+		{Name: "cached", Type: config.FieldBool},
+		{Name: "region", Type: "geo"}, // unknown to this client: presence only
+	}})
+
+	ts := "2025-01-15T10:30:00Z"
+	assert.True(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": 0.25}), "service and model no longer required")
+	assert.False(t, rules.Valid(map[string]any{"timestamp": ts}), "missing cost_usd")
+	assert.False(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": 250.0}), "above max")
+	assert.False(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": "0.25"}), "wrong type")
+	assert.False(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": 1.0, "requests": 1.5}), "not an integer")
+	assert.True(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": 1.0, "requests": 2.0, "cached": true, "region": 7.0}))
+	assert.False(t, rules.Valid(map[string]any{"timestamp": ts, "cost_usd": 1.0, "cached": "yes"}))
+}
+
+func TestRecordValidator_DefaultSchema(t *testing.T) {
+	for _, rules := range []*RecordValidator{nil, NewRecordValidator(nil), NewRecordValidator(&config.ValidationSchema{})} {
+		assert.True(t, rules.Valid(map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "model": "gpt-4", "input_tokens": 10.0}))
+		assert.False(t, rules.Valid(map[string]any{"timestamp": "yesterday", "service": "openai", "model": "gpt-4"}))
+		assert.False(t, rules.Valid(map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "", "model": "gpt-4"}))
+		assert.False(t, rules.Valid(map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "model": "gpt-4", "output_tokens": -1.0}))
+	}
+}
+
+func TestValidateTaggedJSONLFile_Schema(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "usage.jsonl", []string{validRecord(), validRecord()})
+	rules := NewRecordValidator(&config.ValidationSchema{Fields: []config.FieldRule{
+		{Name: "cost_usd", Type: config.FieldNumber, Required: true},
+	}})
+
+	result, err := ValidateTaggedJSONLFile(path, nil, rules, nil)
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, 2, result.InvalidRecords)
+
+	result, err = ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestValidateJSONLFile_Rejections(t *testing.T) {
+	dir := t.TempDir()
+	noModel := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai"}`
+	tooMany := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":2000000}`
+	path := writeJSONLFile(t, dir, "mixed.jsonl", []string{validRecord(), "", "not json", noModel, tooMany, validRecord()})
+
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.InvalidRecords)
+	assert.Equal(t, []LineRejection{
+		{Line: 3, Reason: "not a JSON object"},
+		{Line: 4, Reason: `missing field "model"`},
+		{Line: 5, Reason: `field "input_tokens" is out of range`},
+	}, result.Rejections)
+
+	lines := make([]string, maxLineRejections+5)
+	for i := range lines {
+		lines[i] = invalidRecord()
+	}
+	result, err = ValidateJSONLFile(writeJSONLFile(t, dir, "bad.jsonl", lines))
+	require.NoError(t, err)
+	assert.Equal(t, maxLineRejections+5, result.InvalidRecords)
+	assert.Len(t, result.Rejections, maxLineRejections)
+}
+
+func TestRecordValidator_CheckReasons(t *testing.T) {
+	ts := "2025-01-15T10:30:00Z"
+	assert.Empty(t, defaultValidator.Check(map[string]any{"timestamp": ts, "service": "openai", "model": "gpt-4"}))
+	assert.Equal(t, `field "timestamp" is not an RFC 3339 timestamp`,
+		defaultValidator.Check(map[string]any{"timestamp": "yesterday", "service": "openai", "model": "gpt-4"}))
+	assert.Equal(t, `field "service" is not a non-empty string`,
+		defaultValidator.Check(map[string]any{"timestamp": ts, "service": 7.0, "model": "gpt-4"}))
+	assert.Equal(t, `field "output_tokens" is not a number`,
+		defaultValidator.Check(map[string]any{"timestamp": ts, "service": "openai", "model": "gpt-4", "output_tokens": "5"}))
+}
+
+func TestRecordValidator_TimestampBounds(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	v := NewRecordValidator(nil)
+	v.now = func() time.Time { return now }
+	record := func(ts time.Time) map[string]any {
+		return map[string]any{"timestamp": ts.Format(time.RFC3339), "service": "openai", "model": "gpt-4"}
+	}
+
+	future := record(now.Add(2 * time.Hour))
+	old := record(now.AddDate(0, 0, -40))
+	assert.True(t, v.Valid(future), "no bounds by default")
+	assert.True(t, v.Valid(old))
+
+	v.SetTimestampBounds(time.Hour, 30*24*time.Hour)
+	assert.Equal(t, `field "timestamp" is in the future`, v.Check(future))
+	assert.Equal(t, `field "timestamp" is too old`, v.Check(old))
+	assert.True(t, v.Valid(record(now.Add(30*time.Minute))), "within the allowed skew")
+	assert.True(t, v.Valid(record(now.AddDate(0, 0, -29))))
+}
+
+func TestValidateTaggedJSONLFile_ImplausibleTimestamps(t *testing.T) {
+	path := writeJSONLFile(t, t.TempDir(), "usage.jsonl", []string{
+		validRecord(),
+		`{"timestamp":"2030-01-01T00:00:00Z","service":"openai","model":"gpt-4"}`,
+		`{"timestamp":"2020-01-01T00:00:00Z","service":"openai","model":"gpt-4"}`,
+		invalidRecord(),
+	})
+	v := NewRecordValidator(nil)
+	v.now = func() time.Time { return time.Date(2025, 1, 16, 0, 0, 0, 0, time.UTC) }
+	v.SetTimestampBounds(time.Hour, 365*24*time.Hour)
+
+	result, err := ValidateTaggedJSONLFile(path, nil, v, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.ValidRecords)
+	assert.Equal(t, 3, result.InvalidRecords)
+	assert.Equal(t, 2, result.ImplausibleTimestamps)
+	assert.Equal(t, LineRejection{Line: 2, Reason: `field "timestamp" is in the future`}, result.Rejections[0])
+	assert.Equal(t, LineRejection{Line: 3, Reason: `field "timestamp" is too old`}, result.Rejections[1])
+}
+
+func TestRecordValidator_CrossFieldChecks(t *testing.T) {
+	record := func(extra map[string]any) map[string]any {
+		r := map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "model": "gpt-4",
+			"input_tokens": 100.0, "output_tokens": 50.0}
+		for k, v := range extra {
+			r[k] = v
+		}
+		return r
+	}
+
+	assert.Empty(t, defaultValidator.Check(record(map[string]any{"total_tokens": 150.0, "cost": 0.01})))
+	assert.Equal(t, `field "total_tokens" is not the sum of input_tokens + output_tokens`,
+		defaultValidator.Check(record(map[string]any{"total_tokens": 151.0})))
+	assert.Equal(t, `field "cost" is out of range`, defaultValidator.Check(record(map[string]any{"cost": -1.0})))
+	assert.Equal(t, `field "cache_read_input_tokens" is out of range`,
+		defaultValidator.Check(record(map[string]any{"cache_read_input_tokens": -5.0})))
+
+	partial := record(map[string]any{"total_tokens": 500.0})
+	delete(partial, "output_tokens")
+	assert.Empty(t, defaultValidator.Check(partial), "skipped when a summed field is absent")
+
+	v := NewRecordValidator(&config.ValidationSchema{
+		Fields: []config.FieldRule{{Name: "model", Type: config.FieldString, Required: true}},
+		Checks: []config.CrossFieldRule{
+			{Check: config.CheckAtMost, Field: "cached_tokens", Fields: []string{"prompt_tokens"}},
+			{Check: "ratio", Field: "prompt_tokens", Fields: []string{"cached_tokens"}},
+		},
+	})
+	assert.Empty(t, v.Check(map[string]any{"model": "gpt-4", "prompt_tokens": 100.0, "cached_tokens": 100.0}))
+	assert.Equal(t, `field "cached_tokens" exceeds prompt_tokens`,
+		v.Check(map[string]any{"model": "gpt-4", "prompt_tokens": 100.0, "cached_tokens": 101.0}))
+}
+
+func TestValidateJSONLFile_LongLines(t *testing.T) {
+	dir := t.TempDir()
+	long := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","prompt":"` +
+		strings.Repeat("a", 2*defaultMaxLineBytes) + `"}`
+	path := writeJSONLFile(t, dir, "usage.jsonl", []string{validRecord(), long, validRecord()})
+
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err, "an oversized line does not fail the file")
+	assert.True(t, result.Valid)
+	assert.Equal(t, 3, result.TotalLines)
+	assert.Equal(t, 2, result.ValidRecords)
+	assert.Equal(t, []LineRejection{{Line: 2, Reason: "line is longer than 1048576 bytes"}}, result.Rejections)
+
+	v := NewRecordValidator(nil)
+	v.SetMaxLineBytes(64)
+	result, err = ValidateTaggedJSONLFile(path, nil, v, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.InvalidRecords, "every record is over a 64-byte limit")
+	assert.False(t, looksLikeTokenFile(path, 5, v))
+}
+
+func TestRecordValidator_ServiceFilter(t *testing.T) {
+	record := func(service string) map[string]any {
+		return map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": service, "model": "gpt-4"}
+	}
+
+	v := NewRecordValidator(nil)
+	v.SetServiceFilter(nil, []string{"mock"})
+	assert.True(t, v.Valid(record("openai")))
+	assert.Equal(t, `service "Mock" is not allowed`, v.Check(record("Mock")))
+
+	v.SetServiceFilter([]string{"openai", "anthropic"}, []string{"anthropic"})
+	assert.True(t, v.Valid(record("OpenAI")))
+	assert.False(t, v.Valid(record("azure")), "not on the allowlist")
+	assert.False(t, v.Valid(record("anthropic")), "the denylist wins")
+	assert.Equal(t, `missing field "service"`, v.Check(map[string]any{"timestamp": "2025-01-15T10:30:00Z", "model": "gpt-4"}))
+}
+
+func TestRecordValidator_SchemaVersions(t *testing.T) {
+	v := NewRecordValidator(&config.ValidationSchema{
+		Fields: []config.FieldRule{{Name: "model", Type: config.FieldString, Required: true}},
+		Versions: map[string]*config.ValidationSchema{
+			"2":    {Fields: []config.FieldRule{{Name: "model_id", Type: config.FieldString, Required: true}}},
+			"beta": {Fields: []config.FieldRule{{Name: "ignored", Type: config.FieldString, Required: true}}},
+		},
+	})
+
+	assert.Empty(t, v.Check(map[string]any{"model": "gpt-4"}), "no version: base rules")
+	assert.Empty(t, v.Check(map[string]any{"model": "gpt-4", "schema_version": 1.0}), "unlisted version: base rules")
+	assert.Empty(t, v.Check(map[string]any{"model_id": "gpt-4", "schema_version": 2.0}))
+	assert.Empty(t, v.Check(map[string]any{"model_id": "gpt-4", "schema_version": "2"}))
+	assert.Equal(t, `missing field "model_id"`, v.Check(map[string]any{"model": "gpt-4", "schema_version": 2.0}))
+	assert.Equal(t, `field "schema_version" is not a version number`,
+		v.Check(map[string]any{"model": "gpt-4", "schema_version": 1.5}))
+	assert.Equal(t, `field "schema_version" is not a version number`,
+		v.Check(map[string]any{"model": "gpt-4", "schema_version": "beta"}))
+}
+
+func TestRecordValidator_RequiredFields(t *testing.T) {
+	embedding := map[string]any{"timestamp": "2025-01-15T10:30:00Z", "service": "openai", "input_tokens": 8.0}
+
+	v := NewRecordValidator(nil)
+	assert.Equal(t, `missing field "model"`, v.Check(embedding))
+
+	v.SetRequiredFields([]string{"timestamp", "service", "request_id"})
+	assert.Equal(t, `missing field "request_id"`, v.Check(embedding))
+	embedding["request_id"] = "req_1"
+	assert.Empty(t, v.Check(embedding), "model is no longer required")
+	embedding["model"] = 4.0
+	assert.Equal(t, `field "model" is not a non-empty string`, v.Check(embedding), "an optional field is still type-checked")
+
+	v = NewRecordValidator(&config.ValidationSchema{
+		Fields: []config.FieldRule{{Name: "model", Type: config.FieldString, Required: true}},
+		Versions: map[string]*config.ValidationSchema{
+			"2": {Fields: []config.FieldRule{{Name: "model_id", Type: config.FieldString, Required: true}}},
+		},
+	})
+	v.SetRequiredFields([]string{})
+	assert.Empty(t, v.Check(map[string]any{}))
+	assert.Empty(t, v.Check(map[string]any{"schema_version": 2.0}), "applies to every version")
+}
+
+func TestValidateJSONLFile_SchemaVersion(t *testing.T) {
+	dir := t.TempDir()
+	path := writeJSONLFile(t, dir, "usage.jsonl", []string{
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","schema_version":2}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","schema_version":"3"}`,
+		validRecord(),
+	})
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, result.ValidRecords)
+	assert.Equal(t, 3, result.SchemaVersion)
+
+	result, err = ValidateJSONLFile(writeJSONLFile(t, dir, "plain.jsonl", []string{validRecord()}))
+	require.NoError(t, err)
+	assert.Zero(t, result.SchemaVersion)
+}
+
+func TestValidateJSONLFile_FailureKinds(t *testing.T) {
+	path := writeJSONLFile(t, t.TempDir(), "usage.jsonl", []string{
+		validRecord(),
+		"not json",
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai"}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":"ten"}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":-1}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":1,"output_tokens":1,"total_tokens":5}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","schema_version":"x"}`,
+		`{"timestamp":"2025-01-15T10:30:00Z","service":"secret-internal","model":"gpt-4"}`,
+	})
+	v := NewRecordValidator(nil)
+	v.SetServiceFilter([]string{"openai"}, nil)
+
+	result, err := ValidateTaggedJSONLFile(path, nil, v, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		"not_json":                  1,
+		"missing_field:model":       1,
+		"wrong_type:input_tokens":   1,
+		"out_of_range:input_tokens": 1,
+		"inconsistent:total_tokens": 1,
+		"bad_schema_version":        1,
+		"service_not_allowed":       1,
+	}, result.Failures)
+	for kind := range result.Failures {
+		assert.NotContains(t, kind, "secret", "kinds hold no record content")
+	}
+
+	_, kind := v.check(map[string]any{"timestamp": "2999-01-01T00:00:00Z", "service": "openai", "model": "gpt-4"})
+	assert.Equal(t, "", kind, "no timestamp bounds set")
+	v.SetTimestampBounds(time.Hour, 0)
+	_, kind = v.check(map[string]any{"timestamp": "2999-01-01T00:00:00Z", "service": "openai", "model": "gpt-4"})
+	assert.Equal(t, "future_timestamp:timestamp", kind)
+	assert.True(t, implausibleTime(kind))
+}
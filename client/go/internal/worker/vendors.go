@@ -0,0 +1,126 @@
+package worker
+
+import "time"
+
+// Vendor log formats the client can normalize.
+const (
+	// FormatAnthropicMessageLog is an Anthropic Messages API response, alone
+	// or wrapped in a log line under "message" as agent transcripts do.
+	FormatAnthropicMessageLog = "anthropic_message_log"
+
+	// FormatGeminiUsage is a Gemini generateContent response or usage dump
+	// with its token counts in "usageMetadata".
+	FormatGeminiUsage = "gemini_usage"
+)
+
+// anthropicMessageLog adapts Anthropic message logs, e.g.
+//
+//	{"type":"assistant","timestamp":"2025-01-15T10:30:00.000Z","message":{"id":"msg_01",
+//	 "type":"message","model":"claude-3-5-sonnet","content":[...],"usage":{"input_tokens":12,"output_tokens":40}}}
+type anthropicMessageLog struct{}
+
+func (anthropicMessageLog) Name() string { return FormatAnthropicMessageLog }
+
+// message returns the Messages API object of a record: the record itself or
+// its "message" field.
+func (anthropicMessageLog) message(data map[string]any) (map[string]any, bool) {
+	if m, ok := data["message"].(map[string]any); ok {
+		return m, true
+	}
+	return data, false
+}
+
+func (a anthropicMessageLog) Match(data map[string]any) bool {
+	msg, _ := a.message(data)
+	_, usage := msg["usage"].(map[string]any)
+	_, model := msg["model"].(string)
+	return msg["type"] == "message" && usage && model
+}
+
+// Normalize takes the model and token counts from the message and drops its
+// content. The rest of a log line, e.g. its timestamp and session ID, is
+// kept; the message ID is kept as message_id.
+func (a anthropicMessageLog) Normalize(data map[string]any) map[string]any {
+	msg, wrapped := a.message(data)
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	if wrapped {
+		delete(out, "message")
+	} else {
+		for _, k := range []string{"id", "type", "role", "content", "usage", "stop_reason", "stop_sequence"} {
+			delete(out, k)
+		}
+	}
+	if id, ok := msg["id"].(string); ok {
+		out["message_id"] = id
+	}
+	if _, ok := out["service"]; !ok {
+		out["service"] = "anthropic"
+	}
+	out["model"] = msg["model"]
+	for k, v := range msg["usage"].(map[string]any) {
+		if name, known := usageFieldNames[k]; known {
+			if _, isNum := v.(float64); isNum {
+				out[name] = v
+			}
+		}
+	}
+	return out
+}
+
+// geminiUsage adapts Gemini responses, e.g.
+//
+//	{"createTime":"2025-01-15T10:30:00Z","modelVersion":"gemini-1.5-flash-002","candidates":[...],
+//	 "usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"totalTokenCount":15}}
+type geminiUsage struct{}
+
+func (geminiUsage) Name() string { return FormatGeminiUsage }
+
+func (geminiUsage) Match(data map[string]any) bool {
+	usage, ok := data["usageMetadata"].(map[string]any)
+	if !ok {
+		return false
+	}
+	_, prompt := usage["promptTokenCount"].(float64)
+	return prompt
+}
+
+// Normalize maps the usage metadata onto the canonical fields and drops the
+// generated candidates. Thinking tokens are billed as output and counted in
+// output_tokens; totalTokenCount is not kept, as it can include tool prompt
+// tokens that neither count covers.
+func (geminiUsage) Normalize(data map[string]any) map[string]any {
+	usage := data["usageMetadata"].(map[string]any)
+	out := make(map[string]any, len(data))
+	for k, v := range data {
+		out[k] = v
+	}
+	for _, k := range []string{"usageMetadata", "candidates", "contents", "modelVersion", "createTime"} {
+		delete(out, k)
+	}
+	if _, ok := out["service"]; !ok {
+		out["service"] = "google"
+	}
+	if model, ok := data["modelVersion"].(string); ok {
+		out["model"] = model
+	}
+	out["input_tokens"] = usage["promptTokenCount"]
+	candidates, hasCandidates := usage["candidatesTokenCount"].(float64)
+	thoughts, hasThoughts := usage["thoughtsTokenCount"].(float64)
+	if hasCandidates || hasThoughts {
+		out["output_tokens"] = candidates + thoughts
+	}
+	if cached, ok := usage["cachedContentTokenCount"].(float64); ok {
+		out["cache_read_input_tokens"] = cached
+	}
+	if _, ok := out["timestamp"]; !ok {
+		if s, ok := data["createTime"].(string); ok {
+			if ts, err := time.Parse(time.RFC3339, s); err == nil {
+				out["timestamp"] = ts.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,94 @@
+package worker
+
+import (
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parseRecord(t *testing.T, line string) map[string]any {
+	t.Helper()
+	var data map[string]any
+	require.NoError(t, json.Unmarshal([]byte(line), &data))
+	return data
+}
+
+const anthropicLogLine = `{"type":"assistant","timestamp":"2025-01-15T10:30:00.000Z","sessionId":"s1",` +
+	`"message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-3-5-sonnet",` +
+	`"content":[{"type":"text","text":"secret answer"}],` +
+	`"usage":{"input_tokens":12,"output_tokens":40,"cache_read_input_tokens":100,"service_tier":"standard"}}}`
+
+func TestAnthropicMessageLog_Normalize(t *testing.T) {
+	normalized, format := adaptRecord(parseRecord(t, anthropicLogLine))
+	assert.Equal(t, FormatAnthropicMessageLog, format)
+	assert.Equal(t, map[string]any{
+		"type":                    "assistant",
+		"timestamp":               "2025-01-15T10:30:00.000Z",
+		"sessionId":               "s1",
+		"message_id":              "msg_01",
+		"service":                 "anthropic",
+		"model":                   "claude-3-5-sonnet",
+		"input_tokens":            12.0,
+		"output_tokens":           40.0,
+		"cache_read_input_tokens": 100.0,
+	}, normalized)
+	assert.True(t, defaultValidator.Valid(normalized))
+
+	// A bare Messages API response.
+	bare := parseRecord(t, `{"id":"msg_02","type":"message","role":"assistant","model":"claude-3-haiku",`+
+		`"content":[{"type":"text","text":"hi"}],"stop_reason":"end_turn","usage":{"input_tokens":3,"output_tokens":1}}`)
+	normalized, format = adaptRecord(bare)
+	assert.Equal(t, FormatAnthropicMessageLog, format)
+	assert.Equal(t, map[string]any{"message_id": "msg_02", "service": "anthropic", "model": "claude-3-haiku",
+		"input_tokens": 3.0, "output_tokens": 1.0}, normalized)
+
+	_, format = adaptRecord(parseRecord(t, `{"type":"user","message":{"role":"user","content":"hello"}}`))
+	assert.Empty(t, format, "lines without usage")
+}
+
+func TestGeminiUsage_Normalize(t *testing.T) {
+	normalized, format := adaptRecord(parseRecord(t, `{"createTime":"2025-01-15T10:30:00.123456Z",`+
+		`"modelVersion":"gemini-2.5-flash","candidates":[{"content":{"parts":[{"text":"secret"}]}}],`+
+		`"responseId":"r1","usageMetadata":{"promptTokenCount":10,"candidatesTokenCount":5,"thoughtsTokenCount":7,`+
+		`"cachedContentTokenCount":4,"totalTokenCount":22}}`))
+	assert.Equal(t, FormatGeminiUsage, format)
+	assert.Equal(t, map[string]any{
+		"timestamp":               "2025-01-15T10:30:00Z",
+		"service":                 "google",
+		"model":                   "gemini-2.5-flash",
+		"responseId":              "r1",
+		"input_tokens":            10.0,
+		"output_tokens":           12.0,
+		"cache_read_input_tokens": 4.0,
+	}, normalized)
+	assert.True(t, defaultValidator.Valid(normalized))
+
+	_, format = adaptRecord(parseRecord(t, `{"usageMetadata":{"totalTokenCount":3}}`))
+	assert.Empty(t, format)
+}
+
+func TestValidateJSONLFile_AdapterPerFile(t *testing.T) {
+	// The first matched record selects the file's adapter; records only
+	// another adapter would match are checked as they are, as they would
+	// be uploaded.
+	gemini := `{"timestamp":"2025-01-15T10:30:00Z","modelVersion":"gemini-2.5-flash","usageMetadata":{"promptTokenCount":10}}`
+	path := writeJSONLFile(t, t.TempDir(), "mixed.jsonl", []string{anthropicLogLine, anthropicLogLine, gemini})
+
+	result, err := ValidateJSONLFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, FormatAnthropicMessageLog, result.Format)
+	assert.Equal(t, 2, result.AdaptedRecords)
+	assert.Equal(t, 2, result.ValidRecords)
+	assert.Equal(t, 1, result.InvalidRecords)
+
+	r, err := openNormalized(path, recordRewrite{format: result.Format})
+	require.NoError(t, err)
+	defer r.Close()
+	body, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.NotContains(t, string(body), "secret answer", "message content is not uploaded")
+	assert.Contains(t, string(body), "usageMetadata")
+}
@@ -2,49 +2,147 @@ package worker
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/ComputClaw/tokenly-client/internal/config"
 	"github.com/ComputClaw/tokenly-client/internal/platform"
 )
 
+// Burst cycles follow a cycle that hit the scanner's file cap, so a backlog
+// drains without waiting a full scan interval per batch.
+const (
+	defaultBurstDelay = 30 * time.Second
+	maxBurstCycles    = 5
+)
+
+// Retention runs on its own schedule as well as after full cycles, so the
+// quarantine, archives, and scratch copies stay within their limits however
+// rarely scans run. Sanitized copies older than staleCopyAge are left over
+// from an earlier run.
+const (
+	retentionInterval = time.Hour
+	staleCopyAge      = 24 * time.Hour
+)
+
+// staleTempAge is how old the state file's temp file must be before startup
+// cleanup removes it; the launcher may be writing it.
+const staleTempAge = 10 * time.Minute
+
+// defaultRetryMaxAttempts is how many times a file whose upload failed is
+// retried when the config doesn't say.
+const defaultRetryMaxAttempts = 3
+
 // WorkerConfig holds the parameters needed to create a Worker.
 type WorkerConfig struct {
-	Config       *config.ClientConfig
-	Hostname     string
-	StatePath    string
-	ServerURL    string
-	LogLevel     string
-	LearningPath string // optional; defaults to platform learning path
+	Config        *config.ClientConfig
+	Hostname      string
+	StatePath     string
+	ServerURL     string
+	LogLevel      string
+	Version       string // optional; published in the worker report
+	LearningPath  string // optional; defaults to platform learning path
+	LedgerPath    string // optional; defaults to platform ledger path
+	IndexPath     string // optional; defaults to platform scan index path
+	CachePath     string // optional; defaults to platform validation cache path
+	UncleanPath   string // optional; defaults to platform uncleanable list path
+	SpoolPath     string // optional; defaults to platform retry spool path
+	SanitizedPath string // optional; defaults to platform sanitized progress path
+
+	QuarantineDir string // optional; defaults to platform quarantine directory
+	ArchiveDir    string // optional; defaults to platform archive directory
+
+	IngestPath     string            // optional; defaults to "/api/ingest"
+	RequestHeaders map[string]string // optional extra headers for uploads
+
+	HealthSocket string                 // optional; where to serve health probes
+	Network      *config.NetworkOptions // optional proxy and TLS settings for server requests
+	ClockOffset  time.Duration          // optional; added to local time in timestamps sent to the server
+
+	// ExitOnRestartSettings makes Run return ErrRestartRequired when a
+	// setting the worker reads only at startup changes, for a worker whose
+	// own supervisor restarts it instead of the launcher.
+	ExitOnRestartSettings bool
 }
 
+// ErrRestartRequired is returned by Run when ExitOnRestartSettings is set and
+// a setting the worker reads only at startup has changed.
+var ErrRestartRequired = errors.New("settings read at startup changed")
+
 // Worker orchestrates scanning, validating, uploading, and cleaning JSONL files.
 type Worker struct {
 	config    *config.ClientConfig
 	hostname  string
 	statePath string
+	version   string
 
-	scanner  *Scanner
-	uploader *Uploader
-	cleaner  *Cleaner
-	learner  *Learner
-	logger   *slog.Logger
+	scanner   *Scanner
+	uploader  *Uploader
+	cleaner   *Cleaner
+	archiver  *Archiver
+	learner   *Learner
+	spool     *RetrySpool
+	sanitized *SanitizedProgress
+	ledger    *Ledger
+	index     *ScanIndex // nil when incremental scanning is disabled
+	invalid   *ValidationCache
+	unclean   *UncleanableList
+	syncer    *LearningSync
+	logger    *slog.Logger
 
-	mu            sync.Mutex
-	state         string // "idle", "scanning", "uploading", "stopped"
-	lastScan      time.Time
-	filesFound    int
-	filesUploaded int
-	cancelFunc    context.CancelFunc
+	burstDelay time.Duration // pause before a burst cycle
+	lastSync   time.Time     // of learning data; used by Run only
+	quarantine string        // where uploaded files are held; see Cleaner.SetQuarantine
+	ownFiles   []string      // state files the worker saves; see removeLeftovers
+	health     string        // health socket path; empty disables probes
+	supervised bool          // exits when restart settings change; see WorkerConfig.ExitOnRestartSettings
+	progress   atomic.Int64  // unix nanos of the main loop's last sign of life
+
+	// All fields below are guarded by mu; read them through Status().
+	mu             sync.Mutex
+	state          string // "idle", "scanning", "uploading", "stopped"
+	lastScan       time.Time
+	lastCycle      time.Time // when the last cycle finished
+	unapproved     bool      // the state file says the server hasn't approved this client
+	cycleStarted   time.Time
+	cycleTotal     int
+	cycleProcessed int
+	filesFound     int
+	filesUploaded  int
+	totalUploaded  int
+	recentErrors   []ErrorRecord
+	uploadStats    UploadStats
+	quota          *dailyQuota
+	uploaded       *uploadedSet     // uploads by path and digest, for dedupe
+	tagger         *ProviderTagger  // rebuilt on config reload
+	records        *RecordValidator // rebuilt on config reload
+	csv            *CSVConverter    // rebuilt on config reload
+	clock          time.Duration    // StateFile.ClockOffset, re-read on config reload
+	rules          string           // validationRules of config
+	preflight      *PreflightReport
+	scanReport     *config.ScanReport // from the last completed scan
+	cycleFailures  map[string]int     // validation failure kinds this cycle
+	lastFailures   map[string]int     // cycleFailures of the last completed cycle
+	cancelFunc     context.CancelFunc
+
+	// Upload outcomes this cycle by directory, for the learner.
+	cycleOutcomes map[string]*uploadOutcomes
+}
+
+// uploadOutcomes counts a directory's files the server accepted and rejected.
+type uploadOutcomes struct {
+	accepted, rejected int
 }
 
 // NewWorker creates a Worker with all sub-components wired up.
@@ -57,8 +155,54 @@ func NewWorker(cfg WorkerConfig, logger *slog.Logger) (*Worker, error) {
 	if err != nil {
 		return nil, fmt.Errorf("create learner: %w", err)
 	}
+	configureLearner(learner, cfg.Config)
+
+	ledgerPath := cfg.LedgerPath
+	if ledgerPath == "" {
+		ledgerPath = platform.LedgerFilePath()
+	}
 
-	discoveryPaths := platformDiscoveryPaths(cfg.Config.DiscoveryPaths)
+	var discoveryPaths []string
+	var overrides []config.DiscoveryPath
+	for _, dp := range discoveryPathsFor(cfg.Config) {
+		discoveryPaths = append(discoveryPaths, dp.Path)
+		if dp.HasOverrides() {
+			overrides = append(overrides, dp)
+		}
+	}
+	indexPath := cfg.IndexPath
+	if indexPath == "" {
+		indexPath = platform.ScanIndexFilePath()
+	}
+	cachePath := cfg.CachePath
+	if cachePath == "" {
+		cachePath = platform.ValidationCacheFilePath()
+	}
+	uncleanPath := cfg.UncleanPath
+	if uncleanPath == "" {
+		uncleanPath = platform.UncleanableFilePath()
+	}
+	spoolPath := cfg.SpoolPath
+	if spoolPath == "" {
+		spoolPath = platform.SpoolFilePath()
+	}
+	sanitizedPath := cfg.SanitizedPath
+	if sanitizedPath == "" {
+		sanitizedPath = platform.SanitizedFilePath()
+	}
+	quarantine := cfg.QuarantineDir
+	if quarantine == "" {
+		quarantine = platform.QuarantineDir()
+	}
+	archiveDir := cfg.ArchiveDir
+	if archiveDir == "" {
+		archiveDir = platform.ArchiveDir()
+	}
+	ownDirs := append(platform.AgentDirs(), quarantine, archiveDir)
+	ownPaths := agentFiles(cfg.StatePath, lpath, ledgerPath, indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath)
+	if cfg.Config.PostUploadAction == PostUploadMoveTo {
+		ownDirs = append(ownDirs, cfg.Config.PostUploadMoveTo)
+	}
 
 	scanner := NewScanner(ScannerConfig{
 		DiscoveryPaths:  discoveryPaths,
@@ -66,22 +210,126 @@ func NewWorker(cfg WorkerConfig, logger *slog.Logger) (*Worker, error) {
 		ExcludePatterns: cfg.Config.ExcludePatterns,
 		MaxFileAgeHours: cfg.Config.MaxFileAgeHours,
 		MaxFileSizeMB:   cfg.Config.MaxFileSizeMB,
+		ExcludeDirs:     ownDirs,
+		ExcludeFiles:    ownPaths,
+		SymlinkPolicy:   cfg.Config.SymlinkPolicy,
+		PathOverrides:   overrides,
+		Parallelism:     cfg.Config.ScanParallelism,
+
+		QuiescenceSeconds: cfg.Config.QuiescenceSeconds,
+		SniffMaxBytes:     int64(cfg.Config.SniffMaxKB) * 1024,
+		SniffLines:        cfg.Config.SniffLines,
+		Schema:            cfg.Config.ValidationSchema,
+
+		NetworkFSPolicy: cfg.Config.NetworkFSPolicy,
+		NetworkMaxDepth: cfg.Config.NetworkFSMaxDepth,
+		NetworkMaxTime:  time.Duration(cfg.Config.NetworkFSMaxSeconds) * time.Second,
+		Prioritization:  cfg.Config.Prioritization,
+		MatchRotated:    cfg.Config.MatchRotated,
+		CaseInsensitive: CaseInsensitivePatterns(cfg.Config.PatternCase),
 	}, learner, logger)
 
+	spool, err := OpenRetrySpool(spoolPath, cfg.Config.SpoolMaxFiles, cfg.Config.SpoolMaxMB, logger)
+	if err != nil {
+		return nil, fmt.Errorf("create retry spool: %w", err)
+	}
+	scanner.SetSpool(spool)
+	sanitized, err := OpenSanitizedProgress(sanitizedPath, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var index *ScanIndex
+	if hours := cfg.Config.FullRescanHours; hours > 0 {
+		index, err = NewScanIndex(indexPath, time.Duration(hours)*time.Hour, logger)
+		if err != nil {
+			return nil, fmt.Errorf("create scan index: %w", err)
+		}
+		scanner.SetIndex(index)
+	}
+
+	invalid, err := NewValidationCache(cachePath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("create validation cache: %w", err)
+	}
+	unclean, err := NewUncleanableList(uncleanPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("create uncleanable list: %w", err)
+	}
+	scanner.SetUncleanable(unclean)
+
+	transport, err := cfg.Network.HTTPTransport()
+	if err != nil {
+		return nil, fmt.Errorf("configure network: %w", err)
+	}
 	uploader := NewUploader(cfg.ServerURL, cfg.Hostname, logger)
+	uploader.SetTransport(transport)
+	uploader.SetIngestPath(cfg.IngestPath)
+	uploader.SetClockOffset(cfg.ClockOffset)
+	uploader.SetHeaders(cfg.RequestHeaders)
+	uploader.SetUploadMode(cfg.Config.UploadMode)
+	uploader.SetMinThroughput(cfg.Config.UploadMinKBps)
+	uploader.SetMaxResponseKB(cfg.Config.MaxResponseKB)
+	if cfg.Config.GzipUploadMode != "" && cfg.Config.GzipUploadMode != GzipUploadCompressed &&
+		cfg.Config.GzipUploadMode != GzipUploadDecompress {
+		logger.Warn("unknown gzip upload mode, sending decompressed", "mode", cfg.Config.GzipUploadMode)
+	}
+	syncer := NewLearningSync(cfg.ServerURL)
+	syncer.SetTransport(transport)
+	syncer.SetHeaders(cfg.RequestHeaders)
 	cleaner := NewCleaner(discoveryPaths, logger)
+	cleaner.ProtectAgentDirs(ownDirs)
+	cleaner.ProtectAgentFiles(ownPaths)
+	configureCleaner(cleaner, quarantine, cfg.Config)
+	archiver := NewArchiver(archiveDir, logger)
+	configureArchiver(archiver, cfg.Config)
+
+	ledger := NewLedger(ledgerPath)
+	quota := newDailyQuota(cfg.Config.DailyUploadMaxFiles, cfg.Config.DailyUploadMaxMB)
+	restoreDailyQuota(quota, ledger, logger)
+	uploaded, err := ledger.uploadedDigests(maxUploadedDigests)
+	if err != nil {
+		logger.Warn("failed to restore uploaded digests from ledger", "error", err)
+	}
+	warnUnsupportedChecksum(cfg.Config, logger)
 
-	return &Worker{
-		config:    cfg.Config,
-		hostname:  cfg.Hostname,
-		statePath: cfg.StatePath,
-		scanner:   scanner,
-		uploader:  uploader,
-		cleaner:   cleaner,
-		learner:   learner,
-		logger:    logger,
-		state:     "idle",
-	}, nil
+	w := &Worker{
+		config:     cfg.Config,
+		hostname:   cfg.Hostname,
+		statePath:  cfg.StatePath,
+		version:    cfg.Version,
+		scanner:    scanner,
+		uploader:   uploader,
+		cleaner:    cleaner,
+		archiver:   archiver,
+		learner:    learner,
+		spool:      spool,
+		sanitized:  sanitized,
+		ledger:     ledger,
+		index:      index,
+		invalid:    invalid,
+		unclean:    unclean,
+		syncer:     syncer,
+		tagger:     NewProviderTagger(cfg.Config.ProviderTags),
+		records:    recordValidatorFor(cfg.Config),
+		csv:        NewCSVConverter(cfg.Config.CSVColumns),
+		rules:      validationRules(cfg.Config, cfg.Version),
+		quota:      quota,
+		uploaded:   uploaded,
+		clock:      cfg.ClockOffset,
+		burstDelay: defaultBurstDelay,
+		quarantine: quarantine,
+		ownFiles:   ownFiles(cfg.StatePath, lpath, indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath),
+		health:     cfg.HealthSocket,
+		supervised: cfg.ExitOnRestartSettings,
+		logger:     logger,
+		state:      "idle",
+	}
+	// Walking and uploading count as progress for health probes, so a long
+	// cycle is not taken for a hung one.
+	scanner.SetProgress(w.touch)
+	uploader.SetProgress(w.touch)
+	return w, nil
 }
 
 // Run executes the main scan-upload loop until ctx is cancelled.
@@ -93,272 +341,1149 @@ func (w *Worker) Run(ctx context.Context) error {
 	defer cancel()
 
 	w.logger.Info("worker started", "hostname", w.hostname)
+	w.touch()
+	w.removeLeftovers()
+	if w.health != "" {
+		go func() {
+			if err := w.serveHealth(ctx, w.health); err != nil {
+				w.logger.Warn("health probes unavailable", "error", err)
+			}
+		}()
+	}
+	w.runPreflight(w.currentConfig())
 
-	interval := time.Duration(w.config.ScanIntervalMinutes) * time.Minute
+	interval := time.Duration(w.currentConfig().ScanIntervalMinutes) * time.Minute
 	if interval <= 0 {
 		interval = 60 * time.Minute
 	}
 
-	// Run first scan immediately, then on interval.
+	// Run first scan immediately, then on interval. While cycles hit the file
+	// cap, follow-up cycles run after a short delay to drain the backlog.
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
-	w.runScanCycle(ctx)
+	// Focused cycles between full ones scan directories at the hours they
+	// are productive.
+	var focused <-chan time.Time
+	if every := time.Duration(w.currentConfig().FocusedScanMinutes) * time.Minute; every > 0 && every < interval {
+		ft := time.NewTicker(every)
+		defer ft.Stop()
+		focused = ft.C
+	}
+
+	retention := time.NewTicker(retentionInterval)
+	defer retention.Stop()
+
+	alive := time.NewTicker(aliveInterval)
+	defer alive.Stop()
+
+	w.syncLearning(ctx)
+	backlog := w.runScanCycle(ctx)
+	bursts := 0
 
 	for {
+		var burst <-chan time.Time
+		if backlog && bursts < maxBurstCycles {
+			burst = time.After(w.burstDelay)
+		} else if backlog {
+			w.logger.Info("burst limit reached, waiting for next scan interval", "bursts", bursts)
+		}
+
 		select {
 		case <-ctx.Done():
 			w.logger.Info("worker shutting down")
-			w.saveLearningData()
+			w.shutdown()
 			return nil
+		case <-alive.C:
+			w.touch()
 		case <-ticker.C:
-			w.runScanCycle(ctx)
+			bursts = 0
+			if changed := w.reloadConfig(); len(changed) > 0 && w.supervised {
+				w.logger.Warn("settings read only at startup changed, exiting for the supervisor to restart the worker", "changed", changed)
+				w.shutdown()
+				return fmt.Errorf("%w: %s", ErrRestartRequired, strings.Join(changed, ", "))
+			}
+			w.syncLearning(ctx)
+			backlog = w.runScanCycle(ctx)
+		case <-focused:
+			if !backlog {
+				w.runFocusedCycle(ctx)
+			}
+		case <-retention.C:
+			w.enforceRetention()
+		case <-burst:
+			bursts++
+			w.logger.Info("backlog remaining, starting burst cycle", "burst", bursts)
+			backlog = w.runScanCycle(ctx)
 		}
 	}
 }
 
-// runScanCycle performs one full scan-validate-upload-cleanup cycle.
-func (w *Worker) runScanCycle(ctx context.Context) {
-	if ctx.Err() != nil {
+// RunOnce runs a single scan-and-upload cycle and returns, for schedulers
+// that start the worker periodically instead of keeping it running. Files
+// left over by the cycle's file cap wait for the next run.
+func (w *Worker) RunOnce(ctx context.Context) error {
+	w.logger.Info("worker started for one cycle", "hostname", w.hostname)
+	w.touch()
+	w.removeLeftovers()
+	w.runPreflight(w.currentConfig())
+
+	w.syncLearning(ctx)
+	if w.runScanCycle(ctx) {
+		w.logger.Info("backlog remains for the next run")
+	}
+
+	w.mu.Lock()
+	w.state = "stopped"
+	w.mu.Unlock()
+	w.saveLearningData()
+	return ctx.Err()
+}
+
+// syncLearning downloads directory hints from the server, seeding the learner
+// with those that exist here, and shares this client's directory stats. It
+// runs at most every LearningSyncHours.
+func (w *Worker) syncLearning(ctx context.Context) {
+	hours := w.currentConfig().LearningSyncHours
+	if hours <= 0 || (!w.lastSync.IsZero() && time.Since(w.lastSync) < time.Duration(hours)*time.Hour) {
+		return
+	}
+	w.lastSync = time.Now()
+
+	hints, err := w.syncer.Hints(ctx, platform.OSName())
+	if err != nil {
+		w.logger.Warn("failed to download learning hints", "error", err)
+	}
+	seeded := 0
+	for dir, rate := range localHintDirs(hints) {
+		if w.learner.Seed(dir, rate) {
+			seeded++
+		}
+	}
+	if seeded > 0 {
+		w.logger.Info("seeded learning data from server hints", "directories", seeded)
+	}
+
+	if err := w.syncer.Share(ctx, platform.OSName(), w.learner.Shared(sharedNames(discoveryPathsFor(w.currentConfig())))); err != nil {
+		w.logger.Warn("failed to share learning data", "error", err)
+	}
+}
+
+// runScanCycle performs one full scan-validate-upload-cleanup cycle. It
+// returns true if the cycle hit the scanner's file cap, meaning a backlog
+// remains and a burst cycle should follow.
+func (w *Worker) runScanCycle(ctx context.Context) bool {
+	return w.runCycle(ctx, nil)
+}
+
+// runFocusedCycle runs a cycle over only the learned directories that
+// usually yield files at this hour of day, if there are any.
+func (w *Worker) runFocusedCycle(ctx context.Context) {
+	dirs := w.learner.ProductiveDirs(time.Now().Hour())
+	if len(dirs) == 0 {
 		return
 	}
+	w.logger.Debug("starting focused scan cycle", "dirs", len(dirs))
+	w.runCycle(ctx, dirs)
+}
+
+// runCycle is runScanCycle, scanning only focus when it is set.
+func (w *Worker) runCycle(ctx context.Context, focus []string) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	defer w.completeCycle()
 
 	w.mu.Lock()
-	if !w.config.ScanEnabled {
+	cfg := w.config
+	if !cfg.ScanEnabled {
 		w.mu.Unlock()
 		w.logger.Debug("scanning disabled, skipping cycle")
-		return
+		return false
 	}
+	if w.unapproved {
+		w.mu.Unlock()
+		w.logger.Info("client not approved by the server, skipping cycle")
+		return false
+	}
+	start := time.Now()
 	w.state = "scanning"
+	w.cycleStarted = start
+	w.cycleTotal = 0
+	w.cycleProcessed = 0
+	w.cycleFailures = make(map[string]int)
+	w.cycleOutcomes = make(map[string]*uploadOutcomes)
+	w.uploadStats.resetCycle()
 	w.mu.Unlock()
 
-	start := time.Now()
 	w.logger.Info("starting scan cycle")
+	w.touch()
 
-	candidates, err := w.scanner.Scan(ctx)
-	if err != nil {
+	// Retries due from the spool go first so the backlog drains before new
+	// files are discovered.
+	retries := w.spool.Due(time.Now())
+
+	var candidates []FileCandidate
+	var scanReport *config.ScanReport
+	var err error
+	if focus != nil {
+		candidates, scanReport, err = w.scanner.ScanDirs(ctx, focus)
+	} else {
+		candidates, scanReport, err = w.scanner.Scan(ctx)
+	}
+	if errors.Is(err, ErrSpoolFull) {
+		w.logger.Warn("retry spool full, pausing discovery",
+			"spooled_files", w.spool.Len(), "spooled_bytes", w.spool.Bytes())
+	} else if err != nil {
 		w.logger.Error("scan failed", "error", err)
+		w.recordError("", "scan failed: "+err.Error())
 		w.mu.Lock()
 		w.state = "idle"
 		w.mu.Unlock()
-		return
+		return false
 	}
 
+	if scanReport != nil {
+		w.writeScanReport(scanReport)
+	}
+
+	w.mu.Lock()
+	w.scanReport = scanReport
+	w.mu.Unlock()
+
+	work := dedupeCandidates(append(retries, candidates...))
+
 	w.mu.Lock()
 	w.lastScan = time.Now()
 	w.filesFound = len(candidates)
+	w.cycleTotal = len(work)
 	w.state = "uploading"
 	w.mu.Unlock()
 
-	w.logger.Info("scan complete", "files_found", len(candidates), "duration", time.Since(start))
+	w.logger.Info("scan complete", "files_found", len(candidates), "retries_due", len(retries),
+		"duration", time.Since(start))
+	w.touch()
 
-	// Process files with concurrency limit.
-	maxConcurrent := w.config.MaxConcurrentUploads
-	if maxConcurrent <= 0 {
-		maxConcurrent = 3
+	// Files are validated and uploaded in two stages, each with its own
+	// concurrency limit, so parsing later files overlaps earlier uploads.
+	uploaders := cfg.MaxConcurrentUploads
+	if uploaders <= 0 {
+		uploaders = 3
 	}
-	sem := make(chan struct{}, maxConcurrent)
-	var wg sync.WaitGroup
+	validators := cfg.MaxConcurrentValidations
+	if validators <= 0 {
+		validators = runtime.NumCPU()
+	}
+	queue := make(chan FileCandidate)
+	ready := make(chan *validatedFile, uploaders)
 	var uploadCount int
 	var uploadMu sync.Mutex
-	stopUploads := false
+	var stopUploads atomic.Bool
+
+	// Only accepted uploads count: files dropped in validation or rejected
+	// by the server don't, so a batch of them doesn't start a burst.
+	finish := func(c FileCandidate, accepted bool, err error) {
+		w.touch()
+		w.mu.Lock()
+		w.cycleProcessed++
+		w.quota.release(c.Path)
+		w.mu.Unlock()
+
+		if err != nil {
+			w.logger.Warn("file processing failed", "path", c.Path, "error", err)
+			w.recordError(c.Path, err.Error())
+			// Check if we should stop all uploads (auth error).
+			if err.Error() == "stop uploads" {
+				stopUploads.Store(true)
+			}
+		} else if accepted {
+			uploadMu.Lock()
+			uploadCount++
+			uploadMu.Unlock()
+		}
+	}
 
-	for _, candidate := range candidates {
+	var validating, uploading sync.WaitGroup
+	for range validators {
+		validating.Add(1)
+		go func() {
+			defer validating.Done()
+			for c := range queue {
+				v, err := w.validateFile(c)
+				if err != nil || v == nil {
+					finish(c, false, err)
+					continue
+				}
+				ready <- v
+			}
+		}()
+	}
+	for range uploaders {
+		uploading.Add(1)
+		go func() {
+			defer uploading.Done()
+			for v := range ready {
+				// Files validated before a stop stay for the next cycle.
+				if stopUploads.Load() || ctx.Err() != nil {
+					v.discard()
+					w.mu.Lock()
+					w.quota.release(v.candidate.Path)
+					w.mu.Unlock()
+					continue
+				}
+				accepted, err := w.uploadFile(ctx, v)
+				finish(v.candidate, accepted, err)
+			}
+		}()
+	}
+
+	deferred := 0
+	for _, candidate := range work {
 		if ctx.Err() != nil {
 			break
 		}
-		if stopUploads {
+		if stopUploads.Load() {
 			break
 		}
 
-		sem <- struct{}{}
-		wg.Add(1)
-		go func(c FileCandidate) {
-			defer wg.Done()
-			defer func() { <-sem }()
-
-			if err := w.processFile(ctx, c); err != nil {
-				w.logger.Warn("file processing failed", "path", c.Path, "error", err)
-				// Check if we should stop all uploads (auth error).
-				if err.Error() == "stop uploads" {
-					uploadMu.Lock()
-					stopUploads = true
-					uploadMu.Unlock()
-				}
-			} else {
-				uploadMu.Lock()
-				uploadCount++
-				uploadMu.Unlock()
-			}
-		}(candidate)
+		// Files over today's cap stay where they are and are picked up again
+		// after the UTC day rolls over.
+		w.mu.Lock()
+		allowed := w.quota.reserve(candidate.Path, candidate.SizeBytes, time.Now())
+		w.mu.Unlock()
+		if !allowed {
+			deferred++
+			continue
+		}
+		queue <- candidate
+	}
+	close(queue)
+	validating.Wait()
+	close(ready)
+	uploading.Wait()
+	w.cleaner.SweepEmptyDirs()
+
+	if deferred > 0 {
+		w.logger.Warn("daily upload cap reached, deferring files", "deferred", deferred,
+			"max_files", cfg.DailyUploadMaxFiles, "max_mb", cfg.DailyUploadMaxMB)
 	}
-	wg.Wait()
 
 	w.mu.Lock()
 	w.filesUploaded = uploadCount
+	w.lastFailures = w.cycleFailures
+	outcomes := w.cycleOutcomes
+	w.totalUploaded += uploadCount
 	w.state = "idle"
 	w.mu.Unlock()
 
 	// Update learning for scanned directories.
 	dirCounts := make(map[string]int)
+	dirBytes := make(map[string]int64)
 	for _, c := range candidates {
 		dirCounts[filepath.Dir(c.Path)]++
+		dirBytes[filepath.Dir(c.Path)] += c.SizeBytes
 	}
 	for dir, count := range dirCounts {
-		w.learner.UpdateAfterScan(dir, count)
+		w.learner.UpdateAfterScan(dir, count, dirBytes[dir])
+	}
+	for dir, o := range outcomes {
+		w.learner.RecordUploads(dir, o.accepted, o.rejected)
+	}
+	if focus == nil {
+		w.learner.Prune()
+		w.enforceRetention()
 	}
 
 	w.saveLearningData()
 
+	stats := w.Status().Uploads
 	w.logger.Info("scan cycle complete",
 		"files_found", len(candidates),
 		"files_uploaded", uploadCount,
+		"bytes_uploaded", stats.CycleBytes,
+		"throughput_bps", int64(stats.CycleThroughputBps),
 		"total_duration", time.Since(start))
+
+	// A full batch that uploaded something means more files are likely
+	// waiting; a cap or auth stop means another cycle would not help.
+	return len(candidates) >= w.scanner.config.MaxFiles && uploadCount > 0 &&
+		deferred == 0 && !stopUploads.Load() && ctx.Err() == nil
+}
+
+// validatedFile is a file that passed validation and waits for upload.
+type validatedFile struct {
+	candidate   FileCandidate
+	result      *ValidationResult
+	uploadPath  string        // the candidate, or a sanitized copy of it
+	rewrite     recordRewrite // how the upload's records are rewritten
+	sanitized   bool
+	validatedAt time.Time
 }
 
-// processFile validates, uploads, and cleans up a single file.
-func (w *Worker) processFile(ctx context.Context, candidate FileCandidate) error {
-	// Validate.
-	result, err := ValidateJSONLFile(candidate.Path)
+// discard removes a sanitized copy that will not be uploaded.
+func (v *validatedFile) discard() {
+	if v.sanitized {
+		os.Remove(v.uploadPath)
+	}
+}
+
+// validateFile validates a file and, in sanitize mode, copies out its valid
+// lines. Returns nil if there is nothing to upload; the file is then done.
+func (w *Worker) validateFile(candidate FileCandidate) (v *validatedFile, err error) {
+	// Any outcome other than a retryable upload failure takes the file out of
+	// the spool; uploadFile re-queues retries. A validated file leaves it
+	// when its upload starts.
+	defer func() {
+		if v == nil {
+			w.spool.Remove(candidate.Path)
+		}
+	}()
+
+	w.mu.Lock()
+	tagger, records, csv, rules, clock := w.tagger, w.records, w.csv, w.rules, w.clock
+	w.mu.Unlock()
+	if w.invalid.KnownInvalid(candidate.Path, candidate.SizeBytes, candidate.ModifiedAt, rules) {
+		w.logger.Debug("skipping known invalid file", "path", candidate.Path)
+		w.markDone(candidate)
+		return nil, nil
+	}
+	result, err := ValidateTaggedJSONLFile(candidate.Path, tagger, records, csv)
+	if errors.Is(err, errGzipTooLarge) {
+		w.logger.Warn("skipping gzip file that expands too far", "path", candidate.Path, "error", err)
+		w.markDone(candidate)
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("validate %q: %w", candidate.Path, err)
+		return nil, fmt.Errorf("validate %q: %w", candidate.Path, err)
 	}
-	if !result.Valid {
+	w.countFailures(result)
+	sanitize := w.currentConfig().SanitizeInvalidLines && result.InvalidRecords > 0 && result.ValidRecords > 0
+	if !result.Valid && !sanitize {
 		w.logger.Debug("skipping invalid file", "path", candidate.Path,
 			"valid_records", result.ValidRecords, "total_lines", result.TotalLines)
-		return nil
+		alg, _ := resolveChecksum(w.currentConfig().ChecksumAlgorithm)
+		if err := w.invalid.Remember(candidate.Path, candidate.SizeBytes, candidate.ModifiedAt, rules, alg, result); err != nil {
+			w.logger.Warn("failed to cache validation result", "path", candidate.Path, "error", err)
+		}
+		w.markDone(candidate)
+		return nil, nil
+	}
+
+	// In sanitize mode a copy holding only the valid lines is uploaded and
+	// the original is left in place. When the original grows, the copy holds
+	// only the valid lines after those sent before.
+	// Records are uploaded as validated: normalized, and with the services
+	// inferred for them written in. Timestamps are corrected for this host's
+	// clock when that is on.
+	v = &validatedFile{candidate: candidate, result: result, uploadPath: candidate.Path,
+		rewrite: recordRewrite{format: result.Format, csv: csv, clock: clock}, sanitized: sanitize}
+	if result.TaggedRecords > 0 {
+		v.rewrite.tagger = tagger
+		v.rewrite.pathTag = tagger.matchPath(candidate.Path)
+	}
+	if sanitize {
+		done := w.sanitized.Get(candidate.Path)
+		copyPath, part, err := sanitizeFile(w.scratchDir(), candidate.Path, tagger, records, csv, done.Lines)
+		if err == nil && !part.resumes(done) {
+			// Rewritten rather than grown: send all of it again.
+			os.Remove(copyPath)
+			copyPath, part, err = sanitizeFile(w.scratchDir(), candidate.Path, tagger, records, csv, 0)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sanitize %q: %w", candidate.Path, err)
+		}
+		if part.ValidRecords == 0 {
+			w.logger.Debug("no new valid records in sanitized file", "path", candidate.Path)
+			os.Remove(copyPath)
+			w.sanitized.Set(candidate.Path, part.lines, part.linesHash)
+			w.markDone(candidate)
+			return nil, nil
+		}
+		v.uploadPath, v.result = copyPath, part
+		if v.rewrite.format == FormatCSV || isTextEncoding(v.rewrite.format) {
+			v.rewrite.format = "" // the copy is already plain UTF-8 JSONL
+		}
+		w.logger.Info("uploading sanitized copy", "path", candidate.Path,
+			"valid_records", part.ValidRecords, "invalid_records", part.InvalidRecords, "after_line", part.skipped)
+	}
+	v.validatedAt = time.Now()
+	return v, nil
+}
+
+// uploadFile uploads a validated file and cleans it up. It reports whether
+// the server accepted the file, or already had it; a file the server
+// rejected or asked to be retried is not accepted.
+func (w *Worker) uploadFile(ctx context.Context, v *validatedFile) (accepted bool, err error) {
+	defer v.discard()
+	// Any outcome but a retry takes the file out of the spool. A retry
+	// updates its entry in place, so failed attempts add up.
+	requeued := false
+	defer func() {
+		if !requeued {
+			w.spool.Remove(v.candidate.Path)
+		}
+	}()
+
+	candidate, result, uploadPath, sanitize := v.candidate, v.result, v.uploadPath, v.sanitized
+	timeline := FileTimeline{
+		ModifiedAt:   candidate.ModifiedAt,
+		DiscoveredAt: candidate.DiscoveredAt,
+		ValidatedAt:  v.validatedAt,
 	}
 
 	// Build metadata.
-	meta, err := buildFileMetadata(candidate.Path)
+	alg, _ := resolveChecksum(w.currentConfig().ChecksumAlgorithm)
+	meta, err := buildFileMetadata(uploadPath, alg, w.currentConfig().GzipUploadMode, v.rewrite)
 	if err != nil {
-		return fmt.Errorf("build metadata for %q: %w", candidate.Path, err)
+		return false, fmt.Errorf("build metadata for %q: %w", candidate.Path, err)
+	}
+	if sanitize {
+		describeOriginal(meta, candidate)
+	}
+	meta.Timeline = timeline
+
+	// A file already uploaded unchanged from this path is not sent again.
+	// A sanitized copy holds only lines not sent before, so it may match an
+	// earlier copy and still be new.
+	if !sanitize && w.wasUploaded(candidate.Path, meta.Digest()) {
+		w.logger.Info("skipping duplicate of uploaded content", "path", candidate.Path,
+			"hash_algorithm", meta.HashAlgorithm, "file_hash", meta.FileHash)
+		timeline.UploadedAt = time.Now()
+		entry := newLedgerEntry(meta, timeline, &UploadResult{})
+		entry.Outcome = "duplicate"
+		if err := w.ledger.Append(entry); err != nil {
+			w.logger.Warn("failed to record ledger entry", "path", candidate.Path, "error", err)
+		}
+		w.recordOutcome(candidate.Path, true)
+		w.finishUploaded(v, meta)
+		return true, nil
+	}
+	meta.Validation = result
+	if result.TaggedRecords > 0 {
+		w.logger.Debug("inferred record provider", "path", candidate.Path,
+			"service", result.Tag.Service, "tagged_records", result.TaggedRecords)
 	}
 
 	// Upload.
-	uploadResult, err := w.uploader.Upload(ctx, candidate.Path, meta)
+	uploadResult, err := w.uploader.Upload(ctx, uploadPath, meta)
 	if err != nil {
-		return fmt.Errorf("upload %q: %w", candidate.Path, err)
+		return false, fmt.Errorf("upload %q: %w", candidate.Path, err)
+	}
+
+	timeline.UploadedAt = time.Now()
+	if uploadResult.BytesSent > 0 {
+		w.mu.Lock()
+		w.uploadStats.record(uploadResult)
+		w.mu.Unlock()
+	}
+	if err := w.ledger.Append(newLedgerEntry(meta, timeline, uploadResult)); err != nil {
+		w.logger.Warn("failed to record ledger entry", "path", candidate.Path, "error", err)
 	}
 
 	if uploadResult.ShouldStopUploads {
 		w.logger.Error("authentication failure, stopping uploads", "status", uploadResult.StatusCode)
-		return fmt.Errorf("stop uploads")
+		return false, fmt.Errorf("stop uploads")
 	}
 
 	if uploadResult.ShouldDelete {
-		if err := w.cleaner.CleanupFile(candidate.Path); err != nil {
+		w.mu.Lock()
+		w.quota.commit(candidate.Path, time.Now())
+		w.uploaded.add(candidate.Path, meta.Digest())
+		w.mu.Unlock()
+
+		w.recordOutcome(candidate.Path, true)
+		w.finishUploaded(v, meta)
+		return true, nil
+	}
+
+	if uploadResult.Error != "" {
+		attrs := []any{"path", candidate.Path, "error", uploadResult.Error, "retry", uploadResult.ShouldRetry}
+		if se := uploadResult.ServerError; se != nil {
+			attrs = append(attrs, "error_code", se.Code, "request_id", se.RequestID,
+				"rejected_lines", len(se.Details.RejectedLines))
+		}
+		w.logger.Warn("upload issue", attrs...)
+		w.recordError(candidate.Path, uploadResult.Error)
+	}
+
+	// Content the server refused is known invalid until it changes, like a
+	// file that fails local validation.
+	if uploadResult.Invalid {
+		w.mu.Lock()
+		rules := w.rules
+		w.mu.Unlock()
+		if err := w.invalid.Remember(candidate.Path, candidate.SizeBytes, candidate.ModifiedAt, rules, alg, result); err != nil {
+			w.logger.Warn("failed to cache validation result", "path", candidate.Path, "error", err)
+		}
+	}
+
+	if uploadResult.ShouldRetry && w.currentConfig().RetryFailedUploads {
+		requeued = w.requeue(candidate, uploadResult)
+	} else if !uploadResult.ShouldRetry {
+		w.recordOutcome(candidate.Path, false)
+		w.markDone(candidate)
+	}
+
+	return false, nil
+}
+
+// recordOutcome counts an upload of the file at path that the server
+// accepted or rejected, against its directory.
+func (w *Worker) recordOutcome(path string, accepted bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cycleOutcomes == nil {
+		w.cycleOutcomes = make(map[string]*uploadOutcomes)
+	}
+	o := w.cycleOutcomes[filepath.Dir(path)]
+	if o == nil {
+		o = &uploadOutcomes{}
+		w.cycleOutcomes[filepath.Dir(path)] = o
+	}
+	if accepted {
+		o.accepted++
+	} else {
+		o.rejected++
+	}
+}
+
+// countFailures adds a file's validation failures to the cycle's totals.
+func (w *Worker) countFailures(result *ValidationResult) {
+	if len(result.Failures) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.cycleFailures == nil {
+		w.cycleFailures = make(map[string]int)
+	}
+	for kind, n := range result.Failures {
+		w.cycleFailures[kind] += n
+	}
+}
+
+// configureLearner applies the config's negative cache re-probe interval and
+// TTL, learned directory cap, success rate half-life, and prune age to the
+// learner.
+func configureLearner(l *Learner, cfg *config.ClientConfig) {
+	l.SetNegativeCacheTiming(time.Duration(cfg.NegativeCacheReprobeHours)*time.Hour,
+		time.Duration(cfg.NegativeCacheTTLDays)*24*time.Hour)
+	l.SetMaxDirectories(cfg.MaxLearnedDirectories)
+	l.SetSuccessRateHalfLife(cfg.SuccessRateHalfLifeScans)
+	l.SetPruneAfter(time.Duration(cfg.LearningPruneDays) * 24 * time.Hour)
+}
+
+// configureCleaner applies the config's post-upload action, quarantine
+// period, holding uploaded files in dir, and secure delete setting to the
+// cleaner.
+func configureCleaner(c *Cleaner, dir string, cfg *config.ClientConfig) {
+	c.SetPostUploadAction(cfg.PostUploadAction, cfg.PostUploadMoveTo)
+	c.SetQuarantine(dir, time.Duration(cfg.QuarantineDays)*24*time.Hour, int64(cfg.QuarantineMaxMB)*1024*1024)
+	c.SetSecureDelete(cfg.SecureDelete)
+}
+
+// configureArchiver applies the config's archive retention to the archiver.
+func configureArchiver(a *Archiver, cfg *config.ClientConfig) {
+	a.SetRetention(time.Duration(cfg.ArchiveDays)*24*time.Hour, int64(cfg.ArchiveMaxMB)*1024*1024)
+}
+
+// recordValidatorFor builds the record checks from the config's schema,
+// required fields, timestamp bounds, line length limit, and service filter.
+func recordValidatorFor(cfg *config.ClientConfig) *RecordValidator {
+	v := NewRecordValidator(cfg.ValidationSchema)
+	v.SetTimestampBounds(time.Duration(cfg.TimestampSkewMinutes)*time.Minute,
+		time.Duration(cfg.TimestampHorizonDays)*24*time.Hour)
+	v.SetMaxLineBytes(cfg.MaxLineKB * 1024)
+	v.SetServiceFilter(cfg.AllowedServices, cfg.BlockedServices)
+	v.SetRequiredFields(cfg.RequiredFields)
+	return v
+}
+
+// finishUploaded archives, if enabled, and cleans up a file whose content the
+// server has. A file uploaded as a sanitized copy, or kept by the post-upload
+// action, is left in place and marked done instead, and under the mark
+// action also gets an uploaded marker. For a sanitized copy, the lines it
+// covers are recorded as sent.
+func (w *Worker) finishUploaded(v *validatedFile, meta *FileMetadata) {
+	candidate, sanitized := v.candidate, v.sanitized
+	if sanitized {
+		w.sanitized.Set(candidate.Path, v.result.lines, v.result.linesHash)
+	}
+	w.mu.Lock()
+	action := w.cleaner.PostUploadAction()
+	w.mu.Unlock()
+	if action == PostUploadMark && !sanitized {
+		w.markUploaded(candidate, meta)
+	}
+	if sanitized || action == PostUploadKeep || action == PostUploadMark {
+		w.markDone(candidate)
+		return
+	}
+	// A file that could not be archived is kept; as already-uploaded
+	// content, the next cycle archives and cleans it up.
+	if err := w.archiver.Add(candidate.Path); err != nil {
+		w.logger.Warn("archive failed, keeping file", "path", candidate.Path, "error", err)
+		return
+	}
+	if err := w.cleaner.CleanupUploaded(candidate); err != nil {
+		if errors.Is(err, errFileChanged) {
+			// Its new lines are picked up, with the rest, once it settles.
+			w.logger.Info("file changed since upload, not truncating", "path", candidate.Path)
+			return
+		}
+		if !errors.Is(err, fs.ErrPermission) && !errors.Is(err, syscall.EROFS) {
 			w.logger.Warn("cleanup failed", "path", candidate.Path, "error", err)
+			return
 		}
-		return nil
+		// Left alone, the file would be found and cleaned up again every
+		// cycle; it is skipped until it changes instead.
+		w.logger.Warn("cannot clean up file, skipping it until it changes", "path", candidate.Path, "error", err)
+		w.unclean.Remember(candidate.Path, candidate.SizeBytes, candidate.ModifiedAt, err)
 	}
+}
 
-	if uploadResult.Error != "" {
-		w.logger.Warn("upload issue", "path", candidate.Path, "error", uploadResult.Error,
-			"retry", uploadResult.ShouldRetry)
+// enforceRetention applies the age and size limits of the quarantine and
+// archives, and removes sanitized copies left behind by an earlier run.
+func (w *Worker) enforceRetention() {
+	if _, err := w.cleaner.PurgeQuarantine(); err != nil {
+		w.logger.Warn("failed to purge quarantine", "error", err)
+	}
+	if _, err := w.archiver.Prune(); err != nil {
+		w.logger.Warn("failed to prune archives", "error", err)
 	}
+	n, err := removeStaleCopies(w.scratchDir(), staleCopyAge, time.Now())
+	if err != nil {
+		w.logger.Warn("failed to remove stale sanitized copies", "error", err)
+	} else if n > 0 {
+		w.logger.Info("removed stale sanitized copies", "count", n)
+	}
+}
 
-	return nil
+// markUploaded writes the uploaded marker next to a file. Where its directory
+// is read-only the file is only marked done, as under the keep action.
+func (w *Worker) markUploaded(candidate FileCandidate, meta *FileMetadata) {
+	d := meta.Digest()
+	err := writeUploadedMarker(candidate.Path, UploadedMarker{
+		UploadedAt:    time.Now().UTC(),
+		HashAlgorithm: d.Algorithm,
+		FileHash:      d.Hex,
+		SizeBytes:     candidate.SizeBytes,
+		ModifiedAt:    candidate.ModifiedAt,
+	})
+	if err != nil {
+		w.logger.Debug("cannot write uploaded marker", "path", candidate.Path, "error", err)
+	}
 }
 
-// reloadConfig re-reads the state file and updates config if changed.
-func (w *Worker) reloadConfig() {
+// removeLeftovers deletes temporary files a crashed run left behind: the temp
+// files the worker's state files are saved through, sanitized copies, and the
+// state file's temp file once stale.
+func (w *Worker) removeLeftovers() {
+	removed := 0
+	var tmps []string
+	for _, p := range w.ownFiles {
+		tmps = append(tmps, p+".tmp")
+	}
+	if w.statePath != "" {
+		if info, err := os.Stat(w.statePath + ".tmp"); err == nil && time.Since(info.ModTime()) >= staleTempAge {
+			tmps = append(tmps, w.statePath+".tmp")
+		}
+	}
+	for _, tmp := range tmps {
+		if err := os.Remove(tmp); err == nil {
+			removed++
+		} else if !os.IsNotExist(err) {
+			w.logger.Warn("failed to remove leftover temp file", "path", tmp, "error", err)
+		}
+	}
+
+	// Only this worker writes copies next to the state file; the system temp
+	// dir may hold another's in-flight ones.
+	age := time.Duration(0)
 	if w.statePath == "" {
-		return
+		age = staleCopyAge
+	}
+	n, err := removeStaleCopies(w.scratchDir(), age, time.Now())
+	if err != nil {
+		w.logger.Warn("failed to remove leftover sanitized copies", "error", err)
+	}
+	if removed += n; removed > 0 {
+		w.logger.Info("removed leftovers of an earlier run", "count", removed)
+	}
+}
+
+// ownFiles returns the state files the worker saves by writing a temp file
+// and renaming it over: learning data, scan index, validation cache,
+// uncleanable list, retry spool, sanitized upload progress, and, next to the
+// state file, the worker and scan reports.
+func ownFiles(statePath, learningPath, indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath string) []string {
+	files := []string{learningPath, indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath}
+	if statePath != "" {
+		files = append(files, config.WorkerReportPath(statePath), config.ScanReportPath(statePath))
+	}
+	return files
+}
+
+// scratchDir returns where temporary copies are written: next to the state
+// file, which scans never descend into, or the system temp dir.
+func (w *Worker) scratchDir() string {
+	if w.statePath == "" {
+		return os.TempDir()
+	}
+	return filepath.Dir(w.statePath)
+}
+
+// wasUploaded reports whether this content was uploaded from path before.
+func (w *Worker) wasUploaded(path string, d FileDigest) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.uploaded.has(path, d)
+}
+
+// markDone tells the scan index a kept file needs no further attention until
+// it changes.
+func (w *Worker) markDone(candidate FileCandidate) {
+	if w.index != nil {
+		w.index.MarkDone(candidate.Path, candidate.SizeBytes, candidate.ModifiedAt)
+	}
+}
+
+// requeue spools a file whose upload failed with a retryable error. Once
+// its retries are used up it gives up instead, leaving the file alone until
+// it changes, and returns false.
+func (w *Worker) requeue(candidate FileCandidate, result *UploadResult) bool {
+	maxAttempts := w.currentConfig().RetryMaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryMaxAttempts
+	}
+	retry := w.spool.Attempts(candidate.Path) + 1
+	if retry > maxAttempts {
+		w.logger.Warn("giving up on file after repeated upload failures",
+			"path", candidate.Path, "attempts", retry)
+		w.markDone(candidate)
+		return false
+	}
+	w.spool.Add(candidate, w.retryDelay(result, retry))
+	return true
+}
+
+// retryDelay returns how long to wait before the nth retry of a spooled
+// file: the server's Retry-After if given, else n times the configured
+// delay.
+func (w *Worker) retryDelay(result *UploadResult, retry int) time.Duration {
+	if result.RetryAfter > 0 {
+		return result.RetryAfter
+	}
+	delay := 300 * time.Second
+	if secs := w.currentConfig().RetryDelaySeconds; secs > 0 {
+		delay = time.Duration(secs) * time.Second
+	}
+	return delay * time.Duration(max(retry, 1))
+}
+
+// currentConfig returns the active config. The pointer is swapped wholesale on
+// reload, so callers may read the returned value without holding mu.
+func (w *Worker) currentConfig() *config.ClientConfig {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config
+}
+
+// reloadConfig re-reads the state file and updates config if changed. It
+// returns the settings read only at startup that changed; see
+// config.RestartSettingsChanged.
+func (w *Worker) reloadConfig() (restart []string) {
+	if w.statePath == "" {
+		return nil
 	}
 	state, err := config.LoadState(w.statePath)
 	if err != nil {
 		w.logger.Warn("failed to reload config from state file", "error", err)
-		return
+		return nil
 	}
+	w.mu.Lock()
+	// The launcher normally stops the worker when approval is withdrawn; an
+	// externally supervised worker has to notice itself.
+	w.unapproved = !state.ServerApproved
+	// The skew is measured at every heartbeat and correction can be turned
+	// on or off at any time.
+	w.clock = state.ClockOffset()
+	w.mu.Unlock()
+	w.uploader.SetClockOffset(state.ClockOffset())
 	if state.ServerConfig != nil {
 		w.mu.Lock()
+		prev := w.config
 		w.config = state.ServerConfig
+		w.tagger = NewProviderTagger(state.ServerConfig.ProviderTags)
+		w.records = recordValidatorFor(state.ServerConfig)
+		w.csv = NewCSVConverter(state.ServerConfig.CSVColumns)
+		w.rules = validationRules(state.ServerConfig, w.version)
+		configureLearner(w.learner, state.ServerConfig)
+		configureCleaner(w.cleaner, w.quarantine, state.ServerConfig)
+		configureArchiver(w.archiver, state.ServerConfig)
 		w.mu.Unlock()
 		w.logger.Debug("config reloaded from state file")
+
+		if prev == nil || prev.ChecksumAlgorithm != state.ServerConfig.ChecksumAlgorithm {
+			warnUnsupportedChecksum(state.ServerConfig, w.logger)
+		}
+
+		if !slices.Equal(discoveryPathNames(prev), discoveryPathNames(state.ServerConfig)) {
+			w.runPreflight(state.ServerConfig)
+		}
+		return config.RestartSettingsChanged(prev, state.ServerConfig)
+	}
+	return nil
+}
+
+// runPreflight checks the config's discovery paths for this platform, logs
+// the results, and publishes them in the worker report.
+func (w *Worker) runPreflight(cfg *config.ClientConfig) {
+	report := Preflight(discoveryPathNames(cfg))
+	logPreflight(w.logger, report)
+
+	w.mu.Lock()
+	w.preflight = report
+	w.mu.Unlock()
+	w.writeReport()
+}
+
+// dedupeCandidates drops candidates that are the same file as an earlier one,
+// such as a spooled retry and a hard link to it found by the scan, so the
+// file is not uploaded twice. Candidates that cannot be stat'ed are kept;
+// processing reports the error.
+func dedupeCandidates(work []FileCandidate) []FileCandidate {
+	seen := make(map[string]bool, len(work))
+	out := work[:0]
+	for _, c := range work {
+		if info, err := os.Stat(c.Path); err == nil {
+			key := fileKey(c.Path, info)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// discoveryPathNames returns the config's discovery paths for this platform.
+func discoveryPathNames(cfg *config.ClientConfig) []string {
+	if cfg == nil {
+		return nil
+	}
+	var paths []string
+	for _, dp := range discoveryPathsFor(cfg) {
+		paths = append(paths, dp.Path)
+	}
+	return paths
+}
+
+// completeCycle records that a cycle has ended, skipped and failed ones
+// included, and publishes it in the worker report: the launcher takes a
+// worker whose cycles stop completing for hung.
+func (w *Worker) completeCycle() {
+	w.mu.Lock()
+	w.lastCycle = time.Now()
+	w.mu.Unlock()
+	w.writeReport()
+}
+
+// writeReport publishes the worker's status for the launcher's heartbeat.
+func (w *Worker) writeReport() {
+	if w.statePath == "" {
+		return
+	}
+	st := w.Status()
+	report := &config.WorkerReport{
+		WorkerVersion:      w.version,
+		UpdatedAt:          time.Now().UTC().Format(time.RFC3339),
+		FilesUploadedToday: st.FilesUploadedToday,
+		BytesUploadedToday: st.BytesUploadedToday,
+		DailyCapReached:    st.DailyCapReached,
+
+		DiscoveryPaths:   len(st.DiscoveryPaths),
+		UnreachablePaths: st.UnreachablePaths,
+	}
+	if sr := st.LastScanReport; sr != nil {
+		report.PermissionDenied = sr.PermissionDenied
+		report.FilesTooOld = sr.Filtered[FilterMaxAge]
+		report.FilesTooLarge = sr.Filtered[FilterMaxSize]
+		report.GlobErrors = sr.GlobErrors
+	}
+	if w.currentConfig().ValidationTelemetry {
+		report.ValidationFailures = st.ValidationFailures
+	}
+	if !st.LastScan.IsZero() {
+		report.LastScanTime = st.LastScan.UTC().Format(time.RFC3339)
+	}
+	w.mu.Lock()
+	if !w.lastCycle.IsZero() {
+		report.LastCycleCompleted = w.lastCycle.UTC().Format(time.RFC3339)
+	}
+	w.mu.Unlock()
+	if err := report.Save(config.WorkerReportPath(w.statePath)); err != nil {
+		w.logger.Warn("failed to write worker report", "error", err)
 	}
 }
 
+// writeScanReport saves the last scan's report next to the state file, for
+// admins looking into why files were not picked up.
+func (w *Worker) writeScanReport(report *config.ScanReport) {
+	if w.statePath == "" {
+		return
+	}
+	if err := report.Save(config.ScanReportPath(w.statePath)); err != nil {
+		w.logger.Warn("failed to write scan report", "error", err)
+	}
+}
+
+// restoreDailyQuota seeds today's counters from the ledger so a restart does
+// not reset the daily cap.
+func restoreDailyQuota(q *dailyQuota, ledger *Ledger, logger *slog.Logger) {
+	now := time.Now().UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	files, bytes, err := ledger.UploadedSince(midnight)
+	if err != nil {
+		logger.Warn("failed to restore daily upload counts from ledger", "error", err)
+	}
+	q.roll(now)
+	q.files = files
+	q.bytes = bytes
+}
+
+// shutdown marks the worker stopped and saves what it has learned, as Run
+// returns.
+func (w *Worker) shutdown() {
+	w.mu.Lock()
+	w.state = "stopped"
+	w.mu.Unlock()
+	w.saveLearningData()
+}
+
 // saveLearningData persists learning data, logging any errors.
 func (w *Worker) saveLearningData() {
 	if err := w.learner.Save(); err != nil {
 		w.logger.Error("failed to save learning data", "error", err)
 	}
+	if w.index != nil {
+		if err := w.index.Save(); err != nil {
+			w.logger.Error("failed to save scan index", "error", err)
+		}
+	}
+	if err := w.invalid.Save(); err != nil {
+		w.logger.Error("failed to save validation cache", "error", err)
+	}
+	if err := w.unclean.Save(); err != nil {
+		w.logger.Error("failed to save uncleanable list", "error", err)
+	}
+	if err := w.spool.Save(); err != nil {
+		w.logger.Error("failed to save retry spool", "error", err)
+	}
+	if err := w.sanitized.Save(); err != nil {
+		w.logger.Error("failed to save sanitized upload progress", "error", err)
+	}
 }
 
-// buildFileMetadata gathers metadata about a file for upload.
-func buildFileMetadata(path string) (*FileMetadata, error) {
+// warnUnsupportedChecksum logs if the config asks for a checksum algorithm
+// the client cannot compute. Such files are hashed with the default instead.
+func warnUnsupportedChecksum(cfg *config.ClientConfig, logger *slog.Logger) {
+	if alg, ok := resolveChecksum(cfg.ChecksumAlgorithm); !ok {
+		logger.Warn("unsupported checksum algorithm, using default",
+			"requested", cfg.ChecksumAlgorithm, "using", alg, "supported", config.SupportedChecksums())
+	}
+}
+
+// buildFileMetadata gathers metadata about a file for upload, hashing it with
+// the given algorithm. A gzipped file is described as sent: compressed if
+// gzipMode is GzipUploadCompressed, otherwise decompressed. Content whose
+// records are rewritten is described as rewritten.
+func buildFileMetadata(path, alg, gzipMode string, rw recordRewrite) (*FileMetadata, error) {
 	info, err := os.Stat(path)
 	if err != nil {
 		return nil, fmt.Errorf("stat file: %w", err)
 	}
 
-	lineCount, err := countLines(path)
-	if err != nil {
-		return nil, fmt.Errorf("count lines: %w", err)
+	// Rewritten content is built from the decompressed records.
+	decompress := isGzip(path) && (gzipMode != GzipUploadCompressed || !rw.none())
+	var digest FileDigest
+	var lineCount int
+	var size int64
+	if !rw.none() {
+		digest, lineCount, size, err = digestNormalized(path, alg, rw)
+	} else {
+		digest, lineCount, size, err = digestFile(path, alg, decompress)
 	}
-
-	hash, err := hashFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("hash file: %w", err)
 	}
 
-	return &FileMetadata{
-		OriginalPath: path,
-		Directory:    filepath.Dir(path),
-		Filename:     filepath.Base(path),
-		SizeBytes:    info.Size(),
-		ModifiedAt:   info.ModTime().UTC().Format(time.RFC3339),
-		CreatedAt:    info.ModTime().UTC().Format(time.RFC3339), // Creation time not portable; use mod time.
-		LineCount:    lineCount,
-		FileHash:     hash,
-	}, nil
+	meta := &FileMetadata{
+		OriginalPath:  path,
+		Directory:     filepath.Dir(path),
+		Filename:      filepath.Base(path),
+		SizeBytes:     size,
+		ModifiedAt:    info.ModTime().UTC().Format(time.RFC3339),
+		CreatedAt:     info.ModTime().UTC().Format(time.RFC3339), // Creation time not portable; use mod time.
+		LineCount:     lineCount,
+		FileHash:      digest.Hex,
+		HashAlgorithm: digest.Algorithm,
+		SourceFormat:  rw.format,
+		rewrite:       rw,
+	}
+	if rw.format == FormatCSV {
+		meta.Filename = csvUploadName(meta.Filename)
+	}
+	switch {
+	case decompress:
+		meta.Filename = trimGzip(meta.Filename)
+		meta.OriginalEncoding = "gzip"
+		meta.OriginalSizeBytes = info.Size()
+	case isGzip(path):
+		meta.ContentEncoding = "gzip"
+	}
+	return meta, nil
 }
 
-// countLines counts non-empty lines in a file.
-func countLines(path string) (int, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return 0, err
+// agentFiles returns the files the agent writes, as paths or glob patterns:
+// the state file and credential, learning data and its backup, the ledger
+// and its rotated copy, the scan index, validation cache, uncleanable list,
+// retry spool, sanitized upload progress, and worker and scan reports, each
+// with the temp file it is saved through, plus sanitized copies. Their paths
+// may be overridden into a shared directory such as /var/log, so the files
+// are excluded rather than their directories.
+func agentFiles(statePath, learningPath, ledgerPath, indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath string) []string {
+	paths := []string{learningPath, config.LearningBackupPath(learningPath), ledgerPath, ledgerPath + ".1",
+		indexPath, cachePath, uncleanPath, spoolPath, sanitizedPath}
+	scratch := os.TempDir()
+	if statePath != "" {
+		paths = append(paths, statePath, config.CredentialPath(statePath),
+			config.WorkerReportPath(statePath), config.ScanReportPath(statePath))
+		scratch = filepath.Dir(statePath)
 	}
-	defer f.Close()
-
-	buf := make([]byte, 32*1024)
-	count := 0
-	for {
-		n, err := f.Read(buf)
-		for i := 0; i < n; i++ {
-			if buf[i] == '\n' {
-				count++
-			}
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return 0, err
+	var files []string
+	for _, p := range paths {
+		if p != "" {
+			p = filepath.Clean(p)
+			files = append(files, p, p+".tmp")
 		}
 	}
-	return count, nil
+	return append(files, filepath.Join(scratch, sanitizedPattern))
 }
 
-// hashFile returns the SHA-256 hex digest of a file.
-func hashFile(path string) (string, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return "", err
+// discoveryPathsFor returns the config's discovery paths for the current OS,
+// with drive-relative paths repeated on every fixed drive if AllDrives is set.
+func discoveryPathsFor(cfg *config.ClientConfig) []config.DiscoveryPath {
+	paths := platformDiscoveryPaths(cfg.DiscoveryPaths)
+	if cfg.AllDrives {
+		paths = acrossDrives(paths, platform.FixedDrives())
 	}
-	defer f.Close()
-
-	h := sha256.New()
-	if _, err := io.Copy(h, f); err != nil {
-		return "", err
-	}
-	return hex.EncodeToString(h.Sum(nil)), nil
+	return paths
 }
 
 // platformDiscoveryPaths returns the discovery paths for the current OS.
-func platformDiscoveryPaths(dp config.DiscoveryPaths) []string {
+func platformDiscoveryPaths(dp config.DiscoveryPaths) []config.DiscoveryPath {
 	switch runtime.GOOS {
 	case "linux":
 		return dp.Linux
@@ -371,6 +1496,26 @@ func platformDiscoveryPaths(dp config.DiscoveryPaths) []string {
 	}
 }
 
+// Pattern case modes.
+const (
+	PatternCaseAuto        = "auto" // insensitive where file names usually are: Windows and macOS
+	PatternCaseSensitive   = "sensitive"
+	PatternCaseInsensitive = "insensitive"
+)
+
+// CaseInsensitivePatterns reports whether file and exclude patterns should
+// ignore case under the given mode.
+func CaseInsensitivePatterns(mode string) bool {
+	switch mode {
+	case PatternCaseSensitive:
+		return false
+	case PatternCaseInsensitive:
+		return true
+	default:
+		return runtime.GOOS == "windows" || runtime.GOOS == "darwin"
+	}
+}
+
 // learningFilePath returns the default learning file path using the platform package.
 func learningFilePath() string {
 	return platform.LearningFilePath()
@@ -1,9 +1,16 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,17 +29,23 @@ func testWorkerConfig(t *testing.T) WorkerConfig {
 			MaxFileSizeMB:        10,
 			MaxConcurrentUploads: 2,
 			DiscoveryPaths: config.DiscoveryPaths{
-				Windows: []string{t.TempDir()},
-				Linux:   []string{t.TempDir()},
-				Darwin:  []string{t.TempDir()},
+				Windows: config.PlainPaths(t.TempDir()),
+				Linux:   config.PlainPaths(t.TempDir()),
+				Darwin:  config.PlainPaths(t.TempDir()),
 			},
 			FilePatterns:    []string{"*.jsonl"},
 			ExcludePatterns: []string{"*temp*"},
 		},
-		Hostname:     "test-host",
-		StatePath:    filepath.Join(t.TempDir(), "state.json"),
-		ServerURL:    "http://localhost:8080",
-		LearningPath: filepath.Join(t.TempDir(), "learning.json"),
+		Hostname:      "test-host",
+		StatePath:     filepath.Join(t.TempDir(), "state.json"),
+		ServerURL:     "http://localhost:8080",
+		LearningPath:  filepath.Join(t.TempDir(), "learning.json"),
+		LedgerPath:    filepath.Join(t.TempDir(), "ledger.jsonl"),
+		IndexPath:     filepath.Join(t.TempDir(), "scan-index.json"),
+		CachePath:     filepath.Join(t.TempDir(), "validation-cache.json"),
+		UncleanPath:   filepath.Join(t.TempDir(), "uncleanable.json"),
+		SpoolPath:     filepath.Join(t.TempDir(), "spool.json"),
+		SanitizedPath: filepath.Join(t.TempDir(), "sanitized.json"),
 	}
 }
 
@@ -83,16 +96,22 @@ func TestWorker_ScanCycleWithFiles(t *testing.T) {
 			MaxFileSizeMB:        10,
 			MaxConcurrentUploads: 1,
 			DiscoveryPaths: config.DiscoveryPaths{
-				Windows: []string{dir},
-				Linux:   []string{dir},
-				Darwin:  []string{dir},
+				Windows: config.PlainPaths(dir),
+				Linux:   config.PlainPaths(dir),
+				Darwin:  config.PlainPaths(dir),
 			},
 			FilePatterns: []string{"*.jsonl"},
 		},
-		Hostname:     "test-host",
-		StatePath:    filepath.Join(t.TempDir(), "state.json"),
-		ServerURL:    "http://localhost:0", // Will fail upload, but should not crash.
-		LearningPath: filepath.Join(t.TempDir(), "learning.json"),
+		Hostname:      "test-host",
+		StatePath:     filepath.Join(t.TempDir(), "state.json"),
+		ServerURL:     "http://localhost:0", // Will fail upload, but should not crash.
+		LearningPath:  filepath.Join(t.TempDir(), "learning.json"),
+		LedgerPath:    filepath.Join(t.TempDir(), "ledger.jsonl"),
+		IndexPath:     filepath.Join(t.TempDir(), "scan-index.json"),
+		CachePath:     filepath.Join(t.TempDir(), "validation-cache.json"),
+		UncleanPath:   filepath.Join(t.TempDir(), "uncleanable.json"),
+		SpoolPath:     filepath.Join(t.TempDir(), "spool.json"),
+		SanitizedPath: filepath.Join(t.TempDir(), "sanitized.json"),
 	}
 
 	w, err := NewWorker(cfg, testLogger())
@@ -106,13 +125,41 @@ func TestWorker_ScanCycleWithFiles(t *testing.T) {
 	assert.Equal(t, 1, w.filesFound)
 }
 
+func TestWorker_RunOnce(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{
+		Windows: config.PlainPaths(dir),
+		Linux:   config.PlainPaths(dir),
+		Darwin:  config.PlainPaths(dir),
+	}
+	content := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","input_tokens":100}` + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "usage.jsonl"), []byte(content), 0644))
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+	go func() { done <- w.RunOnce(context.Background()) }()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("worker did not return after one cycle")
+	}
+
+	assert.Equal(t, "stopped", w.state)
+	assert.Equal(t, 1, w.filesFound)
+	assert.False(t, w.lastScan.IsZero())
+	assert.FileExists(t, cfg.LearningPath)
+}
+
 func TestWorker_GracefulShutdownSavesLearning(t *testing.T) {
 	cfg := testWorkerConfig(t)
 	w, err := NewWorker(cfg, testLogger())
 	require.NoError(t, err)
 
 	// Simulate some learning data.
-	w.learner.UpdateAfterScan("/test", 5)
+	w.learner.UpdateAfterScan("/test", 5, 0)
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -158,3 +205,637 @@ func TestWorker_ReloadConfig(t *testing.T) {
 	w.reloadConfig()
 	assert.Equal(t, 999, w.config.ScanIntervalMinutes)
 }
+
+func TestWorker_ReloadAppliesClockOffset(t *testing.T) {
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, _, err := r.FormFile("file")
+		require.NoError(t, err)
+		data, _ := io.ReadAll(f)
+		body = string(data)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	logs := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	wcfg := testWorkerConfig(t)
+	wcfg.StatePath = statePath
+	wcfg.ServerURL = srv.URL
+	wcfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(logs), Windows: config.PlainPaths(logs), Darwin: config.PlainPaths(logs)}
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: wcfg.Config,
+		ClockSkewSeconds: 3600, CorrectClock: true}).Save(statePath))
+	writeJSONLFile(t, logs, "usage.jsonl", []string{validRecord()})
+
+	w, err := NewWorker(wcfg, testLogger())
+	require.NoError(t, err)
+	w.reloadConfig()
+	w.runScanCycle(context.Background())
+	assert.Contains(t, body, `"timestamp":"2025-01-15T11:30:00Z"`, "the skew measured since the worker started is applied")
+}
+
+func TestWorker_ReloadReportsRestartSettings(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	cfg := config.DefaultConfig()
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: &cfg}).Save(statePath))
+
+	wcfg := testWorkerConfig(t)
+	wcfg.StatePath = statePath
+	wcfg.Config = &cfg
+	w, err := NewWorker(wcfg, testLogger())
+	require.NoError(t, err)
+	assert.Empty(t, w.reloadConfig())
+
+	next := cfg
+	next.ScanIntervalMinutes = 5
+	next.SecureDelete = !cfg.SecureDelete
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: &next}).Save(statePath))
+	assert.Equal(t, []string{"scan_interval_minutes"}, w.reloadConfig(), "live settings don't call for a restart")
+	assert.Empty(t, w.reloadConfig(), "each change is reported once")
+}
+
+func TestWorker_PausesWhileUnapproved(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	cfg := config.DefaultConfig()
+	require.NoError(t, (&config.StateFile{ServerConfig: &cfg}).Save(statePath))
+
+	wcfg := testWorkerConfig(t)
+	wcfg.StatePath = statePath
+	w, err := NewWorker(wcfg, testLogger())
+	require.NoError(t, err)
+
+	w.reloadConfig()
+	w.runScanCycle(context.Background())
+	assert.True(t, w.Status().LastScan.IsZero(), "no scan while the client isn't approved")
+
+	require.NoError(t, (&config.StateFile{ServerApproved: true, ServerConfig: &cfg}).Save(statePath))
+	w.reloadConfig()
+	w.runScanCycle(context.Background())
+	assert.False(t, w.Status().LastScan.IsZero())
+}
+
+func TestWorker_SyncLearning(t *testing.T) {
+	seed := t.TempDir()
+	var shares atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case learningHintsPath:
+			json.NewEncoder(w).Encode(map[string]any{"hints": []DirectoryHint{{Path: filepath.ToSlash(seed), SuccessRate: 2}}})
+		case learningStatsPath:
+			shares.Add(1)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	cfg.ServerURL = srv.URL
+	cfg.Config.LearningSyncHours = 24
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.learner.UpdateAfterScan("/var/log/openai", 3, 0)
+
+	w.syncLearning(context.Background())
+	assert.Contains(t, w.learner.GetPriorityPaths(), seed)
+	assert.Equal(t, int32(1), shares.Load())
+
+	w.syncLearning(context.Background())
+	assert.Equal(t, int32(1), shares.Load(), "synced at most once per interval")
+}
+
+func TestWorker_LearnsUploadOutcomes(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if bytes.Contains(body, []byte("rejected.jsonl")) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	good, bad := filepath.Join(root, "good"), filepath.Join(root, "bad")
+	require.NoError(t, os.MkdirAll(good, 0755))
+	require.NoError(t, os.MkdirAll(bad, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(good, "usage.jsonl"), []byte(validRecord()+"\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(bad, "rejected.jsonl"), []byte(validRecord()+"\n\n"), 0644))
+
+	cfg := testWorkerConfig(t)
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(root), Windows: config.PlainPaths(root), Darwin: config.PlainPaths(root)}
+	cfg.ServerURL = srv.URL
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	assert.Equal(t, 1, w.learner.data.Directories[good].FilesUploaded)
+	assert.Equal(t, 1, w.learner.data.Directories[bad].FilesRejected)
+	assert.Greater(t, w.learner.DirScore(good), w.learner.DirScore(bad))
+}
+
+func TestWorker_QuarantinesUploadedFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(validRecord()+"\n"), 0644))
+
+	cfg := testWorkerConfig(t)
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(root), Windows: config.PlainPaths(root), Darwin: config.PlainPaths(root)}
+	cfg.Config.QuarantineDays = 7
+	cfg.QuarantineDir = t.TempDir()
+	cfg.ServerURL = srv.URL
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	held := filepath.Join(cfg.QuarantineDir, time.Now().UTC().Format(quarantineDayFormat), mirroredPath(path))
+	assert.FileExists(t, held)
+}
+
+func TestWorker_ArchivesUploadedFiles(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(validRecord()+"\n"), 0644))
+
+	cfg := testWorkerConfig(t)
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(root), Windows: config.PlainPaths(root), Darwin: config.PlainPaths(root)}
+	cfg.Config.ArchiveDays = 30
+	cfg.ArchiveDir = t.TempDir()
+	cfg.ServerURL = srv.URL
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	archive := filepath.Join(cfg.ArchiveDir, "tokenly-archive-"+time.Now().UTC().Format(archiveDayFormat)+".tar.gz")
+	assert.Equal(t, map[string]string{filepath.ToSlash(mirroredPath(path)): validRecord() + "\n"}, readArchive(t, archive))
+}
+
+func TestWorker_PostUploadAction(t *testing.T) {
+	for _, action := range []string{PostUploadTruncate, PostUploadKeep} {
+		t.Run(action, func(t *testing.T) {
+			uploads := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				uploads++
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+
+			root := t.TempDir()
+			path := filepath.Join(root, "usage.jsonl")
+			require.NoError(t, os.WriteFile(path, []byte(validRecord()+"\n"), 0644))
+
+			cfg := testWorkerConfig(t)
+			cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(root), Windows: config.PlainPaths(root), Darwin: config.PlainPaths(root)}
+			cfg.Config.PostUploadAction = action
+			cfg.ServerURL = srv.URL
+			w, err := NewWorker(cfg, testLogger())
+			require.NoError(t, err)
+			w.runScanCycle(context.Background())
+			w.runScanCycle(context.Background())
+
+			assert.Equal(t, 1, uploads)
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			if action == PostUploadTruncate {
+				assert.Empty(t, data)
+			} else {
+				assert.Equal(t, validRecord()+"\n", string(data))
+			}
+		})
+	}
+}
+
+func TestWorker_MarksUploadedFiles(t *testing.T) {
+	uploads := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	path := filepath.Join(root, "usage.jsonl")
+	require.NoError(t, os.WriteFile(path, []byte(validRecord()+"\n"), 0644))
+
+	cfg := testWorkerConfig(t)
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(root), Windows: config.PlainPaths(root), Darwin: config.PlainPaths(root)}
+	cfg.Config.PostUploadAction = PostUploadMark
+	cfg.Config.FullRescanHours = 0
+	cfg.ServerURL = srv.URL
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	assert.FileExists(t, path)
+	data, err := os.ReadFile(markerPath(path))
+	require.NoError(t, err)
+	var marker UploadedMarker
+	require.NoError(t, json.Unmarshal(data, &marker))
+	assert.Equal(t, config.ChecksumSHA256, marker.HashAlgorithm)
+	assert.NotEmpty(t, marker.FileHash)
+
+	// Without a scan index, the marker alone keeps the file from being
+	// processed again.
+	w.runScanCycle(context.Background())
+	assert.Equal(t, 1, uploads)
+	assert.Equal(t, 1, w.scanReport.Filtered[FilterMarked])
+}
+
+func TestWorker_RemovesLeftovers(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	stateDir := filepath.Dir(cfg.StatePath)
+	leftovers := []string{
+		cfg.LearningPath + ".tmp",
+		cfg.IndexPath + ".tmp",
+		config.ScanReportPath(cfg.StatePath) + ".tmp",
+		filepath.Join(stateDir, "tokenly-sanitized-123.jsonl"),
+	}
+	for _, p := range leftovers {
+		require.NoError(t, os.WriteFile(p, []byte("x"), 0644))
+	}
+	// The launcher may still be writing a fresh state temp file.
+	stateTmp := cfg.StatePath + ".tmp"
+	require.NoError(t, os.WriteFile(stateTmp, []byte("x"), 0644))
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.removeLeftovers()
+	for _, p := range leftovers {
+		assert.NoFileExists(t, p)
+	}
+	assert.FileExists(t, stateTmp)
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(stateTmp, old, old))
+	w.removeLeftovers()
+	assert.NoFileExists(t, stateTmp)
+}
+
+func TestWorker_DailyCapDefersFiles(t *testing.T) {
+	var uploads int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.MaxConcurrentUploads = 1
+	cfg.Config.DailyUploadMaxFiles = 1
+	cfg.ServerURL = srv.URL
+	content := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4"}` + "\n"
+	for _, name := range []string{"a.jsonl", "b.jsonl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	assert.Equal(t, 1, uploads)
+	st := w.Status()
+	assert.True(t, st.DailyCapReached)
+	assert.Equal(t, 1, st.FilesUploadedToday)
+
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.True(t, report.DailyCapReached)
+	assert.Equal(t, 1, report.FilesUploadedToday)
+
+	scanReport, err := config.LoadScanReport(config.ScanReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	require.NotNil(t, scanReport)
+	assert.Equal(t, 2, scanReport.Candidates)
+
+	// A restarted worker restores today's count from the ledger.
+	w2, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	assert.Equal(t, 1, w2.Status().FilesUploadedToday)
+}
+
+func TestWorker_ReportIncludesScanCounters(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.MaxFileSizeMB = 1
+	old := filepath.Join(dir, "old.jsonl")
+	require.NoError(t, os.WriteFile(old, []byte("{}\n"), 0644))
+	past := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "big.jsonl"), make([]byte, 2*1024*1024), 0644))
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Equal(t, 1, report.FilesTooOld)
+	assert.Equal(t, 1, report.FilesTooLarge)
+	assert.Zero(t, report.PermissionDenied)
+	assert.Zero(t, report.GlobErrors)
+}
+
+func TestWorker_ReportsCompletedCycles(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	cfg.Config.ScanEnabled = false
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+
+	w.runPreflight(cfg.Config)
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	assert.Empty(t, report.LastCycleCompleted)
+
+	// Skipped cycles count: the loop is alive.
+	w.runScanCycle(context.Background())
+	report, err = config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	completed, err := time.Parse(time.RFC3339, report.LastCycleCompleted)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), completed, 5*time.Second)
+}
+
+func TestWorker_ReportsValidationFailuresWhenOptedIn(t *testing.T) {
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	writeJSONLFile(t, dir, "bad.jsonl", []string{invalidRecord(), "not json", invalidRecord()})
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	want := map[string]int{"not_json": 1, "missing_field:timestamp": 2}
+	assert.Equal(t, want, w.Status().ValidationFailures)
+	report, err := config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	assert.Nil(t, report.ValidationFailures, "not reported without opting in")
+
+	cfg.Config.ValidationTelemetry = true
+	w.writeReport()
+	report, err = config.LoadWorkerReport(config.WorkerReportPath(cfg.StatePath))
+	require.NoError(t, err)
+	assert.Equal(t, want, report.ValidationFailures)
+}
+
+func TestWorker_SkipsDuplicateContent(t *testing.T) {
+	var uploads int
+	var algs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads++
+		var meta struct {
+			FileInfo struct {
+				HashAlgorithm string `json:"hash_algorithm"`
+			} `json:"file_info"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(r.FormValue("metadata")), &meta))
+		algs = append(algs, meta.FileInfo.HashAlgorithm)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.MaxConcurrentUploads = 1
+	cfg.Config.ChecksumAlgorithm = config.ChecksumBLAKE3
+	cfg.ServerURL = srv.URL
+	content := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4"}` + "\n"
+	for _, name := range []string{"a.jsonl", "copy.jsonl"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	// The same content in two files is two uploads.
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+	assert.Equal(t, 2, uploads)
+	assert.Equal(t, []string{"blake3", "blake3"}, algs)
+	assert.NoFileExists(t, filepath.Join(dir, "a.jsonl"))
+	assert.NoFileExists(t, filepath.Join(dir, "copy.jsonl"))
+
+	// A file found again unchanged at the same path is not, even by a
+	// restarted worker, which remembers it from the ledger.
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.jsonl"), []byte(content), 0644))
+	w2, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w2.runScanCycle(context.Background())
+	assert.Equal(t, 2, uploads)
+	assert.NoFileExists(t, filepath.Join(dir, "a.jsonl"))
+
+	var outcomes []string
+	for _, e := range readLedger(t, cfg.LedgerPath) {
+		assert.Equal(t, "blake3", e.HashAlgorithm)
+		outcomes = append(outcomes, e.Outcome)
+	}
+	assert.ElementsMatch(t, []string{"uploaded", "uploaded", "duplicate"}, outcomes)
+}
+
+func TestWorker_BurstCyclesDrainBacklog(t *testing.T) {
+	var uploads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.ScanIntervalMinutes = 60
+	cfg.ServerURL = srv.URL
+	for _, name := range []string{"a", "b", "c"} {
+		content := `{"timestamp":"2025-01-15T10:30:00Z","service":"openai","model":"gpt-4","session":"` + name + `"}` + "\n"
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name+".jsonl"), []byte(content), 0644))
+	}
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.scanner.config.MaxFiles = 1
+	w.burstDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+
+	assert.Eventually(t, func() bool { return uploads.Load() == 3 }, 5*time.Second, 10*time.Millisecond,
+		"backlog should drain through burst cycles, not the hourly interval")
+}
+
+func TestWorker_NoBurstWithoutAcceptedUploads(t *testing.T) {
+	status := http.StatusBadRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.scanner.config.MaxFiles = 2
+	batch := func(record string) bool {
+		a := writeJSONLFile(t, dir, "a.jsonl", []string{record})
+		b := writeJSONLFile(t, dir, "b.jsonl", []string{record})
+		defer os.Remove(a)
+		defer os.Remove(b)
+		return w.runScanCycle(context.Background())
+	}
+
+	assert.False(t, batch(invalidRecord()), "a full batch of invalid files")
+	assert.False(t, batch(validRecord()), "a full batch the server rejects")
+	status = http.StatusOK
+	assert.True(t, batch(validRecord()), "a full batch the server accepts")
+}
+
+func TestWorker_RemembersFilesTheServerRefuses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, header, err := r.FormFile("file")
+		require.NoError(t, err)
+		f.Close()
+		w.Header().Set("Content-Type", "application/json")
+		if header.Filename == "refused.jsonl" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"validation_failed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`{"error":"storage_unavailable"}`))
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	cfg.Config.RetryFailedUploads = true
+	refused := writeJSONLFile(t, dir, "refused.jsonl", []string{validRecord()})
+	busy := writeJSONLFile(t, dir, "busy.jsonl", []string{validRecord()})
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	w.runScanCycle(context.Background())
+
+	known := func(path string) bool {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		return w.invalid.KnownInvalid(path, info.Size(), info.ModTime(), w.rules)
+	}
+	assert.True(t, known(refused), "refused content isn't sent again unchanged")
+	assert.False(t, known(busy), "a transient failure is retried")
+	assert.Equal(t, 1, w.spool.Attempts(busy))
+}
+
+func TestWorker_ValidatesWhileUploading(t *testing.T) {
+	release := make(chan struct{})
+	var uploads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploads.Add(1)
+		<-release
+		w.WriteHeader(200)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.Config.MaxConcurrentUploads = 1
+	cfg.Config.MaxConcurrentValidations = 2
+	cfg.ServerURL = srv.URL
+	writeJSONLFile(t, dir, "a.jsonl", []string{validRecord()})
+	writeJSONLFile(t, dir, "b.jsonl", []string{validRecord(), validRecord()})
+	for _, name := range []string{"c.jsonl", "d.jsonl", "e.jsonl"} {
+		writeJSONLFile(t, dir, name, []string{invalidRecord()})
+	}
+
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	done := make(chan struct{})
+	go func() {
+		w.runScanCycle(context.Background())
+		close(done)
+	}()
+
+	// The invalid files finish while the first upload is still held.
+	require.Eventually(t, func() bool {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.cycleProcessed == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int32(1), uploads.Load())
+
+	close(release)
+	<-done
+	assert.Equal(t, int32(2), uploads.Load())
+	assert.Equal(t, 2, w.filesUploaded, "invalid files are not counted as uploads")
+}
+
+func TestCaseInsensitivePatterns(t *testing.T) {
+	assert.False(t, CaseInsensitivePatterns(PatternCaseSensitive))
+	assert.True(t, CaseInsensitivePatterns(PatternCaseInsensitive))
+	assert.Equal(t, runtime.GOOS == "windows" || runtime.GOOS == "darwin", CaseInsensitivePatterns(PatternCaseAuto))
+	assert.Equal(t, CaseInsensitivePatterns(PatternCaseAuto), CaseInsensitivePatterns(""))
+}
+
+func TestWorker_RetriesCountAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	cfg := testWorkerConfig(t)
+	dir := t.TempDir()
+	cfg.Config.DiscoveryPaths = config.DiscoveryPaths{Linux: config.PlainPaths(dir), Windows: config.PlainPaths(dir), Darwin: config.PlainPaths(dir)}
+	cfg.ServerURL = srv.URL
+	cfg.Config.RetryFailedUploads = true
+	cfg.Config.RetryMaxAttempts = 3
+	path := writeJSONLFile(t, dir, "usage.jsonl", []string{validRecord()})
+	w, err := NewWorker(cfg, testLogger())
+	require.NoError(t, err)
+	// Makes the spooled retry due at once rather than after its delay.
+	due := func() {
+		entry := w.spool.data.Files[path]
+		entry.NextAttempt = time.Time{}
+		w.spool.data.Files[path] = entry
+	}
+
+	for retry := 1; retry <= 3; retry++ {
+		w.runScanCycle(context.Background())
+		assert.Equal(t, retry, w.spool.Attempts(path))
+		due()
+	}
+	w.runScanCycle(context.Background())
+	assert.False(t, w.spool.Contains(path), "given up after the last retry")
+	assert.FileExists(t, path)
+}
+
+func TestWorker_RetryDelayBacksOff(t *testing.T) {
+	w, err := NewWorker(testWorkerConfig(t), testLogger())
+	require.NoError(t, err)
+	w.config.RetryDelaySeconds = 60
+
+	assert.Equal(t, time.Minute, w.retryDelay(&UploadResult{}, 1))
+	assert.Equal(t, 3*time.Minute, w.retryDelay(&UploadResult{}, 3))
+	assert.Equal(t, 5*time.Second, w.retryDelay(&UploadResult{RetryAfter: 5 * time.Second}, 3))
+}